@@ -0,0 +1,60 @@
+package caption
+
+// CEA-608 character sets.
+
+// Basic characters that differ from ASCII.
+var basicChars = map[byte]rune{
+	0x2a: 'á',
+	0x5c: 'é',
+	0x5e: 'í',
+	0x5f: 'ó',
+	0x60: 'ú',
+	0x7b: 'ç',
+	0x7c: '÷',
+	0x7d: 'Ñ',
+	0x7e: 'ñ',
+	0x7f: '█',
+}
+
+// Special characters, second byte 0x30-0x3f after 0x11 (0x19).
+var specialChars = [16]rune{
+	'®', '°', '½', '¿', '™', '¢', '£', '♪',
+	'à', ' ', 'è', 'â', 'ê', 'î', 'ô', 'û',
+}
+
+// Extended characters, second byte 0x20-0x3f after 0x12 (0x1a) and
+// 0x13 (0x1b). They replace the character before them.
+var extendedChars = [2][32]rune{
+	{
+		'Á', 'É', 'Ó', 'Ú', 'Ü', 'ü', '‘', '¡',
+		'*', '’', '─', '©', '℠', '•', '“', '”',
+		'À', 'Â', 'Ç', 'È', 'Ê', 'Ë', 'ë', 'Î',
+		'Ï', 'ï', 'Ô', 'Ù', 'ù', 'Û', '«', '»',
+	},
+	{
+		'Ã', 'ã', 'Í', 'Ì', 'ì', 'Ò', 'ò', 'Õ',
+		'õ', '{', '}', '\\', '^', '_', '|', '~',
+		'Ä', 'ä', 'Ö', 'ö', 'ß', '¥', '¤', '│',
+		'Å', 'å', 'Ø', 'ø', '┌', '┐', '└', '┘',
+	},
+}
+
+func basicChar(b byte) rune {
+	if r, ok := basicChars[b]; ok {
+		return r
+	}
+	return rune(b)
+}
+
+// Rows addressed by preamble address codes, indexed by the low three bits
+// of the first byte and by whether the second byte is >= 0x60.
+var pacRows = [8][2]int{
+	{11, 11},
+	{1, 2},
+	{3, 4},
+	{12, 13},
+	{14, 15},
+	{5, 6},
+	{7, 8},
+	{9, 10},
+}
@@ -0,0 +1,375 @@
+// Package caption decodes CEA-608 closed captions captured from VBI and
+// exports them as timed subtitles.
+package caption
+
+import (
+	"strings"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+type Channel int
+
+const (
+	CC1 Channel = 1
+	CC2 Channel = 2
+	CC3 Channel = 3
+	CC4 Channel = 4
+)
+
+type Mode int
+
+const (
+	Mode_PopOn Mode = iota
+	Mode_RollUp
+	Mode_PaintOn
+	Mode_Text
+)
+
+// Cue is a caption that was on screen from Start until End.
+type Cue struct {
+	Channel Channel
+	Start   time.Duration
+	End     time.Duration
+	Text    string
+}
+
+const (
+	rows = 15
+	cols = 32
+)
+
+type screen [rows][cols]rune
+
+func (s *screen) text() string {
+	var lines []string
+	for _, row := range s {
+		var b strings.Builder
+		for _, r := range row {
+			if r == 0 {
+				r = ' '
+			}
+			b.WriteRune(r)
+		}
+		if line := strings.TrimSpace(b.String()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Decoder is a CEA-608 caption decoder for all four caption channels and
+// XDS. Cue times are relative to the first byte pair fed to the decoder.
+type Decoder struct {
+	channels [4]channelState
+	current  [2]*channelState // channel receiving characters, per field
+	lastCtrl [2][2]byte
+	inXds    bool
+	xds      xdsDecoder
+	origin   time.Duration
+	started  bool
+	cues     []Cue
+}
+
+type channelState struct {
+	channel   Channel
+	mode      Mode
+	displayed screen
+	hidden    screen
+	row       int
+	col       int
+	rollRows  int
+	text      bool // TR or RTD: the channel carries a text service
+	shown     string
+	since     time.Duration
+}
+
+func NewDecoder() *Decoder {
+	d := &Decoder{}
+	for i := range d.channels {
+		d.channels[i] = channelState{
+			channel: Channel(i + 1),
+			row:     rows - 1,
+		}
+	}
+	d.current[0] = &d.channels[0]
+	d.current[1] = &d.channels[2]
+	return d
+}
+
+// Decode feeds one captured byte pair. Captions of the first field carry
+// CC1 and CC2, the second field carries CC3, CC4 and XDS.
+func (d *Decoder) Decode(pair v4l2.CaptionPair, timestamp time.Duration) {
+	d.DecodeBytes(pair.Field, pair.Data[0], pair.Data[1], timestamp)
+}
+
+// DecodeBytes is Decode for a byte pair that still carries parity bits.
+func (d *Decoder) DecodeBytes(field int, b1, b2 byte, timestamp time.Duration) {
+	if !d.started {
+		d.origin = timestamp
+		d.started = true
+	}
+	ts := timestamp - d.origin
+	if field != 0 {
+		field = 1
+	}
+
+	if !v4l2.OddParity(b1) {
+		d.lastCtrl[field] = [2]byte{}
+		return
+	}
+	b1 &= 0x7f
+	if v4l2.OddParity(b2) {
+		b2 &= 0x7f
+	} else {
+		b2 = 0x7f
+	}
+	if b1 == 0 && b2 == 0 {
+		return
+	}
+
+	if field == 1 && b1 < 0x10 {
+		d.inXds = true
+		d.xds.decode(b1, b2)
+		return
+	}
+	if b1 >= 0x10 && b1 < 0x20 {
+		// Control codes are sent twice, the repetition is ignored.
+		ctrl := [2]byte{b1, b2}
+		if ctrl == d.lastCtrl[field] {
+			d.lastCtrl[field] = [2]byte{}
+			return
+		}
+		d.lastCtrl[field] = ctrl
+		if field == 1 {
+			d.inXds = false
+		}
+		d.control(field, b1, b2, ts)
+		return
+	}
+	d.lastCtrl[field] = [2]byte{}
+
+	if field == 1 && d.inXds {
+		d.xds.decode(b1, b2)
+		return
+	}
+	c := d.current[field]
+	c.put(basicChar(b1))
+	if b2 >= 0x20 {
+		c.put(basicChar(b2))
+	}
+	if c.mode != Mode_PopOn {
+		d.update(c, ts)
+	}
+}
+
+func (d *Decoder) control(field int, b1, b2 byte, ts time.Duration) {
+	c := &d.channels[field*2]
+	if b1&0x08 != 0 {
+		c = &d.channels[field*2+1]
+	}
+	d.current[field] = c
+	b1 &^= 0x08
+
+	switch {
+	case b2 >= 0x40:
+		half := 0
+		if b2 >= 0x60 {
+			half = 1
+		}
+		if !c.text {
+			c.pac(pacRows[b1&7][half]-1, b2)
+		}
+	case (b1 == 0x14 || b1 == 0x15) && b2 >= 0x20 && b2 < 0x30:
+		if c.command(b2) {
+			d.update(c, ts)
+		}
+	case b1 == 0x17 && b2 >= 0x21 && b2 <= 0x23:
+		c.col += int(b2 - 0x20)
+		if c.col >= cols {
+			c.col = cols - 1
+		}
+	case b1 == 0x11 && b2 >= 0x30 && b2 < 0x40:
+		c.put(specialChars[b2-0x30])
+	case b1 == 0x11 && b2 >= 0x20 && b2 < 0x30:
+		// Mid-row style codes are displayed as a space.
+		c.put(' ')
+	case (b1 == 0x12 || b1 == 0x13) && b2 >= 0x20 && b2 < 0x40:
+		c.backspace()
+		c.put(extendedChars[b1-0x12][b2-0x20])
+	}
+	// Paint-on and roll-up captions are written to the screen directly.
+	if c.mode != Mode_PopOn {
+		d.update(c, ts)
+	}
+}
+
+func (d *Decoder) update(c *channelState, ts time.Duration) {
+	text := c.displayed.text()
+	if text == c.shown {
+		return
+	}
+	if c.mode != Mode_PopOn && c.shown != "" && strings.HasPrefix(text, c.shown) {
+		// Text painted or rolled in extends the caption on screen.
+		c.shown = text
+		return
+	}
+	if c.shown != "" {
+		d.cues = append(d.cues, Cue{
+			Channel: c.channel,
+			Start:   c.since,
+			End:     ts,
+			Text:    c.shown,
+		})
+	}
+	c.shown = text
+	c.since = ts
+}
+
+// Flush ends the captions still on screen at the given timestamp.
+func (d *Decoder) Flush(timestamp time.Duration) {
+	ts := timestamp - d.origin
+	for i := range d.channels {
+		c := &d.channels[i]
+		c.displayed = screen{}
+		d.update(c, ts)
+	}
+}
+
+// Cues returns the captions completed since the last call.
+func (d *Decoder) Cues() []Cue {
+	cues := d.cues
+	d.cues = nil
+	return cues
+}
+
+// Mode returns the caption mode a channel is in, or Mode_Text while it
+// carries a text service. Channels other than CC1 to CC4 have the zero
+// Mode.
+func (d *Decoder) Mode(channel Channel) Mode {
+	if channel < CC1 || channel > CC4 {
+		return 0
+	}
+	c := &d.channels[channel-1]
+	if c.text {
+		return Mode_Text
+	}
+	return c.mode
+}
+
+// XDS returns the XDS packets received since the last call.
+func (d *Decoder) XDS() []XdsPacket {
+	packets := d.xds.packets
+	d.xds.packets = nil
+	return packets
+}
+
+func (c *channelState) memory() *screen {
+	if c.mode == Mode_PopOn {
+		return &c.hidden
+	}
+	return &c.displayed
+}
+
+func (c *channelState) put(r rune) {
+	if c.text {
+		return
+	}
+	if c.col >= cols {
+		c.col = cols - 1
+	}
+	c.memory()[c.row][c.col] = r
+	c.col++
+}
+
+func (c *channelState) backspace() {
+	if c.col > 0 {
+		c.col--
+		c.memory()[c.row][c.col] = 0
+	}
+}
+
+// pac handles a preamble address code.
+func (c *channelState) pac(row int, b2 byte) {
+	if c.mode == Mode_RollUp && row != c.row {
+		// Move the roll-up window so that its base row is row.
+		old := c.displayed
+		c.displayed = screen{}
+		for i := 0; i < c.rollRows; i++ {
+			if row-i >= 0 && c.row-i >= 0 {
+				c.displayed[row-i] = old[c.row-i]
+			}
+		}
+	}
+	if c.mode == Mode_RollUp && row < c.rollRows-1 {
+		row = c.rollRows - 1
+	}
+	c.row = row
+	c.col = 0
+	if b2&0x10 != 0 {
+		c.col = int(b2&0x0e) * 2
+	}
+}
+
+// command handles a miscellaneous control code and reports whether the
+// displayed memory may have changed.
+func (c *channelState) command(b2 byte) bool {
+	if c.text && (b2 == 0x21 || b2 == 0x24 || b2 == 0x2d) {
+		// BS, DER and CR edit the text service, which is not decoded.
+		return false
+	}
+	switch b2 {
+	case 0x20: // RCL resume caption loading
+		c.mode = Mode_PopOn
+		c.text = false
+	case 0x21: // BS backspace
+		c.backspace()
+	case 0x24: // DER delete to end of row
+		mem := c.memory()
+		for i := c.col; i < cols; i++ {
+			mem[c.row][i] = 0
+		}
+	case 0x25, 0x26, 0x27: // RU2, RU3, RU4 roll-up captions
+		if c.mode != Mode_RollUp {
+			c.displayed = screen{}
+			c.hidden = screen{}
+			c.row = rows - 1
+			c.col = 0
+		}
+		c.mode = Mode_RollUp
+		c.text = false
+		c.rollRows = int(b2-0x25) + 2
+	case 0x29: // RDC resume direct captioning
+		c.mode = Mode_PaintOn
+		c.text = false
+	case 0x2a, 0x2b: // TR text restart, RTD resume text display
+		c.text = true
+		return false
+	case 0x2c: // EDM erase displayed memory
+		c.displayed = screen{}
+	case 0x2d: // CR carriage return
+		if c.mode != Mode_RollUp {
+			return false
+		}
+		top := c.row - c.rollRows + 1
+		if top < 0 {
+			top = 0
+		}
+		for i := top; i < c.row; i++ {
+			c.displayed[i] = c.displayed[i+1]
+		}
+		c.displayed[c.row] = [cols]rune{}
+		c.col = 0
+	case 0x2e: // ENM erase non-displayed memory
+		c.hidden = screen{}
+		return false
+	case 0x2f: // EOC end of caption
+		c.displayed, c.hidden = c.hidden, c.displayed
+		c.mode = Mode_PopOn
+		c.text = false
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package caption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fixtures are recorded field 1 byte pairs, parity included, as in SCC
+// files: each line is the frame of the first pair followed by the pairs of
+// consecutive frames.
+const (
+	popOnFixture = `
+0: 9420 9420 94ae 94ae 9470 9470 c845 4c4c 4f80 942f 942f
+90: 942c 942c
+`
+	paintOnFixture = `
+0: 9429 9429 9470 9470 c849 2054 c845 5245
+60: 942c 942c
+`
+	rollUpFixture = `
+0: 9425 9425 9470 9470 4fce 4580
+30: 94ad 94ad 5457 4f80
+60: 94ad 94ad 54c8 5245 4580
+`
+	textFixture = `
+0: 9425 9425 9470 9470 4fce 4580
+30: 942a 942a 5445 5854
+`
+)
+
+func at(frame int) time.Duration {
+	return time.Duration(frame) * time.Second / 30
+}
+
+func decodeFixture(t *testing.T, d *Decoder, fixture string) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(fixture), "\n") {
+		i := strings.IndexByte(line, ':')
+		frame, err := strconv.Atoi(line[:i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, word := range strings.Fields(line[i+1:]) {
+			pair, err := hex.DecodeString(word)
+			if err != nil || len(pair) != 2 {
+				t.Fatalf("bad pair %q", word)
+			}
+			d.DecodeBytes(0, pair[0], pair[1], at(frame))
+			frame++
+		}
+	}
+}
+
+func checkCues(t *testing.T, got, want []Cue) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cues:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestPopOn(t *testing.T) {
+	d := NewDecoder()
+	decodeFixture(t, d, popOnFixture)
+	checkCues(t, d.Cues(), []Cue{
+		{Channel: CC1, Start: at(9), End: at(90), Text: "HELLO"},
+	})
+	if mode := d.Mode(CC1); mode != Mode_PopOn {
+		t.Errorf("mode %d, want Mode_PopOn", mode)
+	}
+}
+
+func TestPaintOn(t *testing.T) {
+	d := NewDecoder()
+	decodeFixture(t, d, paintOnFixture)
+	checkCues(t, d.Cues(), []Cue{
+		{Channel: CC1, Start: at(4), End: at(60), Text: "HI THERE"},
+	})
+}
+
+func TestRollUp(t *testing.T) {
+	d := NewDecoder()
+	decodeFixture(t, d, rollUpFixture)
+	d.Flush(at(90))
+	checkCues(t, d.Cues(), []Cue{
+		{Channel: CC1, Start: at(4), End: at(60), Text: "ONE\nTWO"},
+		{Channel: CC1, Start: at(60), End: at(90), Text: "TWO\nTHREE"},
+	})
+}
+
+func TestTextMode(t *testing.T) {
+	d := NewDecoder()
+	decodeFixture(t, d, textFixture)
+	if mode := d.Mode(CC1); mode != Mode_Text {
+		t.Errorf("mode %d, want Mode_Text", mode)
+	}
+	// Text service characters are not captions.
+	d.Flush(at(60))
+	checkCues(t, d.Cues(), []Cue{
+		{Channel: CC1, Start: at(4), End: at(60), Text: "ONE"},
+	})
+	// Captions resume in the mode they were in.
+	d.DecodeBytes(0, 0x94, 0x25, at(61))
+	if mode := d.Mode(CC1); mode != Mode_RollUp {
+		t.Errorf("mode %d, want Mode_RollUp", mode)
+	}
+	for _, channel := range []Channel{0, 5, -1} {
+		if mode := d.Mode(channel); mode != 0 {
+			t.Errorf("channel %d: mode %d, want 0", channel, mode)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	d := NewDecoder()
+	decodeFixture(t, d, popOnFixture)
+	cues := d.Cues()
+
+	var srt bytes.Buffer
+	if err := WriteSRT(&srt, cues); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n00:00:00,300 --> 00:00:03,000\nHELLO\n\n"; srt.String() != want {
+		t.Errorf("SRT:\n%q\nwant\n%q", srt.String(), want)
+	}
+
+	var vtt bytes.Buffer
+	if err := WriteWebVTT(&vtt, cues); err != nil {
+		t.Fatal(err)
+	}
+	if want := "WEBVTT\n\n00:00:00.300 --> 00:00:03.000\nHELLO\n\n"; vtt.String() != want {
+		t.Errorf("WebVTT:\n%q\nwant\n%q", vtt.String(), want)
+	}
+}
@@ -0,0 +1,41 @@
+package caption
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteSRT writes cues as a SubRip subtitle file.
+func WriteSRT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	for i, cue := range cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n",
+			i+1, formatTime(cue.Start, ','), formatTime(cue.End, ','), cue.Text)
+	}
+	return bw.Flush()
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WriteWebVTT writes cues as a WebVTT subtitle file.
+func WriteWebVTT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n",
+			formatTime(cue.Start, '.'), formatTime(cue.End, '.'), vttEscaper.Replace(cue.Text))
+	}
+	return bw.Flush()
+}
+
+func formatTime(d time.Duration, sep byte) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d",
+		ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,93 @@
+package caption
+
+import "strings"
+
+// XdsClass is the class of an extended data services packet, as given by
+// its start code.
+type XdsClass byte
+
+const (
+	XdsClass_Current  XdsClass = 0x01
+	XdsClass_Future   XdsClass = 0x03
+	XdsClass_Channel  XdsClass = 0x05
+	XdsClass_Misc     XdsClass = 0x07
+	XdsClass_Public   XdsClass = 0x09
+	XdsClass_Reserved XdsClass = 0x0b
+	XdsClass_Private  XdsClass = 0x0d
+)
+
+// Some packet types (CEA-608 section 9.5).
+const (
+	XdsType_ProgramId      = 0x01 // current and future class
+	XdsType_ProgramLength  = 0x02
+	XdsType_ProgramName    = 0x03
+	XdsType_ProgramType    = 0x04
+	XdsType_ContentAdvisor = 0x05
+	XdsType_NetworkName    = 0x01 // channel class
+	XdsType_CallLetters    = 0x02
+	XdsType_TimeOfDay      = 0x01 // misc class
+)
+
+// XdsPacket is a complete XDS packet with a valid checksum.
+type XdsPacket struct {
+	Class XdsClass
+	Type  byte
+	Data  []byte
+}
+
+// Text returns the data of a packet carrying a string, such as a program
+// or network name.
+func (p *XdsPacket) Text() string {
+	return strings.TrimSpace(string(p.Data))
+}
+
+type xdsDecoder struct {
+	pending map[XdsClass]*XdsPacket
+	current *XdsPacket
+	sum     map[XdsClass]int
+	packets []XdsPacket
+}
+
+func (x *xdsDecoder) decode(b1, b2 byte) {
+	if x.pending == nil {
+		x.pending = make(map[XdsClass]*XdsPacket)
+		x.sum = make(map[XdsClass]int)
+	}
+	switch {
+	case b1 == 0x0f:
+		// End of packet, b2 is the checksum.
+		if x.current == nil {
+			return
+		}
+		class := x.current.Class
+		if (x.sum[class]+0x0f+int(b2))&0x7f == 0 {
+			x.packets = append(x.packets, *x.current)
+		}
+		delete(x.pending, class)
+		delete(x.sum, class)
+		x.current = nil
+	case b1 < 0x0f && b1&1 == 1:
+		// Start of a packet, b2 is the type.
+		class := XdsClass(b1)
+		x.current = &XdsPacket{Class: class, Type: b2}
+		x.pending[class] = x.current
+		x.sum[class] = int(b1) + int(b2)
+	case b1 < 0x0f:
+		// Continuation of an interrupted packet.
+		class := XdsClass(b1 - 1)
+		if p, ok := x.pending[class]; ok && p.Type == b2 {
+			x.current = p
+		} else {
+			x.current = nil
+		}
+	default:
+		if x.current == nil {
+			return
+		}
+		x.sum[x.current.Class] += int(b1) + int(b2)
+		x.current.Data = append(x.current.Data, b1)
+		if b2 != 0 {
+			x.current.Data = append(x.current.Data, b2)
+		}
+	}
+}
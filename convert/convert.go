@@ -0,0 +1,69 @@
+// Package convert turns raw V4L2 frames into standard library images.
+package convert
+
+import (
+	"errors"
+	"image"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrUnsupported = errors.New("convert: unsupported pixel format")
+	ErrShortData   = errors.New("convert: frame smaller than its format")
+)
+
+// Image converts a frame to the closest standard library image: *image.Gray
+// or *image.Gray16 for luma-only formats, *image.RGBA for RGB formats, and
+// for YUV formats *image.YCbCr if the frame uses the JPEG encoding that
+// image.YCbCr assumes, *image.RGBA otherwise. The image never aliases data.
+func Image(format *v4l2.PixFormat, data []byte) (image.Image, error) {
+	switch {
+	case isGray(format.PixelFormat):
+		return Gray16(format, data)
+	case format.PixelFormat == v4l2.PixFmt_Grey:
+		return Gray(format, data)
+	case isYUV(format.PixelFormat):
+		if NewMatrix(format).IsJpeg() {
+			return YCbCr(format, data)
+		}
+		return RGBA(format, data)
+	default:
+		return RGBA(format, data)
+	}
+}
+
+// RGBA converts a YUV or RGB frame to RGB. YUV frames are converted with
+// the matrix described by the format's colorspace, Y'CbCr encoding and
+// quantization.
+func RGBA(format *v4l2.PixFormat, data []byte) (*image.RGBA, error) {
+	if isYUV(format.PixelFormat) {
+		img, err := YCbCr(format, data)
+		if err != nil {
+			return nil, err
+		}
+		return NewMatrix(format).RGBA(img), nil
+	}
+	return rgba(format, data)
+}
+
+// stride returns the number of bytes between rows of the first plane.
+func stride(format *v4l2.PixFormat, bytesPerPixel int) int {
+	if format.BytesPerLine != 0 {
+		return int(format.BytesPerLine)
+	}
+	return int(format.Width) * bytesPerPixel
+}
+
+// rows returns the image rectangle and checks that data holds height rows
+// of stride bytes, the last one at least rowSize long.
+func rows(format *v4l2.PixFormat, data []byte, stride, rowSize int) (image.Rectangle, error) {
+	r := image.Rect(0, 0, int(format.Width), int(format.Height))
+	if r.Empty() {
+		return r, nil
+	}
+	if stride < rowSize || len(data) < (r.Dy()-1)*stride+rowSize {
+		return r, ErrShortData
+	}
+	return r, nil
+}
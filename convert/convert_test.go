@@ -0,0 +1,264 @@
+package convert
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+func TestMatrix(t *testing.T) {
+	tests := []struct {
+		enc          v4l2.YcbcrEncoding
+		quantization v4l2.Quantization
+		kr, kb       float64
+		jpeg         bool
+	}{
+		{v4l2.YcbcrEnc_601, v4l2.Quantization_LimRange, 0.299, 0.114, false},
+		{v4l2.YcbcrEnc_601, v4l2.Quantization_FullRange, 0.299, 0.114, true},
+		{v4l2.YcbcrEnc_709, v4l2.Quantization_LimRange, 0.2126, 0.0722, false},
+		{v4l2.YcbcrEnc_709, v4l2.Quantization_FullRange, 0.2126, 0.0722, false},
+	}
+	for _, test := range tests {
+		m := NewMatrix(&v4l2.PixFormat{
+			YcbcrEncOrHsvEnc: uint32(test.enc),
+			Quantization:     test.quantization,
+		})
+		if m.IsJpeg() != test.jpeg || m.Encoding() != test.enc || m.Quantization() != test.quantization {
+			t.Errorf("encoding %d, quantization %d: got %v", test.enc, test.quantization, m)
+		}
+		yOffset, yScale, cScale := 0.0, 1.0, 1.0
+		if test.quantization == v4l2.Quantization_LimRange {
+			yOffset, yScale, cScale = 16, 255.0/219, 255.0/224
+		}
+		kg := 1 - test.kr - test.kb
+		for y := 0; y < 256; y += 5 {
+			for cb := 0; cb < 256; cb += 15 {
+				for cr := 0; cr < 256; cr += 15 {
+					yy := (float64(y) - yOffset) * yScale
+					u := (float64(cb) - 128) * cScale
+					v := (float64(cr) - 128) * cScale
+					want := [3]float64{
+						yy + 2*(1-test.kr)*v,
+						yy - 2*test.kb*(1-test.kb)/kg*u - 2*test.kr*(1-test.kr)/kg*v,
+						yy + 2*(1-test.kb)*u,
+					}
+					r, g, b := m.RGB(uint8(y), uint8(cb), uint8(cr))
+					for i, got := range [3]uint8{r, g, b} {
+						w := math.Max(0, math.Min(255, want[i]))
+						if math.Abs(float64(got)-w) > 1 {
+							t.Fatalf("encoding %d, quantization %d: %d,%d,%d to %d,%d,%d, want %.1f,%.1f,%.1f",
+								test.enc, test.quantization, y, cb, cr, r, g, b, want[0], want[1], want[2])
+						}
+					}
+					if test.jpeg {
+						jr, jg, jb := color.YCbCrToRGB(uint8(y), uint8(cb), uint8(cr))
+						if absDiff(r, jr) > 1 || absDiff(g, jg) > 1 || absDiff(b, jb) > 1 {
+							t.Fatalf("%d,%d,%d to %d,%d,%d, image/color gives %d,%d,%d", y, cb, cr, r, g, b, jr, jg, jb)
+						}
+					}
+				}
+			}
+		}
+		// Black and white are exact.
+		black, white := uint8(yOffset), uint8(255)
+		if test.quantization == v4l2.Quantization_LimRange {
+			white = 235
+		}
+		if r, g, b := m.RGB(black, 128, 128); r != 0 || g != 0 || b != 0 {
+			t.Errorf("encoding %d, quantization %d: black is %d,%d,%d", test.enc, test.quantization, r, g, b)
+		}
+		if r, g, b := m.RGB(white, 128, 128); r != 255 || g != 255 || b != 255 {
+			t.Errorf("encoding %d, quantization %d: white is %d,%d,%d", test.enc, test.quantization, r, g, b)
+		}
+	}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestPackedStride(t *testing.T) {
+	// 3x2 YUYV, with 4 bytes of padding after each row.
+	format := &v4l2.PixFormat{
+		Width:        3,
+		Height:       2,
+		PixelFormat:  v4l2.PixFmt_Yuyv,
+		BytesPerLine: 12,
+	}
+	data := []byte{
+		10, 20, 11, 30, 12, 21, 0, 31, 0xee, 0xee, 0xee, 0xee,
+		13, 22, 14, 32, 15, 23, 0, 33, 0xee, 0xee, 0xee, 0xee,
+	}
+	img, err := YCbCr(format, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Y, []byte{10, 11, 12, 13, 14, 15}) ||
+		!bytes.Equal(img.Cb, []byte{20, 21, 22, 23}) ||
+		!bytes.Equal(img.Cr, []byte{30, 31, 32, 33}) {
+		t.Errorf("got Y %v, Cb %v, Cr %v", img.Y, img.Cb, img.Cr)
+	}
+	if _, err := YCbCr(format, data[:12+5]); err != ErrShortData {
+		t.Errorf("short frame: %v", err)
+	}
+	// The padding of the last row may be missing.
+	if _, err := YCbCr(format, data[:12+8]); err != nil {
+		t.Errorf("frame without the last padding: %v", err)
+	}
+}
+
+func TestRGBStride(t *testing.T) {
+	format := &v4l2.PixFormat{
+		Width:        2,
+		Height:       2,
+		PixelFormat:  v4l2.PixFmt_Bgr24,
+		BytesPerLine: 8,
+	}
+	data := []byte{
+		1, 2, 3, 4, 5, 6, 0xee, 0xee,
+		7, 8, 9, 10, 11, 12, 0xee, 0xee,
+	}
+	img, err := RGBA(format, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{3, 2, 1, 0xff, 6, 5, 4, 0xff, 9, 8, 7, 0xff, 12, 11, 10, 0xff}
+	if !bytes.Equal(img.Pix, want) {
+		t.Errorf("got %v, want %v", img.Pix, want)
+	}
+}
+
+func TestRGB565(t *testing.T) {
+	format := &v4l2.PixFormat{Width: 5, Height: 1, PixelFormat: v4l2.PixFmt_Rgb565}
+	data := []byte{0x00, 0xf8, 0xe0, 0x07, 0x1f, 0x00, 0x10, 0x84, 0xff, 0xff}
+	img, err := RGBA(format, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		255, 0, 0, 255,
+		0, 255, 0, 255,
+		0, 0, 255, 255,
+		132, 130, 132, 255,
+		255, 255, 255, 255,
+	}
+	if !bytes.Equal(img.Pix, want) {
+		t.Errorf("got %v, want %v", img.Pix, want)
+	}
+}
+
+func TestGray16(t *testing.T) {
+	tests := []struct {
+		format v4l2.PixFmt
+		data   []byte
+		want   []uint16
+	}{
+		{v4l2.PixFmt_Y10, []byte{0xff, 0x03, 0x00, 0x02, 0x00, 0x00, 0xff, 0xff}, []uint16{0xffff, 0x8020, 0, 0xffff}},
+		{v4l2.PixFmt_Y12, []byte{0xff, 0x0f, 0x00, 0x08, 0x01, 0x00, 0xff, 0xff}, []uint16{0xffff, 0x8008, 0x0010, 0xffff}},
+		{v4l2.PixFmt_Y16, []byte{0xff, 0xff, 0x34, 0x12, 0x00, 0x00, 0x01, 0x00}, []uint16{0xffff, 0x1234, 0, 1}},
+		{v4l2.PixFmt_Y16_Be, []byte{0xff, 0xff, 0x12, 0x34, 0x00, 0x00, 0x00, 0x01}, []uint16{0xffff, 0x1234, 0, 1}},
+		{v4l2.PixFmt_Grey, []byte{0xff, 0x80, 0x00, 0x01}, []uint16{0xffff, 0x8080, 0, 0x0101}},
+	}
+	for _, test := range tests {
+		format := &v4l2.PixFormat{Width: 4, Height: 1, PixelFormat: test.format}
+		img, err := Gray16(format, test.data)
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+		for x, want := range test.want {
+			if v := img.Gray16At(x, 0).Y; v != want {
+				t.Errorf("%v: sample %d is %#x, want %#x", test.format, x, v, want)
+			}
+		}
+		gray, err := Gray(format, test.data)
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+		for x, want := range test.want {
+			if v := gray.GrayAt(x, 0).Y; v != uint8(want>>8) {
+				t.Errorf("%v: 8-bit sample %d is %#x, want %#x", test.format, x, v, want>>8)
+			}
+		}
+	}
+}
+
+func TestPlanarOddWidth(t *testing.T) {
+	tests := []struct {
+		format       v4l2.PixFmt
+		ratio        image.YCbCrSubsampleRatio
+		bytesPerLine uint32
+		chromaStride int
+		chromaRows   int
+	}{
+		// Chroma rows are 3 bytes long, the kernel rounds up.
+		{v4l2.PixFmt_Yuv420, image.YCbCrSubsampleRatio420, 0, 3, 2},
+		{v4l2.PixFmt_Yvu420, image.YCbCrSubsampleRatio420, 0, 3, 2},
+		{v4l2.PixFmt_Yuv420, image.YCbCrSubsampleRatio420, 8, 4, 2},
+		{v4l2.PixFmt_Yuv422P, image.YCbCrSubsampleRatio422, 0, 3, 3},
+	}
+	for _, test := range tests {
+		format := &v4l2.PixFormat{
+			Width:        5,
+			Height:       3,
+			PixelFormat:  test.format,
+			BytesPerLine: test.bytesPerLine,
+		}
+		s := stride(format, 1)
+		planeSize := test.chromaStride * test.chromaRows
+		data := make([]byte, s*3+2*planeSize)
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 5; x++ {
+				data[y*s+x] = byte(y*10 + x)
+			}
+		}
+		u, v := data[s*3:], data[s*3+planeSize:]
+		if test.format == v4l2.PixFmt_Yvu420 {
+			u, v = v, u
+		}
+		for y := 0; y < test.chromaRows; y++ {
+			for x := 0; x < 3; x++ {
+				u[y*test.chromaStride+x] = byte(100 + y*10 + x)
+				v[y*test.chromaStride+x] = byte(200 + y*10 + x)
+			}
+		}
+
+		img, err := YCbCr(format, data)
+		if err != nil {
+			t.Errorf("%v with %d bytes per line: %v", test.format, test.bytesPerLine, err)
+			continue
+		}
+		if img.SubsampleRatio != test.ratio {
+			t.Errorf("%v: ratio %v", test.format, img.SubsampleRatio)
+		}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 5; x++ {
+				c := img.YCbCrAt(x, y)
+				cy := y
+				if test.ratio == image.YCbCrSubsampleRatio420 {
+					cy /= 2
+				}
+				want := color.YCbCr{Y: byte(y*10 + x), Cb: byte(100 + cy*10 + x/2), Cr: byte(200 + cy*10 + x/2)}
+				if c != want {
+					t.Errorf("%v with %d bytes per line: pixel %d,%d is %v, want %v",
+						test.format, test.bytesPerLine, x, y, c, want)
+				}
+			}
+		}
+		// Only the padding of the last chroma row may be missing.
+		if _, err := YCbCr(format, data[:len(data)-test.chromaStride+3]); err != nil {
+			t.Errorf("%v: frame without the last padding: %v", test.format, err)
+		}
+		if _, err := YCbCr(format, data[:len(data)-test.chromaStride+2]); err != ErrShortData {
+			t.Errorf("%v: short frame: %v", test.format, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package convert
+
+import (
+	"image"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// rgbLayout gives the byte offsets of the components of a packed RGB pixel.
+// a is -1 for formats without alpha.
+type rgbLayout struct {
+	size    int
+	r, g, b int
+	a       int
+}
+
+var rgbLayouts = map[v4l2.PixFmt]rgbLayout{
+	v4l2.PixFmt_Rgb24:  {3, 0, 1, 2, -1},
+	v4l2.PixFmt_Bgr24:  {3, 2, 1, 0, -1},
+	v4l2.PixFmt_Xrgb32: {4, 1, 2, 3, -1},
+	v4l2.PixFmt_Argb32: {4, 1, 2, 3, 0},
+	v4l2.PixFmt_Rgb32:  {4, 1, 2, 3, -1},
+	v4l2.PixFmt_Xbgr32: {4, 2, 1, 0, -1},
+	v4l2.PixFmt_Abgr32: {4, 2, 1, 0, 3},
+	v4l2.PixFmt_Bgr32:  {4, 2, 1, 0, -1},
+	v4l2.PixFmt_Rgbx32: {4, 0, 1, 2, -1},
+	v4l2.PixFmt_Rgba32: {4, 0, 1, 2, 3},
+	v4l2.PixFmt_Bgrx32: {4, 3, 2, 1, -1},
+	v4l2.PixFmt_Bgra32: {4, 3, 2, 1, 0},
+}
+
+func rgba(format *v4l2.PixFormat, data []byte) (*image.RGBA, error) {
+	if format.PixelFormat == v4l2.PixFmt_Rgb565 {
+		return rgb565(format, data)
+	}
+	layout, ok := rgbLayouts[format.PixelFormat]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	s := stride(format, layout.size)
+	r, err := rows(format, data, s, int(format.Width)*layout.size)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(r)
+	for y := 0; y < r.Dy(); y++ {
+		src := data[y*s:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < r.Dx(); x++ {
+			p := src[x*layout.size:]
+			q := dst[x*4 : x*4+4]
+			q[0], q[1], q[2], q[3] = p[layout.r], p[layout.g], p[layout.b], 0xff
+			if layout.a >= 0 && p[layout.a] != 0xff {
+				// image.RGBA is alpha-premultiplied.
+				a := uint32(p[layout.a])
+				q[0] = uint8(uint32(q[0]) * a / 0xff)
+				q[1] = uint8(uint32(q[1]) * a / 0xff)
+				q[2] = uint8(uint32(q[2]) * a / 0xff)
+				q[3] = uint8(a)
+			}
+		}
+	}
+	return img, nil
+}
+
+// rgb565 converts little endian 5:6:5 pixels, expanding each component to
+// eight bits by replicating its high bits.
+func rgb565(format *v4l2.PixFormat, data []byte) (*image.RGBA, error) {
+	s := stride(format, 2)
+	r, err := rows(format, data, s, int(format.Width)*2)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(r)
+	for y := 0; y < r.Dy(); y++ {
+		src := data[y*s:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < r.Dx(); x++ {
+			v := uint16(src[x*2]) | uint16(src[x*2+1])<<8
+			red := uint8(v >> 11)
+			green := uint8(v>>5) & 0x3f
+			blue := uint8(v) & 0x1f
+			q := dst[x*4 : x*4+4]
+			q[0] = red<<3 | red>>2
+			q[1] = green<<2 | green>>4
+			q[2] = blue<<3 | blue>>2
+			q[3] = 0xff
+		}
+	}
+	return img, nil
+}
+
+// Gray copies an 8-bit luma frame. Frames with more bits are reduced to
+// their 8 most significant bits.
+func Gray(format *v4l2.PixFormat, data []byte) (*image.Gray, error) {
+	if format.PixelFormat != v4l2.PixFmt_Grey {
+		img, err := Gray16(format, data)
+		if err != nil {
+			return nil, err
+		}
+		gray := image.NewGray(img.Rect)
+		for i := range gray.Pix {
+			gray.Pix[i] = img.Pix[i*2]
+		}
+		return gray, nil
+	}
+	s := stride(format, 1)
+	r, err := rows(format, data, s, int(format.Width))
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewGray(r)
+	copyPlane(img.Pix, img.Stride, data, s, r.Dx(), r.Dy())
+	return img, nil
+}
+
+func isGray(f v4l2.PixFmt) bool {
+	_, ok := grayBits[f]
+	return ok
+}
+
+// grayBits is the number of significant bits of luma formats stored in
+// 16-bit little endian words, or 0 for big endian Y16.
+var grayBits = map[v4l2.PixFmt]uint{
+	v4l2.PixFmt_Y10:    10,
+	v4l2.PixFmt_Y12:    12,
+	v4l2.PixFmt_Y16:    16,
+	v4l2.PixFmt_Y16_Be: 0,
+}
+
+// Gray16 copies a 10, 12 or 16-bit luma frame, scaling samples to the full
+// 16-bit range. 8-bit frames are widened.
+func Gray16(format *v4l2.PixFormat, data []byte) (*image.Gray16, error) {
+	if format.PixelFormat == v4l2.PixFmt_Grey {
+		img, err := Gray(format, data)
+		if err != nil {
+			return nil, err
+		}
+		gray := image.NewGray16(img.Rect)
+		for i, v := range img.Pix {
+			gray.Pix[i*2] = v
+			gray.Pix[i*2+1] = v
+		}
+		return gray, nil
+	}
+	bits, ok := grayBits[format.PixelFormat]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	s := stride(format, 2)
+	r, err := rows(format, data, s, int(format.Width)*2)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewGray16(r)
+	for y := 0; y < r.Dy(); y++ {
+		src := data[y*s:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < r.Dx(); x++ {
+			var v uint16
+			if bits == 0 {
+				v = uint16(src[x*2])<<8 | uint16(src[x*2+1])
+			} else {
+				v = uint16(src[x*2]) | uint16(src[x*2+1])<<8
+				if bits < 16 {
+					v &= uint16(1)<<bits - 1
+				}
+				// Replicate the high bits into the low ones so that
+				// white maps to 0xffff.
+				v = v<<(16-bits) | v>>(2*bits-16)
+			}
+			dst[x*2] = uint8(v >> 8)
+			dst[x*2+1] = uint8(v)
+		}
+	}
+	return img, nil
+}
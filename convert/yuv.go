@@ -0,0 +1,271 @@
+package convert
+
+import (
+	"image"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+func isYUV(f v4l2.PixFmt) bool {
+	switch f {
+	case v4l2.PixFmt_Yuyv, v4l2.PixFmt_Uyvy, v4l2.PixFmt_Yvyu, v4l2.PixFmt_Vyuy,
+		v4l2.PixFmt_Nv12, v4l2.PixFmt_Nv21, v4l2.PixFmt_Nv16, v4l2.PixFmt_Nv61,
+		v4l2.PixFmt_Yuv420, v4l2.PixFmt_Yvu420, v4l2.PixFmt_Yuv422P:
+		return true
+	}
+	return false
+}
+
+// YCbCr copies the samples of a YUV frame into an image.YCbCr without
+// converting them. image.YCbCr assumes full range BT.601 (JPEG), use
+// Matrix.RGBA to convert frames in other encodings.
+func YCbCr(format *v4l2.PixFormat, data []byte) (*image.YCbCr, error) {
+	switch format.PixelFormat {
+	case v4l2.PixFmt_Yuyv:
+		return packedYCbCr(format, data, 0, 1, 3)
+	case v4l2.PixFmt_Yvyu:
+		return packedYCbCr(format, data, 0, 3, 1)
+	case v4l2.PixFmt_Uyvy:
+		return packedYCbCr(format, data, 1, 0, 2)
+	case v4l2.PixFmt_Vyuy:
+		return packedYCbCr(format, data, 1, 2, 0)
+	case v4l2.PixFmt_Nv12:
+		return semiPlanarYCbCr(format, data, image.YCbCrSubsampleRatio420, false)
+	case v4l2.PixFmt_Nv21:
+		return semiPlanarYCbCr(format, data, image.YCbCrSubsampleRatio420, true)
+	case v4l2.PixFmt_Nv16:
+		return semiPlanarYCbCr(format, data, image.YCbCrSubsampleRatio422, false)
+	case v4l2.PixFmt_Nv61:
+		return semiPlanarYCbCr(format, data, image.YCbCrSubsampleRatio422, true)
+	case v4l2.PixFmt_Yuv420:
+		return planarYCbCr(format, data, image.YCbCrSubsampleRatio420, false)
+	case v4l2.PixFmt_Yvu420:
+		return planarYCbCr(format, data, image.YCbCrSubsampleRatio420, true)
+	case v4l2.PixFmt_Yuv422P:
+		return planarYCbCr(format, data, image.YCbCrSubsampleRatio422, false)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// packedYCbCr unpacks 4:2:2 formats storing two pixels in four bytes. y is
+// the offset of the first luma sample, cb and cr of the chroma samples.
+func packedYCbCr(format *v4l2.PixFormat, data []byte, y, cb, cr int) (*image.YCbCr, error) {
+	s := stride(format, 2)
+	r, err := rows(format, data, s, (int(format.Width)+1)/2*4)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewYCbCr(r, image.YCbCrSubsampleRatio422)
+	for row := 0; row < r.Dy(); row++ {
+		src := data[row*s:]
+		dstY := img.Y[row*img.YStride:]
+		dstCb := img.Cb[row*img.CStride:]
+		dstCr := img.Cr[row*img.CStride:]
+		for x := 0; x < r.Dx(); x += 2 {
+			p := src[x*2 : x*2+4]
+			dstY[x] = p[y]
+			if x+1 < r.Dx() {
+				dstY[x+1] = p[y+2]
+			}
+			dstCb[x/2] = p[cb]
+			dstCr[x/2] = p[cr]
+		}
+	}
+	return img, nil
+}
+
+// chromaSize returns the size of a chroma plane of img.
+func chromaSize(img *image.YCbCr) (int, int) {
+	r := img.Rect
+	w, h := (r.Dx()+1)/2, r.Dy()
+	if img.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+		h = (h + 1) / 2
+	}
+	return w, h
+}
+
+// semiPlanarYCbCr unpacks NV formats: a luma plane followed by a plane of
+// interleaved chroma pairs with the same stride.
+func semiPlanarYCbCr(format *v4l2.PixFormat, data []byte, ratio image.YCbCrSubsampleRatio, swap bool) (*image.YCbCr, error) {
+	s := stride(format, 1)
+	r, err := rows(format, data, s, int(format.Width))
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewYCbCr(r, ratio)
+	cw, ch := chromaSize(img)
+	chroma := data[min(len(data), s*r.Dy()):]
+	if ch > 0 && len(chroma) < (ch-1)*s+cw*2 {
+		return nil, ErrShortData
+	}
+	copyPlane(img.Y, img.YStride, data, s, r.Dx(), r.Dy())
+	cb, cr := img.Cb, img.Cr
+	if swap {
+		cb, cr = cr, cb
+	}
+	for row := 0; row < ch; row++ {
+		src := chroma[row*s:]
+		dstCb := cb[row*img.CStride:]
+		dstCr := cr[row*img.CStride:]
+		for x := 0; x < cw; x++ {
+			dstCb[x] = src[x*2]
+			dstCr[x] = src[x*2+1]
+		}
+	}
+	return img, nil
+}
+
+// planarYCbCr unpacks formats with three planes. Chroma planes have half
+// the stride of the luma plane, rounded up for odd widths.
+func planarYCbCr(format *v4l2.PixFormat, data []byte, ratio image.YCbCrSubsampleRatio, swap bool) (*image.YCbCr, error) {
+	s := stride(format, 1)
+	r, err := rows(format, data, s, int(format.Width))
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewYCbCr(r, ratio)
+	cw, ch := chromaSize(img)
+	cs := (s + 1) / 2
+	planeSize := cs * ch
+	chroma := data[min(len(data), s*r.Dy()):]
+	if ch > 0 && len(chroma) < planeSize+(ch-1)*cs+cw {
+		return nil, ErrShortData
+	}
+	copyPlane(img.Y, img.YStride, data, s, r.Dx(), r.Dy())
+	cb, cr := img.Cb, img.Cr
+	if swap {
+		cb, cr = cr, cb
+	}
+	copyPlane(cb, img.CStride, chroma, cs, cw, ch)
+	copyPlane(cr, img.CStride, chroma[planeSize:], cs, cw, ch)
+	return img, nil
+}
+
+func copyPlane(dst []byte, dstStride int, src []byte, srcStride int, width, height int) {
+	for row := 0; row < height; row++ {
+		copy(dst[row*dstStride:row*dstStride+width], src[row*srcStride:])
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Matrix converts Y'CbCr samples to R'G'B'. Transfer functions are not
+// applied: the result is in the same non-linear space as the input, which
+// is what image.RGBA consumers expect.
+type Matrix struct {
+	jpeg         bool
+	encoding     v4l2.YcbcrEncoding
+	quantization v4l2.Quantization
+	// 16.16 fixed point
+	yOffset int32
+	yScale  int32
+	crR     int32
+	cbG     int32
+	crG     int32
+	cbB     int32
+}
+
+// NewMatrix returns the matrix for the colorimetry of format, filling in
+// the defaults the kernel uses for unset fields.
+func NewMatrix(format *v4l2.PixFormat) Matrix {
+	enc := v4l2.YcbcrEncoding(format.YcbcrEncOrHsvEnc)
+	if enc == v4l2.YcbcrEnc_Default {
+		enc = v4l2.MapYcbcrEncDefault(format.Colorspace)
+	}
+	quantization := format.Quantization
+	if quantization == v4l2.Quantization_Default {
+		quantization = v4l2.MapQuantizationDefault(false, format.Colorspace, enc)
+	}
+
+	var kr, kb float64
+	switch enc {
+	case v4l2.YcbcrEnc_709, v4l2.YcbcrEnc_Xv709:
+		kr, kb = 0.2126, 0.0722
+	case v4l2.YcbcrEnc_Bt2020, v4l2.YcbcrEnc_Bt2020ConstLum:
+		kr, kb = 0.2627, 0.0593
+	case v4l2.YcbcrEnc_Smpte240M:
+		kr, kb = 0.212, 0.087
+	default:
+		kr, kb = 0.299, 0.114
+	}
+	kg := 1 - kr - kb
+
+	yScale, cScale := 1.0, 1.0
+	m := Matrix{encoding: enc, quantization: quantization}
+	if quantization == v4l2.Quantization_LimRange {
+		m.yOffset = 16
+		yScale, cScale = 255.0/219, 255.0/224
+	} else {
+		m.jpeg = enc == v4l2.YcbcrEnc_601 || enc == v4l2.YcbcrEnc_Sycc
+	}
+	fixed := func(f float64) int32 {
+		return int32(f*65536 + 0.5)
+	}
+	m.yScale = fixed(yScale)
+	m.crR = fixed(2 * (1 - kr) * cScale)
+	m.cbG = fixed(2 * kb * (1 - kb) / kg * cScale)
+	m.crG = fixed(2 * kr * (1 - kr) / kg * cScale)
+	m.cbB = fixed(2 * (1 - kb) * cScale)
+	return m
+}
+
+// IsJpeg reports whether the matrix is the full range BT.601 one that
+// image.YCbCr and color.YCbCrToRGB implement.
+func (m Matrix) IsJpeg() bool {
+	return m.jpeg
+}
+
+// Encoding returns the Y'CbCr encoding, with the default resolved.
+func (m Matrix) Encoding() v4l2.YcbcrEncoding {
+	return m.encoding
+}
+
+// Quantization returns the quantization range, with the default resolved.
+func (m Matrix) Quantization() v4l2.Quantization {
+	return m.quantization
+}
+
+func (m Matrix) RGB(y, cb, cr uint8) (uint8, uint8, uint8) {
+	yy := (int32(y)-m.yOffset)*m.yScale + 1<<15
+	u := int32(cb) - 128
+	v := int32(cr) - 128
+	return clamp((yy + m.crR*v) >> 16),
+		clamp((yy - m.cbG*u - m.crG*v) >> 16),
+		clamp((yy + m.cbB*u) >> 16)
+}
+
+func clamp(x int32) uint8 {
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return uint8(x)
+}
+
+// RGBA converts img to RGB with the matrix instead of the one image.YCbCr
+// assumes.
+func (m Matrix) RGBA(img *image.YCbCr) *image.RGBA {
+	r := img.Rect
+	dst := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		p := dst.Pix[(y-r.Min.Y)*dst.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.COffset(x, y)
+			red, green, blue := m.RGB(img.Y[img.YOffset(x, y)], img.Cb[c], img.Cr[c])
+			i := (x - r.Min.X) * 4
+			p[i+0] = red
+			p[i+1] = green
+			p[i+2] = blue
+			p[i+3] = 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,118 @@
+package demosaic
+
+import "image"
+
+type Algorithm uint8
+
+const (
+	// Algorithm_Bilinear averages the nearest samples of each colour.
+	Algorithm_Bilinear Algorithm = iota
+	// Algorithm_Malvar corrects the bilinear estimate with the gradient of
+	// the known colour (Malvar, He and Cutler, "High-quality linear
+	// interpolation for demosaicing of Bayer-patterned color images",
+	// ICASSP 2004), which greatly reduces colour fringes at edges.
+	Algorithm_Malvar
+)
+
+// Demosaic interpolates the missing colours of every pixel. Samples are
+// scaled to 16 bits.
+func (r *Raw) Demosaic(algorithm Algorithm) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, r.Width, r.Height))
+	interpolate := r.bilinear
+	if algorithm == Algorithm_Malvar {
+		interpolate = r.malvar
+	}
+	maximum := int32(r.Max())
+	for y := 0; y < r.Height; y++ {
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < r.Width; x++ {
+			rgb := interpolate(x, y)
+			p := dst[x*8 : x*8+8]
+			for i, v := range rgb {
+				if v < 0 {
+					v = 0
+				} else if v > maximum {
+					v = maximum
+				}
+				v16 := r.scale(uint16(v))
+				p[i*2] = uint8(v16 >> 8)
+				p[i*2+1] = uint8(v16)
+			}
+			p[6] = 0xff
+			p[7] = 0xff
+		}
+	}
+	return img
+}
+
+// scale expands a sample to 16 bits, replicating its high bits into the
+// low ones so that the maximum maps to 0xffff.
+func (r *Raw) scale(v uint16) uint16 {
+	if r.Bits >= 16 {
+		return v
+	}
+	return v<<(16-r.Bits) | v>>(2*r.Bits-16)
+}
+
+// neighbours sums samples around (x, y): the four at distance one along the
+// axes, the four diagonal ones, and the four at distance two along the
+// horizontal and vertical axis.
+type neighbours struct {
+	c            int32
+	h1, v1, diag int32
+	h2, v2       int32
+}
+
+func (r *Raw) neighbours(x, y int) neighbours {
+	return neighbours{
+		c:    r.at(x, y),
+		h1:   r.at(x-1, y) + r.at(x+1, y),
+		v1:   r.at(x, y-1) + r.at(x, y+1),
+		diag: r.at(x-1, y-1) + r.at(x+1, y-1) + r.at(x-1, y+1) + r.at(x+1, y+1),
+		h2:   r.at(x-2, y) + r.at(x+2, y),
+		v2:   r.at(x, y-2) + r.at(x, y+2),
+	}
+}
+
+// place stores the known sample and the two estimates in RGB order.
+// horizontal is the estimate for the colour of the horizontal neighbours
+// of a green pixel, or the green estimate at red and blue pixels.
+func (r *Raw) place(x, y int, c, horizontal, vertical int32) [3]int32 {
+	var rgb [3]int32
+	switch known := r.color(x, y); known {
+	case green:
+		rgb[green] = c
+		if r.color(x+1, y) == red {
+			rgb[red], rgb[blue] = horizontal, vertical
+		} else {
+			rgb[blue], rgb[red] = horizontal, vertical
+		}
+	default:
+		rgb[known] = c
+		rgb[green] = horizontal
+		rgb[2-known] = vertical
+	}
+	return rgb
+}
+
+func (r *Raw) bilinear(x, y int) [3]int32 {
+	n := r.neighbours(x, y)
+	if r.color(x, y) == green {
+		return r.place(x, y, n.c, (n.h1+1)/2, (n.v1+1)/2)
+	}
+	return r.place(x, y, n.c, (n.h1+n.v1+2)/4, (n.diag+2)/4)
+}
+
+// malvar applies the 5x5 filters of the paper, with weights doubled to
+// keep them integral.
+func (r *Raw) malvar(x, y int) [3]int32 {
+	n := r.neighbours(x, y)
+	if r.color(x, y) == green {
+		h := 10*n.c + 8*n.h1 - 2*n.h2 - 2*n.diag + n.v2
+		v := 10*n.c + 8*n.v1 - 2*n.v2 - 2*n.diag + n.h2
+		return r.place(x, y, n.c, (h+8)>>4, (v+8)>>4)
+	}
+	g := 8*n.c + 4*(n.h1+n.v1) - 2*(n.h2+n.v2)
+	opposite := 12*n.c + 4*n.diag - 3*(n.h2+n.v2)
+	return r.place(x, y, n.c, (g+8)>>4, (opposite+8)>>4)
+}
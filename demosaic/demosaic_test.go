@@ -0,0 +1,192 @@
+package demosaic
+
+import (
+	"testing"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+func TestUnpack(t *testing.T) {
+	tests := []struct {
+		format v4l2.PixFmt
+		width  int
+		row    []byte
+		want   []uint16
+	}{
+		{
+			v4l2.PixFmt_Srggb8, 3,
+			[]byte{0x00, 0x7f, 0xff},
+			[]uint16{0x00, 0x7f, 0xff},
+		},
+		{
+			// The high bits above 10 are masked.
+			v4l2.PixFmt_Srggb10, 2,
+			[]byte{0xff, 0x03, 0x34, 0xfe},
+			[]uint16{0x3ff, 0x234},
+		},
+		{
+			// A group of 4 and a partial group of 2.
+			v4l2.PixFmt_Srggb10P, 6,
+			[]byte{0xff, 0x00, 0xaa, 0x55, 0x67, 0x48, 0xff, 0x00, 0x00, 0x0b},
+			[]uint16{0x3ff, 0x001, 0x2aa, 0x155, 0x123, 0x3fe},
+		},
+		{
+			v4l2.PixFmt_Sbggr12P, 3,
+			[]byte{0xab, 0x12, 0x3c, 0xff, 0x00, 0x0f},
+			[]uint16{0xabc, 0x123, 0xfff},
+		},
+		{
+			v4l2.PixFmt_Sgbrg14P, 5,
+			[]byte{0xff, 0x00, 0xaa, 0x55, 0x7f, 0xc0, 0x57, 0x3f, 0x00, 0x00, 0x00, 0x2d, 0x00, 0x00},
+			[]uint16{0x3fff, 0x0001, 0x2abc, 0x1555, 0x0fed},
+		},
+	}
+	for _, test := range tests {
+		rf, _ := LookupRawFormat(test.format)
+		if size := rf.RowSize(test.width); size != len(test.row) {
+			t.Errorf("%v: row size %d, want %d", test.format, size, len(test.row))
+		}
+		// Two rows with a stride larger than the row.
+		stride := len(test.row) + 3
+		data := make([]byte, stride+len(test.row))
+		copy(data, test.row)
+		copy(data[stride:], test.row)
+		format := &v4l2.PixFormat{
+			Width:        uint32(test.width),
+			Height:       2,
+			PixelFormat:  test.format,
+			BytesPerLine: uint32(stride),
+		}
+		raw, err := Unpack(format, data)
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+		if raw.Pattern != rf.Pattern || raw.Bits != rf.Bits {
+			t.Errorf("%v: pattern %v, %d bits", test.format, raw.Pattern, raw.Bits)
+		}
+		for i, v := range raw.Pix {
+			if want := test.want[i%test.width]; v != want {
+				t.Errorf("%v: sample %d is %#x, want %#x", test.format, i, v, want)
+			}
+		}
+		if _, err := Unpack(format, data[:len(data)-1]); err != ErrShortData {
+			t.Errorf("%v: short frame: %v", test.format, err)
+		}
+	}
+	if _, err := Unpack(&v4l2.PixFormat{PixelFormat: v4l2.PixFmt_Yuyv}, nil); err != ErrUnsupported {
+		t.Errorf("YUYV: %v", err)
+	}
+}
+
+// flatRaw returns a frame in which each colour has a constant value.
+func flatRaw(pattern Pattern, bits uint, rgb [3]uint16) *Raw {
+	r := &Raw{Width: 8, Height: 6, Pattern: pattern, Bits: bits}
+	r.Pix = make([]uint16, r.Width*r.Height)
+	for y := 0; y < r.Height; y++ {
+		for x := 0; x < r.Width; x++ {
+			r.Pix[y*r.Width+x] = rgb[r.color(x, y)]
+		}
+	}
+	return r
+}
+
+func TestDemosaicFlat(t *testing.T) {
+	rgb := [3]uint16{0x123, 0xfff, 0x040}
+	for _, pattern := range []Pattern{Pattern_Rggb, Pattern_Bggr, Pattern_Grbg, Pattern_Gbrg} {
+		for _, algorithm := range []Algorithm{Algorithm_Bilinear, Algorithm_Malvar} {
+			r := flatRaw(pattern, 12, rgb)
+			img := r.Demosaic(algorithm)
+			for y := 0; y < r.Height; y++ {
+				for x := 0; x < r.Width; x++ {
+					c := img.RGBA64At(x, y)
+					if c.R != r.scale(rgb[red]) || c.G != 0xffff || c.B != r.scale(rgb[blue]) || c.A != 0xffff {
+						t.Fatalf("%v, algorithm %d: pixel %d,%d is %v", pattern, algorithm, x, y, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		bits uint
+		v    uint16
+		want uint16
+	}{
+		{8, 0xff, 0xffff},
+		{8, 0x80, 0x8080},
+		{10, 0x3ff, 0xffff},
+		{10, 0x200, 0x8020},
+		{14, 0x3fff, 0xffff},
+		{16, 0x1234, 0x1234},
+	}
+	for _, test := range tests {
+		r := &Raw{Bits: test.bits}
+		if got := r.scale(test.v); got != test.want {
+			t.Errorf("%d bits: %#x scaled to %#x, want %#x", test.bits, test.v, got, test.want)
+		}
+	}
+}
+
+func TestSubtractBlack(t *testing.T) {
+	r := &Raw{Width: 5, Height: 1, Bits: 10, Pix: []uint16{0, 64, 65, 544, 1023}}
+	r.SubtractBlack(64)
+	want := []uint16{0, 0, 1, 512, 1023}
+	for i, v := range r.Pix {
+		if v != want[i] {
+			t.Errorf("sample %d is %d, want %d", i, v, want[i])
+		}
+	}
+	// A level at the maximum is ignored.
+	r.SubtractBlack(1023)
+	if r.Pix[3] != 512 {
+		t.Errorf("level at the maximum changed %d", r.Pix[3])
+	}
+}
+
+func TestGains(t *testing.T) {
+	r := flatRaw(Pattern_Grbg, 10, [3]uint16{100, 200, 600})
+	if gains := r.GrayWorld(); gains != [3]float64{2, 1, 200.0 / 600} {
+		t.Errorf("grey world gains %v", gains)
+	}
+	r.ApplyGains([3]float64{2.5, 1, 2})
+	for y := 0; y < r.Height; y++ {
+		for x := 0; x < r.Width; x++ {
+			// Blue clips at the maximum.
+			want := [3]uint16{250, 200, 1023}[r.color(x, y)]
+			if v := r.Pix[y*r.Width+x]; v != want {
+				t.Fatalf("sample %d,%d is %d, want %d", x, y, v, want)
+			}
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	// RGGB 10-bit in 16-bit words, with a black level of 64.
+	format := &v4l2.PixFormat{Width: 4, Height: 4, PixelFormat: v4l2.PixFmt_Srggb10}
+	data := make([]byte, 4*4*2)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			v := [4]uint16{303, 543, 543, 64}[(y&1)*2+x&1]
+			data[(y*4+x)*2] = byte(v)
+			data[(y*4+x)*2+1] = byte(v >> 8)
+		}
+	}
+	// Zero gains count as 1.
+	img, err := Image(format, data, &Options{BlackLevel: 64, Gains: [3]float64{2, 0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Red stretches to 255, doubles to 510, green to 511 and blue to 0.
+	r := &Raw{Bits: 10}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := img.RGBA64At(x, y)
+			if c.R != r.scale(510) || c.G != r.scale(511) || c.B != 0 {
+				t.Fatalf("pixel %d,%d is %v", x, y, c)
+			}
+		}
+	}
+}
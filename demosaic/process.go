@@ -0,0 +1,147 @@
+package demosaic
+
+import (
+	"image"
+	"math"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// Options control the conversion done by Image.
+type Options struct {
+	Algorithm Algorithm
+	// BlackLevel is subtracted from every sample, in units of the raw
+	// format. Sensors usually report it in a control or their datasheet.
+	BlackLevel uint16
+	// Gains multiply the red, green and blue samples. A zero gain leaves
+	// its samples unchanged. Gains are ignored if AutoWhiteBalance is set.
+	Gains            [3]float64
+	AutoWhiteBalance bool
+	// Gamma encodes the linear sensor output for display, 2.2 is typical.
+	// Zero leaves the output linear.
+	Gamma float64
+}
+
+// Image unpacks and demosaics a raw frame.
+func Image(format *v4l2.PixFormat, data []byte, options *Options) (*image.RGBA64, error) {
+	raw, err := Unpack(format, data)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &Options{}
+	}
+	if options.BlackLevel != 0 {
+		raw.SubtractBlack(options.BlackLevel)
+	}
+	gains := options.Gains
+	if options.AutoWhiteBalance {
+		gains = raw.GrayWorld()
+	} else {
+		for c, g := range gains {
+			if g == 0 {
+				gains[c] = 1
+			}
+		}
+	}
+	if gains != [3]float64{1, 1, 1} {
+		raw.ApplyGains(gains)
+	}
+	img := raw.Demosaic(options.Algorithm)
+	if options.Gamma != 0 {
+		ApplyGamma(img, options.Gamma)
+	}
+	return img, nil
+}
+
+// SubtractBlack subtracts the black level from every sample and stretches
+// the remaining range back to the full range of the format.
+func (r *Raw) SubtractBlack(level uint16) {
+	maximum := uint32(r.Max())
+	if uint32(level) >= maximum {
+		return
+	}
+	span := maximum - uint32(level)
+	for i, v := range r.Pix {
+		if v <= level {
+			r.Pix[i] = 0
+			continue
+		}
+		r.Pix[i] = uint16((uint32(v-level)*maximum + span/2) / span)
+	}
+}
+
+// GrayWorld estimates white balance gains assuming that the scene averages
+// to grey. Green is the reference and keeps a gain of 1.
+func (r *Raw) GrayWorld() [3]float64 {
+	var sum [3]float64
+	var count [3]int
+	for y := 0; y < r.Height; y++ {
+		row := r.Pix[y*r.Width : (y+1)*r.Width]
+		for x, v := range row {
+			c := r.color(x, y)
+			sum[c] += float64(v)
+			count[c]++
+		}
+	}
+	gains := [3]float64{1, 1, 1}
+	if count[green] == 0 || sum[green] == 0 {
+		return gains
+	}
+	meanGreen := sum[green] / float64(count[green])
+	for _, c := range []int{red, blue} {
+		if sum[c] > 0 {
+			gains[c] = meanGreen / (sum[c] / float64(count[c]))
+		}
+	}
+	return gains
+}
+
+// ApplyGains multiplies the samples of each colour by its gain, clipping
+// at the maximum sample value.
+func (r *Raw) ApplyGains(gains [3]float64) {
+	// 8.8 fixed point
+	var fixed [3]uint32
+	for c, g := range gains {
+		if g < 0 {
+			g = 0
+		} else if g > 255 {
+			g = 255
+		}
+		fixed[c] = uint32(g*256 + 0.5)
+	}
+	limit := uint32(r.Max())
+	for y := 0; y < r.Height; y++ {
+		row := r.Pix[y*r.Width : (y+1)*r.Width]
+		for x, v := range row {
+			scaled := (uint32(v)*fixed[r.color(x, y)] + 128) >> 8
+			if scaled > limit {
+				scaled = limit
+			}
+			row[x] = uint16(scaled)
+		}
+	}
+}
+
+// ApplyGamma applies a power law to the colour channels of img.
+func ApplyGamma(img *image.RGBA64, gamma float64) {
+	// 12 bits of the 16 are enough for a lookup table that is smooth in
+	// 8-bit output.
+	var table [4097]uint16
+	for i := range table {
+		table[i] = uint16(math.Pow(float64(i)/4096, 1/gamma)*65535 + 0.5)
+	}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*8]
+		for i := 0; i < len(row); i += 8 {
+			for c := 0; c < 6; c += 2 {
+				v := uint32(row[i+c])<<8 | uint32(row[i+c+1])
+				// Interpolate between the two nearest entries.
+				lo, frac := v>>4, v&0xf
+				out := (uint32(table[lo])*(16-frac) + uint32(table[lo+1])*frac + 8) >> 4
+				row[i+c] = uint8(out >> 8)
+				row[i+c+1] = uint8(out)
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package demosaic converts raw Bayer frames from image sensors to RGB.
+package demosaic
+
+import (
+	"errors"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrUnsupported = errors.New("demosaic: unsupported pixel format")
+	ErrShortData   = errors.New("demosaic: frame smaller than its format")
+)
+
+// Pattern is the arrangement of the colour filter array, named after the
+// colours of the top left 2x2 block in raster order.
+type Pattern uint8
+
+const (
+	Pattern_Rggb Pattern = iota
+	Pattern_Bggr
+	Pattern_Grbg
+	Pattern_Gbrg
+)
+
+const (
+	red = iota
+	green
+	blue
+)
+
+var patternColors = [...][4]uint8{
+	Pattern_Rggb: {red, green, green, blue},
+	Pattern_Bggr: {blue, green, green, red},
+	Pattern_Grbg: {green, red, blue, green},
+	Pattern_Gbrg: {green, blue, red, green},
+}
+
+func (p Pattern) String() string {
+	const names = "RGB"
+	c := patternColors[p]
+	return string([]byte{names[c[0]], names[c[1]], names[c[2]], names[c[3]]})
+}
+
+// Packing is the layout of samples in memory.
+type Packing uint8
+
+const (
+	Packing_8Bit  Packing = iota // one byte per sample
+	Packing_16Bit                // little endian 16-bit words
+	Packing_Mipi                 // MIPI CSI-2 RAW10/12/14 packing
+)
+
+// RawFormat describes a Bayer pixel format.
+type RawFormat struct {
+	Pattern Pattern
+	Bits    uint
+	Packing Packing
+}
+
+var rawFormats = map[v4l2.PixFmt]RawFormat{
+	v4l2.PixFmt_Srggb8:   {Pattern_Rggb, 8, Packing_8Bit},
+	v4l2.PixFmt_Sbggr8:   {Pattern_Bggr, 8, Packing_8Bit},
+	v4l2.PixFmt_Sgrbg8:   {Pattern_Grbg, 8, Packing_8Bit},
+	v4l2.PixFmt_Sgbrg8:   {Pattern_Gbrg, 8, Packing_8Bit},
+	v4l2.PixFmt_Srggb10:  {Pattern_Rggb, 10, Packing_16Bit},
+	v4l2.PixFmt_Sbggr10:  {Pattern_Bggr, 10, Packing_16Bit},
+	v4l2.PixFmt_Sgrbg10:  {Pattern_Grbg, 10, Packing_16Bit},
+	v4l2.PixFmt_Sgbrg10:  {Pattern_Gbrg, 10, Packing_16Bit},
+	v4l2.PixFmt_Srggb12:  {Pattern_Rggb, 12, Packing_16Bit},
+	v4l2.PixFmt_Sbggr12:  {Pattern_Bggr, 12, Packing_16Bit},
+	v4l2.PixFmt_Sgrbg12:  {Pattern_Grbg, 12, Packing_16Bit},
+	v4l2.PixFmt_Sgbrg12:  {Pattern_Gbrg, 12, Packing_16Bit},
+	v4l2.PixFmt_Srggb16:  {Pattern_Rggb, 16, Packing_16Bit},
+	v4l2.PixFmt_Sbggr16:  {Pattern_Bggr, 16, Packing_16Bit},
+	v4l2.PixFmt_Sgrbg16:  {Pattern_Grbg, 16, Packing_16Bit},
+	v4l2.PixFmt_Sgbrg16:  {Pattern_Gbrg, 16, Packing_16Bit},
+	v4l2.PixFmt_Srggb10P: {Pattern_Rggb, 10, Packing_Mipi},
+	v4l2.PixFmt_Sbggr10P: {Pattern_Bggr, 10, Packing_Mipi},
+	v4l2.PixFmt_Sgrbg10P: {Pattern_Grbg, 10, Packing_Mipi},
+	v4l2.PixFmt_Sgbrg10P: {Pattern_Gbrg, 10, Packing_Mipi},
+	v4l2.PixFmt_Srggb12P: {Pattern_Rggb, 12, Packing_Mipi},
+	v4l2.PixFmt_Sbggr12P: {Pattern_Bggr, 12, Packing_Mipi},
+	v4l2.PixFmt_Sgrbg12P: {Pattern_Grbg, 12, Packing_Mipi},
+	v4l2.PixFmt_Sgbrg12P: {Pattern_Gbrg, 12, Packing_Mipi},
+	v4l2.PixFmt_Srggb14P: {Pattern_Rggb, 14, Packing_Mipi},
+	v4l2.PixFmt_Sbggr14P: {Pattern_Bggr, 14, Packing_Mipi},
+	v4l2.PixFmt_Sgrbg14P: {Pattern_Grbg, 14, Packing_Mipi},
+	v4l2.PixFmt_Sgbrg14P: {Pattern_Gbrg, 14, Packing_Mipi},
+}
+
+func LookupRawFormat(f v4l2.PixFmt) (RawFormat, bool) {
+	format, ok := rawFormats[f]
+	return format, ok
+}
+
+// group returns the number of samples packed together and their size in
+// bytes.
+func (f RawFormat) group() (int, int) {
+	switch f.Packing {
+	case Packing_8Bit:
+		return 1, 1
+	case Packing_16Bit:
+		return 1, 2
+	}
+	switch f.Bits {
+	case 12:
+		return 2, 3
+	case 14:
+		return 4, 7
+	default:
+		return 4, 5
+	}
+}
+
+// RowSize returns the minimum number of bytes of a row of width samples.
+func (f RawFormat) RowSize(width int) int {
+	samples, size := f.group()
+	return (width + samples - 1) / samples * size
+}
+
+// Raw is an unpacked Bayer frame, one sample per pixel in raster order.
+type Raw struct {
+	Width   int
+	Height  int
+	Pattern Pattern
+	Bits    uint
+	Pix     []uint16
+}
+
+// Unpack unpacks a raw frame, honouring the stride in BytesPerLine.
+func Unpack(format *v4l2.PixFormat, data []byte) (*Raw, error) {
+	rf, ok := rawFormats[format.PixelFormat]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	width, height := int(format.Width), int(format.Height)
+	rowSize := rf.RowSize(width)
+	stride := int(format.BytesPerLine)
+	if stride == 0 {
+		stride = rowSize
+	}
+	if height > 0 && (stride < rowSize || len(data) < (height-1)*stride+rowSize) {
+		return nil, ErrShortData
+	}
+	raw := &Raw{
+		Width:   width,
+		Height:  height,
+		Pattern: rf.Pattern,
+		Bits:    rf.Bits,
+		Pix:     make([]uint16, width*height),
+	}
+	for y := 0; y < height; y++ {
+		src := data[y*stride : y*stride+rowSize]
+		dst := raw.Pix[y*width : (y+1)*width]
+		switch rf.Packing {
+		case Packing_8Bit:
+			for x := range dst {
+				dst[x] = uint16(src[x])
+			}
+		case Packing_16Bit:
+			mask := uint16(1<<rf.Bits - 1)
+			for x := range dst {
+				dst[x] = (uint16(src[x*2]) | uint16(src[x*2+1])<<8) & mask
+			}
+		case Packing_Mipi:
+			unpackMipi(dst, src, rf.Bits)
+		}
+	}
+	return raw, nil
+}
+
+// unpackMipi unpacks one row of CSI-2 packed samples. Each group stores the
+// 8 most significant bits of its samples in one byte each, followed by the
+// remaining low bits of all samples, first sample in the least
+// significant bits.
+func unpackMipi(dst []uint16, src []byte, bits uint) {
+	low := bits - 8
+	samples, size := RawFormat{Bits: bits, Packing: Packing_Mipi}.group()
+	for x := 0; x < len(dst); x += samples {
+		g := src[x/samples*size:]
+		var lowBits uint64
+		for i := size - 1; i >= samples; i-- {
+			lowBits = lowBits<<8 | uint64(g[i])
+		}
+		for i := 0; i < samples && x+i < len(dst); i++ {
+			dst[x+i] = uint16(g[i])<<low | uint16(lowBits>>(uint(i)*low))&(1<<low-1)
+		}
+	}
+}
+
+// color returns the colour of the filter above pixel (x, y).
+func (r *Raw) color(x, y int) uint8 {
+	return patternColors[r.Pattern][(y&1)*2+(x&1)]
+}
+
+// at returns the sample at (x, y), mirroring coordinates outside the frame
+// so that the colour of the pixel is preserved.
+func (r *Raw) at(x, y int) int32 {
+	x = mirror(x, r.Width)
+	y = mirror(y, r.Height)
+	return int32(r.Pix[y*r.Width+x])
+}
+
+func mirror(i, n int) int {
+	if i < 0 {
+		i = -i
+	} else if i >= n {
+		i = 2*(n-1) - i
+	}
+	if i < 0 || i >= n {
+		// Frames smaller than the filter kernels.
+		if i < 0 {
+			return 0
+		}
+		return n - 1
+	}
+	return i
+}
+
+// Max returns the largest sample value.
+func (r *Raw) Max() uint16 {
+	return uint16(1<<r.Bits - 1)
+}
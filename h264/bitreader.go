@@ -0,0 +1,71 @@
+package h264
+
+import "errors"
+
+var ErrShortData = errors.New("h264: unexpected end of data")
+
+// bitReader reads the syntax elements of an RBSP, most significant bit
+// first.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = ErrShortData
+			return 0
+		}
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.u(1) == 1
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros == 32 {
+			r.err = ErrShortData
+			return 0
+		}
+		zeros++
+	}
+	return 1<<uint(zeros) - 1 + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v&1 == 1 {
+		return int32(v/2 + 1)
+	}
+	return -int32(v / 2)
+}
+
+// moreRbspData reports whether data remains before the rbsp_trailing_bits.
+func (r *bitReader) moreRbspData() bool {
+	last := len(r.data) - 1
+	for last >= 0 && r.data[last] == 0 {
+		last--
+	}
+	if last < 0 {
+		return false
+	}
+	b := r.data[last]
+	stop := last*8 + 7
+	for b&1 == 0 {
+		b >>= 1
+		stop--
+	}
+	return r.pos < stop
+}
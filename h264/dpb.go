@@ -0,0 +1,448 @@
+package h264
+
+import (
+	"sort"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// DpbEntry is a frame used for reference.
+type DpbEntry struct {
+	Timestamp           uint64 // of the CAPTURE buffer holding the frame, in nanoseconds
+	FrameNum            uint32
+	LongTerm            bool
+	LongTermFrameIdx    uint32
+	TopFieldOrderCnt    int32
+	BottomFieldOrderCnt int32
+
+	picNum int32 // relative to the current picture
+}
+
+func (e *DpbEntry) poc() int32 {
+	if e.TopFieldOrderCnt < e.BottomFieldOrderCnt {
+		return e.TopFieldOrderCnt
+	}
+	return e.BottomFieldOrderCnt
+}
+
+// Dpb tracks the reference frames and picture order count state of a
+// stream, following 8.2.1 and 8.2.5. Only frame pictures are supported and
+// gaps in frame_num are not filled in.
+type Dpb struct {
+	Entries []*DpbEntry
+
+	maxLongTermFrameIdx int32 // -1 for no long-term frame indices
+
+	prevPocMsb         int32
+	prevPocLsb         int32
+	prevFrameNum       uint32
+	prevFrameNumOffset int32
+}
+
+// Reset drops all reference frames.
+func (d *Dpb) Reset() {
+	*d = Dpb{maxLongTermFrameIdx: -1}
+}
+
+// References returns the timestamps of the frames still used for
+// reference. Their CAPTURE buffers must not be overwritten.
+func (d *Dpb) References() []uint64 {
+	ts := make([]uint64, len(d.Entries))
+	for i, e := range d.Entries {
+		ts[i] = e.Timestamp
+	}
+	return ts
+}
+
+// picOrderCnt derives TopFieldOrderCnt and BottomFieldOrderCnt of a frame.
+func (d *Dpb) picOrderCnt(h *SliceHeader, sps *Sps) (top, bottom int32, frameNumOffset int32) {
+	if sps.PicOrderCntType == 0 {
+		if h.Idr {
+			d.prevPocMsb, d.prevPocLsb = 0, 0
+		}
+		lsb := int32(h.PicOrderCntLsb)
+		max := int32(sps.MaxPicOrderCntLsb())
+		msb := d.prevPocMsb
+		switch {
+		case lsb < d.prevPocLsb && d.prevPocLsb-lsb >= max/2:
+			msb += max
+		case lsb > d.prevPocLsb && lsb-d.prevPocLsb > max/2:
+			msb -= max
+		}
+		top = msb + lsb
+		return top, top + h.DeltaPicOrderCntBottom, 0
+	}
+
+	maxFrameNum := int32(sps.MaxFrameNum())
+	switch {
+	case h.Idr:
+		frameNumOffset = 0
+	case d.prevFrameNum > h.FrameNum:
+		frameNumOffset = d.prevFrameNumOffset + maxFrameNum
+	default:
+		frameNumOffset = d.prevFrameNumOffset
+	}
+
+	if sps.PicOrderCntType == 2 {
+		var poc int32
+		switch {
+		case h.Idr:
+			poc = 0
+		case h.NalRefIdc == 0:
+			poc = 2*(frameNumOffset+int32(h.FrameNum)) - 1
+		default:
+			poc = 2 * (frameNumOffset + int32(h.FrameNum))
+		}
+		return poc, poc, frameNumOffset
+	}
+
+	n := int32(len(sps.OffsetForRefFrame))
+	var absFrameNum int32
+	if n != 0 {
+		absFrameNum = frameNumOffset + int32(h.FrameNum)
+	}
+	if h.NalRefIdc == 0 && absFrameNum > 0 {
+		absFrameNum--
+	}
+	var expected int32
+	if absFrameNum > 0 {
+		var delta int32
+		for _, offset := range sps.OffsetForRefFrame {
+			delta += offset
+		}
+		cycle := (absFrameNum - 1) / n
+		inCycle := (absFrameNum - 1) % n
+		expected = cycle * delta
+		for i := int32(0); i <= inCycle; i++ {
+			expected += sps.OffsetForRefFrame[i]
+		}
+	}
+	if h.NalRefIdc == 0 {
+		expected += sps.OffsetForNonRefPic
+	}
+	top = expected + h.DeltaPicOrderCnt[0]
+	bottom = top + sps.OffsetForTopToBottomField + h.DeltaPicOrderCnt[1]
+	return top, bottom, frameNumOffset
+}
+
+// updatePicNums derives PicNum of the short-term references for a picture
+// with the given frame_num.
+func (d *Dpb) updatePicNums(frameNum uint32, sps *Sps) {
+	for _, e := range d.Entries {
+		switch {
+		case e.LongTerm:
+			e.picNum = int32(e.LongTermFrameIdx)
+		case e.FrameNum > frameNum:
+			e.picNum = int32(e.FrameNum) - int32(sps.MaxFrameNum())
+		default:
+			e.picNum = int32(e.FrameNum)
+		}
+	}
+}
+
+// DecodeParams returns the V4L2_CID_STATELESS_H264_DECODE_PARAMS payload
+// for the picture started by h, whose order counts are top and bottom.
+func (d *Dpb) DecodeParams(h *SliceHeader, top, bottom int32) v4l2.CtrlH264DecodeParams {
+	c := v4l2.CtrlH264DecodeParams{
+		NalRefIdc:               uint16(h.NalRefIdc),
+		FrameNum:                uint16(h.FrameNum),
+		TopFieldOrderCnt:        top,
+		BottomFieldOrderCnt:     bottom,
+		IdrPicId:                uint16(h.IdrPicId),
+		PicOrderCntLsb:          uint16(h.PicOrderCntLsb),
+		DeltaPicOrderCntBottom:  h.DeltaPicOrderCntBottom,
+		DeltaPicOrderCnt0:       h.DeltaPicOrderCnt[0],
+		DeltaPicOrderCnt1:       h.DeltaPicOrderCnt[1],
+		DecRefPicMarkingBitSize: h.DecRefPicMarkingBitSize,
+		PicOrderCntBitSize:      h.PicOrderCntBitSize,
+		SliceGroupChangeCycle:   h.SliceGroupChangeCycle,
+	}
+	if h.Idr {
+		c.Flags |= v4l2.H264DecodeParamFlag_IdrPic
+	}
+	switch h.Type {
+	case SliceType_P, SliceType_Sp:
+		c.Flags |= v4l2.H264DecodeParamFlag_Pframe
+	case SliceType_B:
+		c.Flags |= v4l2.H264DecodeParamFlag_Bframe
+	}
+	for i, e := range d.Entries {
+		if i == v4l2.H264NumDpbEntries {
+			break
+		}
+		entry := &c.Dpb[i]
+		entry.ReferenceTs = e.Timestamp
+		entry.PicNum = uint32(e.picNum)
+		entry.FrameNum = uint16(e.FrameNum)
+		entry.Fields = v4l2.H264FrameRef
+		entry.TopFieldOrderCnt = e.TopFieldOrderCnt
+		entry.BottomFieldOrderCnt = e.BottomFieldOrderCnt
+		entry.Flags = v4l2.H264DpbEntryFlag_Valid | v4l2.H264DpbEntryFlag_Active
+		if e.LongTerm {
+			entry.FrameNum = uint16(e.LongTermFrameIdx)
+			entry.Flags |= v4l2.H264DpbEntryFlag_LongTerm
+		}
+	}
+	return c
+}
+
+// RefPicLists builds the reference picture lists of a slice of the current
+// picture as indices into Entries, following 8.2.4.
+func (d *Dpb) RefPicLists(h *SliceHeader, sps *Sps, poc int32) (list0, list1 []int) {
+	var short, long []int
+	for i, e := range d.Entries {
+		if e.LongTerm {
+			long = append(long, i)
+		} else {
+			short = append(short, i)
+		}
+	}
+	sort.SliceStable(long, func(a, b int) bool {
+		return d.Entries[long[a]].picNum < d.Entries[long[b]].picNum
+	})
+
+	switch h.Type {
+	case SliceType_P, SliceType_Sp:
+		sort.SliceStable(short, func(a, b int) bool {
+			return d.Entries[short[a]].picNum > d.Entries[short[b]].picNum
+		})
+		list0 = append(short, long...)
+	case SliceType_B:
+		var before, after []int
+		for _, i := range short {
+			if d.Entries[i].poc() < poc {
+				before = append(before, i)
+			} else {
+				after = append(after, i)
+			}
+		}
+		sort.SliceStable(before, func(a, b int) bool {
+			return d.Entries[before[a]].poc() > d.Entries[before[b]].poc()
+		})
+		sort.SliceStable(after, func(a, b int) bool {
+			return d.Entries[after[a]].poc() < d.Entries[after[b]].poc()
+		})
+		list0 = append(append(append([]int{}, before...), after...), long...)
+		list1 = append(append(append([]int{}, after...), before...), long...)
+		if len(list1) > 1 && equalLists(list0, list1) {
+			list1[0], list1[1] = list1[1], list1[0]
+		}
+	default:
+		return nil, nil
+	}
+
+	list0 = d.modifyRefPicList(list0, h.RefPicListModification[0], int(h.NumRefIdxL0ActiveMinus1)+1, h.FrameNum, sps)
+	if h.Type == SliceType_B {
+		list1 = d.modifyRefPicList(list1, h.RefPicListModification[1], int(h.NumRefIdxL1ActiveMinus1)+1, h.FrameNum, sps)
+	}
+	return list0, list1
+}
+
+func equalLists(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Dpb) modifyRefPicList(list []int, mods []RefPicListModification, active int, frameNum uint32, sps *Sps) []int {
+	if len(list) > active {
+		list = list[:active]
+	}
+	maxPicNum := int32(sps.MaxFrameNum())
+	currPicNum := int32(frameNum)
+	picNumPred := currPicNum
+	refIdx := 0
+	for _, m := range mods {
+		var long bool
+		var picNum int32
+		switch m.Idc {
+		case 0, 1:
+			var noWrap int32
+			if m.Idc == 0 {
+				noWrap = picNumPred - int32(m.AbsDiffPicNum)
+				if noWrap < 0 {
+					noWrap += maxPicNum
+				}
+			} else {
+				noWrap = picNumPred + int32(m.AbsDiffPicNum)
+				if noWrap >= maxPicNum {
+					noWrap -= maxPicNum
+				}
+			}
+			picNumPred = noWrap
+			picNum = noWrap
+			if picNum > currPicNum {
+				picNum -= maxPicNum
+			}
+		case 2:
+			long = true
+			picNum = int32(m.LongTermPicNum)
+		}
+		found := -1
+		for i, e := range d.Entries {
+			if e.LongTerm == long && e.picNum == picNum {
+				found = i
+				break
+			}
+		}
+		if found < 0 || refIdx >= active {
+			continue
+		}
+		// Insert at refIdx and drop the later copy of the same picture.
+		modified := append([]int{}, list[:refIdx]...)
+		modified = append(modified, found)
+		for _, i := range list[refIdx:] {
+			if i != found {
+				modified = append(modified, i)
+			}
+		}
+		list = modified
+		refIdx++
+	}
+	if len(list) > active {
+		list = list[:active]
+	}
+	return list
+}
+
+// mark applies the reference picture marking of a decoded picture and
+// updates the order count state, following 8.2.5.
+func (d *Dpb) mark(h *SliceHeader, sps *Sps, ts uint64, top, bottom, frameNumOffset int32) {
+	cur := &DpbEntry{
+		Timestamp:           ts,
+		FrameNum:            h.FrameNum,
+		TopFieldOrderCnt:    top,
+		BottomFieldOrderCnt: bottom,
+	}
+	mmco5 := false
+	if h.NalRefIdc != 0 {
+		switch {
+		case h.Idr:
+			d.Entries = nil
+			d.maxLongTermFrameIdx = -1
+			if h.LongTermReference {
+				cur.LongTerm = true
+				d.maxLongTermFrameIdx = 0
+			}
+		case h.AdaptiveRefPicMarking:
+			mmco5 = d.applyMmcos(h, sps, cur)
+		}
+		if !cur.LongTerm {
+			// Also guards against streams exceeding max_num_ref_frames
+			// with adaptive marking.
+			d.slidingWindow(sps)
+		}
+		d.Entries = append(d.Entries, cur)
+	}
+
+	if mmco5 {
+		poc := cur.poc()
+		cur.TopFieldOrderCnt -= poc
+		cur.BottomFieldOrderCnt -= poc
+		cur.FrameNum = 0
+		d.prevPocMsb = 0
+		d.prevPocLsb = cur.TopFieldOrderCnt
+		d.prevFrameNum = 0
+		d.prevFrameNumOffset = 0
+		return
+	}
+	if h.NalRefIdc != 0 && sps.PicOrderCntType == 0 {
+		d.prevPocMsb = top - int32(h.PicOrderCntLsb)
+		d.prevPocLsb = int32(h.PicOrderCntLsb)
+	}
+	d.prevFrameNum = h.FrameNum
+	d.prevFrameNumOffset = frameNumOffset
+}
+
+func (d *Dpb) slidingWindow(sps *Sps) {
+	max := int(sps.MaxNumRefFrames)
+	if max == 0 {
+		max = 1
+	}
+	for len(d.Entries) >= max {
+		oldest := -1
+		for i, e := range d.Entries {
+			if !e.LongTerm && (oldest < 0 || e.picNum < d.Entries[oldest].picNum) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			return
+		}
+		d.remove(oldest)
+	}
+}
+
+func (d *Dpb) remove(i int) {
+	d.Entries = append(d.Entries[:i], d.Entries[i+1:]...)
+}
+
+func (d *Dpb) find(long bool, picNum int32) int {
+	for i, e := range d.Entries {
+		if e.LongTerm == long && e.picNum == picNum {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Dpb) removeLongTermIdx(idx uint32) {
+	for i := 0; i < len(d.Entries); i++ {
+		if e := d.Entries[i]; e.LongTerm && e.LongTermFrameIdx == idx {
+			d.remove(i)
+			i--
+		}
+	}
+}
+
+// applyMmcos runs the memory management control operations of h and
+// reports whether they included operation 5.
+func (d *Dpb) applyMmcos(h *SliceHeader, sps *Sps, cur *DpbEntry) bool {
+	currPicNum := int32(h.FrameNum)
+	mmco5 := false
+	for _, m := range h.Mmcos {
+		switch m.Op {
+		case 1:
+			if i := d.find(false, currPicNum-int32(m.DifferenceOfPicNums)); i >= 0 {
+				d.remove(i)
+			}
+		case 2:
+			if i := d.find(true, int32(m.LongTermPicNum)); i >= 0 {
+				d.remove(i)
+			}
+		case 3:
+			i := d.find(false, currPicNum-int32(m.DifferenceOfPicNums))
+			if i < 0 {
+				continue
+			}
+			e := d.Entries[i]
+			d.removeLongTermIdx(m.LongTermFrameIdx)
+			e.LongTerm = true
+			e.LongTermFrameIdx = m.LongTermFrameIdx
+			e.picNum = int32(m.LongTermFrameIdx)
+		case 4:
+			d.maxLongTermFrameIdx = int32(m.MaxLongTermFrameIdxPlus1) - 1
+			for i := 0; i < len(d.Entries); i++ {
+				if e := d.Entries[i]; e.LongTerm && int32(e.LongTermFrameIdx) > d.maxLongTermFrameIdx {
+					d.remove(i)
+					i--
+				}
+			}
+		case 5:
+			d.Entries = nil
+			d.maxLongTermFrameIdx = -1
+			mmco5 = true
+		case 6:
+			d.removeLongTermIdx(m.LongTermFrameIdx)
+			cur.LongTerm = true
+			cur.LongTermFrameIdx = m.LongTermFrameIdx
+		}
+	}
+	return mmco5
+}
@@ -0,0 +1,124 @@
+package h264
+
+import "bytes"
+
+type NalType uint8
+
+const (
+	NalType_Slice        NalType = 1
+	NalType_SliceDpa     NalType = 2
+	NalType_SliceDpb     NalType = 3
+	NalType_SliceDpc     NalType = 4
+	NalType_SliceIdr     NalType = 5
+	NalType_Sei          NalType = 6
+	NalType_Sps          NalType = 7
+	NalType_Pps          NalType = 8
+	NalType_Aud          NalType = 9
+	NalType_EndSequence  NalType = 10
+	NalType_EndStream    NalType = 11
+	NalType_Filler       NalType = 12
+	NalType_SpsExt       NalType = 13
+	NalType_Prefix       NalType = 14
+	NalType_SubsetSps    NalType = 15
+	NalType_SliceAux     NalType = 19
+	NalType_SliceExt     NalType = 20
+	NalType_SliceExtView NalType = 21
+)
+
+// IsSlice reports whether the NAL unit holds slice data of the primary
+// coded picture.
+func (t NalType) IsSlice() bool {
+	return t == NalType_Slice || t == NalType_SliceIdr
+}
+
+// NalHeader is the first byte of a NAL unit.
+type NalHeader struct {
+	RefIdc uint8
+	Type   NalType
+}
+
+func ParseNalHeader(nal []byte) NalHeader {
+	if len(nal) == 0 {
+		return NalHeader{}
+	}
+	return NalHeader{
+		RefIdc: nal[0] >> 5 & 3,
+		Type:   NalType(nal[0] & 0x1f),
+	}
+}
+
+// Unescape removes the emulation prevention bytes of a NAL unit payload,
+// turning it into an RBSP.
+func Unescape(data []byte) []byte {
+	if bytes.Index(data, []byte{0, 0, 3}) < 0 {
+		return data
+	}
+	rbsp := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+// SplitAnnexB returns the NAL units of an Annex B byte stream without
+// their start codes.
+func SplitAnnexB(data []byte) [][]byte {
+	var nals [][]byte
+	for len(data) > 0 {
+		advance, nal, _ := ScanNalUnits(data, true)
+		if advance == 0 {
+			break
+		}
+		if nal != nil {
+			nals = append(nals, nal)
+		}
+		data = data[advance:]
+	}
+	return nals
+}
+
+// ScanNalUnits is a bufio.SplitFunc splitting an Annex B byte stream into
+// NAL units without start codes.
+func ScanNalUnits(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := bytes.Index(data, []byte{0, 0, 1})
+	if start < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		// Keep a possible partial start code.
+		if len(data) > 2 {
+			return len(data) - 2, nil, nil
+		}
+		return 0, nil, nil
+	}
+	start += 3
+	end := bytes.Index(data[start:], []byte{0, 0, 1})
+	if end < 0 {
+		if !atEOF {
+			return start - 3, nil, nil
+		}
+		end = len(data)
+	} else {
+		end += start
+	}
+	next := end
+	// Trailing zeros belong to the next start code (zero_byte) or are
+	// trailing_zero_8bits.
+	for end > start && data[end-1] == 0 {
+		end--
+	}
+	if end == start {
+		return next, nil, nil
+	}
+	return next, data[start:end], nil
+}
@@ -0,0 +1,201 @@
+package h264
+
+import "github.com/paskozdilar/go-v4l2/v4l2"
+
+// Slice is a slice NAL unit of a Picture with its controls.
+type Slice struct {
+	Nal         []byte // without start code
+	Header      *SliceHeader
+	Params      v4l2.CtrlH264SliceParams
+	PredWeights v4l2.CtrlH264PredWeights
+}
+
+// Controls returns the per-slice controls for slice-based decoding.
+func (s *Slice) Controls() []v4l2.ControlValue {
+	return []v4l2.ControlValue{s.Params.Control(), s.PredWeights.Control()}
+}
+
+// Picture is a primary coded picture with the controls a stateless
+// decoder needs to decode it.
+type Picture struct {
+	Timestamp uint64 // reference_ts of this picture in later DPBs
+	Sps       *Sps
+	Pps       *Pps
+	Slices    []*Slice
+
+	SpsControl    v4l2.CtrlH264Sps
+	PpsControl    v4l2.CtrlH264Pps
+	ScalingMatrix v4l2.CtrlH264ScalingMatrix
+	DecodeParams  v4l2.CtrlH264DecodeParams
+
+	top, bottom    int32
+	frameNumOffset int32
+}
+
+// Controls returns the per-picture controls. Frame-based decoders need
+// only these, slice-based ones also need the controls of each slice.
+func (p *Picture) Controls() []v4l2.ControlValue {
+	return []v4l2.ControlValue{
+		p.SpsControl.Control(),
+		p.PpsControl.Control(),
+		p.ScalingMatrix.Control(),
+		p.DecodeParams.Control(),
+	}
+}
+
+// Data returns the slice NAL units of the picture, each prefixed with an
+// Annex B start code if startCodes is set.
+func (p *Picture) Data(startCodes bool) []byte {
+	var data []byte
+	for _, s := range p.Slices {
+		if startCodes {
+			data = append(data, 0, 0, 1)
+		}
+		data = append(data, s.Nal...)
+	}
+	return data
+}
+
+// Idr reports whether the picture is an IDR picture.
+func (p *Picture) Idr() bool {
+	return p.Slices[0].Header.Idr
+}
+
+// Parser turns NAL units into Pictures and keeps track of the parameter
+// sets and the reference frames.
+type Parser struct {
+	Sps map[uint32]*Sps
+	Pps map[uint32]*Pps
+	Dpb Dpb
+
+	cur  *Picture
+	prev *SliceHeader
+}
+
+func NewParser() *Parser {
+	p := &Parser{
+		Sps: make(map[uint32]*Sps),
+		Pps: make(map[uint32]*Pps),
+	}
+	p.Dpb.Reset()
+	return p
+}
+
+// Push parses a NAL unit without start code. The timestamp identifies the
+// picture the NAL unit belongs to; it is the timestamp of the OUTPUT buffer
+// the picture is decoded from, in nanoseconds. Push returns the previous
+// picture once the NAL unit shows that it is complete. The NAL unit is
+// copied, so its buffer may be reused, as bufio.Scanner does.
+func (p *Parser) Push(nal []byte, timestamp uint64) (*Picture, error) {
+	if len(nal) == 0 {
+		return nil, nil
+	}
+	header := ParseNalHeader(nal)
+	switch {
+	case header.Type.IsSlice():
+		return p.pushSlice(nal, timestamp)
+	case header.Type == NalType_Sps:
+		done := p.finish()
+		sps, err := ParseSps(Unescape(nal[1:]))
+		if err != nil {
+			return done, err
+		}
+		p.Sps[sps.Id] = sps
+		return done, nil
+	case header.Type == NalType_Pps:
+		done := p.finish()
+		pps, err := ParsePps(Unescape(nal[1:]), p.Sps)
+		if err != nil {
+			return done, err
+		}
+		p.Pps[pps.Id] = pps
+		return done, nil
+	case header.Type == NalType_Sei, header.Type == NalType_Aud,
+		header.Type == NalType_EndSequence, header.Type == NalType_EndStream,
+		header.Type >= NalType_Prefix && header.Type <= 18:
+		// These start a new access unit.
+		return p.finish(), nil
+	}
+	return nil, nil
+}
+
+// Flush returns the last picture of the stream.
+func (p *Parser) Flush() *Picture {
+	return p.finish()
+}
+
+func (p *Parser) pushSlice(nal []byte, timestamp uint64) (*Picture, error) {
+	// The slice outlives the call, the picture is returned with the
+	// next one.
+	nal = append([]byte(nil), nal...)
+	h, sps, pps, err := ParseSliceHeader(nal, p.Sps, p.Pps)
+	if err != nil {
+		return nil, err
+	}
+	if h.FieldPic {
+		return nil, ErrUnsupported
+	}
+	var done *Picture
+	if p.cur == nil || h.firstSliceOfPicture(p.prev, sps) {
+		done = p.finish()
+		p.start(h, sps, pps, timestamp)
+	}
+	p.prev = h
+
+	cur := p.cur
+	slice := &Slice{
+		Nal:         nal,
+		Header:      h,
+		Params:      h.Control(),
+		PredWeights: h.PredWeights,
+	}
+	list0, list1 := p.Dpb.RefPicLists(h, sps, min32(cur.top, cur.bottom))
+	for i, idx := range list0 {
+		slice.Params.RefPicList0[i] = v4l2.H264Reference{Fields: v4l2.H264FrameRef, Index: uint8(idx)}
+	}
+	for i, idx := range list1 {
+		slice.Params.RefPicList1[i] = v4l2.H264Reference{Fields: v4l2.H264FrameRef, Index: uint8(idx)}
+	}
+	cur.Slices = append(cur.Slices, slice)
+	return done, nil
+}
+
+func (p *Parser) start(h *SliceHeader, sps *Sps, pps *Pps, timestamp uint64) {
+	if h.Idr {
+		// An IDR picture never refers to earlier frames.
+		p.Dpb.Entries = nil
+	}
+	top, bottom, frameNumOffset := p.Dpb.picOrderCnt(h, sps)
+	p.Dpb.updatePicNums(h.FrameNum, sps)
+	p.cur = &Picture{
+		Timestamp:      timestamp,
+		Sps:            sps,
+		Pps:            pps,
+		SpsControl:     sps.Control(),
+		PpsControl:     pps.Control(sps),
+		ScalingMatrix:  pps.ScalingMatrix(),
+		DecodeParams:   p.Dpb.DecodeParams(h, top, bottom),
+		top:            top,
+		bottom:         bottom,
+		frameNumOffset: frameNumOffset,
+	}
+}
+
+func (p *Parser) finish() *Picture {
+	cur := p.cur
+	if cur == nil {
+		return nil
+	}
+	h := cur.Slices[0].Header
+	p.Dpb.mark(h, cur.Sps, cur.Timestamp, cur.top, cur.bottom, cur.frameNumOffset)
+	p.cur = nil
+	p.prev = nil
+	return cur
+}
+
+func min32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package h264
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// testSlice describes a slice header written by writeSlice.
+type testSlice struct {
+	refIdc   uint8
+	typ      SliceType
+	frameNum uint32
+	idr      bool
+	pocLsb   uint32
+	active   [2]uint32 // num_ref_idx_lX_active_minus1
+	mods     []uint32  // abs_diff_pic_num_minus1 of list 0, subtracted
+	ts       uint64
+}
+
+// writeSlice writes a slice of a stream with the SPS of writeSps and the
+// PPS of writePps(nil), followed by a byte of slice data.
+func writeSlice(s testSlice) []byte {
+	w := &bitWriter{}
+	w.ue(0) // first_mb_in_slice
+	w.ue(uint32(s.typ) + 5)
+	w.ue(0) // pic_parameter_set_id
+	w.u(4, s.frameNum)
+	if s.idr {
+		w.ue(0) // idr_pic_id
+	}
+	w.u(6, s.pocLsb)
+	if s.typ == SliceType_B {
+		w.flag(true) // direct_spatial_mv_pred_flag
+	}
+	if s.typ != SliceType_I {
+		w.flag(true) // num_ref_idx_active_override_flag
+		w.ue(s.active[0])
+		if s.typ == SliceType_B {
+			w.ue(s.active[1])
+		}
+		w.flag(s.mods != nil)
+		for _, m := range s.mods {
+			w.ue(0) // modification_of_pic_nums_idc
+			w.ue(m)
+		}
+		if s.mods != nil {
+			w.ue(3)
+		}
+		if s.typ == SliceType_B {
+			w.flag(false)
+		}
+	}
+	if s.refIdc != 0 {
+		if s.idr {
+			w.flag(false) // no_output_of_prior_pics_flag
+			w.flag(false) // long_term_reference_flag
+		} else {
+			w.flag(false) // adaptive_ref_pic_marking_mode_flag
+		}
+	}
+	w.se(0) // slice_qp_delta
+	w.u(8, 0xa5)
+	if s.idr {
+		return w.nal(s.refIdc, NalType_SliceIdr)
+	}
+	return w.nal(s.refIdc, NalType_Slice)
+}
+
+func TestParser(t *testing.T) {
+	// An IPBPP stream in decode order. With two reference frames, the
+	// sliding window drops the IDR frame once the second P frame is
+	// decoded. The last P frame reorders its list.
+	slices := []testSlice{
+		{refIdc: 3, typ: SliceType_I, idr: true, pocLsb: 0, ts: 1000},
+		{refIdc: 2, typ: SliceType_P, frameNum: 1, pocLsb: 8, ts: 2000},
+		{refIdc: 0, typ: SliceType_B, frameNum: 2, pocLsb: 4, active: [2]uint32{1, 1}, ts: 3000},
+		{refIdc: 2, typ: SliceType_P, frameNum: 2, pocLsb: 16, active: [2]uint32{1, 0}, ts: 4000},
+		{refIdc: 2, typ: SliceType_P, frameNum: 3, pocLsb: 24, active: [2]uint32{1, 0}, mods: []uint32{1}, ts: 5000},
+	}
+	want := []struct {
+		poc          int32
+		dpb          []uint64 // reference timestamps
+		list0, list1 []uint8  // indices into the DPB
+	}{
+		{poc: 0},
+		{poc: 8, dpb: []uint64{1000}, list0: []uint8{0}},
+		{poc: 4, dpb: []uint64{1000, 2000}, list0: []uint8{0, 1}, list1: []uint8{1, 0}},
+		{poc: 16, dpb: []uint64{1000, 2000}, list0: []uint8{1, 0}},
+		{poc: 24, dpb: []uint64{2000, 4000}, list0: []uint8{0, 1}},
+	}
+
+	p := NewParser()
+	// The NAL units share a buffer, as with bufio.Scanner.
+	var buf []byte
+	push := func(nal []byte, ts uint64) *Picture {
+		t.Helper()
+		buf = append(buf[:0], nal...)
+		pic, err := p.Push(buf, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pic
+	}
+	push(writeSps(spsConfig{profile: 77, maxRefs: 2, log2PocLsb: 2, widthInMbs: 20, heightInMbs: 15}).nal(3, NalType_Sps), 0)
+	push(writePps(nil).nal(3, NalType_Pps), 0)
+	var pics []*Picture
+	var nals [][]byte
+	for _, s := range slices {
+		nal := writeSlice(s)
+		nals = append(nals, nal)
+		if pic := push(nal, s.ts); pic != nil {
+			pics = append(pics, pic)
+		}
+	}
+	pics = append(pics, p.Flush())
+	if len(pics) != len(want) {
+		t.Fatalf("%d pictures, want %d", len(pics), len(want))
+	}
+
+	for i, pic := range pics {
+		w := want[i]
+		if pic.Timestamp != slices[i].ts || len(pic.Slices) != 1 {
+			t.Fatalf("picture %d: timestamp %d, %d slices", i, pic.Timestamp, len(pic.Slices))
+		}
+		slice := pic.Slices[0]
+		if !reflect.DeepEqual(slice.Nal, nals[i]) {
+			t.Errorf("picture %d: NAL unit overwritten", i)
+		}
+		params := pic.DecodeParams
+		if params.TopFieldOrderCnt != w.poc || params.BottomFieldOrderCnt != w.poc {
+			t.Errorf("picture %d: POC %d/%d, want %d", i, params.TopFieldOrderCnt, params.BottomFieldOrderCnt, w.poc)
+		}
+		var dpb []uint64
+		for _, e := range params.Dpb {
+			if e.Flags&v4l2.H264DpbEntryFlag_Valid != 0 {
+				dpb = append(dpb, e.ReferenceTs)
+			}
+		}
+		if !reflect.DeepEqual(dpb, w.dpb) {
+			t.Errorf("picture %d: DPB %v, want %v", i, dpb, w.dpb)
+		}
+		list0 := refIndices(slice.Params.RefPicList0[:], int(slice.Params.NumRefIdxL0ActiveMinus1)+1, slices[i].typ != SliceType_I)
+		list1 := refIndices(slice.Params.RefPicList1[:], int(slice.Params.NumRefIdxL1ActiveMinus1)+1, slices[i].typ == SliceType_B)
+		if !reflect.DeepEqual(list0, w.list0) || !reflect.DeepEqual(list1, w.list1) {
+			t.Errorf("picture %d: lists %v %v, want %v %v", i, list0, list1, w.list0, w.list1)
+		}
+	}
+}
+
+func refIndices(list []v4l2.H264Reference, active int, used bool) []uint8 {
+	if !used {
+		return nil
+	}
+	var indices []uint8
+	for _, ref := range list[:active] {
+		indices = append(indices, ref.Index)
+	}
+	return indices
+}
+
+func TestSliceGroupChangeCycle(t *testing.T) {
+	// 7 macroblocks in slice groups changing by 2: the cycle takes
+	// Ceil(Log2(7 ÷ 2 + 1)) = 3 bits.
+	sps, err := ParseSps(writeSps(spsConfig{profile: 66, log2PocLsb: 2, widthInMbs: 7, heightInMbs: 1}).rbsp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &bitWriter{}
+	w.ue(0) // pic_parameter_set_id
+	w.ue(0) // seq_parameter_set_id
+	w.flag(false)
+	w.flag(false)
+	w.ue(1)       // num_slice_groups_minus1
+	w.ue(4)       // slice_group_map_type
+	w.flag(false) // slice_group_change_direction_flag
+	w.ue(1)       // slice_group_change_rate_minus1
+	w.ue(0)
+	w.ue(0)
+	w.flag(false)
+	w.u(2, 0)
+	w.se(0)
+	w.se(0)
+	w.se(0)
+	w.flag(false)
+	w.flag(false)
+	w.flag(false)
+	pps, err := ParsePps(w.rbsp(), map[uint32]*Sps{0: sps})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = &bitWriter{}
+	w.ue(0) // first_mb_in_slice
+	w.ue(uint32(SliceType_I) + 5)
+	w.ue(0) // pic_parameter_set_id
+	w.u(4, 1)
+	w.u(6, 2)
+	w.se(0)   // slice_qp_delta
+	w.u(3, 5) // slice_group_change_cycle
+	bits := w.n
+	w.u(8, 0xa5)
+	h, _, _, err := ParseSliceHeader(w.nal(0, NalType_Slice), map[uint32]*Sps{0: sps}, map[uint32]*Pps{0: pps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.SliceGroupChangeCycle != 5 || h.HeaderBitSize != uint32(bits) {
+		t.Errorf("slice_group_change_cycle %d, header of %d bits, want 5 and %d", h.SliceGroupChangeCycle, h.HeaderBitSize, bits)
+	}
+}
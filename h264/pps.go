@@ -0,0 +1,174 @@
+package h264
+
+import (
+	"errors"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrMissingParameterSet = errors.New("h264: missing parameter set")
+
+// Pps is a parsed pic_parameter_set_rbsp().
+type Pps struct {
+	Id                                uint32
+	SpsId                             uint32
+	EntropyCodingMode                 bool
+	BottomFieldPicOrderInFramePresent bool
+	NumSliceGroupsMinus1              uint32
+	SliceGroupMapType                 uint32
+	SliceGroupChangeRateMinus1        uint32
+	NumRefIdxL0DefaultActiveMinus1    uint32
+	NumRefIdxL1DefaultActiveMinus1    uint32
+	WeightedPred                      bool
+	WeightedBipredIdc                 uint32
+	PicInitQpMinus26                  int32
+	PicInitQsMinus26                  int32
+	ChromaQpIndexOffset               int32
+	DeblockingFilterControlPresent    bool
+	ConstrainedIntraPred              bool
+	RedundantPicCntPresent            bool
+	Transform8x8Mode                  bool
+	ScalingMatrixPresent              bool
+	ScalingLists                      ScalingLists // effective lists, including those of the SPS
+	SecondChromaQpIndexOffset         int32
+}
+
+// ParsePps parses the RBSP of a PPS NAL unit, without the NAL header. The
+// PPS refers to one of spss, indexed by id.
+func ParsePps(rbsp []byte, spss map[uint32]*Sps) (*Pps, error) {
+	r := &bitReader{data: rbsp}
+	p := &Pps{
+		Id:    r.ue(),
+		SpsId: r.ue(),
+	}
+	if p.Id > 255 {
+		return nil, ErrUnsupported
+	}
+	sps := spss[p.SpsId]
+	if sps == nil {
+		return nil, ErrMissingParameterSet
+	}
+	p.EntropyCodingMode = r.flag()
+	p.BottomFieldPicOrderInFramePresent = r.flag()
+	p.NumSliceGroupsMinus1 = r.ue()
+	if p.NumSliceGroupsMinus1 > 7 {
+		return nil, ErrUnsupported
+	}
+	if p.NumSliceGroupsMinus1 > 0 {
+		p.SliceGroupMapType = r.ue()
+		switch p.SliceGroupMapType {
+		case 0:
+			for i := uint32(0); i <= p.NumSliceGroupsMinus1; i++ {
+				r.ue() // run_length_minus1
+			}
+		case 2:
+			for i := uint32(0); i < p.NumSliceGroupsMinus1; i++ {
+				r.ue() // top_left
+				r.ue() // bottom_right
+			}
+		case 3, 4, 5:
+			r.flag() // slice_group_change_direction_flag
+			p.SliceGroupChangeRateMinus1 = r.ue()
+		case 6:
+			n := r.ue() + 1
+			bits := ceilLog2(p.NumSliceGroupsMinus1 + 1)
+			for i := uint32(0); i < n && r.err == nil; i++ {
+				r.u(bits) // slice_group_id
+			}
+		}
+	}
+	p.NumRefIdxL0DefaultActiveMinus1 = r.ue()
+	p.NumRefIdxL1DefaultActiveMinus1 = r.ue()
+	p.WeightedPred = r.flag()
+	p.WeightedBipredIdc = r.u(2)
+	p.PicInitQpMinus26 = r.se()
+	p.PicInitQsMinus26 = r.se()
+	p.ChromaQpIndexOffset = r.se()
+	p.DeblockingFilterControlPresent = r.flag()
+	p.ConstrainedIntraPred = r.flag()
+	p.RedundantPicCntPresent = r.flag()
+	p.ScalingLists = sps.ScalingLists
+	p.SecondChromaQpIndexOffset = p.ChromaQpIndexOffset
+	if r.moreRbspData() {
+		p.Transform8x8Mode = r.flag()
+		p.ScalingMatrixPresent = r.flag()
+		if p.ScalingMatrixPresent {
+			count := 6
+			if p.Transform8x8Mode {
+				if sps.ChromaFormatIdc == 3 {
+					count += 6
+				} else {
+					count += 2
+				}
+			}
+			// Rule B falls back to the SPS lists, rule A to the
+			// defaults when the SPS has none.
+			var fallback *ScalingLists
+			if sps.ScalingMatrixPresent {
+				fallback = &sps.ScalingLists
+			}
+			p.ScalingLists = parseScalingLists(r, count, fallback)
+		}
+		p.SecondChromaQpIndexOffset = r.se()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if p.NumRefIdxL0DefaultActiveMinus1 > 31 || p.NumRefIdxL1DefaultActiveMinus1 > 31 {
+		return nil, ErrUnsupported
+	}
+	return p, nil
+}
+
+func ceilLog2(v uint32) int {
+	n := 0
+	for uint32(1)<<uint(n) < v {
+		n++
+	}
+	return n
+}
+
+// Control returns the V4L2_CID_STATELESS_H264_PPS payload. The scaling
+// matrix flag is set if either the SPS or the PPS carry a matrix.
+func (p *Pps) Control(sps *Sps) v4l2.CtrlH264Pps {
+	c := v4l2.CtrlH264Pps{
+		PicParameterSetId:              uint8(p.Id),
+		SeqParameterSetId:              uint8(p.SpsId),
+		NumSliceGroupsMinus1:           uint8(p.NumSliceGroupsMinus1),
+		NumRefIdxL0DefaultActiveMinus1: uint8(p.NumRefIdxL0DefaultActiveMinus1),
+		NumRefIdxL1DefaultActiveMinus1: uint8(p.NumRefIdxL1DefaultActiveMinus1),
+		WeightedBipredIdc:              uint8(p.WeightedBipredIdc),
+		PicInitQpMinus26:               int8(p.PicInitQpMinus26),
+		PicInitQsMinus26:               int8(p.PicInitQsMinus26),
+		ChromaQpIndexOffset:            int8(p.ChromaQpIndexOffset),
+		SecondChromaQpIndexOffset:      int8(p.SecondChromaQpIndexOffset),
+	}
+	flags := []struct {
+		set  bool
+		flag uint16
+	}{
+		{p.EntropyCodingMode, v4l2.H264PpsFlag_EntropyCodingMode},
+		{p.BottomFieldPicOrderInFramePresent, v4l2.H264PpsFlag_BottomFieldPicOrderInFramePresent},
+		{p.WeightedPred, v4l2.H264PpsFlag_WeightedPred},
+		{p.DeblockingFilterControlPresent, v4l2.H264PpsFlag_DeblockingFilterControlPresent},
+		{p.ConstrainedIntraPred, v4l2.H264PpsFlag_ConstrainedIntraPred},
+		{p.RedundantPicCntPresent, v4l2.H264PpsFlag_RedundantPicCntPresent},
+		{p.Transform8x8Mode, v4l2.H264PpsFlag_Transform8x8Mode},
+		{p.ScalingMatrixPresent || sps.ScalingMatrixPresent, v4l2.H264PpsFlag_ScalingMatrixPresent},
+	}
+	for _, f := range flags {
+		if f.set {
+			c.Flags |= f.flag
+		}
+	}
+	return c
+}
+
+// ScalingMatrix returns the V4L2_CID_STATELESS_H264_SCALING_MATRIX payload.
+func (p *Pps) ScalingMatrix() v4l2.CtrlH264ScalingMatrix {
+	raster := p.ScalingLists.Raster()
+	return v4l2.CtrlH264ScalingMatrix{
+		ScalingList4x4: raster.List4x4,
+		ScalingList8x8: raster.List8x8,
+	}
+}
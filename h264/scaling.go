@@ -0,0 +1,149 @@
+package h264
+
+// Scaling lists are kept in the zig-zag order they are coded in. Lists 0-5
+// are 4x4 (Intra Y, Cb, Cr, Inter Y, Cb, Cr), lists 6-11 are 8x8 (Intra Y,
+// Inter Y, Intra Cb, Inter Cb, Intra Cr, Inter Cr).
+type ScalingLists struct {
+	List4x4 [6][16]uint8
+	List8x8 [6][64]uint8
+}
+
+var (
+	flat4x4 = [16]uint8{16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16}
+
+	default4x4Intra = [16]uint8{6, 13, 13, 20, 20, 20, 28, 28, 28, 28, 32, 32, 32, 37, 37, 42}
+	default4x4Inter = [16]uint8{10, 14, 14, 20, 20, 20, 24, 24, 24, 24, 27, 27, 27, 30, 30, 34}
+
+	default8x8Intra = [64]uint8{
+		6, 10, 10, 13, 11, 13, 16, 16, 16, 16, 18, 18, 18, 18, 18, 23,
+		23, 23, 23, 23, 23, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27,
+		27, 27, 27, 27, 29, 29, 29, 29, 29, 29, 29, 31, 31, 31, 31, 31,
+		31, 33, 33, 33, 33, 33, 36, 36, 36, 36, 38, 38, 38, 40, 40, 42,
+	}
+	default8x8Inter = [64]uint8{
+		9, 13, 13, 15, 13, 15, 17, 17, 17, 17, 19, 19, 19, 19, 19, 21,
+		21, 21, 21, 21, 21, 22, 22, 22, 22, 22, 22, 22, 24, 24, 24, 24,
+		24, 24, 24, 24, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27, 27,
+		27, 28, 28, 28, 28, 28, 30, 30, 30, 30, 32, 32, 32, 33, 33, 35,
+	}
+
+	// Raster position of each coefficient in zig-zag (frame) scan order.
+	zigzag4x4 = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	zigzag8x8 = [64]uint8{
+		0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+		12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+		35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+		58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+	}
+)
+
+func flatScalingLists() ScalingLists {
+	var s ScalingLists
+	for i := range s.List4x4 {
+		s.List4x4[i] = flat4x4
+	}
+	for i := range s.List8x8 {
+		for j := range s.List8x8[i] {
+			s.List8x8[i][j] = 16
+		}
+	}
+	return s
+}
+
+// parseScalingList reads scaling_list() and reports whether the default
+// list is to be used.
+func parseScalingList(r *bitReader, list []uint8) bool {
+	last, next := int32(8), int32(8)
+	for j := range list {
+		if next != 0 {
+			delta := r.se()
+			next = (last + delta + 256) % 256
+			if j == 0 && next == 0 {
+				return true
+			}
+		}
+		if next != 0 {
+			list[j] = uint8(next)
+		} else {
+			list[j] = uint8(last)
+		}
+		last = int32(list[j])
+	}
+	return false
+}
+
+// parseScalingLists reads count lists of an SPS or PPS. Lists that are not
+// present are inferred with fall-back rule A (fallback nil) or rule B (the
+// SPS lists).
+func parseScalingLists(r *bitReader, count int, fallback *ScalingLists) ScalingLists {
+	s := flatScalingLists()
+	for i := 0; i < count; i++ {
+		present := r.flag()
+		if i < 6 {
+			list := &s.List4x4[i]
+			switch {
+			case present:
+				if parseScalingList(r, list[:]) {
+					*list = default4x4(i)
+				}
+			case i == 0 || i == 3:
+				if fallback != nil {
+					*list = fallback.List4x4[i]
+				} else {
+					*list = default4x4(i)
+				}
+			default:
+				*list = s.List4x4[i-1]
+			}
+			continue
+		}
+		j := i - 6
+		list := &s.List8x8[j]
+		switch {
+		case present:
+			if parseScalingList(r, list[:]) {
+				*list = default8x8(j)
+			}
+		case j < 2:
+			if fallback != nil {
+				*list = fallback.List8x8[j]
+			} else {
+				*list = default8x8(j)
+			}
+		default:
+			*list = s.List8x8[j-2]
+		}
+	}
+	return s
+}
+
+func default4x4(i int) [16]uint8 {
+	if i < 3 {
+		return default4x4Intra
+	}
+	return default4x4Inter
+}
+
+func default8x8(i int) [64]uint8 {
+	if i%2 == 0 {
+		return default8x8Intra
+	}
+	return default8x8Inter
+}
+
+// Raster returns the lists in raster scan order, as expected by the
+// V4L2_CID_STATELESS_H264_SCALING_MATRIX control.
+func (s *ScalingLists) Raster() ScalingLists {
+	var r ScalingLists
+	for i := range s.List4x4 {
+		for j, v := range s.List4x4[i] {
+			r.List4x4[i][zigzag4x4[j]] = v
+		}
+	}
+	for i := range s.List8x8 {
+		for j, v := range s.List8x8[i] {
+			r.List8x8[i][zigzag8x8[j]] = v
+		}
+	}
+	return r
+}
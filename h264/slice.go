@@ -0,0 +1,340 @@
+package h264
+
+import "github.com/paskozdilar/go-v4l2/v4l2"
+
+type SliceType uint32
+
+const (
+	SliceType_P  SliceType = 0
+	SliceType_B  SliceType = 1
+	SliceType_I  SliceType = 2
+	SliceType_Sp SliceType = 3
+	SliceType_Si SliceType = 4
+)
+
+func (t SliceType) IsIntra() bool {
+	return t == SliceType_I || t == SliceType_Si
+}
+
+// RefPicListModification is one modification_of_pic_nums_idc operation.
+type RefPicListModification struct {
+	Idc            uint32
+	AbsDiffPicNum  uint32 // abs_diff_pic_num_minus1 + 1, idc 0 and 1
+	LongTermPicNum uint32 // idc 2
+}
+
+// Mmco is one memory_management_control_operation.
+type Mmco struct {
+	Op                       uint32
+	DifferenceOfPicNums      uint32 // difference_of_pic_nums_minus1 + 1
+	LongTermPicNum           uint32
+	LongTermFrameIdx         uint32
+	MaxLongTermFrameIdxPlus1 uint32
+}
+
+// SliceHeader is a parsed slice_header().
+type SliceHeader struct {
+	NalRefIdc                  uint8
+	Idr                        bool
+	FirstMbInSlice             uint32
+	Type                       SliceType
+	PpsId                      uint32
+	ColourPlaneId              uint32
+	FrameNum                   uint32
+	FieldPic                   bool
+	BottomField                bool
+	IdrPicId                   uint32
+	PicOrderCntLsb             uint32
+	DeltaPicOrderCntBottom     int32
+	DeltaPicOrderCnt           [2]int32
+	RedundantPicCnt            uint32
+	DirectSpatialMvPred        bool
+	NumRefIdxL0ActiveMinus1    uint32
+	NumRefIdxL1ActiveMinus1    uint32
+	RefPicListModification     [2][]RefPicListModification
+	PredWeights                v4l2.CtrlH264PredWeights
+	NoOutputOfPriorPics        bool
+	LongTermReference          bool
+	AdaptiveRefPicMarking      bool
+	Mmcos                      []Mmco
+	CabacInitIdc               uint32
+	SliceQpDelta               int32
+	SpForSwitch                bool
+	SliceQsDelta               int32
+	DisableDeblockingFilterIdc uint32
+	SliceAlphaC0OffsetDiv2     int32
+	SliceBetaOffsetDiv2        int32
+	SliceGroupChangeCycle      uint32
+
+	// Sizes in bits of syntax elements within the RBSP, after the NAL
+	// header, as needed by the V4L2 controls.
+	HeaderBitSize           uint32
+	PicOrderCntBitSize      uint32
+	DecRefPicMarkingBitSize uint32
+}
+
+// ParseSliceHeader parses the slice header of a slice NAL unit, including
+// its NAL header.
+func ParseSliceHeader(nal []byte, spss map[uint32]*Sps, ppss map[uint32]*Pps) (*SliceHeader, *Sps, *Pps, error) {
+	header := ParseNalHeader(nal)
+	if !header.Type.IsSlice() {
+		return nil, nil, nil, ErrUnsupported
+	}
+	r := &bitReader{data: Unescape(nal[1:])}
+	h := &SliceHeader{
+		NalRefIdc:      header.RefIdc,
+		Idr:            header.Type == NalType_SliceIdr,
+		FirstMbInSlice: r.ue(),
+		Type:           SliceType(r.ue() % 5),
+		PpsId:          r.ue(),
+	}
+	pps := ppss[h.PpsId]
+	if pps == nil {
+		return nil, nil, nil, ErrMissingParameterSet
+	}
+	sps := spss[pps.SpsId]
+	if sps == nil {
+		return nil, nil, nil, ErrMissingParameterSet
+	}
+	if sps.SeparateColourPlane {
+		h.ColourPlaneId = r.u(2)
+	}
+	h.FrameNum = r.u(int(sps.Log2MaxFrameNumMinus4 + 4))
+	if !sps.FrameMbsOnly {
+		h.FieldPic = r.flag()
+		if h.FieldPic {
+			h.BottomField = r.flag()
+		}
+	}
+	if h.Idr {
+		h.IdrPicId = r.ue()
+	}
+
+	start := r.pos
+	if sps.PicOrderCntType == 0 {
+		h.PicOrderCntLsb = r.u(int(sps.Log2MaxPicOrderCntLsbMinus4 + 4))
+		if pps.BottomFieldPicOrderInFramePresent && !h.FieldPic {
+			h.DeltaPicOrderCntBottom = r.se()
+		}
+	}
+	if sps.PicOrderCntType == 1 && !sps.DeltaPicOrderAlwaysZero {
+		h.DeltaPicOrderCnt[0] = r.se()
+		if pps.BottomFieldPicOrderInFramePresent && !h.FieldPic {
+			h.DeltaPicOrderCnt[1] = r.se()
+		}
+	}
+	h.PicOrderCntBitSize = uint32(r.pos - start)
+
+	if pps.RedundantPicCntPresent {
+		h.RedundantPicCnt = r.ue()
+	}
+	if h.Type == SliceType_B {
+		h.DirectSpatialMvPred = r.flag()
+	}
+	h.NumRefIdxL0ActiveMinus1 = pps.NumRefIdxL0DefaultActiveMinus1
+	h.NumRefIdxL1ActiveMinus1 = pps.NumRefIdxL1DefaultActiveMinus1
+	if h.FieldPic {
+		h.NumRefIdxL0ActiveMinus1 = 2*h.NumRefIdxL0ActiveMinus1 + 1
+		h.NumRefIdxL1ActiveMinus1 = 2*h.NumRefIdxL1ActiveMinus1 + 1
+	}
+	if h.Type == SliceType_P || h.Type == SliceType_Sp || h.Type == SliceType_B {
+		if r.flag() { // num_ref_idx_active_override_flag
+			h.NumRefIdxL0ActiveMinus1 = r.ue()
+			if h.Type == SliceType_B {
+				h.NumRefIdxL1ActiveMinus1 = r.ue()
+			}
+		}
+	}
+	if h.NumRefIdxL0ActiveMinus1 > 31 || h.NumRefIdxL1ActiveMinus1 > 31 {
+		return nil, nil, nil, ErrUnsupported
+	}
+
+	if !h.Type.IsIntra() {
+		h.RefPicListModification[0] = parseRefPicListModification(r)
+		if h.Type == SliceType_B {
+			h.RefPicListModification[1] = parseRefPicListModification(r)
+		}
+	}
+	if (pps.WeightedPred && (h.Type == SliceType_P || h.Type == SliceType_Sp)) ||
+		(pps.WeightedBipredIdc == 1 && h.Type == SliceType_B) {
+		h.parsePredWeightTable(r, sps)
+	}
+
+	if h.NalRefIdc != 0 {
+		start := r.pos
+		h.parseDecRefPicMarking(r)
+		h.DecRefPicMarkingBitSize = uint32(r.pos - start)
+	}
+	if pps.EntropyCodingMode && !h.Type.IsIntra() {
+		h.CabacInitIdc = r.ue()
+	}
+	h.SliceQpDelta = r.se()
+	if h.Type == SliceType_Sp || h.Type == SliceType_Si {
+		if h.Type == SliceType_Sp {
+			h.SpForSwitch = r.flag()
+		}
+		h.SliceQsDelta = r.se()
+	}
+	if pps.DeblockingFilterControlPresent {
+		h.DisableDeblockingFilterIdc = r.ue()
+		if h.DisableDeblockingFilterIdc != 1 {
+			h.SliceAlphaC0OffsetDiv2 = r.se()
+			h.SliceBetaOffsetDiv2 = r.se()
+		}
+	}
+	if pps.NumSliceGroupsMinus1 > 0 && pps.SliceGroupMapType >= 3 && pps.SliceGroupMapType <= 5 {
+		picSize := (sps.PicWidthInMbsMinus1 + 1) * (sps.PicHeightInMapUnitsMinus1 + 1)
+		rate := pps.SliceGroupChangeRateMinus1 + 1
+		h.SliceGroupChangeCycle = r.u(ceilLog2((picSize+rate-1)/rate + 1))
+	}
+	h.HeaderBitSize = uint32(r.pos)
+	if r.err != nil {
+		return nil, nil, nil, r.err
+	}
+	return h, sps, pps, nil
+}
+
+func parseRefPicListModification(r *bitReader) []RefPicListModification {
+	if !r.flag() {
+		return nil
+	}
+	var mods []RefPicListModification
+	for r.err == nil {
+		m := RefPicListModification{Idc: r.ue()}
+		switch m.Idc {
+		case 0, 1:
+			m.AbsDiffPicNum = r.ue() + 1
+		case 2:
+			m.LongTermPicNum = r.ue()
+		default:
+			return mods
+		}
+		mods = append(mods, m)
+	}
+	return mods
+}
+
+func (h *SliceHeader) parsePredWeightTable(r *bitReader, sps *Sps) {
+	w := &h.PredWeights
+	w.LumaLog2WeightDenom = uint16(r.ue())
+	chroma := sps.ChromaArrayType() != 0
+	if chroma {
+		w.ChromaLog2WeightDenom = uint16(r.ue())
+	}
+	lists := 1
+	if h.Type == SliceType_B {
+		lists = 2
+	}
+	active := [2]uint32{h.NumRefIdxL0ActiveMinus1, h.NumRefIdxL1ActiveMinus1}
+	for l := 0; l < lists; l++ {
+		f := &w.WeightFactors[l]
+		for i := uint32(0); i <= active[l]; i++ {
+			f.LumaWeight[i] = 1 << w.LumaLog2WeightDenom
+			if r.flag() {
+				f.LumaWeight[i] = int16(r.se())
+				f.LumaOffset[i] = int16(r.se())
+			}
+			if !chroma {
+				continue
+			}
+			f.ChromaWeight[i] = [2]int16{1 << w.ChromaLog2WeightDenom, 1 << w.ChromaLog2WeightDenom}
+			if r.flag() {
+				for j := 0; j < 2; j++ {
+					f.ChromaWeight[i][j] = int16(r.se())
+					f.ChromaOffset[i][j] = int16(r.se())
+				}
+			}
+		}
+	}
+}
+
+func (h *SliceHeader) parseDecRefPicMarking(r *bitReader) {
+	if h.Idr {
+		h.NoOutputOfPriorPics = r.flag()
+		h.LongTermReference = r.flag()
+		return
+	}
+	h.AdaptiveRefPicMarking = r.flag()
+	if !h.AdaptiveRefPicMarking {
+		return
+	}
+	for r.err == nil {
+		m := Mmco{Op: r.ue()}
+		if m.Op == 0 {
+			return
+		}
+		if m.Op == 1 || m.Op == 3 {
+			m.DifferenceOfPicNums = r.ue() + 1
+		}
+		if m.Op == 2 {
+			m.LongTermPicNum = r.ue()
+		}
+		if m.Op == 3 || m.Op == 6 {
+			m.LongTermFrameIdx = r.ue()
+		}
+		if m.Op == 4 {
+			m.MaxLongTermFrameIdxPlus1 = r.ue()
+		}
+		h.Mmcos = append(h.Mmcos, m)
+	}
+}
+
+// HasMmco5 reports whether the slice marks all reference pictures unused.
+func (h *SliceHeader) HasMmco5() bool {
+	for _, m := range h.Mmcos {
+		if m.Op == 5 {
+			return true
+		}
+	}
+	return false
+}
+
+// firstSliceOfPicture reports whether h starts a new primary coded picture
+// after prev, following 7.4.1.2.4.
+func (h *SliceHeader) firstSliceOfPicture(prev *SliceHeader, sps *Sps) bool {
+	switch {
+	case prev == nil:
+		return true
+	case h.FrameNum != prev.FrameNum,
+		h.PpsId != prev.PpsId,
+		h.FieldPic != prev.FieldPic,
+		h.BottomField != prev.BottomField,
+		(h.NalRefIdc == 0) != (prev.NalRefIdc == 0),
+		h.Idr != prev.Idr,
+		h.Idr && h.IdrPicId != prev.IdrPicId:
+		return true
+	case sps.PicOrderCntType == 0 &&
+		(h.PicOrderCntLsb != prev.PicOrderCntLsb || h.DeltaPicOrderCntBottom != prev.DeltaPicOrderCntBottom):
+		return true
+	case sps.PicOrderCntType == 1 && h.DeltaPicOrderCnt != prev.DeltaPicOrderCnt:
+		return true
+	}
+	return false
+}
+
+// Control returns the V4L2_CID_STATELESS_H264_SLICE_PARAMS payload, without
+// the reference picture lists.
+func (h *SliceHeader) Control() v4l2.CtrlH264SliceParams {
+	c := v4l2.CtrlH264SliceParams{
+		HeaderBitSize:              h.HeaderBitSize,
+		FirstMbInSlice:             h.FirstMbInSlice,
+		SliceType:                  uint8(h.Type),
+		ColourPlaneId:              uint8(h.ColourPlaneId),
+		RedundantPicCnt:            uint8(h.RedundantPicCnt),
+		CabacInitIdc:               uint8(h.CabacInitIdc),
+		SliceQpDelta:               int8(h.SliceQpDelta),
+		SliceQsDelta:               int8(h.SliceQsDelta),
+		DisableDeblockingFilterIdc: uint8(h.DisableDeblockingFilterIdc),
+		SliceAlphaC0OffsetDiv2:     int8(h.SliceAlphaC0OffsetDiv2),
+		SliceBetaOffsetDiv2:        int8(h.SliceBetaOffsetDiv2),
+		NumRefIdxL0ActiveMinus1:    uint8(h.NumRefIdxL0ActiveMinus1),
+		NumRefIdxL1ActiveMinus1:    uint8(h.NumRefIdxL1ActiveMinus1),
+	}
+	if h.DirectSpatialMvPred {
+		c.Flags |= v4l2.H264SliceFlag_DirectSpatialMvPred
+	}
+	if h.SpForSwitch {
+		c.Flags |= v4l2.H264SliceFlag_SpForSwitch
+	}
+	return c
+}
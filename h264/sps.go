@@ -0,0 +1,209 @@
+package h264
+
+import (
+	"errors"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrUnsupported = errors.New("h264: unsupported stream")
+
+// Sps is a parsed seq_parameter_set_rbsp(). The VUI is not parsed.
+type Sps struct {
+	ProfileIdc                  uint8
+	ConstraintSetFlags          uint8
+	LevelIdc                    uint8
+	Id                          uint32
+	ChromaFormatIdc             uint32
+	SeparateColourPlane         bool
+	BitDepthLumaMinus8          uint32
+	BitDepthChromaMinus8        uint32
+	QpprimeYZeroTransformBypass bool
+	ScalingMatrixPresent        bool
+	ScalingLists                ScalingLists
+	Log2MaxFrameNumMinus4       uint32
+	PicOrderCntType             uint32
+	Log2MaxPicOrderCntLsbMinus4 uint32
+	DeltaPicOrderAlwaysZero     bool
+	OffsetForNonRefPic          int32
+	OffsetForTopToBottomField   int32
+	OffsetForRefFrame           []int32
+	MaxNumRefFrames             uint32
+	GapsInFrameNumValueAllowed  bool
+	PicWidthInMbsMinus1         uint32
+	PicHeightInMapUnitsMinus1   uint32
+	FrameMbsOnly                bool
+	MbAdaptiveFrameField        bool
+	Direct8x8Inference          bool
+	FrameCropping               bool
+	CropLeft, CropRight         uint32
+	CropTop, CropBottom         uint32
+	VuiParametersPresent        bool
+}
+
+// ParseSps parses the RBSP of an SPS NAL unit, without the NAL header.
+func ParseSps(rbsp []byte) (*Sps, error) {
+	r := &bitReader{data: rbsp}
+	s := &Sps{
+		ProfileIdc:         uint8(r.u(8)),
+		ConstraintSetFlags: uint8(r.u(8)),
+		LevelIdc:           uint8(r.u(8)),
+		Id:                 r.ue(),
+		ChromaFormatIdc:    1,
+	}
+	if s.Id > 31 {
+		return nil, ErrUnsupported
+	}
+	s.ScalingLists = flatScalingLists()
+	switch s.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.ChromaFormatIdc = r.ue()
+		if s.ChromaFormatIdc == 3 {
+			s.SeparateColourPlane = r.flag()
+		}
+		s.BitDepthLumaMinus8 = r.ue()
+		s.BitDepthChromaMinus8 = r.ue()
+		s.QpprimeYZeroTransformBypass = r.flag()
+		s.ScalingMatrixPresent = r.flag()
+		if s.ScalingMatrixPresent {
+			count := 8
+			if s.ChromaFormatIdc == 3 {
+				count = 12
+			}
+			s.ScalingLists = parseScalingLists(r, count, nil)
+		}
+	}
+	s.Log2MaxFrameNumMinus4 = r.ue()
+	s.PicOrderCntType = r.ue()
+	switch s.PicOrderCntType {
+	case 0:
+		s.Log2MaxPicOrderCntLsbMinus4 = r.ue()
+	case 1:
+		s.DeltaPicOrderAlwaysZero = r.flag()
+		s.OffsetForNonRefPic = r.se()
+		s.OffsetForTopToBottomField = r.se()
+		n := r.ue()
+		if n > 255 {
+			return nil, ErrUnsupported
+		}
+		s.OffsetForRefFrame = make([]int32, n)
+		for i := range s.OffsetForRefFrame {
+			s.OffsetForRefFrame[i] = r.se()
+		}
+	}
+	s.MaxNumRefFrames = r.ue()
+	s.GapsInFrameNumValueAllowed = r.flag()
+	s.PicWidthInMbsMinus1 = r.ue()
+	s.PicHeightInMapUnitsMinus1 = r.ue()
+	s.FrameMbsOnly = r.flag()
+	if !s.FrameMbsOnly {
+		s.MbAdaptiveFrameField = r.flag()
+	}
+	s.Direct8x8Inference = r.flag()
+	s.FrameCropping = r.flag()
+	if s.FrameCropping {
+		s.CropLeft = r.ue()
+		s.CropRight = r.ue()
+		s.CropTop = r.ue()
+		s.CropBottom = r.ue()
+	}
+	s.VuiParametersPresent = r.flag()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if s.Log2MaxFrameNumMinus4 > 12 || s.Log2MaxPicOrderCntLsbMinus4 > 12 || s.PicOrderCntType > 2 {
+		return nil, ErrUnsupported
+	}
+	return s, nil
+}
+
+func (s *Sps) MaxFrameNum() uint32 {
+	return 1 << (s.Log2MaxFrameNumMinus4 + 4)
+}
+
+func (s *Sps) MaxPicOrderCntLsb() uint32 {
+	return 1 << (s.Log2MaxPicOrderCntLsbMinus4 + 4)
+}
+
+// ChromaArrayType is 0 for monochrome and separately coded colour planes.
+func (s *Sps) ChromaArrayType() uint32 {
+	if s.SeparateColourPlane {
+		return 0
+	}
+	return s.ChromaFormatIdc
+}
+
+// Width returns the width of the decoded frame, before cropping.
+func (s *Sps) Width() uint32 {
+	return (s.PicWidthInMbsMinus1 + 1) * 16
+}
+
+// Height returns the height of the decoded frame, before cropping.
+func (s *Sps) Height() uint32 {
+	height := (s.PicHeightInMapUnitsMinus1 + 1) * 16
+	if !s.FrameMbsOnly {
+		height *= 2
+	}
+	return height
+}
+
+// Crop returns the visible rectangle of decoded frames.
+func (s *Sps) Crop() v4l2.Rect {
+	unitX, unitY := uint32(1), uint32(1)
+	if !s.FrameMbsOnly {
+		unitY = 2
+	}
+	switch s.ChromaArrayType() {
+	case 1:
+		unitX, unitY = 2, unitY*2
+	case 2:
+		unitX = 2
+	}
+	return v4l2.Rect{
+		Left:   int32(s.CropLeft * unitX),
+		Top:    int32(s.CropTop * unitY),
+		Width:  s.Width() - (s.CropLeft+s.CropRight)*unitX,
+		Height: s.Height() - (s.CropTop+s.CropBottom)*unitY,
+	}
+}
+
+// Control returns the V4L2_CID_STATELESS_H264_SPS payload.
+func (s *Sps) Control() v4l2.CtrlH264Sps {
+	c := v4l2.CtrlH264Sps{
+		ProfileIdc:                     s.ProfileIdc,
+		ConstraintSetFlags:             s.ConstraintSetFlags,
+		LevelIdc:                       s.LevelIdc,
+		SeqParameterSetId:              uint8(s.Id),
+		ChromaFormatIdc:                uint8(s.ChromaFormatIdc),
+		BitDepthLumaMinus8:             uint8(s.BitDepthLumaMinus8),
+		BitDepthChromaMinus8:           uint8(s.BitDepthChromaMinus8),
+		Log2MaxFrameNumMinus4:          uint8(s.Log2MaxFrameNumMinus4),
+		PicOrderCntType:                uint8(s.PicOrderCntType),
+		Log2MaxPicOrderCntLsbMinus4:    uint8(s.Log2MaxPicOrderCntLsbMinus4),
+		MaxNumRefFrames:                uint8(s.MaxNumRefFrames),
+		NumRefFramesInPicOrderCntCycle: uint8(len(s.OffsetForRefFrame)),
+		OffsetForNonRefPic:             s.OffsetForNonRefPic,
+		OffsetForTopToBottomField:      s.OffsetForTopToBottomField,
+		PicWidthInMbsMinus1:            uint16(s.PicWidthInMbsMinus1),
+		PicHeightInMapUnitsMinus1:      uint16(s.PicHeightInMapUnitsMinus1),
+	}
+	copy(c.OffsetForRefFrame[:], s.OffsetForRefFrame)
+	flags := []struct {
+		set  bool
+		flag uint32
+	}{
+		{s.SeparateColourPlane, v4l2.H264SpsFlag_SeparateColourPlane},
+		{s.QpprimeYZeroTransformBypass, v4l2.H264SpsFlag_QpprimeYZeroTransformBypass},
+		{s.DeltaPicOrderAlwaysZero, v4l2.H264SpsFlag_DeltaPicOrderAlwaysZero},
+		{s.GapsInFrameNumValueAllowed, v4l2.H264SpsFlag_GapsInFrameNumValueAllowed},
+		{s.FrameMbsOnly, v4l2.H264SpsFlag_FrameMbsOnly},
+		{s.MbAdaptiveFrameField, v4l2.H264SpsFlag_MbAdaptiveFrameField},
+		{s.Direct8x8Inference, v4l2.H264SpsFlag_Direct8x8Inference},
+	}
+	for _, f := range flags {
+		if f.set {
+			c.Flags |= f.flag
+		}
+	}
+	return c
+}
@@ -0,0 +1,297 @@
+package h264
+
+import (
+	"reflect"
+	"testing"
+)
+
+// bitWriter writes the syntax elements read by bitReader.
+type bitWriter struct {
+	data []byte
+	n    int // bits written
+}
+
+func (w *bitWriter) u(n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.data[len(w.data)-1] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) flag(v bool) {
+	if v {
+		w.u(1, 1)
+	} else {
+		w.u(1, 0)
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	bits := 0
+	for (v+1)>>uint(bits) > 1 {
+		bits++
+	}
+	w.u(bits, 0)
+	w.u(bits+1, v+1)
+}
+
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+// rbsp returns the data followed by rbsp_trailing_bits().
+func (w *bitWriter) rbsp() []byte {
+	w.u(1, 1)
+	for w.n%8 != 0 {
+		w.u(1, 0)
+	}
+	return w.data
+}
+
+// nal returns a NAL unit with the RBSP of w, emulation prevention included.
+func (w *bitWriter) nal(refIdc uint8, t NalType) []byte {
+	nal := []byte{refIdc<<5 | uint8(t)}
+	zeros := 0
+	for _, b := range w.rbsp() {
+		if zeros >= 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, b)
+	}
+	return nal
+}
+
+// spsConfig holds the fields of the SPS written by writeSps.
+type spsConfig struct {
+	profile     uint8
+	matrix      []int // lists sent with a uniform value, nil for none
+	maxRefs     uint32
+	log2PocLsb  uint32 // minus 4
+	widthInMbs  uint32
+	heightInMbs uint32
+}
+
+func writeSps(c spsConfig) *bitWriter {
+	w := &bitWriter{}
+	w.u(8, uint32(c.profile))
+	w.u(8, 0) // constraint_set_flags
+	w.u(8, 30)
+	w.ue(0) // seq_parameter_set_id
+	if c.profile == 100 {
+		w.ue(1) // chroma_format_idc
+		w.ue(0) // bit_depth_luma_minus8
+		w.ue(0) // bit_depth_chroma_minus8
+		w.flag(false)
+		w.flag(c.matrix != nil)
+		if c.matrix != nil {
+			writeScalingLists(w, 8, c.matrix)
+		}
+	}
+	w.ue(0) // log2_max_frame_num_minus4
+	w.ue(0) // pic_order_cnt_type
+	w.ue(c.log2PocLsb)
+	w.ue(c.maxRefs)
+	w.flag(false) // gaps_in_frame_num_value_allowed_flag
+	w.ue(c.widthInMbs - 1)
+	w.ue(c.heightInMbs - 1)
+	w.flag(true) // frame_mbs_only_flag
+	w.flag(true) // direct_8x8_inference_flag
+	w.flag(false)
+	w.flag(false)
+	return w
+}
+
+// writePps writes a PPS with a 8x8 transform and the lists of matrix, if
+// not nil.
+func writePps(matrix []int) *bitWriter {
+	w := &bitWriter{}
+	w.ue(0) // pic_parameter_set_id
+	w.ue(0) // seq_parameter_set_id
+	w.flag(false)
+	w.flag(false)
+	w.ue(0) // num_slice_groups_minus1
+	w.ue(0) // num_ref_idx_l0_default_active_minus1
+	w.ue(0) // num_ref_idx_l1_default_active_minus1
+	w.flag(false)
+	w.u(2, 0)
+	w.se(0) // pic_init_qp_minus26
+	w.se(0) // pic_init_qs_minus26
+	w.se(0) // chroma_qp_index_offset
+	w.flag(false)
+	w.flag(false)
+	w.flag(false)
+	if matrix != nil {
+		w.flag(true) // transform_8x8_mode_flag
+		w.flag(true)
+		writeScalingLists(w, 8, matrix)
+		w.se(0) // second_chroma_qp_index_offset
+	}
+	return w
+}
+
+// writeScalingLists writes count lists: values holds a value per list, 0
+// for a list that is not present and -1 for the default list.
+func writeScalingLists(w *bitWriter, count int, values []int) {
+	for i := 0; i < count; i++ {
+		v := 0
+		if i < len(values) {
+			v = values[i]
+		}
+		w.flag(v != 0)
+		switch {
+		case v < 0:
+			w.se(-8)
+		case v > 0:
+			w.se(int32(v - 8))
+			size := 16
+			if i >= 6 {
+				size = 64
+			}
+			for j := 1; j < size; j++ {
+				w.se(0)
+			}
+		}
+	}
+}
+
+func uniform4x4(v uint8) (l [16]uint8) {
+	for i := range l {
+		l[i] = v
+	}
+	return l
+}
+
+func uniform8x8(v uint8) (l [64]uint8) {
+	for i := range l {
+		l[i] = v
+	}
+	return l
+}
+
+func TestParseSps(t *testing.T) {
+	w := writeSps(spsConfig{profile: 77, maxRefs: 2, log2PocLsb: 2, widthInMbs: 20, heightInMbs: 15})
+	sps, err := ParseSps(w.rbsp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Sps{
+		ProfileIdc:                  77,
+		LevelIdc:                    30,
+		ChromaFormatIdc:             1,
+		ScalingLists:                flatScalingLists(),
+		Log2MaxPicOrderCntLsbMinus4: 2,
+		MaxNumRefFrames:             2,
+		PicWidthInMbsMinus1:         19,
+		PicHeightInMapUnitsMinus1:   14,
+		FrameMbsOnly:                true,
+		Direct8x8Inference:          true,
+	}
+	if !reflect.DeepEqual(sps, want) {
+		t.Errorf("got %+v\nwant %+v", sps, want)
+	}
+	if sps.Width() != 320 || sps.Height() != 240 {
+		t.Errorf("size %dx%d, want 320x240", sps.Width(), sps.Height())
+	}
+	if sps.MaxFrameNum() != 16 || sps.MaxPicOrderCntLsb() != 64 {
+		t.Errorf("MaxFrameNum %d, MaxPicOrderCntLsb %d", sps.MaxFrameNum(), sps.MaxPicOrderCntLsb())
+	}
+}
+
+func parseParameterSets(t *testing.T, spsMatrix, ppsMatrix []int) (*Sps, *Pps) {
+	t.Helper()
+	sps, err := ParseSps(writeSps(spsConfig{profile: 100, matrix: spsMatrix, widthInMbs: 1, heightInMbs: 1}).rbsp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pps, err := ParsePps(writePps(ppsMatrix).rbsp(), map[uint32]*Sps{0: sps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sps, pps
+}
+
+func TestScalingLists(t *testing.T) {
+	tests := []struct {
+		name       string
+		sps, pps   []int
+		spsLists   ScalingLists
+		ppsLists   ScalingLists
+		ppsPresent bool
+	}{
+		{
+			name:     "flat",
+			spsLists: flatScalingLists(),
+			ppsLists: flatScalingLists(),
+		},
+		{
+			// Rule A: lists 0, 3, 6 and 7 fall back to the defaults,
+			// the others to the previous list.
+			name: "sps rule A",
+			sps:  []int{20, 0, 21, 0, 0, 0, 0, -1},
+			spsLists: ScalingLists{
+				List4x4: [6][16]uint8{uniform4x4(20), uniform4x4(20), uniform4x4(21), default4x4Inter, default4x4Inter, default4x4Inter},
+				List8x8: [6][64]uint8{default8x8Intra, default8x8Inter, uniform8x8(16), uniform8x8(16), uniform8x8(16), uniform8x8(16)},
+			},
+		},
+		{
+			// An SPS without a matrix does not provide rule B lists.
+			name:     "pps rule A",
+			pps:      []int{20, 0, 0, 0, 0, 0, 0, 22},
+			spsLists: flatScalingLists(),
+			ppsLists: ScalingLists{
+				List4x4: [6][16]uint8{uniform4x4(20), uniform4x4(20), uniform4x4(20), default4x4Inter, default4x4Inter, default4x4Inter},
+				List8x8: [6][64]uint8{default8x8Intra, uniform8x8(22), uniform8x8(16), uniform8x8(16), uniform8x8(16), uniform8x8(16)},
+			},
+			ppsPresent: true,
+		},
+		{
+			// Rule B: lists 0, 3, 6 and 7 fall back to those of the SPS.
+			name: "pps rule B",
+			sps:  []int{20, 0, 0, 24, 0, 0, 30, 31},
+			pps:  []int{0, 21, 0, 0, 0, 0, 0, -1},
+			spsLists: ScalingLists{
+				List4x4: [6][16]uint8{uniform4x4(20), uniform4x4(20), uniform4x4(20), uniform4x4(24), uniform4x4(24), uniform4x4(24)},
+				List8x8: [6][64]uint8{uniform8x8(30), uniform8x8(31), uniform8x8(16), uniform8x8(16), uniform8x8(16), uniform8x8(16)},
+			},
+			ppsLists: ScalingLists{
+				List4x4: [6][16]uint8{uniform4x4(20), uniform4x4(21), uniform4x4(21), uniform4x4(24), uniform4x4(24), uniform4x4(24)},
+				List8x8: [6][64]uint8{uniform8x8(30), default8x8Inter, uniform8x8(16), uniform8x8(16), uniform8x8(16), uniform8x8(16)},
+			},
+			ppsPresent: true,
+		},
+	}
+	for _, test := range tests {
+		sps, pps := parseParameterSets(t, test.sps, test.pps)
+		if sps.ScalingMatrixPresent != (test.sps != nil) {
+			t.Errorf("%s: SPS ScalingMatrixPresent %v", test.name, sps.ScalingMatrixPresent)
+		}
+		if !reflect.DeepEqual(sps.ScalingLists, test.spsLists) {
+			t.Errorf("%s: SPS lists\n got %v\nwant %v", test.name, sps.ScalingLists, test.spsLists)
+		}
+		ppsLists := test.ppsLists
+		if !test.ppsPresent {
+			ppsLists = test.spsLists
+		}
+		if pps.ScalingMatrixPresent != test.ppsPresent {
+			t.Errorf("%s: PPS ScalingMatrixPresent %v", test.name, pps.ScalingMatrixPresent)
+		}
+		if !reflect.DeepEqual(pps.ScalingLists, ppsLists) {
+			t.Errorf("%s: PPS lists\n got %v\nwant %v", test.name, pps.ScalingLists, ppsLists)
+		}
+	}
+}
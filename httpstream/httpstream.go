@@ -0,0 +1,276 @@
+// Package httpstream serves captured frames over HTTP as a
+// multipart/x-mixed-replace MJPEG stream, the format browsers show in an
+// <img> element, and as single JPEG snapshots.
+package httpstream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/paskozdilar/go-v4l2/snapshot"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrClosed = errors.New("httpstream: server is closed")
+
+const (
+	DefaultQuality = 85
+	SnapshotPath   = "/snapshot.jpg"
+	boundary       = "frame"
+)
+
+// Source produces frames, typically by dequeuing capture buffers. The
+// frame may be reused once ReadFrame is called again.
+type Source interface {
+	ReadFrame() ([]byte, v4l2.PixFormat, error)
+}
+
+type rawFrame struct {
+	data     []byte
+	format   v4l2.PixFormat
+	sequence uint64
+}
+
+type jpegFrame struct {
+	data     []byte
+	sequence uint64 // of the raw frame it was encoded from
+}
+
+// client is a connected stream. Its channel holds at most the latest
+// frame, older ones are dropped when the client falls behind.
+type client struct {
+	frames chan *jpegFrame
+}
+
+// Server is an http.Handler serving SnapshotPath with the latest frame and
+// any other path with the MJPEG stream. Frames are handed to it with
+// Publish, which never blocks; raw formats are encoded to JPEG in the
+// background only while someone is watching.
+type Server struct {
+	quality int
+
+	mu      sync.Mutex
+	raw     *rawFrame
+	jpeg    *jpegFrame
+	clients map[*client]struct{}
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// NewServer returns a Server encoding raw frames at the given JPEG quality,
+// 0 for DefaultQuality. Close stops it.
+func NewServer(quality int) *Server {
+	if quality == 0 {
+		quality = DefaultQuality
+	}
+	s := &Server{
+		quality: quality,
+		clients: make(map[*client]struct{}),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go s.encodeLoop()
+	return s
+}
+
+// Publish makes frame the latest one. The frame is copied, so the caller
+// may requeue its buffer right away.
+func (s *Server) Publish(frame []byte, format *v4l2.PixFormat) {
+	data := append([]byte(nil), frame...)
+	s.mu.Lock()
+	sequence := uint64(1)
+	if s.raw != nil {
+		sequence = s.raw.sequence + 1
+	}
+	s.raw = &rawFrame{data: data, format: *format, sequence: sequence}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the frames of src until it fails or the server is closed.
+func (s *Server) Run(src Source) error {
+	for {
+		select {
+		case <-s.done:
+			return ErrClosed
+		default:
+		}
+		frame, format, err := src.ReadFrame()
+		if err != nil {
+			return err
+		}
+		s.Publish(frame, &format)
+	}
+}
+
+// Close disconnects the clients and stops encoding.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+	close(s.done)
+	return nil
+}
+
+// encodeLoop encodes the latest frame for the stream clients, skipping
+// frames published while it was busy.
+func (s *Server) encodeLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		s.mu.Lock()
+		raw, watched := s.raw, len(s.clients) > 0
+		s.mu.Unlock()
+		if raw == nil || !watched {
+			continue
+		}
+		frame, err := s.encode(raw)
+		if err != nil {
+			// Corrupt frames happen, keep showing the last good one.
+			continue
+		}
+		s.mu.Lock()
+		for c := range s.clients {
+			select {
+			case c.frames <- frame:
+			default:
+				// Replace the frame the client has not taken yet.
+				select {
+				case <-c.frames:
+				default:
+				}
+				c.frames <- frame
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// encode returns raw as JPEG, reusing the last encoded frame if it is the
+// same one.
+func (s *Server) encode(raw *rawFrame) (*jpegFrame, error) {
+	s.mu.Lock()
+	last := s.jpeg
+	s.mu.Unlock()
+	if last != nil && last.sequence == raw.sequence {
+		return last, nil
+	}
+	data, err := snapshot.Snapshot(raw.data, &raw.format, s.quality)
+	if err != nil {
+		return nil, err
+	}
+	frame := &jpegFrame{data: data, sequence: raw.sequence}
+	s.mu.Lock()
+	if s.jpeg == nil || s.jpeg.sequence < frame.sequence {
+		s.jpeg = frame
+	}
+	s.mu.Unlock()
+	return frame, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, SnapshotPath) {
+		s.serveSnapshot(w, r)
+	} else {
+		s.serveStream(w, r)
+	}
+}
+
+func (s *Server) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	raw := s.raw
+	s.mu.Unlock()
+	if raw == nil {
+		http.Error(w, "no frame captured yet", http.StatusServiceUnavailable)
+		return
+	}
+	frame, err := s.encode(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "image/jpeg")
+	h.Set("Content-Length", fmt.Sprint(len(frame.data)))
+	h.Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(frame.data)
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	h.Set("Cache-Control", "no-store")
+	h.Set("Connection", "close")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	c := &client{frames: make(chan *jpegFrame, 1)}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+	// Start with the latest frame rather than waiting for the next one.
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.WriteHeader(http.StatusOK)
+	for {
+		var frame *jpegFrame
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case frame = <-c.frames:
+		}
+		_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n",
+			boundary, len(frame.data))
+		if err == nil {
+			_, err = w.Write(frame.data)
+		}
+		if err == nil {
+			_, err = w.Write([]byte("\r\n"))
+		}
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
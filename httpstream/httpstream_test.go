@@ -0,0 +1,269 @@
+package httpstream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var testFormat = v4l2.PixFormat{Width: 16, Height: 16, PixelFormat: v4l2.PixFmt_Grey, BytesPerLine: 16}
+
+// source is a fake capture device returning the frames sent on its
+// channel, and io.EOF once it is closed.
+type source chan []byte
+
+func (s source) ReadFrame() ([]byte, v4l2.PixFormat, error) {
+	frame, ok := <-s
+	if !ok {
+		return nil, v4l2.PixFormat{}, io.EOF
+	}
+	return frame, testFormat, nil
+}
+
+// grey returns a frame of testFormat filled with v.
+func grey(v uint8) []byte {
+	return bytes.Repeat([]byte{v}, 16*16)
+}
+
+// level returns the grey level of a JPEG frame.
+func level(t *testing.T, data []byte) uint8 {
+	t.Helper()
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 16 {
+		t.Fatalf("%v image, want 16x16", b)
+	}
+	return color.GrayModel.Convert(img.At(8, 8)).(color.Gray).Y
+}
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	s := NewServer(0)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+	})
+	return s, ts
+}
+
+// stream requests the MJPEG stream and returns a reader of its parts.
+func stream(t *testing.T, url string) (*http.Response, *textproto.Reader) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" || params["boundary"] != boundary {
+		t.Fatalf("Content-Type %q", resp.Header.Get("Content-Type"))
+	}
+	return resp, textproto.NewReader(bufio.NewReader(resp.Body))
+}
+
+// nextFrame returns the grey level of the next frame of a stream. The end
+// of a part is only known from its length: a multipart.Reader would wait
+// for the boundary of the next frame.
+func nextFrame(t *testing.T, r *textproto.Reader) uint8 {
+	t.Helper()
+	line, err := r.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "--"+boundary {
+		t.Fatalf("boundary line %q", line)
+	}
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := h.Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("part Content-Type %q", ct)
+	}
+	n, err := strconv.Atoi(h.Get("Content-Length"))
+	if err != nil {
+		t.Fatalf("part Content-Length %q", h.Get("Content-Length"))
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r.R, data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		t.Errorf("part not followed by CRLF")
+	}
+	return level(t, data[:n])
+}
+
+func TestSnapshot(t *testing.T) {
+	s, ts := newTestServer(t)
+	resp, err := http.Get(ts.URL + SnapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("snapshot before the first frame: %d", resp.StatusCode)
+	}
+
+	s.Publish(grey(100), &testFormat)
+	resp, err = http.Get(ts.URL + SnapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("snapshot: %d %v", resp.StatusCode, resp.Header)
+	}
+	if v := level(t, data); v < 99 || v > 101 {
+		t.Errorf("snapshot level %d, want 100", v)
+	}
+
+	resp, err = http.Head(ts.URL + SnapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ContentLength != int64(len(data)) {
+		t.Errorf("HEAD Content-Length %d, want %d", resp.ContentLength, len(data))
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+SnapshotPath, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", resp.StatusCode)
+	}
+}
+
+func TestStream(t *testing.T) {
+	s, ts := newTestServer(t)
+	src := make(source)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(src) }()
+
+	src <- grey(50)
+	_, r := stream(t, ts.URL+"/stream.mjpg")
+	// The stream starts with the frame published before the request.
+	if v := nextFrame(t, r); v < 49 || v > 51 {
+		t.Fatalf("first frame level %d, want 50", v)
+	}
+	for _, want := range []uint8{100, 150, 200} {
+		src <- grey(want)
+		if v := nextFrame(t, r); v < want-1 || v > want+1 {
+			t.Fatalf("frame level %d, want %d", v, want)
+		}
+	}
+	close(src)
+	if err := <-done; err != io.EOF {
+		t.Errorf("Run: %v, want io.EOF", err)
+	}
+}
+
+// waitFrame waits until the frame of c is the one of the given sequence.
+func waitFrame(t *testing.T, s *Server, c *client, sequence uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		// The encoder only hands out frames with the lock held.
+		s.mu.Lock()
+		var frame *jpegFrame
+		select {
+		case frame = <-c.frames:
+			c.frames <- frame
+		default:
+		}
+		s.mu.Unlock()
+		if frame != nil && frame.sequence == sequence {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("frame %d never queued", sequence)
+}
+
+func TestSlowClient(t *testing.T) {
+	s := NewServer(0)
+	defer s.Close()
+	c := &client{frames: make(chan *jpegFrame, 1)}
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	// A client that does not keep up only gets the latest frame, without
+	// holding up the others.
+	for i := 1; i <= 4; i++ {
+		s.Publish(grey(uint8(50*i)), &testFormat)
+		waitFrame(t, s, c, uint64(i))
+	}
+	frame := <-c.frames
+	if v := level(t, frame.data); v < 199 || v > 201 {
+		t.Errorf("frame level %d, want 200", v)
+	}
+	if len(c.frames) != 0 {
+		t.Errorf("%d frames left", len(c.frames))
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, ts := newTestServer(t)
+	src := make(source, 1)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(src) }()
+
+	src <- grey(50)
+	resp, r := stream(t, ts.URL+"/")
+	nextFrame(t, r)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The stream ends instead of waiting for the next frame.
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("reading the closed stream: %v", err)
+	}
+	if err := s.Close(); err != ErrClosed {
+		t.Errorf("second Close: %v, want ErrClosed", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("stream after Close: %d", resp.StatusCode)
+	}
+	src <- grey(100)
+	if err := <-done; err != ErrClosed {
+		t.Errorf("Run: %v, want ErrClosed", err)
+	}
+}
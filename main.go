@@ -14,6 +14,16 @@ func main() {
 	// Configure logger
 	log.SetFlags(log.Flags() | log.Lshortfile)
 
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		snapshotMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serveMain(os.Args[2:])
+		return
+	}
+
 	// Parse device path
 	var devPath string
 	flag.StringVar(&devPath, "dev-path", "/dev/video0", "Video4linux device path")
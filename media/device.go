@@ -0,0 +1,62 @@
+package media
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Device is an open media controller device node.
+type Device struct {
+	file *os.File
+	fd   uintptr
+}
+
+func Open(path string) (*Device, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{file: f, fd: f.Fd()}, nil
+}
+
+func (d *Device) Close() error {
+	return d.file.Close()
+}
+
+func (d *Device) Fd() uintptr {
+	return d.fd
+}
+
+func (d *Device) Ioctl(request Ioc, arg unsafe.Pointer) error {
+	return ioctl(d.fd, request, arg)
+}
+
+func (d *Device) DeviceInfo() (DeviceInfo, error) {
+	info := DeviceInfo{}
+	err := d.Ioctl(MediaIoc_DeviceInfo, unsafe.Pointer(&info))
+	return info, err
+}
+
+// AllocRequest allocates a new request. Requests can be reused after
+// completion with Reinit.
+func (d *Device) AllocRequest() (*Request, error) {
+	var fd int32
+	if err := d.Ioctl(MediaIoc_RequestAlloc, unsafe.Pointer(&fd)); err != nil {
+		return nil, err
+	}
+	return &Request{fd: fd}, nil
+}
+
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
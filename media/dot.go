@@ -0,0 +1,59 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDot writes the data links of the topology as a Graphviz graph, in
+// the style of media-ctl --print-dot. Disabled links are dashed and
+// immutable ones bold.
+func (t *Topology) WriteDot(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "digraph board {\n\trankdir=TB\n")
+	for _, e := range t.Entities {
+		var sinks, sources []string
+		for _, p := range e.Pads {
+			port := fmt.Sprintf("<port%d> %d", p.Index, p.Index)
+			if p.IsSink() {
+				sinks = append(sinks, port)
+			} else {
+				sources = append(sources, port)
+			}
+		}
+		label := dotEscape(e.Name)
+		if node := e.DevNode(); node != "" {
+			label += "\\n" + node
+		}
+		color := "green"
+		if e.Function == EntF_IoV4l {
+			color = "yellow"
+		}
+		fmt.Fprintf(b, "\tn%08x [label=\"{{%s} | %s | {%s}}\", shape=Mrecord, style=filled, fillcolor=%s]\n",
+			e.Id, strings.Join(sinks, " | "), label, strings.Join(sources, " | "), color)
+	}
+	for _, l := range t.Links {
+		var style []string
+		if !l.Enabled() {
+			style = append(style, "dashed")
+		}
+		if l.Immutable() {
+			style = append(style, "bold")
+		}
+		fmt.Fprintf(b, "\tn%08x:port%d -> n%08x:port%d",
+			l.Source.Entity.Id, l.Source.Index, l.Sink.Entity.Id, l.Sink.Index)
+		if len(style) > 0 {
+			fmt.Fprintf(b, " [style=\"%s\"]", strings.Join(style, ","))
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	fmt.Fprintf(b, "}\n")
+	return b.Flush()
+}
+
+func dotEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`)
+	return r.Replace(s)
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// SetupLink enables or disables a data link. Only LnkFl_Enabled can be
+// changed, immutable links are always enabled.
+func (d *Device) SetupLink(source, sink *Pad, flags LnkFl) error {
+	desc := LinkDesc{
+		Source: PadDesc{Entity: source.Entity.Id, Index: uint16(source.Index), Flags: source.Flags},
+		Sink:   PadDesc{Entity: sink.Entity.Id, Index: uint16(sink.Index), Flags: sink.Flags},
+		Flags:  flags,
+	}
+	return d.Ioctl(MediaIoc_SetupLink, unsafe.Pointer(&desc))
+}
+
+// EnumLinks returns the pads of an entity and its outbound data links
+// with MEDIA_IOC_ENUM_LINKS. The topology sizes the result.
+func (d *Device) EnumLinks(e *Entity) ([]PadDesc, []LinkDesc, error) {
+	numLinks := 0
+	for _, p := range e.Pads {
+		if p.IsSource() {
+			numLinks += len(p.Links)
+		}
+	}
+	pads := make([]PadDesc, len(e.Pads)+1)
+	links := make([]LinkDesc, numLinks+1)
+	enum := LinksEnum{
+		Entity: e.Id,
+		Pads:   uintptr(unsafe.Pointer(&pads[0])),
+		Links:  uintptr(unsafe.Pointer(&links[0])),
+	}
+	err := d.Ioctl(MediaIoc_EnumLinks, unsafe.Pointer(&enum))
+	runtime.KeepAlive(pads)
+	runtime.KeepAlive(links)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pads[:len(e.Pads)], links[:numLinks], nil
+}
+
+// Link returns the data link between two pads, or nil.
+func (t *Topology) Link(source, sink *Pad) *Link {
+	for _, l := range source.Links {
+		if l.Source == source && l.Sink == sink {
+			return l
+		}
+	}
+	return nil
+}
+
+// ResetLinks disables all links that are not immutable, like media-ctl -r.
+func (d *Device) ResetLinks(t *Topology) error {
+	for _, l := range t.Links {
+		if l.Immutable() || !l.Enabled() {
+			continue
+		}
+		if err := d.SetupLink(l.Source, l.Sink, l.Flags&^LnkFl_Enabled); err != nil {
+			return err
+		}
+		l.Flags &^= LnkFl_Enabled
+	}
+	return nil
+}
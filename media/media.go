@@ -0,0 +1,263 @@
+package media
+
+import "unsafe"
+
+// media.h
+
+type DeviceInfo struct {
+	Driver        [16]uint8
+	Model         [32]uint8
+	Serial        [40]uint8
+	BusInfo       [32]uint8
+	MediaVersion  uint32
+	HwRevision    uint32
+	DriverVersion uint32
+	Reserved      [31]uint32
+}
+
+type EntF uint32 // Entity function
+
+const (
+	EntF_Base          EntF = 0x00000000
+	EntF_OldBase       EntF = 0x00010000
+	EntF_OldSubdevBase EntF = 0x00020000
+
+	EntF_Unknown           EntF = EntF_Base
+	EntF_V4l2SubdevUnknown EntF = EntF_OldSubdevBase
+
+	EntF_DtvDemod    EntF = EntF_Base + 0x00001
+	EntF_TsDemux     EntF = EntF_Base + 0x00002
+	EntF_DtvCa       EntF = EntF_Base + 0x00003
+	EntF_DtvNetDecap EntF = EntF_Base + 0x00004
+
+	EntF_ConnRf        EntF = EntF_Base + 0x30001
+	EntF_ConnSvideo    EntF = EntF_Base + 0x30002
+	EntF_ConnComposite EntF = EntF_Base + 0x30003
+
+	EntF_IoV4l     EntF = EntF_OldBase + 1
+	EntF_IoDtv     EntF = EntF_Base + 0x01001
+	EntF_IoVbi     EntF = EntF_Base + 0x01002
+	EntF_IoSwradio EntF = EntF_Base + 0x01003
+
+	EntF_CamSensor  EntF = EntF_OldSubdevBase + 1
+	EntF_Flash      EntF = EntF_OldSubdevBase + 2
+	EntF_Lens       EntF = EntF_OldSubdevBase + 3
+	EntF_AtvDecoder EntF = EntF_OldSubdevBase + 4
+	EntF_Tuner      EntF = EntF_OldSubdevBase + 5
+
+	EntF_IfVidDecoder EntF = EntF_Base + 0x02001
+	EntF_IfAudDecoder EntF = EntF_Base + 0x02002
+
+	EntF_AudioCapture  EntF = EntF_Base + 0x03001
+	EntF_AudioPlayback EntF = EntF_Base + 0x03002
+	EntF_AudioMixer    EntF = EntF_Base + 0x03003
+
+	EntF_ProcVideoComposer       EntF = EntF_Base + 0x4001
+	EntF_ProcVideoPixelFormatter EntF = EntF_Base + 0x4002
+	EntF_ProcVideoPixelEncConv   EntF = EntF_Base + 0x4003
+	EntF_ProcVideoLut            EntF = EntF_Base + 0x4004
+	EntF_ProcVideoScaler         EntF = EntF_Base + 0x4005
+	EntF_ProcVideoStatistics     EntF = EntF_Base + 0x4006
+	EntF_ProcVideoEncoder        EntF = EntF_Base + 0x4007
+	EntF_ProcVideoDecoder        EntF = EntF_Base + 0x4008
+	EntF_ProcVideoIsp            EntF = EntF_Base + 0x4009
+
+	EntF_VidMux      EntF = EntF_Base + 0x5001
+	EntF_VidIfBridge EntF = EntF_Base + 0x5002
+
+	EntF_DvDecoder EntF = EntF_Base + 0x6001
+	EntF_DvEncoder EntF = EntF_Base + 0x6002
+)
+
+type EntFl uint32 // Entity flags
+
+const (
+	EntFl_Default   EntFl = 1 << 0
+	EntFl_Connector EntFl = 1 << 1
+)
+
+type PadFl uint32 // Pad flags
+
+const (
+	PadFl_Sink        PadFl = 1 << 0
+	PadFl_Source      PadFl = 1 << 1
+	PadFl_MustConnect PadFl = 1 << 2
+)
+
+type LnkFl uint32 // Link flags
+
+const (
+	LnkFl_Enabled   LnkFl = 1 << 0
+	LnkFl_Immutable LnkFl = 1 << 1
+	LnkFl_Dynamic   LnkFl = 1 << 2
+
+	LnkFl_LinkTypeMask  LnkFl = 0xf << 28
+	LnkFl_DataLink      LnkFl = 0 << 28
+	LnkFl_InterfaceLink LnkFl = 1 << 28
+	LnkFl_AncillaryLink LnkFl = 2 << 28
+)
+
+type IntfT uint32 // Interface type
+
+const (
+	IntfT_DvbBase  IntfT = 0x00000100
+	IntfT_V4lBase  IntfT = 0x00000200
+	IntfT_AlsaBase IntfT = 0x00000300
+
+	IntfT_DvbFe    IntfT = IntfT_DvbBase
+	IntfT_DvbDemux IntfT = IntfT_DvbBase + 1
+	IntfT_DvbDvr   IntfT = IntfT_DvbBase + 2
+	IntfT_DvbCa    IntfT = IntfT_DvbBase + 3
+	IntfT_DvbNet   IntfT = IntfT_DvbBase + 4
+
+	IntfT_V4lVideo   IntfT = IntfT_V4lBase
+	IntfT_V4lVbi     IntfT = IntfT_V4lBase + 1
+	IntfT_V4lRadio   IntfT = IntfT_V4lBase + 2
+	IntfT_V4lSubdev  IntfT = IntfT_V4lBase + 3
+	IntfT_V4lSwradio IntfT = IntfT_V4lBase + 4
+	IntfT_V4lTouch   IntfT = IntfT_V4lBase + 5
+
+	IntfT_AlsaPcmCapture  IntfT = IntfT_AlsaBase
+	IntfT_AlsaPcmPlayback IntfT = IntfT_AlsaBase + 1
+	IntfT_AlsaControl     IntfT = IntfT_AlsaBase + 2
+)
+
+// MEDIA_IOC_G_TOPOLOGY structs
+
+type V2Entity struct {
+	Id       uint32
+	Name     [64]uint8
+	Function EntF
+	Flags    EntFl
+	Reserved [5]uint32
+}
+
+type V2IntfDevnode struct {
+	Major uint32
+	Minor uint32
+}
+
+type V2Interface struct {
+	Id       uint32
+	IntfType IntfT
+	Flags    uint32
+	Reserved [9]uint32
+	Raw      [16]uint32
+	//	union {
+	//		V2IntfDevnode
+	//		[16]uint32
+	//	}
+}
+
+func (i *V2Interface) Devnode() *V2IntfDevnode {
+	return (*V2IntfDevnode)(unsafe.Pointer(&i.Raw))
+}
+
+type V2Pad struct {
+	Id       uint32
+	EntityId uint32
+	Flags    PadFl
+	Index    uint32
+	Reserved [4]uint32
+}
+
+type V2Link struct {
+	Id       uint32
+	SourceId uint32
+	SinkId   uint32
+	Flags    LnkFl
+	Reserved [6]uint32
+}
+
+type V2Topology struct {
+	TopologyVersion uint64
+	NumEntities     uint32
+	Reserved1       uint32
+	PtrEntities     uint64 // *V2Entity
+	NumInterfaces   uint32
+	Reserved2       uint32
+	PtrInterfaces   uint64 // *V2Interface
+	NumPads         uint32
+	Reserved3       uint32
+	PtrPads         uint64 // *V2Pad
+	NumLinks        uint32
+	Reserved4       uint32
+	PtrLinks        uint64 // *V2Link
+}
+
+// Legacy structs, still used for link setup
+
+type PadDesc struct {
+	Entity   uint32
+	Index    uint16
+	Flags    PadFl
+	Reserved [2]uint32
+}
+
+type LinkDesc struct {
+	Source   PadDesc
+	Sink     PadDesc
+	Flags    LnkFl
+	Reserved [2]uint32
+}
+
+type LinksEnum struct {
+	Entity   uint32
+	Pads     uintptr // *PadDesc
+	Links    uintptr // *LinkDesc
+	Reserved [4]uint32
+}
+
+type Ioc = uintptr // Media ioctl code
+
+var (
+	MediaIoc_DeviceInfo   Ioc = _IOWR('|', 0x00, unsafe.Sizeof(DeviceInfo{}))
+	MediaIoc_EnumLinks    Ioc = _IOWR('|', 0x02, unsafe.Sizeof(LinksEnum{}))
+	MediaIoc_SetupLink    Ioc = _IOWR('|', 0x03, unsafe.Sizeof(LinkDesc{}))
+	MediaIoc_GTopology    Ioc = _IOWR('|', 0x04, unsafe.Sizeof(V2Topology{}))
+	MediaIoc_RequestAlloc Ioc = _IOR('|', 0x05, unsafe.Sizeof(int32(0)))
+
+	MediaRequestIoc_Queue  Ioc = _IO('|', 0x80)
+	MediaRequestIoc_Reinit Ioc = _IO('|', 0x81)
+)
+
+// ioctl.h (but a little more golangy)
+
+func _IO(t rune, nr int) uintptr {
+	return _IOC(_IOC_NONE, t, nr, 0)
+}
+
+func _IOR(t rune, nr int, size uintptr) uintptr {
+	return _IOC(_IOC_READ, t, nr, size)
+}
+
+func _IOW(t rune, nr int, size uintptr) uintptr {
+	return _IOC(_IOC_WRITE, t, nr, size)
+}
+
+func _IOWR(t rune, nr int, size uintptr) uintptr {
+	return _IOC(_IOC_READ|_IOC_WRITE, t, nr, size)
+}
+
+func _IOC(dir int, t rune, nr int, size uintptr) uintptr {
+	return ((uintptr(dir) << _IOC_DIRSHIFT) |
+		(uintptr(t) << _IOC_TYPESHIFT) |
+		(uintptr(nr) << _IOC_NRSHIFT) |
+		(uintptr(size) << _IOC_SIZESHIFT))
+}
+
+const (
+	_IOC_NONE  = 0
+	_IOC_WRITE = 1
+	_IOC_READ  = 2
+
+	_IOC_NRBITS   = 8
+	_IOC_TYPEBITS = 8
+	_IOC_SIZEBITS = 14
+	_IOC_DIRBITS  = 2
+
+	_IOC_NRSHIFT   = 0
+	_IOC_TYPESHIFT = _IOC_NRSHIFT + _IOC_NRBITS
+	_IOC_SIZESHIFT = _IOC_TYPESHIFT + _IOC_TYPEBITS
+	_IOC_DIRSHIFT  = _IOC_SIZESHIFT + _IOC_SIZEBITS
+)
@@ -0,0 +1,675 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// PadRef names a pad as in media-ctl: an entity name or id and a pad
+// index.
+type PadRef struct {
+	Entity string
+	Pad    uint32
+}
+
+func (p PadRef) String() string {
+	return fmt.Sprintf("%q:%d", p.Entity, p.Pad)
+}
+
+// Resolve looks up the pad in the topology.
+func (p PadRef) Resolve(t *Topology) (*Pad, error) {
+	e := t.Entity(p.Entity)
+	if e == nil {
+		if id, err := strconv.ParseUint(p.Entity, 10, 32); err == nil {
+			e = t.EntityById(uint32(id))
+		}
+	}
+	if e == nil {
+		return nil, fmt.Errorf("media: no entity %q", p.Entity)
+	}
+	pad := e.Pad(p.Pad)
+	if pad == nil {
+		return nil, fmt.Errorf("media: entity %q has no pad %d", p.Entity, p.Pad)
+	}
+	return pad, nil
+}
+
+// LinkConfig is one link of a media-ctl -l description.
+type LinkConfig struct {
+	Source  PadRef
+	Sink    PadRef
+	Enabled bool
+}
+
+// FormatConfig is one pad of a media-ctl -V description. Zero values are
+// left unchanged.
+type FormatConfig struct {
+	Pad          PadRef
+	Code         v4l2.MbusFmt
+	Width        uint32
+	Height       uint32
+	Interval     v4l2.Fract
+	Field        v4l2.Field
+	Colorspace   v4l2.Colorspace
+	XferFunc     v4l2.XferFunc
+	YcbcrEnc     v4l2.YcbcrEncoding
+	Quantization v4l2.Quantization
+	Crop         *v4l2.Rect
+	Compose      *v4l2.Rect
+}
+
+// PipelineConfig is a declarative description of a media pipeline.
+type PipelineConfig struct {
+	Links   []LinkConfig
+	Formats []FormatConfig
+}
+
+// ParseLinks parses links in media-ctl -l syntax, e.g.
+//
+//	"imx219 1-0010":0 -> "csis":0 [1], "csis":1 -> 5:0 [1]
+func ParseLinks(s string) ([]LinkConfig, error) {
+	p := &pipelineParser{s: s}
+	var links []LinkConfig
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		var link LinkConfig
+		var err error
+		if link.Source, err = p.pad(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("->"); err != nil {
+			return nil, err
+		}
+		if link.Sink, err = p.pad(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		flags, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		link.Enabled = flags&uint64(LnkFl_Enabled) != 0
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+		if !p.next(",") {
+			break
+		}
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected input")
+	}
+	return links, nil
+}
+
+// ParseFormats parses pad formats in media-ctl -V syntax, with media bus
+// codes given by name or number, e.g.
+//
+//	"imx219 1-0010":0 [fmt:SRGGB10_1X10/1920x1080@1/30 field:none crop:(0,0)/1920x1080]
+func ParseFormats(s string) ([]FormatConfig, error) {
+	p := &pipelineParser{s: s}
+	var formats []FormatConfig
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		var format FormatConfig
+		var err error
+		if format.Pad, err = p.pad(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		for {
+			p.skipSpace()
+			if p.next("]") {
+				break
+			}
+			if p.eof() {
+				return nil, p.errorf("missing ]")
+			}
+			if err := p.property(&format); err != nil {
+				return nil, err
+			}
+		}
+		formats = append(formats, format)
+		if !p.next(",") {
+			break
+		}
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected input")
+	}
+	return formats, nil
+}
+
+type pipelineParser struct {
+	s   string
+	pos int
+}
+
+func (p *pipelineParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("media: %s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *pipelineParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *pipelineParser) skipSpace() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *pipelineParser) next(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *pipelineParser) expect(token string) error {
+	if !p.next(token) {
+		return p.errorf("expected %q", token)
+	}
+	return nil
+}
+
+// word reads up to the next space or one of the stop characters.
+func (p *pipelineParser) word(stop string) string {
+	start := p.pos
+	for !p.eof() && p.s[p.pos] != ' ' && strings.IndexByte(stop, p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *pipelineParser) number() (uint64, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("expected number")
+	}
+	return strconv.ParseUint(p.s[start:p.pos], 10, 32)
+}
+
+func (p *pipelineParser) pad() (PadRef, error) {
+	var ref PadRef
+	p.skipSpace()
+	if p.next(`"`) {
+		end := strings.IndexByte(p.s[p.pos:], '"')
+		if end < 0 {
+			return ref, p.errorf("unterminated entity name")
+		}
+		ref.Entity = p.s[p.pos : p.pos+end]
+		p.pos += end + 1
+	} else {
+		ref.Entity = p.word(":")
+	}
+	if ref.Entity == "" {
+		return ref, p.errorf("expected entity")
+	}
+	if err := p.expect(":"); err != nil {
+		return ref, err
+	}
+	pad, err := p.number()
+	ref.Pad = uint32(pad)
+	return ref, err
+}
+
+func (p *pipelineParser) size() (uint32, uint32, error) {
+	w, err := p.number()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := p.expect("x"); err != nil {
+		return 0, 0, err
+	}
+	h, err := p.number()
+	return uint32(w), uint32(h), err
+}
+
+func (p *pipelineParser) interval() (v4l2.Fract, error) {
+	num, err := p.number()
+	if err != nil {
+		return v4l2.Fract{}, err
+	}
+	if err := p.expect("/"); err != nil {
+		return v4l2.Fract{}, err
+	}
+	den, err := p.number()
+	return v4l2.Fract{Numerator: uint32(num), Denominator: uint32(den)}, err
+}
+
+// rect reads "(left,top)/widthxheight".
+func (p *pipelineParser) rect() (*v4l2.Rect, error) {
+	var values [2]int64
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for i := range values {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		p.skipSpace()
+		v, err := strconv.ParseInt(p.word(",)"), 10, 32)
+		if err != nil {
+			return nil, p.errorf("expected number")
+		}
+		values[i] = v
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("/"); err != nil {
+		return nil, err
+	}
+	w, h, err := p.size()
+	if err != nil {
+		return nil, err
+	}
+	return &v4l2.Rect{Left: int32(values[0]), Top: int32(values[1]), Width: w, Height: h}, nil
+}
+
+var (
+	fieldNames = map[string]v4l2.Field{
+		"any": v4l2.Field_Any, "none": v4l2.Field_None,
+		"top": v4l2.Field_Top, "bottom": v4l2.Field_Bottom,
+		"interlaced": v4l2.Field_Interlaced,
+		"seq-tb":     v4l2.Field_SeqTb, "seq-bt": v4l2.Field_SeqBt,
+		"alternate":     v4l2.Field_Alternate,
+		"interlaced-tb": v4l2.Field_InterlacedTb, "interlaced-bt": v4l2.Field_InterlacedBt,
+	}
+	colorspaceNames = map[string]v4l2.Colorspace{
+		"default": v4l2.Colorspace_Default, "smpte170m": v4l2.Colorspace_Smpte170M,
+		"smpte240m": v4l2.Colorspace_Smpte240M, "rec709": v4l2.Colorspace_Rec709,
+		"bt878": v4l2.Colorspace_Bt878, "470m": v4l2.Colorspace_470SystemM,
+		"470bg": v4l2.Colorspace_470SystemBg, "jpeg": v4l2.Colorspace_Jpeg,
+		"srgb": v4l2.Colorspace_Srgb, "oprgb": v4l2.Colorspace_Oprgb,
+		"bt2020": v4l2.Colorspace_Bt2020, "raw": v4l2.Colorspace_Raw,
+		"dcip3": v4l2.Colorspace_DciP3,
+	}
+	xferNames = map[string]v4l2.XferFunc{
+		"default": v4l2.XferFunc_Default, "709": v4l2.XferFunc_709,
+		"srgb": v4l2.XferFunc_Srgb, "oprgb": v4l2.XferFunc_Oprgb,
+		"smpte240m": v4l2.XferFunc_Smpte240m, "smpte2084": v4l2.XferFunc_Smpte2084,
+		"dcip3": v4l2.XferFunc_DciP3, "none": v4l2.XferFunc_None,
+	}
+	ycbcrNames = map[string]v4l2.YcbcrEncoding{
+		"default": v4l2.YcbcrEnc_Default, "601": v4l2.YcbcrEnc_601,
+		"709": v4l2.YcbcrEnc_709, "xv601": v4l2.YcbcrEnc_Xv601,
+		"xv709": v4l2.YcbcrEnc_Xv709, "bt2020": v4l2.YcbcrEnc_Bt2020,
+		"bt2020c": v4l2.YcbcrEnc_Bt2020ConstLum, "smpte240m": v4l2.YcbcrEnc_Smpte240M,
+	}
+	quantizationNames = map[string]v4l2.Quantization{
+		"default": v4l2.Quantization_Default, "full-range": v4l2.Quantization_FullRange,
+		"lim-range": v4l2.Quantization_LimRange,
+	}
+)
+
+func (p *pipelineParser) property(f *FormatConfig) error {
+	if p.next("@") {
+		var err error
+		f.Interval, err = p.interval()
+		return err
+	}
+	key := p.word(":]")
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	var ok bool
+	switch key {
+	case "fmt":
+		p.skipSpace()
+		name := p.word("/]")
+		if f.Code, ok = v4l2.ParseMbusFmt(name); !ok {
+			code, err := strconv.ParseUint(name, 0, 32)
+			if err != nil {
+				return p.errorf("unknown media bus code %q", name)
+			}
+			f.Code = v4l2.MbusFmt(code)
+		}
+		if err := p.expect("/"); err != nil {
+			return err
+		}
+		var err error
+		if f.Width, f.Height, err = p.size(); err != nil {
+			return err
+		}
+		if p.next("@") {
+			f.Interval, err = p.interval()
+		}
+		return err
+	case "crop", "compose":
+		r, err := p.rect()
+		if key == "crop" {
+			f.Crop = r
+		} else {
+			f.Compose = r
+		}
+		return err
+	}
+	p.skipSpace()
+	value := p.word("]")
+	switch key {
+	case "field":
+		f.Field, ok = fieldNames[value]
+	case "colorspace":
+		f.Colorspace, ok = colorspaceNames[value]
+	case "xfer":
+		f.XferFunc, ok = xferNames[value]
+	case "ycbcr":
+		f.YcbcrEnc, ok = ycbcrNames[value]
+	case "quantization":
+		f.Quantization, ok = quantizationNames[value]
+	default:
+		return p.errorf("unknown property %q", key)
+	}
+	if !ok {
+		return p.errorf("invalid %s %q", key, value)
+	}
+	return nil
+}
+
+// ApplyLinks enables and disables links as described.
+func (d *Device) ApplyLinks(t *Topology, links []LinkConfig) error {
+	for _, lc := range links {
+		source, err := lc.Source.Resolve(t)
+		if err != nil {
+			return err
+		}
+		sink, err := lc.Sink.Resolve(t)
+		if err != nil {
+			return err
+		}
+		link := t.Link(source, sink)
+		if link == nil {
+			return fmt.Errorf("media: no link %v -> %v", lc.Source, lc.Sink)
+		}
+		flags := link.Flags &^ LnkFl_Enabled
+		if lc.Enabled {
+			flags |= LnkFl_Enabled
+		}
+		if flags == link.Flags {
+			continue
+		}
+		if err := d.SetupLink(source, sink, flags); err != nil {
+			return fmt.Errorf("media: setting up link %v -> %v: %w", lc.Source, lc.Sink, err)
+		}
+		link.Flags = flags
+	}
+	return nil
+}
+
+// ApplyFormats configures the pads of sub-devices as described. Like
+// media-ctl, formats set on source pads are propagated to the sink pads
+// at the other end of enabled links.
+func ApplyFormats(t *Topology, formats []FormatConfig) error {
+	subdevs := make(map[*Entity]*v4l2.Subdev)
+	defer func() {
+		for _, s := range subdevs {
+			s.Close()
+		}
+	}()
+	open := func(e *Entity) (*v4l2.Subdev, error) {
+		if s := subdevs[e]; s != nil {
+			return s, nil
+		}
+		node := e.DevNode()
+		if node == "" {
+			return nil, fmt.Errorf("media: entity %q has no device node", e.Name)
+		}
+		s, err := v4l2.OpenSubdev(node)
+		if err != nil {
+			return nil, err
+		}
+		subdevs[e] = s
+		return s, nil
+	}
+
+	for _, fc := range formats {
+		pad, err := fc.Pad.Resolve(t)
+		if err != nil {
+			return err
+		}
+		subdev, err := open(pad.Entity)
+		if err != nil {
+			return err
+		}
+		if fc.Crop != nil {
+			if err := setSelection(subdev, pad, v4l2.SelTgt_Crop, fc.Crop); err != nil {
+				return fmt.Errorf("media: setting crop on %v: %w", fc.Pad, err)
+			}
+		}
+		format, err := setFormat(subdev, pad, &fc)
+		if err != nil {
+			return fmt.Errorf("media: setting format on %v: %w", fc.Pad, err)
+		}
+		if fc.Compose != nil {
+			if err := setSelection(subdev, pad, v4l2.SelTgt_Compose, fc.Compose); err != nil {
+				return fmt.Errorf("media: setting compose on %v: %w", fc.Pad, err)
+			}
+		}
+		if fc.Interval.Denominator != 0 {
+			interval := v4l2.SubdevFrameInterval{
+				Pad:      pad.Index,
+				Interval: fc.Interval,
+				Which:    v4l2.SubdevFormat_Active,
+			}
+			if err := subdev.SetFrameInterval(&interval); err != nil {
+				return fmt.Errorf("media: setting frame interval on %v: %w", fc.Pad, err)
+			}
+		}
+
+		if !pad.IsSource() {
+			continue
+		}
+		for _, l := range pad.Links {
+			if !l.Enabled() || l.Source != pad || l.Sink.Entity.Function == EntF_IoV4l {
+				continue
+			}
+			remote, err := open(l.Sink.Entity)
+			if err != nil {
+				return err
+			}
+			propagated := FormatConfig{
+				Code:         format.Code,
+				Width:        format.Width,
+				Height:       format.Height,
+				Field:        format.Field,
+				Colorspace:   format.Colorspace,
+				XferFunc:     v4l2.XferFunc(format.XferFunc),
+				YcbcrEnc:     v4l2.YcbcrEncoding(format.YcbcrEnc),
+				Quantization: v4l2.Quantization(format.Quantization),
+			}
+			if _, err := setFormat(remote, l.Sink, &propagated); err != nil {
+				return fmt.Errorf("media: propagating format to %q:%d: %w", l.Sink.Entity.Name, l.Sink.Index, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setFormat(subdev *v4l2.Subdev, pad *Pad, fc *FormatConfig) (v4l2.MbusFramefmt, error) {
+	format, err := subdev.GetFormat(pad.Index, v4l2.SubdevFormat_Active)
+	if err != nil {
+		return format, err
+	}
+	if fc.Code != 0 {
+		format.Code = fc.Code
+	}
+	if fc.Width != 0 {
+		format.Width, format.Height = fc.Width, fc.Height
+	}
+	if fc.Field != 0 {
+		format.Field = fc.Field
+	}
+	if fc.Colorspace != 0 {
+		format.Colorspace = fc.Colorspace
+	}
+	if fc.XferFunc != 0 {
+		format.XferFunc = uint16(fc.XferFunc)
+	}
+	if fc.YcbcrEnc != 0 {
+		format.YcbcrEnc = uint16(fc.YcbcrEnc)
+	}
+	if fc.Quantization != 0 {
+		format.Quantization = uint16(fc.Quantization)
+	}
+	sf := v4l2.SubdevFormat{
+		Which:  v4l2.SubdevFormat_Active,
+		Pad:    pad.Index,
+		Format: format,
+	}
+	err = subdev.SetFormat(&sf)
+	return sf.Format, err
+}
+
+func setSelection(subdev *v4l2.Subdev, pad *Pad, target v4l2.SelTgt, r *v4l2.Rect) error {
+	selection := v4l2.SubdevSelection{
+		Which:  v4l2.SubdevFormat_Active,
+		Pad:    pad.Index,
+		Target: target,
+		R:      *r,
+	}
+	return subdev.SetSelection(&selection)
+}
+
+// Apply sets up the links and then the formats of the pipeline.
+func (d *Device) Apply(t *Topology, config *PipelineConfig) error {
+	if err := d.ApplyLinks(t, config.Links); err != nil {
+		return err
+	}
+	return ApplyFormats(t, config.Formats)
+}
+
+// PipelineError lists the links whose ends disagree on the format.
+type PipelineError struct {
+	Mismatches []string
+}
+
+func (e *PipelineError) Error() string {
+	return "media: format mismatch on " + strings.Join(e.Mismatches, "; ")
+}
+
+// Verify checks that the formats at both ends of every enabled link match,
+// as the kernel does when streaming starts. Links ending in a video node
+// are checked against the video node's size.
+func Verify(t *Topology) error {
+	pe := &PipelineError{}
+	for _, l := range t.Links {
+		if !l.Enabled() {
+			continue
+		}
+		source, err := padFormat(l.Source)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			continue
+		}
+		name := fmt.Sprintf("%q:%d -> %q:%d", l.Source.Entity.Name, l.Source.Index, l.Sink.Entity.Name, l.Sink.Index)
+		if l.Sink.Entity.Function == EntF_IoV4l {
+			width, height, err := videoSize(l.Sink.Entity)
+			if err != nil {
+				return err
+			}
+			if width != 0 && (width != source.Width || height != source.Height) {
+				pe.Mismatches = append(pe.Mismatches, fmt.Sprintf("%s (%dx%d != %dx%d)",
+					name, source.Width, source.Height, width, height))
+			}
+			continue
+		}
+		sink, err := padFormat(l.Sink)
+		if err != nil {
+			return err
+		}
+		if sink == nil {
+			continue
+		}
+		if source.Code != sink.Code || source.Width != sink.Width || source.Height != sink.Height {
+			pe.Mismatches = append(pe.Mismatches, fmt.Sprintf("%s (%v/%dx%d != %v/%dx%d)", name,
+				source.Code, source.Width, source.Height, sink.Code, sink.Width, sink.Height))
+		}
+	}
+	if len(pe.Mismatches) > 0 {
+		return pe
+	}
+	return nil
+}
+
+// padFormat returns the active format of a sub-device pad, or nil for
+// entities without a sub-device node.
+func padFormat(pad *Pad) (*v4l2.MbusFramefmt, error) {
+	node := pad.Entity.DevNode()
+	if node == "" || pad.Entity.Function == EntF_IoV4l {
+		return nil, nil
+	}
+	subdev, err := v4l2.OpenSubdev(node)
+	if err != nil {
+		return nil, err
+	}
+	defer subdev.Close()
+	format, err := subdev.GetFormat(pad.Index, v4l2.SubdevFormat_Active)
+	if err != nil {
+		return nil, err
+	}
+	return &format, nil
+}
+
+var errNoVideoCapture = errors.New("media: not a video capture node")
+
+// videoSize returns the frame size configured on a capture video node.
+func videoSize(e *Entity) (uint32, uint32, error) {
+	node := e.DevNode()
+	if node == "" {
+		return 0, 0, nil
+	}
+	dev, err := v4l2.Open(node)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer dev.Close()
+	capability, err := dev.QueryCap()
+	if err != nil {
+		return 0, 0, err
+	}
+	caps := capability.Capabilities
+	if caps&v4l2.Cap_DeviceCaps != 0 {
+		caps = v4l2.Cap(capability.DeviceCaps)
+	}
+	t := v4l2.BufType_VideoCapture
+	switch {
+	case caps&v4l2.Cap_VideoCaptureMplane != 0:
+		t = v4l2.BufType_VideoCaptureMplane
+	case caps&v4l2.Cap_VideoCapture == 0:
+		return 0, 0, errNoVideoCapture
+	}
+	format, err := dev.GetFormat(t)
+	if err != nil {
+		return 0, 0, err
+	}
+	return format.Pix().Width, format.Pix().Height, nil
+}
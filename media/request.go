@@ -0,0 +1,54 @@
+package media
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// Request bundles buffers and controls of video devices that are applied
+// together, as used by stateless codecs: the controls describing a frame
+// are set in the request along with the OUTPUT buffer holding its data.
+type Request struct {
+	fd int32
+}
+
+func (r *Request) Fd() int32 {
+	return r.fd
+}
+
+// SetControls stores control values in the request.
+func (r *Request) SetControls(dev *v4l2.Device, values ...v4l2.ControlValue) error {
+	return dev.SetControls(r.fd, values...)
+}
+
+// QueueBuffer adds a buffer to the request.
+func (r *Request) QueueBuffer(q *v4l2.Queue, b *v4l2.QueueBuffer) error {
+	return q.EnqueueRequest(b, r.fd)
+}
+
+// Queue submits the request to the driver. It must contain at least one
+// buffer.
+func (r *Request) Queue() error {
+	return ioctl(uintptr(r.fd), MediaRequestIoc_Queue, nil)
+}
+
+// Wait waits until the request has completed. It returns false when the
+// timeout expires first. A negative timeout waits forever.
+func (r *Request) Wait(timeout time.Duration) (bool, error) {
+	revents, err := v4l2.PollFd(uintptr(r.fd), v4l2.PollPri, timeout)
+	if err != nil {
+		return false, err
+	}
+	return revents&v4l2.PollPri != 0, nil
+}
+
+// Reinit clears a completed request so it can be used again.
+func (r *Request) Reinit() error {
+	return ioctl(uintptr(r.fd), MediaRequestIoc_Reinit, nil)
+}
+
+func (r *Request) Close() error {
+	return syscall.Close(int(r.fd))
+}
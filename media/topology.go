@@ -0,0 +1,258 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Topology is the graph of entities, interfaces, pads and links of a media
+// device.
+type Topology struct {
+	Info       DeviceInfo
+	Version    uint64
+	Entities   []*Entity
+	Interfaces []*Interface
+	Pads       []*Pad
+	Links      []*Link // data links between pads
+}
+
+type Entity struct {
+	Id         uint32
+	Name       string
+	Function   EntF
+	Flags      EntFl
+	Pads       []*Pad
+	Interfaces []*Interface
+}
+
+type Interface struct {
+	Id       uint32
+	Type     IntfT
+	Flags    uint32
+	Major    uint32
+	Minor    uint32
+	DevNode  string // device node path, if known
+	Entities []*Entity
+}
+
+type Pad struct {
+	Id     uint32
+	Entity *Entity
+	Flags  PadFl
+	Index  uint32
+	Links  []*Link
+}
+
+type Link struct {
+	Id     uint32
+	Source *Pad
+	Sink   *Pad
+	Flags  LnkFl
+}
+
+func (l *Link) Enabled() bool {
+	return l.Flags&LnkFl_Enabled != 0
+}
+
+func (l *Link) Immutable() bool {
+	return l.Flags&LnkFl_Immutable != 0
+}
+
+// Topology reads the graph of the device with MEDIA_IOC_G_TOPOLOGY and
+// resolves the device nodes of its interfaces through sysfs.
+func (d *Device) Topology() (*Topology, error) {
+	info, err := d.DeviceInfo()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var count V2Topology
+		if err := d.Ioctl(MediaIoc_GTopology, unsafe.Pointer(&count)); err != nil {
+			return nil, err
+		}
+		// Leave room for a graph that grows in between the two calls.
+		entities := make([]V2Entity, count.NumEntities+1)
+		interfaces := make([]V2Interface, count.NumInterfaces+1)
+		pads := make([]V2Pad, count.NumPads+1)
+		links := make([]V2Link, count.NumLinks+1)
+		topo := V2Topology{
+			NumEntities:   uint32(len(entities)),
+			PtrEntities:   uint64(uintptr(unsafe.Pointer(&entities[0]))),
+			NumInterfaces: uint32(len(interfaces)),
+			PtrInterfaces: uint64(uintptr(unsafe.Pointer(&interfaces[0]))),
+			NumPads:       uint32(len(pads)),
+			PtrPads:       uint64(uintptr(unsafe.Pointer(&pads[0]))),
+			NumLinks:      uint32(len(links)),
+			PtrLinks:      uint64(uintptr(unsafe.Pointer(&links[0]))),
+		}
+		err := d.Ioctl(MediaIoc_GTopology, unsafe.Pointer(&topo))
+		runtime.KeepAlive(entities)
+		runtime.KeepAlive(interfaces)
+		runtime.KeepAlive(pads)
+		runtime.KeepAlive(links)
+		if err == syscall.ENOSPC {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if topo.TopologyVersion != count.TopologyVersion {
+			continue
+		}
+		t := NewTopology(info, topo.TopologyVersion,
+			entities[:topo.NumEntities], interfaces[:topo.NumInterfaces],
+			pads[:topo.NumPads], links[:topo.NumLinks])
+		for _, intf := range t.Interfaces {
+			intf.DevNode = devNodePath(intf.Major, intf.Minor)
+		}
+		return t, nil
+	}
+}
+
+// NewTopology builds the graph from the arrays returned by
+// MEDIA_IOC_G_TOPOLOGY. Device nodes are not resolved.
+func NewTopology(info DeviceInfo, version uint64, entities []V2Entity, interfaces []V2Interface, pads []V2Pad, links []V2Link) *Topology {
+	t := &Topology{Info: info, Version: version}
+	entityById := make(map[uint32]*Entity)
+	for i := range entities {
+		e := &entities[i]
+		entity := &Entity{
+			Id:       e.Id,
+			Name:     cString(e.Name[:]),
+			Function: e.Function,
+			Flags:    e.Flags,
+		}
+		entityById[e.Id] = entity
+		t.Entities = append(t.Entities, entity)
+	}
+	intfById := make(map[uint32]*Interface)
+	for i := range interfaces {
+		intf := &interfaces[i]
+		devnode := intf.Devnode()
+		iface := &Interface{
+			Id:    intf.Id,
+			Type:  intf.IntfType,
+			Flags: intf.Flags,
+			Major: devnode.Major,
+			Minor: devnode.Minor,
+		}
+		intfById[intf.Id] = iface
+		t.Interfaces = append(t.Interfaces, iface)
+	}
+	padById := make(map[uint32]*Pad)
+	for i := range pads {
+		p := &pads[i]
+		entity := entityById[p.EntityId]
+		if entity == nil {
+			continue
+		}
+		pad := &Pad{
+			Id:     p.Id,
+			Entity: entity,
+			Flags:  p.Flags,
+			Index:  p.Index,
+		}
+		padById[p.Id] = pad
+		entity.Pads = append(entity.Pads, pad)
+		t.Pads = append(t.Pads, pad)
+	}
+	for i := range links {
+		l := &links[i]
+		switch l.Flags & LnkFl_LinkTypeMask {
+		case LnkFl_DataLink:
+			source, sink := padById[l.SourceId], padById[l.SinkId]
+			if source == nil || sink == nil {
+				continue
+			}
+			link := &Link{Id: l.Id, Source: source, Sink: sink, Flags: l.Flags}
+			source.Links = append(source.Links, link)
+			sink.Links = append(sink.Links, link)
+			t.Links = append(t.Links, link)
+		case LnkFl_InterfaceLink:
+			iface, entity := intfById[l.SourceId], entityById[l.SinkId]
+			if iface == nil || entity == nil {
+				continue
+			}
+			iface.Entities = append(iface.Entities, entity)
+			entity.Interfaces = append(entity.Interfaces, iface)
+		}
+	}
+	return t
+}
+
+// Entity returns the entity with the given name, or nil.
+func (t *Topology) Entity(name string) *Entity {
+	for _, e := range t.Entities {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *Topology) EntityById(id uint32) *Entity {
+	for _, e := range t.Entities {
+		if e.Id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// DevNode returns the /dev/video* or /dev/v4l-subdev* node of the entity,
+// or "" if it has none.
+func (e *Entity) DevNode() string {
+	for _, intf := range e.Interfaces {
+		if intf.DevNode != "" {
+			return intf.DevNode
+		}
+	}
+	return ""
+}
+
+// Pad returns the pad with the given index, or nil.
+func (e *Entity) Pad(index uint32) *Pad {
+	for _, p := range e.Pads {
+		if p.Index == index {
+			return p
+		}
+	}
+	return nil
+}
+
+func (p *Pad) IsSource() bool {
+	return p.Flags&PadFl_Source != 0
+}
+
+func (p *Pad) IsSink() bool {
+	return p.Flags&PadFl_Sink != 0
+}
+
+// devNodePath looks up the name of a character device in sysfs.
+func devNodePath(major, minor uint32) string {
+	f, err := os.Open(fmt.Sprintf("/sys/dev/char/%d:%d/uevent", major, minor))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if name := strings.TrimPrefix(s.Text(), "DEVNAME="); name != s.Text() {
+			return "/dev/" + name
+		}
+	}
+	return ""
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
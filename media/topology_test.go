@@ -0,0 +1,128 @@
+package media
+
+import (
+	"bytes"
+	"testing"
+)
+
+func entityName(s string) (name [64]uint8) {
+	copy(name[:], s)
+	return name
+}
+
+func devnodeInterface(id uint32, t IntfT, major, minor uint32) V2Interface {
+	intf := V2Interface{Id: id, IntfType: t}
+	*intf.Devnode() = V2IntfDevnode{Major: major, Minor: minor}
+	return intf
+}
+
+// testTopology returns the MEDIA_IOC_G_TOPOLOGY results of a sensor, a
+// debayer and a capture video node, as found on vimc.
+func testTopology() *Topology {
+	entities := []V2Entity{
+		{Id: 1, Name: entityName("Sensor A"), Function: EntF_CamSensor},
+		{Id: 3, Name: entityName("Debayer A"), Function: EntF_ProcVideoPixelEncConv},
+		{Id: 6, Name: entityName("Raw Capture 0"), Function: EntF_IoV4l, Flags: EntFl_Default},
+	}
+	interfaces := []V2Interface{
+		devnodeInterface(8, IntfT_V4lSubdev, 81, 1),
+		devnodeInterface(9, IntfT_V4lVideo, 81, 0),
+	}
+	pads := []V2Pad{
+		{Id: 2, EntityId: 1, Flags: PadFl_Source, Index: 0},
+		{Id: 4, EntityId: 3, Flags: PadFl_Sink | PadFl_MustConnect, Index: 0},
+		{Id: 5, EntityId: 3, Flags: PadFl_Source, Index: 1},
+		{Id: 7, EntityId: 6, Flags: PadFl_Sink, Index: 0},
+		{Id: 20, EntityId: 99, Flags: PadFl_Sink}, // of an unknown entity
+	}
+	links := []V2Link{
+		{Id: 10, SourceId: 2, SinkId: 4, Flags: LnkFl_Enabled | LnkFl_Immutable},
+		{Id: 11, SourceId: 5, SinkId: 7},
+		{Id: 12, SourceId: 8, SinkId: 1, Flags: LnkFl_InterfaceLink | LnkFl_Enabled | LnkFl_Immutable},
+		{Id: 13, SourceId: 9, SinkId: 6, Flags: LnkFl_InterfaceLink | LnkFl_Enabled | LnkFl_Immutable},
+		{Id: 14, SourceId: 1, SinkId: 3, Flags: LnkFl_AncillaryLink | LnkFl_Enabled},
+		{Id: 15, SourceId: 5, SinkId: 20, Flags: LnkFl_Enabled},
+	}
+	return NewTopology(DeviceInfo{}, 7, entities, interfaces, pads, links)
+}
+
+func TestNewTopology(t *testing.T) {
+	topo := testTopology()
+	if topo.Version != 7 || len(topo.Entities) != 3 || len(topo.Interfaces) != 2 || len(topo.Pads) != 4 {
+		t.Fatalf("version %d, %d entities, %d interfaces, %d pads",
+			topo.Version, len(topo.Entities), len(topo.Interfaces), len(topo.Pads))
+	}
+	if len(topo.Links) != 2 {
+		t.Fatalf("%d data links, want 2", len(topo.Links))
+	}
+
+	sensor, debayer, capture := topo.Entity("Sensor A"), topo.Entity("Debayer A"), topo.EntityById(6)
+	if sensor == nil || debayer == nil || capture == nil || capture.Name != "Raw Capture 0" {
+		t.Fatalf("entities %v %v %v", sensor, debayer, capture)
+	}
+	if topo.Entity("Sensor B") != nil || topo.EntityById(2) != nil {
+		t.Error("found a missing entity")
+	}
+
+	sink, source := debayer.Pad(0), debayer.Pad(1)
+	if sink == nil || !sink.IsSink() || sink.IsSource() || source == nil || !source.IsSource() {
+		t.Fatalf("debayer pads %v", debayer.Pads)
+	}
+	if debayer.Pad(2) != nil {
+		t.Error("found a missing pad")
+	}
+	in := sink.Links
+	if len(in) != 1 || in[0].Source != sensor.Pad(0) || in[0].Sink != sink || !in[0].Enabled() || !in[0].Immutable() {
+		t.Errorf("debayer input links %+v", in)
+	}
+	out := source.Links
+	if len(out) != 1 || out[0].Sink != capture.Pad(0) || out[0].Enabled() || out[0].Immutable() {
+		t.Errorf("debayer output links %+v", out)
+	}
+
+	if len(capture.Interfaces) != 1 {
+		t.Fatalf("capture has %d interfaces", len(capture.Interfaces))
+	}
+	video := capture.Interfaces[0]
+	if video.Id != 9 || video.Type != IntfT_V4lVideo || video.Major != 81 || video.Minor != 0 {
+		t.Errorf("video interface %+v", video)
+	}
+	if len(video.Entities) != 1 || video.Entities[0] != capture {
+		t.Errorf("video interface entities %v", video.Entities)
+	}
+	if len(debayer.Interfaces) != 0 || debayer.DevNode() != "" {
+		t.Errorf("debayer interfaces %v", debayer.Interfaces)
+	}
+	// NewTopology does not look at sysfs.
+	if capture.DevNode() != "" {
+		t.Errorf("capture device node %q", capture.DevNode())
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	topo := testTopology()
+	topo.Interfaces[0].DevNode = "/dev/v4l-subdev1"
+	topo.Interfaces[1].DevNode = "/dev/video0"
+	var b bytes.Buffer
+	if err := topo.WriteDot(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph board {
+	rankdir=TB
+	n00000001 [label="{{} | Sensor A\n/dev/v4l-subdev1 | {<port0> 0}}", shape=Mrecord, style=filled, fillcolor=green]
+	n00000003 [label="{{<port0> 0} | Debayer A | {<port1> 1}}", shape=Mrecord, style=filled, fillcolor=green]
+	n00000006 [label="{{<port0> 0} | Raw Capture 0\n/dev/video0 | {}}", shape=Mrecord, style=filled, fillcolor=yellow]
+	n00000001:port0 -> n00000003:port0 [style="bold"]
+	n00000003:port1 -> n00000006:port0 [style="dashed"]
+}
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestDotEscape(t *testing.T) {
+	if s := dotEscape(`a{b}|<c>"d"\`); s != `a\{b\}\|\<c\>\"d\"\\` {
+		t.Errorf("escaped %s", s)
+	}
+}
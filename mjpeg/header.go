@@ -0,0 +1,189 @@
+package mjpeg
+
+import (
+	"bytes"
+	"errors"
+)
+
+var ErrNotBaseline = errors.New("mjpeg: not a single-scan baseline frame")
+
+const (
+	markerSof0 = 0xc0
+	markerSof1 = 0xc1
+	markerDqt  = 0xdb
+	markerDri  = 0xdd
+)
+
+type Component struct {
+	Id         uint8
+	H, V       uint8 // sampling factors
+	QuantTable uint8
+}
+
+// Header holds the parameters of a baseline frame that RTP payload formats
+// such as RFC 2435 carry instead of the JPEG headers.
+type Header struct {
+	Width      uint16
+	Height     uint16
+	Components []Component
+
+	// Quantization tables by destination, in the zigzag order of DQT.
+	// Tables are 64 bytes, or 128 big endian bytes if 16-bit.
+	QuantTables [4][]byte
+
+	RestartInterval uint16
+	// CustomHuffman is set if a DHT segment defines tables other than
+	// those of Annex K, which RTP payload formats assume.
+	CustomHuffman bool
+	// Scan is the entropy-coded data of the only scan, restart markers
+	// included.
+	Scan []byte
+}
+
+// ParseHeader parses the marker segments of a frame. The scan data aliases
+// data.
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSoi {
+		return nil, ErrNoSoi
+	}
+	h := &Header{}
+	sof := false
+	pos := 2
+	for {
+		if pos >= len(data) {
+			return nil, ErrTruncated
+		}
+		if data[pos] != 0xff {
+			return nil, ErrCorrupt
+		}
+		for pos < len(data) && data[pos] == 0xff {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, ErrTruncated
+		}
+		marker := data[pos]
+		pos++
+		switch {
+		case marker == markerEoi:
+			return nil, ErrNotBaseline // no scan
+		case marker == markerSoi || marker == 0:
+			return nil, ErrCorrupt
+		case marker == markerTem || marker&0xf8 == markerRst:
+			continue
+		}
+		if pos+2 > len(data) {
+			return nil, ErrTruncated
+		}
+		length := int(data[pos])<<8 | int(data[pos+1])
+		if length < 2 || pos+length > len(data) {
+			return nil, ErrCorrupt
+		}
+		segment := data[pos+2 : pos+length]
+		pos += length
+
+		switch {
+		case marker == markerSof0 || marker == markerSof1:
+			if err := h.parseSof(segment); err != nil {
+				return nil, err
+			}
+			sof = true
+		case marker >= 0xc2 && marker <= 0xcf && marker != markerDht && marker != 0xc8 && marker != 0xcc:
+			// Progressive, lossless, hierarchical or arithmetic coded.
+			return nil, ErrNotBaseline
+		case marker == markerDqt:
+			if err := h.parseDqt(segment); err != nil {
+				return nil, err
+			}
+		case marker == markerDht:
+			custom, err := customHuffman(segment)
+			if err != nil {
+				return nil, err
+			}
+			h.CustomHuffman = h.CustomHuffman || custom
+		case marker == markerDri:
+			if len(segment) < 2 {
+				return nil, ErrCorrupt
+			}
+			h.RestartInterval = uint16(segment[0])<<8 | uint16(segment[1])
+		case marker == markerSos:
+			if !sof || len(segment) < 1 || int(segment[0]) != len(h.Components) {
+				// Frames with several scans are not baseline
+				// interleaved.
+				return nil, ErrNotBaseline
+			}
+			end := skipEntropyCoded(data, pos)
+			if end+1 >= len(data) || data[end+1] != markerEoi {
+				return nil, ErrTruncated
+			}
+			h.Scan = data[pos:end]
+			return h, nil
+		}
+	}
+}
+
+func (h *Header) parseSof(segment []byte) error {
+	if len(segment) < 6 {
+		return ErrCorrupt
+	}
+	if segment[0] != 8 {
+		return ErrNotBaseline
+	}
+	h.Height = uint16(segment[1])<<8 | uint16(segment[2])
+	h.Width = uint16(segment[3])<<8 | uint16(segment[4])
+	n := int(segment[5])
+	if len(segment) < 6+3*n {
+		return ErrCorrupt
+	}
+	h.Components = make([]Component, n)
+	for i := range h.Components {
+		c := segment[6+3*i:]
+		h.Components[i] = Component{Id: c[0], H: c[1] >> 4, V: c[1] & 0xf, QuantTable: c[2] & 3}
+	}
+	return nil
+}
+
+func (h *Header) parseDqt(segment []byte) error {
+	for len(segment) > 0 {
+		precision, id := segment[0]>>4, segment[0]&3
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(segment) < 1+size {
+			return ErrCorrupt
+		}
+		h.QuantTables[id] = segment[1 : 1+size]
+		segment = segment[1+size:]
+	}
+	return nil
+}
+
+// customHuffman reports whether a DHT segment defines a table that differs
+// from the standard one of its class and destination.
+func customHuffman(segment []byte) (bool, error) {
+	custom := false
+	for len(segment) > 0 {
+		if len(segment) < 17 {
+			return false, ErrCorrupt
+		}
+		class, id := segment[0]>>4, segment[0]&0xf
+		n := 0
+		for _, count := range segment[1:17] {
+			n += int(count)
+		}
+		if len(segment) < 17+n {
+			return false, ErrCorrupt
+		}
+		counts, values := segment[1:17], segment[17:17+n]
+		standard := false
+		for _, t := range huffmanTables {
+			if t.class == class && t.id == id {
+				standard = bytes.Equal(counts, t.counts[:]) && bytes.Equal(values, t.values)
+			}
+		}
+		custom = custom || !standard
+		segment = segment[17+n:]
+	}
+	return custom, nil
+}
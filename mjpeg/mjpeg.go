@@ -0,0 +1,205 @@
+// Package mjpeg prepares Motion JPEG frames captured from webcams for
+// decoding with image/jpeg.
+package mjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrNoSoi     = errors.New("mjpeg: missing start of image marker")
+	ErrTruncated = errors.New("mjpeg: frame truncated before end of image marker")
+	ErrCorrupt   = errors.New("mjpeg: invalid marker segment")
+	ErrNotYCbCr  = errors.New("mjpeg: frame is not a YCbCr image")
+)
+
+const (
+	markerSoi = 0xd8
+	markerEoi = 0xd9
+	markerSos = 0xda
+	markerDht = 0xc4
+	markerRst = 0xd0 // RST0, up to RST7 at 0xd7
+	markerTem = 0x01
+)
+
+// frameInfo is the result of walking the marker segments of a frame.
+type frameInfo struct {
+	size int // up to and including EOI
+	sos  int // offset of the first SOS marker
+	dht  bool
+}
+
+func scan(data []byte) (frameInfo, error) {
+	var info frameInfo
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSoi {
+		return info, ErrNoSoi
+	}
+	pos := 2
+	for {
+		// Markers may be preceded by fill bytes.
+		if pos >= len(data) {
+			return info, ErrTruncated
+		}
+		if data[pos] != 0xff {
+			return info, ErrCorrupt
+		}
+		for pos < len(data) && data[pos] == 0xff {
+			pos++
+		}
+		if pos >= len(data) {
+			return info, ErrTruncated
+		}
+		marker := data[pos]
+		pos++
+		switch {
+		case marker == markerEoi:
+			info.size = pos
+			return info, nil
+		case marker == markerSoi || marker == 0:
+			return info, ErrCorrupt
+		case marker == markerTem || marker&0xf8 == markerRst:
+			continue
+		}
+		if pos+2 > len(data) {
+			return info, ErrTruncated
+		}
+		length := int(data[pos])<<8 | int(data[pos+1])
+		if length < 2 {
+			return info, ErrCorrupt
+		}
+		if marker == markerDht {
+			info.dht = true
+		}
+		if marker == markerSos && info.sos == 0 {
+			info.sos = pos - 2
+		}
+		pos += length
+		if marker == markerSos {
+			pos = skipEntropyCoded(data, pos)
+		}
+	}
+}
+
+// skipEntropyCoded returns the offset of the first marker after the
+// entropy-coded data at pos, skipping stuffed zero bytes and restart
+// markers.
+func skipEntropyCoded(data []byte, pos int) int {
+	for pos+1 < len(data) {
+		if data[pos] == 0xff {
+			next := data[pos+1]
+			if next != 0 && next&0xf8 != markerRst && next != 0xff {
+				return pos
+			}
+			if next != 0xff {
+				pos++
+			}
+		}
+		pos++
+	}
+	return len(data)
+}
+
+// Validate checks that data holds a complete JPEG frame.
+func Validate(data []byte) error {
+	_, err := scan(data)
+	return err
+}
+
+// Trim returns data up to the end of image marker, dropping the padding
+// some cameras append to frames.
+func Trim(data []byte) ([]byte, error) {
+	info, err := scan(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:info.size], nil
+}
+
+// FromBuffer returns the frame held by a dequeued buffer, without padding.
+// It aliases the buffer's memory.
+func FromBuffer(b *v4l2.QueueBuffer) ([]byte, error) {
+	data := b.Data()
+	if len(data) == 0 {
+		return nil, ErrNoSoi
+	}
+	return Trim(data[0])
+}
+
+// HasHuffmanTables reports whether the frame defines its Huffman tables.
+// UVC cameras often omit them and rely on the standard ones.
+func HasHuffmanTables(data []byte) bool {
+	info, err := scan(data)
+	return err == nil && info.dht
+}
+
+// Fix returns a trimmed copy of the frame that includes the standard
+// Huffman tables if it has none, or the trimmed frame itself if it does.
+func Fix(data []byte) ([]byte, error) {
+	info, err := scan(data)
+	if err != nil {
+		return nil, err
+	}
+	if info.dht || info.sos == 0 {
+		return data[:info.size], nil
+	}
+	fixed := make([]byte, 0, info.size+len(standardDht))
+	fixed = append(fixed, data[:info.sos]...)
+	fixed = append(fixed, standardDht...)
+	fixed = append(fixed, data[info.sos:info.size]...)
+	return fixed, nil
+}
+
+// reader returns the frame with the standard Huffman tables inserted if
+// necessary, without copying it.
+func reader(data []byte) (io.Reader, error) {
+	info, err := scan(data)
+	if err != nil {
+		return nil, err
+	}
+	if info.dht || info.sos == 0 {
+		return bytes.NewReader(data[:info.size]), nil
+	}
+	return io.MultiReader(
+		bytes.NewReader(data[:info.sos]),
+		bytes.NewReader(standardDht),
+		bytes.NewReader(data[info.sos:info.size]),
+	), nil
+}
+
+// Decode validates and decodes a frame, inserting the standard Huffman
+// tables if needed.
+func Decode(data []byte) (image.Image, error) {
+	r, err := reader(data)
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(r)
+}
+
+// DecodeYCbCr decodes a colour frame without converting it to RGB.
+func DecodeYCbCr(data []byte) (*image.YCbCr, error) {
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	ycbcr, ok := img.(*image.YCbCr)
+	if !ok {
+		return nil, ErrNotYCbCr
+	}
+	return ycbcr, nil
+}
+
+// DecodeConfig returns the dimensions of a frame without decoding it.
+func DecodeConfig(data []byte) (image.Config, error) {
+	r, err := reader(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return jpeg.DecodeConfig(r)
+}
@@ -0,0 +1,156 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// restartFrame returns a grey 16x8 frame without DHT, as UVC cameras send
+// them. Each block is followed by a restart marker. The DC difference of
+// the first one is 511, coded as FD FF with a stuffed zero byte, and the
+// second one is flat grey. Fill bytes precede EOI and padding follows it.
+func restartFrame() (frame, padding []byte) {
+	frame = []byte{0xff, markerSoi, 0xff, markerDqt, 0, 67, 0}
+	frame = append(frame, bytes.Repeat([]byte{1}, 64)...)
+	frame = append(frame,
+		0xff, markerSof0, 0, 11, 8, 0, 8, 0, 16, 1, 1, 0x11, 0,
+		0xff, markerDri, 0, 4, 0, 1,
+		0xff, markerSos, 0, 8, 1, 1, 0x00, 0, 63, 0,
+		0xfd, 0xff, 0x00, 0xaf, 0xff, markerRst, 0x2b,
+		0xff, 0xff, 0xff, markerEoi,
+	)
+	return frame, []byte{0, 0, 0xff, 0}
+}
+
+func TestFixRestart(t *testing.T) {
+	frame, padding := restartFrame()
+	padded := append(append([]byte{}, frame...), padding...)
+	if HasHuffmanTables(padded) {
+		t.Error("HasHuffmanTables without DHT")
+	}
+	trimmed, err := Trim(padded)
+	if err != nil || !bytes.Equal(trimmed, frame) {
+		t.Errorf("Trim: %x, %v", trimmed, err)
+	}
+
+	fixed, err := Fix(padded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sos := bytes.Index(frame, []byte{0xff, markerSos})
+	if !bytes.Equal(fixed[:sos], frame[:sos]) ||
+		!bytes.Equal(fixed[sos:sos+len(standardDht)], standardDht) ||
+		!bytes.Equal(fixed[sos+len(standardDht):], frame[sos:]) {
+		t.Fatalf("DHT not inserted before SOS: %x", fixed)
+	}
+	if !HasHuffmanTables(fixed) {
+		t.Error("HasHuffmanTables after Fix")
+	}
+	if again, err := Fix(fixed); err != nil || !bytes.Equal(again, fixed) {
+		t.Errorf("Fix of a fixed frame: %x, %v", again, err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok || gray.Bounds() != image.Rect(0, 0, 16, 8) {
+		t.Fatalf("decoded %T of %v", img, img.Bounds())
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			want := uint8(192)
+			if x >= 8 {
+				want = 128
+			}
+			if v := gray.GrayAt(x, y).Y; v != want {
+				t.Fatalf("pixel %d,%d is %d, want %d", x, y, v, want)
+			}
+		}
+	}
+	if _, err := Decode(padded); err != nil {
+		t.Errorf("Decode: %v", err)
+	}
+}
+
+func TestFixEncoded(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 32, 16), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i * 7)
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = uint8(i*13), uint8(255-i*5)
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := b.Bytes()
+	want, err := jpeg.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// image/jpeg writes the standard tables, so stripping them leaves
+	// a frame that decodes the same once fixed.
+	dht := bytes.Index(encoded, []byte{0xff, markerDht})
+	if dht < 0 {
+		t.Fatal("no DHT")
+	}
+	length := int(encoded[dht+2])<<8 | int(encoded[dht+3])
+	stripped := append(append([]byte{}, encoded[:dht]...), encoded[dht+2+length:]...)
+	if HasHuffmanTables(stripped) {
+		t.Fatal("DHT not stripped")
+	}
+	fixed, err := Fix(append(stripped, 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeYCbCr(fixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := want.(*image.YCbCr)
+	if !bytes.Equal(got.Y, w.Y) || !bytes.Equal(got.Cb, w.Cb) || !bytes.Equal(got.Cr, w.Cr) {
+		t.Error("fixed frame decodes differently")
+	}
+	if config, err := DecodeConfig(stripped); err != nil || config.Width != 32 || config.Height != 16 {
+		t.Errorf("DecodeConfig: %+v, %v", config, err)
+	}
+	if _, err := DecodeYCbCr(grayJpeg(t)); err != ErrNotYCbCr {
+		t.Errorf("DecodeYCbCr of a grey frame: %v", err)
+	}
+}
+
+func grayJpeg(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	img.SetGray(1, 1, color.Gray{Y: 200})
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestTruncated(t *testing.T) {
+	frame, _ := restartFrame()
+	for n := 2; n < len(frame); n++ {
+		if _, err := Fix(frame[:n]); err != ErrTruncated {
+			t.Errorf("Fix of %d bytes: %v, want ErrTruncated", n, err)
+		}
+		if err := Validate(frame[:n]); err != ErrTruncated {
+			t.Errorf("Validate of %d bytes: %v, want ErrTruncated", n, err)
+		}
+	}
+	if err := Validate(frame[:1]); err != ErrNoSoi {
+		t.Errorf("Validate of 1 byte: %v, want ErrNoSoi", err)
+	}
+	if err := Validate(frame); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
@@ -0,0 +1,535 @@
+// Package avi records MJPEG frames, and optionally PCM audio, to AVI files
+// without re-encoding them. Files grow past the 1 GiB limit of AVI 1.0 with
+// the OpenDML extensions: the first RIFF keeps an idx1 index for old
+// players and every RIFF carries its own standard index.
+package avi
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrClosed  = errors.New("avi: writer is closed")
+	ErrNoAudio = errors.New("avi: no audio stream configured")
+)
+
+const (
+	defaultSegmentSize = 1 << 30
+	superIndexEntries  = 256 // segments, 256 GiB with the default size
+
+	aviFlagHasIndex       = 0x00000010
+	aviFlagIsInterleaved  = 0x00000100
+	aviFlagTrustChunkType = 0x00000800
+	indexFlagKeyframe     = 0x00000010
+
+	indexOfIndexes = 0x00
+	indexOfChunks  = 0x01
+
+	videoChunk = "00dc"
+	audioChunk = "01wb"
+)
+
+type Config struct {
+	Width     uint32
+	Height    uint32
+	FrameRate v4l2.Fract   // frames per second, 0 for 30
+	Audio     *AudioConfig // optional
+
+	// SegmentSize limits the size of each RIFF, 0 for 1 GiB.
+	SegmentSize int64
+}
+
+// AudioConfig describes interleaved PCM audio. Samples are little endian
+// and signed, unless 8-bit.
+type AudioConfig struct {
+	SampleRate    uint32
+	Channels      uint16
+	BitsPerSample uint16
+}
+
+func (a *AudioConfig) blockAlign() uint32 {
+	return uint32(a.Channels) * uint32(a.BitsPerSample+7) / 8
+}
+
+type indexEntry struct {
+	offset int64 // of the chunk data
+	size   uint32
+}
+
+// segment is one RIFF of the file.
+type segment struct {
+	riff  int64 // offset of the RIFF header
+	movi  int64 // offset of the "movi" list type
+	video []indexEntry
+	audio []indexEntry
+}
+
+// superIndexEntry points to the standard index of one segment.
+type superIndexEntry struct {
+	offset   int64
+	size     uint32
+	duration uint32
+}
+
+// Writer writes an AVI file. WriteFrame and WriteAudio should be called in
+// the order the data was captured so that the streams are interleaved.
+type Writer struct {
+	w      io.WriteSeeker
+	file   *os.File // closed by Close if opened by Create
+	config Config
+	pos    int64
+	closed bool
+
+	frameDuration time.Duration
+	firstTs       time.Duration
+	frames        uint32 // index entries, including repeated frames
+	lastFrame     indexEntry
+	audioBytes    uint64
+	maxVideoChunk uint32
+	maxAudioChunk uint32
+
+	segments   []*segment
+	videoIndex []superIndexEntry
+	audioIndex []superIndexEntry
+	idx1       []idx1Entry
+	headerSize int
+
+	// sizes of the first RIFF and its movi list, once it is finished
+	riffSize uint32
+	moviSize uint32
+}
+
+type idx1Entry struct {
+	id     string
+	offset int64 // of the chunk header
+	size   uint32
+}
+
+// Create creates an AVI file at path.
+func Create(path string, config Config) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, config)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.file = f
+	return w, nil
+}
+
+// NewWriter starts an AVI file at the current position of w, which must be
+// the start of the file.
+func NewWriter(w io.WriteSeeker, config Config) (*Writer, error) {
+	if config.FrameRate.Numerator == 0 || config.FrameRate.Denominator == 0 {
+		config.FrameRate = v4l2.Fract{Numerator: 30, Denominator: 1}
+	}
+	if config.SegmentSize == 0 {
+		config.SegmentSize = defaultSegmentSize
+	}
+	aw := &Writer{
+		w:      w,
+		config: config,
+		frameDuration: time.Duration(config.FrameRate.Denominator) * time.Second /
+			time.Duration(config.FrameRate.Numerator),
+		firstTs: -1,
+	}
+	header := aw.header()
+	aw.headerSize = len(header)
+	if err := aw.write(header); err != nil {
+		return nil, err
+	}
+	aw.segments = []*segment{{riff: 0, movi: int64(aw.headerSize) - 4}}
+	return aw, nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.pos += int64(n)
+	return err
+}
+
+// writeAt overwrites earlier data and returns to the end of the file.
+func (w *Writer) writeAt(data []byte, offset int64) error {
+	if _, err := w.w.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(w.pos, io.SeekStart)
+	return err
+}
+
+func (w *Writer) writeChunk(id string, data []byte) (indexEntry, error) {
+	var c chunkBuffer
+	c.id(id)
+	c.u32(uint32(len(data)))
+	entry := indexEntry{offset: w.pos + 8, size: uint32(len(data))}
+	if err := w.write(c.b); err != nil {
+		return entry, err
+	}
+	if err := w.write(data); err != nil {
+		return entry, err
+	}
+	if len(data)%2 != 0 {
+		return entry, w.write([]byte{0})
+	}
+	return entry, nil
+}
+
+// WriteFrame appends a JPEG frame captured at timestamp. Frames missing
+// from the constant frame rate of the file, as judged from the timestamps,
+// are filled by repeating the previous frame in the index.
+func (w *Writer) WriteFrame(frame []byte, timestamp time.Duration) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.firstTs < 0 {
+		w.firstTs = timestamp
+	}
+	if w.frames > 0 {
+		n := (timestamp - w.firstTs + w.frameDuration/2) / w.frameDuration
+		for ; n > time.Duration(w.frames); w.frames++ {
+			w.addIndex(videoChunk, w.lastFrame)
+		}
+	}
+	if err := w.split(len(frame)); err != nil {
+		return err
+	}
+	entry, err := w.writeChunk(videoChunk, frame)
+	if err != nil {
+		return err
+	}
+	w.addIndex(videoChunk, entry)
+	w.lastFrame = entry
+	w.frames++
+	if entry.size > w.maxVideoChunk {
+		w.maxVideoChunk = entry.size
+	}
+	return nil
+}
+
+// WriteAudio appends a block of PCM samples.
+func (w *Writer) WriteAudio(samples []byte) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.config.Audio == nil {
+		return ErrNoAudio
+	}
+	if err := w.split(len(samples)); err != nil {
+		return err
+	}
+	entry, err := w.writeChunk(audioChunk, samples)
+	if err != nil {
+		return err
+	}
+	w.addIndex(audioChunk, entry)
+	w.audioBytes += uint64(len(samples))
+	if entry.size > w.maxAudioChunk {
+		w.maxAudioChunk = entry.size
+	}
+	return nil
+}
+
+func (w *Writer) addIndex(id string, entry indexEntry) {
+	s := w.segments[len(w.segments)-1]
+	if id == videoChunk {
+		s.video = append(s.video, entry)
+	} else {
+		s.audio = append(s.audio, entry)
+	}
+	if len(w.segments) == 1 {
+		w.idx1 = append(w.idx1, idx1Entry{id: id, offset: entry.offset - 8, size: entry.size})
+	}
+}
+
+// split starts a new RIFF if a chunk of size bytes would not fit into the
+// current one.
+func (w *Writer) split(size int) error {
+	s := w.segments[len(w.segments)-1]
+	// Leave room for the chunk and the indexes.
+	used := w.pos - s.riff + int64(size) + 8
+	used += int64(len(s.video)+len(s.audio)+2)*8 + 64
+	if len(w.segments) == 1 {
+		used += int64(len(w.idx1)+1) * 16
+	}
+	if used <= w.config.SegmentSize || len(s.video)+len(s.audio) == 0 {
+		return nil
+	}
+	if len(w.segments) >= superIndexEntries {
+		// The super index is full, keep growing the last RIFF.
+		return nil
+	}
+	if err := w.endSegment(); err != nil {
+		return err
+	}
+	var c chunkBuffer
+	c.beginList("RIFF", "AVIX")
+	c.beginList("LIST", "movi")
+	next := &segment{riff: w.pos, movi: w.pos + int64(len(c.b)) - 4}
+	w.segments = append(w.segments, next)
+	return w.write(c.b)
+}
+
+// endSegment writes the standard indexes of the current segment, the idx1
+// index of the first one, and patches the sizes of its lists.
+func (w *Writer) endSegment() error {
+	s := w.segments[len(w.segments)-1]
+	if len(s.video) > 0 {
+		entry, err := w.writeStandardIndex("ix00", videoChunk, s.video)
+		if err != nil {
+			return err
+		}
+		entry.duration = uint32(len(s.video))
+		w.videoIndex = append(w.videoIndex, entry)
+	}
+	if w.config.Audio != nil && len(s.audio) > 0 {
+		entry, err := w.writeStandardIndex("ix01", audioChunk, s.audio)
+		if err != nil {
+			return err
+		}
+		var bytes uint32
+		for _, e := range s.audio {
+			bytes += e.size
+		}
+		entry.duration = bytes / w.config.Audio.blockAlign()
+		w.audioIndex = append(w.audioIndex, entry)
+	}
+
+	// movi ends here, idx1 follows it in the first RIFF.
+	moviSize := uint32(w.pos - s.movi)
+	var c chunkBuffer
+	c.u32(moviSize)
+	if err := w.writeAt(c.b, s.movi-4); err != nil {
+		return err
+	}
+	if len(w.segments) == 1 {
+		if err := w.writeIdx1(s); err != nil {
+			return err
+		}
+	}
+	riffSize := uint32(w.pos - s.riff - 8)
+	if len(w.segments) == 1 {
+		w.riffSize, w.moviSize = riffSize, moviSize
+	}
+	c = chunkBuffer{}
+	c.u32(riffSize)
+	return w.writeAt(c.b, s.riff+4)
+}
+
+func (w *Writer) writeStandardIndex(id, chunkId string, entries []indexEntry) (superIndexEntry, error) {
+	base := entries[0].offset
+	var c chunkBuffer
+	c.beginChunk(id)
+	c.u16(2) // longs per entry
+	c.b = append(c.b, 0, indexOfChunks)
+	c.u32(uint32(len(entries)))
+	c.id(chunkId)
+	c.u64(uint64(base))
+	c.u32(0)
+	for _, e := range entries {
+		c.u32(uint32(e.offset - base))
+		c.u32(e.size) // bit 31 clear: keyframe
+	}
+	c.endChunk()
+	entry := superIndexEntry{offset: w.pos, size: uint32(len(c.b))}
+	return entry, w.write(c.b)
+}
+
+func (w *Writer) writeIdx1(s *segment) error {
+	var c chunkBuffer
+	c.beginChunk("idx1")
+	for _, e := range w.idx1 {
+		c.id(e.id)
+		c.u32(indexFlagKeyframe)
+		c.u32(uint32(e.offset - s.movi))
+		c.u32(e.size)
+	}
+	c.endChunk()
+	return w.write(c.b)
+}
+
+// Close finishes the file and rewrites the headers with the final counts.
+// It closes the file if the Writer was made by Create.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	err := w.endSegment()
+	if err == nil {
+		err = w.writeAt(w.header(), 0)
+	}
+	if w.file != nil {
+		if errClose := w.file.Close(); err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
+
+// header builds everything up to the data of the first movi list with the
+// current counts. Its size does not depend on them, so Close can rewrite it
+// in place.
+func (w *Writer) header() []byte {
+	cfg := &w.config
+	streams := uint32(1)
+	bytesPerSec := uint64(w.maxVideoChunk) * uint64(cfg.FrameRate.Numerator) /
+		uint64(cfg.FrameRate.Denominator)
+	if cfg.Audio != nil {
+		streams++
+		bytesPerSec += uint64(cfg.Audio.SampleRate * cfg.Audio.blockAlign())
+	}
+	var firstFrames uint32
+	if len(w.segments) > 0 {
+		firstFrames = uint32(len(w.segments[0].video))
+	}
+
+	var c chunkBuffer
+	c.id("RIFF")
+	c.u32(w.riffSize)
+	c.id("AVI ")
+	c.beginList("LIST", "hdrl")
+
+	c.beginChunk("avih")
+	c.u32(uint32(w.frameDuration / time.Microsecond))
+	c.u32(uint32(bytesPerSec))
+	c.u32(0) // padding granularity
+	c.u32(aviFlagHasIndex | aviFlagIsInterleaved | aviFlagTrustChunkType)
+	c.u32(firstFrames)
+	c.u32(0) // initial frames
+	c.u32(streams)
+	c.u32(w.maxVideoChunk + 8)
+	c.u32(cfg.Width)
+	c.u32(cfg.Height)
+	c.b = append(c.b, make([]byte, 16)...)
+	c.endChunk()
+
+	c.beginList("LIST", "strl")
+	c.beginChunk("strh")
+	c.id("vids")
+	c.id("MJPG")
+	c.u32(0) // flags
+	c.u16(0) // priority
+	c.u16(0) // language
+	c.u32(0) // initial frames
+	c.u32(cfg.FrameRate.Denominator)
+	c.u32(cfg.FrameRate.Numerator)
+	c.u32(0) // start
+	c.u32(w.frames)
+	c.u32(w.maxVideoChunk + 8)
+	c.u32(0xffffffff) // default quality
+	c.u32(0)          // sample size, variable
+	c.u16(0)
+	c.u16(0)
+	c.u16(uint16(cfg.Width))
+	c.u16(uint16(cfg.Height))
+	c.endChunk()
+	// BITMAPINFOHEADER
+	c.beginChunk("strf")
+	c.u32(40)
+	c.u32(cfg.Width)
+	c.u32(cfg.Height)
+	c.u16(1)  // planes
+	c.u16(24) // bits per pixel
+	c.id("MJPG")
+	c.u32(cfg.Width * cfg.Height * 3)
+	c.u32(0)
+	c.u32(0)
+	c.u32(0)
+	c.u32(0)
+	c.endChunk()
+	w.appendSuperIndex(&c, videoChunk, w.videoIndex)
+	c.endList()
+
+	if a := cfg.Audio; a != nil {
+		blockAlign := a.blockAlign()
+		c.beginList("LIST", "strl")
+		c.beginChunk("strh")
+		c.id("auds")
+		c.u32(0) // handler
+		c.u32(0) // flags
+		c.u16(0) // priority
+		c.u16(0) // language
+		c.u32(0) // initial frames
+		c.u32(blockAlign)
+		c.u32(a.SampleRate * blockAlign)
+		c.u32(0) // start
+		c.u32(uint32(w.audioBytes / uint64(blockAlign)))
+		c.u32(w.maxAudioChunk + 8)
+		c.u32(0xffffffff) // default quality
+		c.u32(blockAlign)
+		c.u16(0)
+		c.u16(0)
+		c.u16(0)
+		c.u16(0)
+		c.endChunk()
+		// WAVEFORMATEX
+		c.beginChunk("strf")
+		c.u16(1) // WAVE_FORMAT_PCM
+		c.u16(a.Channels)
+		c.u32(a.SampleRate)
+		c.u32(a.SampleRate * blockAlign)
+		c.u16(uint16(blockAlign))
+		c.u16(a.BitsPerSample)
+		c.u16(0) // extra size
+		c.endChunk()
+		w.appendSuperIndex(&c, audioChunk, w.audioIndex)
+		c.endList()
+	}
+
+	c.beginList("LIST", "odml")
+	c.beginChunk("dmlh")
+	c.u32(w.frames)
+	c.b = append(c.b, make([]byte, 244)...)
+	c.endChunk()
+	c.endList()
+	c.endList() // hdrl
+
+	moviSize := w.moviSize
+	if moviSize == 0 {
+		moviSize = 4
+	}
+	c.id("LIST")
+	c.u32(moviSize)
+	c.id("movi")
+	if w.riffSize == 0 {
+		binary.LittleEndian.PutUint32(c.b[4:], uint32(len(c.b)-8))
+	}
+	return c.b
+}
+
+// appendSuperIndex appends an indx chunk with room for superIndexEntries
+// standard indexes.
+func (w *Writer) appendSuperIndex(c *chunkBuffer, chunkId string, entries []superIndexEntry) {
+	c.beginChunk("indx")
+	c.u16(4) // longs per entry
+	c.b = append(c.b, 0, indexOfIndexes)
+	c.u32(uint32(len(entries)))
+	c.id(chunkId)
+	c.u32(0)
+	c.u32(0)
+	c.u32(0)
+	for i := 0; i < superIndexEntries; i++ {
+		if i < len(entries) {
+			c.u64(uint64(entries[i].offset))
+			c.u32(entries[i].size)
+			c.u32(entries[i].duration)
+		} else {
+			c.u64(0)
+			c.u32(0)
+			c.u32(0)
+		}
+	}
+	c.endChunk()
+}
@@ -0,0 +1,248 @@
+package avi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// memFile is an in-memory io.WriteSeeker.
+type memFile struct {
+	b   []byte
+	pos int64
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.b)) {
+		f.b = append(f.b, make([]byte, end-int64(len(f.b)))...)
+	}
+	copy(f.b[f.pos:], p)
+	f.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(len(f.b))
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// chunk is a RIFF chunk or list found in a file.
+type chunk struct {
+	id       string
+	listType string // of a RIFF or LIST
+	offset   int64  // of the chunk header
+	size     uint32
+}
+
+// data returns the offset of the data, after the list type of a list.
+func (c chunk) data() int64 {
+	if c.listType != "" {
+		return c.offset + 12
+	}
+	return c.offset + 8
+}
+
+func (c chunk) end() int64 {
+	return c.offset + 8 + int64(c.size+c.size%2)
+}
+
+// chunks walks the chunks from start to end, which must line up.
+func chunks(t *testing.T, b []byte, start, end int64) []chunk {
+	t.Helper()
+	var list []chunk
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			t.Fatalf("chunk at %#x overruns %#x", pos, end)
+		}
+		c := chunk{
+			id:     string(b[pos : pos+4]),
+			offset: pos,
+			size:   binary.LittleEndian.Uint32(b[pos+4:]),
+		}
+		if c.id == "RIFF" || c.id == "LIST" {
+			c.listType = string(b[pos+8 : pos+12])
+		}
+		if c.end() > end {
+			t.Fatalf("%s at %#x of size %d overruns %#x", c.id, pos, c.size, end)
+		}
+		list = append(list, c)
+		pos = c.end()
+	}
+	return list
+}
+
+func find(t *testing.T, list []chunk, id string) chunk {
+	t.Helper()
+	for _, c := range list {
+		if c.id == id || c.listType == id {
+			return c
+		}
+	}
+	t.Fatalf("no %s chunk", id)
+	return chunk{}
+}
+
+func testFrame(n int) []byte {
+	// Odd sizes, so that the chunks are padded.
+	return bytes.Repeat([]byte{byte(n)}, 101+2*n)
+}
+
+func TestOpenDML(t *testing.T) {
+	f := &memFile{}
+	w, err := NewWriter(f, Config{
+		Width:       16,
+		Height:      8,
+		FrameRate:   v4l2.Fract{Numerator: 10, Denominator: 1},
+		SegmentSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Frames 1, 2, 7 and 8 are missing and filled by repeating the
+	// previous frame. The headers alone overflow the first RIFF, which
+	// gets a single chunk.
+	var want []int
+	for _, n := range []int{0, 3, 4, 5, 6, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19} {
+		for len(want) < n {
+			want = append(want, want[len(want)-1])
+		}
+		want = append(want, n)
+		if err := w.WriteFrame(testFrame(n), time.Duration(n)*100*time.Millisecond+time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(testFrame(0), 0); err != ErrClosed {
+		t.Errorf("WriteFrame after Close: %v", err)
+	}
+	b := f.b
+
+	riffs := chunks(t, b, 0, int64(len(b)))
+	if len(riffs) < 3 {
+		t.Fatalf("%d RIFFs, want at least 3", len(riffs))
+	}
+	for i, riff := range riffs {
+		if want := "AVIX"; i == 0 {
+			want = "AVI "
+			if riff.listType != want {
+				t.Errorf("RIFF %d is %q, want %q", i, riff.listType, want)
+			}
+		} else if riff.listType != want {
+			t.Errorf("RIFF %d is %q, want %q", i, riff.listType, want)
+		}
+		if i > 0 && riff.size+8 > uint32(w.config.SegmentSize) {
+			t.Errorf("RIFF %d: %d bytes, over the segment size", i, riff.size+8)
+		}
+	}
+	u32 := func(offset int64) uint32 { return binary.LittleEndian.Uint32(b[offset:]) }
+
+	// The standard index of each RIFF points at its frames.
+	var got []int
+	var moviOffsets []int64
+	for i, riff := range riffs {
+		movi := find(t, chunks(t, b, riff.data(), riff.end()), "movi")
+		moviOffsets = append(moviOffsets, movi.data()-4)
+		ix := find(t, chunks(t, b, movi.data(), movi.end()), "ix00")
+		pos := ix.data()
+		entries := int(u32(pos + 4))
+		if string(b[pos+8:pos+12]) != videoChunk || b[pos+3] != indexOfChunks {
+			t.Errorf("RIFF %d: bad ix00 header %x", i, b[pos:pos+24])
+		}
+		base := int64(binary.LittleEndian.Uint64(b[pos+12:]))
+		if ix.size != uint32(24+8*entries) {
+			t.Errorf("RIFF %d: ix00 of %d bytes for %d entries", i, ix.size, entries)
+		}
+		for e := 0; e < entries; e++ {
+			offset := base + int64(u32(pos+24+int64(8*e)))
+			size := u32(pos + 28 + int64(8*e))
+			if offset < movi.data() || offset+int64(size) > movi.end() {
+				t.Errorf("RIFF %d: entry %d at %#x is outside of movi", i, e, offset)
+				continue
+			}
+			if string(b[offset-8:offset-4]) != videoChunk || u32(offset-4) != size {
+				t.Errorf("RIFF %d: entry %d does not point at chunk data", i, e)
+			}
+			got = append(got, int(b[offset]))
+			if !bytes.Equal(b[offset:offset+int64(size)], testFrame(int(b[offset]))) {
+				t.Errorf("RIFF %d: entry %d: bad frame data", i, e)
+			}
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("indexed frames %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("indexed frames %v, want %v", got, want)
+		}
+	}
+
+	// idx1 follows the first movi, with offsets relative to it.
+	first := chunks(t, b, riffs[0].data(), riffs[0].end())
+	idx1 := find(t, first, "idx1")
+	if movi := find(t, first, "movi"); idx1.offset != movi.end() {
+		t.Errorf("idx1 at %#x, want %#x after movi", idx1.offset, movi.end())
+	}
+	firstFrames := int(idx1.size / 16)
+	if firstFrames != 3 {
+		t.Errorf("idx1: %d entries, want 3", firstFrames)
+	}
+	for e := 0; e < firstFrames; e++ {
+		pos := idx1.data() + int64(16*e)
+		offset := moviOffsets[0] + int64(u32(pos+8))
+		size := u32(pos + 12)
+		if string(b[pos:pos+4]) != videoChunk || u32(pos+4) != indexFlagKeyframe {
+			t.Errorf("idx1 entry %d: %x", e, b[pos:pos+16])
+		}
+		if string(b[offset:offset+4]) != videoChunk || u32(offset+4) != size || int(b[offset+8]) != want[e] {
+			t.Errorf("idx1 entry %d does not point at frame %d", e, want[e])
+		}
+	}
+
+	// avih counts the frames of the first RIFF, strh and dmlh all of them.
+	hdrl := find(t, first, "hdrl")
+	headers := chunks(t, b, hdrl.data(), hdrl.end())
+	if frames := u32(find(t, headers, "avih").data() + 16); int(frames) != firstFrames {
+		t.Errorf("avih: %d frames, want %d", frames, firstFrames)
+	}
+	strl := find(t, headers, "strl")
+	streams := chunks(t, b, strl.data(), strl.end())
+	if frames := u32(find(t, streams, "strh").data() + 32); int(frames) != len(want) {
+		t.Errorf("strh: %d frames, want %d", frames, len(want))
+	}
+	odml := find(t, headers, "odml")
+	if frames := u32(find(t, chunks(t, b, odml.data(), odml.end()), "dmlh").data()); int(frames) != len(want) {
+		t.Errorf("dmlh: %d frames, want %d", frames, len(want))
+	}
+
+	// The super index points at the standard indexes.
+	indx := find(t, streams, "indx")
+	pos := indx.data()
+	if n := int(u32(pos + 4)); n != len(riffs) {
+		t.Fatalf("indx: %d entries, want %d", n, len(riffs))
+	}
+	var duration uint32
+	for i := range riffs {
+		e := pos + 24 + int64(16*i)
+		offset := int64(binary.LittleEndian.Uint64(b[e:]))
+		if string(b[offset:offset+4]) != "ix00" || u32(offset+4)+8 != u32(e+8) {
+			t.Errorf("indx entry %d does not point at ix00", i)
+		}
+		duration += u32(e + 12)
+	}
+	if int(duration) != len(want) {
+		t.Errorf("indx: duration %d, want %d", duration, len(want))
+	}
+}
@@ -0,0 +1,55 @@
+package avi
+
+import "encoding/binary"
+
+// chunkBuffer builds RIFF structures in memory. Lists are closed by
+// patching their size once their content is written.
+type chunkBuffer struct {
+	b     []byte
+	lists []int // offsets of the size fields of open lists
+}
+
+func (c *chunkBuffer) u16(v uint16) {
+	c.b = append(c.b, byte(v), byte(v>>8))
+}
+
+func (c *chunkBuffer) u32(v uint32) {
+	c.b = append(c.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (c *chunkBuffer) u64(v uint64) {
+	c.u32(uint32(v))
+	c.u32(uint32(v >> 32))
+}
+
+func (c *chunkBuffer) id(s string) {
+	c.b = append(c.b, s...)
+}
+
+// beginList starts a RIFF or LIST of the given type.
+func (c *chunkBuffer) beginList(list, listType string) {
+	c.id(list)
+	c.lists = append(c.lists, len(c.b))
+	c.u32(0)
+	c.id(listType)
+}
+
+func (c *chunkBuffer) endList() {
+	start := c.lists[len(c.lists)-1]
+	c.lists = c.lists[:len(c.lists)-1]
+	binary.LittleEndian.PutUint32(c.b[start:], uint32(len(c.b)-start-4))
+}
+
+// beginChunk starts a chunk, which endChunk closes like a list.
+func (c *chunkBuffer) beginChunk(id string) {
+	c.id(id)
+	c.lists = append(c.lists, len(c.b))
+	c.u32(0)
+}
+
+func (c *chunkBuffer) endChunk() {
+	c.endList()
+	if len(c.b)%2 != 0 {
+		c.b = append(c.b, 0)
+	}
+}
@@ -0,0 +1,58 @@
+package fmp4
+
+import "encoding/binary"
+
+// boxBuffer builds ISO BMFF boxes in memory. Boxes are closed by patching
+// their size once their content is written.
+type boxBuffer struct {
+	b     []byte
+	boxes []int // offsets of open boxes
+}
+
+func (c *boxBuffer) u16(v uint16) {
+	c.b = append(c.b, byte(v>>8), byte(v))
+}
+
+func (c *boxBuffer) u32(v uint32) {
+	c.b = append(c.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (c *boxBuffer) u64(v uint64) {
+	c.u32(uint32(v >> 32))
+	c.u32(uint32(v))
+}
+
+func (c *boxBuffer) zeros(n int) {
+	c.b = append(c.b, make([]byte, n)...)
+}
+
+func (c *boxBuffer) str(s string) {
+	c.b = append(c.b, s...)
+}
+
+func (c *boxBuffer) begin(boxType string) {
+	c.boxes = append(c.boxes, len(c.b))
+	c.u32(0)
+	c.str(boxType)
+}
+
+// beginFull starts a FullBox.
+func (c *boxBuffer) beginFull(boxType string, version uint8, flags uint32) {
+	c.begin(boxType)
+	c.u32(uint32(version)<<24 | flags)
+}
+
+func (c *boxBuffer) end() {
+	start := c.boxes[len(c.boxes)-1]
+	c.boxes = c.boxes[:len(c.boxes)-1]
+	binary.BigEndian.PutUint32(c.b[start:], uint32(len(c.b)-start))
+}
+
+// unityMatrix is the transformation matrix of mvhd and tkhd.
+var unityMatrix = [9]uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func (c *boxBuffer) matrix() {
+	for _, v := range unityMatrix {
+		c.u32(v)
+	}
+}
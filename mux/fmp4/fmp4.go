@@ -0,0 +1,248 @@
+// Package fmp4 writes H.264 and HEVC access units to fragmented MP4: an
+// initialization segment with the moov box, followed by moof and mdat
+// fragments. The fragments go to a single stream or, for HLS and DASH, to
+// separate segment files listed in a playlist.
+package fmp4
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/h264"
+	"github.com/paskozdilar/go-v4l2/mux/nal"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrUnsupported = errors.New("fmp4: unsupported codec")
+	ErrEmptyBuffer = errors.New("fmp4: buffer has no payload")
+	ErrClosed      = errors.New("fmp4: writer is closed")
+)
+
+const (
+	defaultTimescale        = 90000
+	defaultFragmentDuration = 2 * time.Second
+)
+
+type Config struct {
+	Codec     v4l2.PixFmt // PixFmt_H264 or PixFmt_Hevc
+	Width     uint32      // 0 to take it from the SPS
+	Height    uint32
+	FrameRate v4l2.Fract // frames per second, optional
+	Timescale uint32     // ticks per second, 0 for 90000
+
+	// FragmentDuration is the shortest fragment, 0 for 2 seconds.
+	// Fragments start at keyframes, so they last until the first keyframe
+	// after it. Each fragment is a segment when segmenting.
+	FragmentDuration time.Duration
+
+	// PlaylistSize is the number of segments kept in the playlist by
+	// CreateSegmented, older segment files are removed. 0 keeps them all.
+	PlaylistSize int
+}
+
+// output receives the initialization segment and the fragments.
+type output interface {
+	writeInit(data []byte) error
+	writeFragment(data []byte, duration time.Duration) error
+	close() error
+}
+
+// Writer muxes a single video track. Frames before the first keyframe are
+// dropped since they cannot be decoded.
+type Writer struct {
+	config Config
+	out    output
+	closed bool
+
+	params   nal.ParameterSets
+	started  bool
+	firstTs  time.Duration
+	sequence uint32
+	samples  []sample
+}
+
+type streamOutput struct {
+	w    io.Writer
+	file *os.File // closed by close if opened by Create
+}
+
+func (o *streamOutput) writeInit(data []byte) error {
+	_, err := o.w.Write(data)
+	return err
+}
+
+func (o *streamOutput) writeFragment(data []byte, duration time.Duration) error {
+	_, err := o.w.Write(data)
+	return err
+}
+
+func (o *streamOutput) close() error {
+	if o.file != nil {
+		return o.file.Close()
+	}
+	return nil
+}
+
+// NewWriter writes a single fragmented MP4 stream to w. Nothing is written
+// until the first keyframe supplies the parameter sets.
+func NewWriter(w io.Writer, config Config) (*Writer, error) {
+	return newWriter(&streamOutput{w: w}, config)
+}
+
+// Create creates a fragmented MP4 file at path.
+func Create(path string, config Config) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWriter(&streamOutput{w: f, file: f}, config)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func newWriter(out output, config Config) (*Writer, error) {
+	if config.Codec != v4l2.PixFmt_H264 && config.Codec != v4l2.PixFmt_Hevc {
+		return nil, ErrUnsupported
+	}
+	if config.Timescale == 0 {
+		config.Timescale = defaultTimescale
+	}
+	if config.FragmentDuration <= 0 {
+		config.FragmentDuration = defaultFragmentDuration
+	}
+	w := &Writer{config: config, out: out}
+	w.params.Codec = config.Codec
+	return w, nil
+}
+
+// WritePacket writes a packet dequeued from an Encoder.
+func (w *Writer) WritePacket(p *v4l2.EncodedPacket) error {
+	return w.WriteFrame(p.Data, p.Timestamp, p.Keyframe())
+}
+
+// WriteBuffer writes the payload of a dequeued CAPTURE buffer, taking the
+// timestamp and keyframe flag from it.
+func (w *Writer) WriteBuffer(b *v4l2.QueueBuffer) error {
+	data := b.Data()
+	if len(data) == 0 {
+		return ErrEmptyBuffer
+	}
+	return w.WriteFrame(data[0], time.Duration(b.TimestampNs()), b.Flags&v4l2.BufFlag_Keyframe != 0)
+}
+
+// WriteFrame writes one Annex B access unit. Frames must be in decode
+// order, the timestamps give their decode times.
+func (w *Writer) WriteFrame(data []byte, timestamp time.Duration, keyframe bool) error {
+	if w.closed {
+		return ErrClosed
+	}
+	nals := h264.SplitAnnexB(data)
+	for _, n := range nals {
+		w.params.Add(n)
+	}
+	if !w.started {
+		if !keyframe {
+			return nil
+		}
+		if err := w.start(timestamp); err != nil {
+			return err
+		}
+	}
+	s := sample{
+		data:     nal.LengthPrefixed(w.config.Codec, nals),
+		ticks:    w.ticks(timestamp),
+		keyframe: keyframe,
+	}
+	if keyframe && len(w.samples) > 0 && s.ticks >= w.samples[0].ticks+w.toTicks(w.config.FragmentDuration) {
+		if err := w.flush(s.ticks); err != nil {
+			return err
+		}
+	}
+	w.samples = append(w.samples, s)
+	return nil
+}
+
+// ticks converts a timestamp to the track timescale, relative to the first
+// keyframe.
+func (w *Writer) ticks(ts time.Duration) uint64 {
+	if ts < w.firstTs {
+		return 0
+	}
+	return w.toTicks(ts - w.firstTs)
+}
+
+func (w *Writer) toTicks(duration time.Duration) uint64 {
+	d := uint64(duration)
+	scale := uint64(w.config.Timescale)
+	return d/uint64(time.Second)*scale + d%uint64(time.Second)*scale/uint64(time.Second)
+}
+
+// defaultDuration is the duration of a sample not followed by another.
+func (w *Writer) defaultDuration() uint32 {
+	if fr := w.config.FrameRate; fr.Numerator != 0 && fr.Denominator != 0 {
+		return uint32(uint64(w.config.Timescale) * uint64(fr.Denominator) / uint64(fr.Numerator))
+	}
+	if n := len(w.samples); n > 1 && w.samples[n-1].ticks > w.samples[n-2].ticks {
+		return uint32(w.samples[n-1].ticks - w.samples[n-2].ticks)
+	}
+	return w.config.Timescale / 30
+}
+
+func (w *Writer) start(timestamp time.Duration) error {
+	decoderConfig, width, height, err := w.params.DecoderConfig()
+	if err != nil {
+		return err
+	}
+	if w.config.Width != 0 && w.config.Height != 0 {
+		width, height = w.config.Width, w.config.Height
+	}
+	w.started = true
+	w.firstTs = timestamp
+	return w.out.writeInit(initSegment(&w.config, decoderConfig, width, height))
+}
+
+// flush writes the pending samples as a fragment. next is the decode time
+// of the sample following them.
+func (w *Writer) flush(next uint64) error {
+	last := len(w.samples) - 1
+	for i := range w.samples {
+		next := next
+		if i < last {
+			next = w.samples[i+1].ticks
+		}
+		if next > w.samples[i].ticks {
+			w.samples[i].duration = uint32(next - w.samples[i].ticks)
+		} else {
+			w.samples[i].duration = w.defaultDuration()
+		}
+	}
+	total := w.samples[last].ticks + uint64(w.samples[last].duration) - w.samples[0].ticks
+	duration := time.Duration(total) * time.Second / time.Duration(w.config.Timescale)
+
+	w.sequence++
+	data := fragment(w.sequence, w.samples)
+	w.samples = w.samples[:0]
+	return w.out.writeFragment(data, duration)
+}
+
+// Close writes the pending samples and finishes the output.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	var err error
+	if len(w.samples) > 0 {
+		err = w.flush(0)
+	}
+	if errClose := w.out.close(); err == nil {
+		err = errClose
+	}
+	return err
+}
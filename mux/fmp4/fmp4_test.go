@@ -0,0 +1,45 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFragment(t *testing.T) {
+	samples := []sample{
+		{data: []byte{0, 0, 0, 1, 0x65}, ticks: 0x123456789, duration: 3000, keyframe: true},
+		{data: []byte{0, 0, 0, 2, 0x41, 0x9a}, ticks: 0x123456789 + 3000, duration: 3003},
+	}
+	want := unhex(t, `
+		00000070 6d6f6f66
+			00000010 6d666864 00000000 00000003
+			00000058 74726166
+				00000010 74666864 00020000 00000001
+				00000014 74666474 01000000 0000000123456789
+				0000002c 7472756e 00000701 00000002
+					00000078
+					00000bb8 00000005 02000000
+					00000bbb 00000006 01010000
+		00000013 6d646174
+			00000001 65
+			00000002 419a`)
+	got := fragment(3, samples)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%x\nwant\n%x", got, want)
+	}
+	// The data offset, relative to the moof, points at the first sample.
+	if offset := 0x78; !bytes.Equal(got[offset:offset+5], samples[0].data) {
+		t.Errorf("data offset points at %x", got[offset:offset+5])
+	}
+}
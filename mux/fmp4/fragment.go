@@ -0,0 +1,73 @@
+package fmp4
+
+import "encoding/binary"
+
+// Sample flags of trun.
+const (
+	sampleFlagsSync    = 0x02000000 // depends on no other sample
+	sampleFlagsNonSync = 0x01010000 // depends on others, not a sync sample
+)
+
+type sample struct {
+	data     []byte // length prefixed NAL units
+	ticks    uint64 // decode time in the track timescale
+	duration uint32
+	keyframe bool
+}
+
+// fragment builds the moof and mdat boxes of samples.
+func fragment(sequence uint32, samples []sample) []byte {
+	var c boxBuffer
+	c.begin("moof")
+	c.beginFull("mfhd", 0, 0)
+	c.u32(sequence)
+	c.end()
+	c.begin("traf")
+	c.beginFull("tfhd", 0, 0x020000) // default-base-is-moof
+	c.u32(trackId)
+	c.end()
+	c.beginFull("tfdt", 1, 0)
+	c.u64(samples[0].ticks)
+	c.end()
+	// data-offset, sample-duration, sample-size and sample-flags present
+	c.beginFull("trun", 0, 0x000701)
+	c.u32(uint32(len(samples)))
+	dataOffset := len(c.b)
+	c.u32(0)
+	size := 0
+	for _, s := range samples {
+		c.u32(s.duration)
+		c.u32(uint32(len(s.data)))
+		if s.keyframe {
+			c.u32(sampleFlagsSync)
+		} else {
+			c.u32(sampleFlagsNonSync)
+		}
+		size += len(s.data)
+	}
+	c.end() // trun
+	c.end() // traf
+	c.end() // moof
+
+	// The data offset is relative to the moof and skips the mdat header.
+	binary.BigEndian.PutUint32(c.b[dataOffset:], uint32(len(c.b)+8))
+
+	c.u32(uint32(size + 8))
+	c.str("mdat")
+	for _, s := range samples {
+		c.b = append(c.b, s.data...)
+	}
+	return c.b
+}
+
+// segmentType is the styp box starting each media segment.
+func segmentType() []byte {
+	var c boxBuffer
+	c.begin("styp")
+	c.str("msdh")
+	c.u32(0)
+	c.str("msdh")
+	c.str("msix")
+	c.end()
+	return c.b
+}
@@ -0,0 +1,131 @@
+package fmp4
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	InitName     = "init.mp4"
+	PlaylistName = "playlist.m3u8"
+)
+
+// SegmentName returns the file name of the media segment with the given
+// sequence number, counted from 1.
+func SegmentName(sequence uint32) string {
+	return fmt.Sprintf("segment%06d.m4s", sequence)
+}
+
+type segmentInfo struct {
+	name     string
+	duration time.Duration
+}
+
+// segmentOutput writes each fragment to its own file and keeps an HLS
+// playlist of them up to date. The segments start with a styp box, so
+// DASH players accept them as well.
+type segmentOutput struct {
+	dir          string
+	size         int // segments in the playlist, 0 for all
+	sequence     uint32
+	segments     []segmentInfo
+	removed      uint32 // segments dropped from the playlist
+	targetLength int    // EXT-X-TARGETDURATION, in seconds
+	ended        bool
+}
+
+// CreateSegmented writes InitName, a file per fragment named by
+// SegmentName and an HLS playlist named PlaylistName in dir, creating it if
+// needed. The playlist is replaced atomically after each segment, so it
+// can be served while recording.
+func CreateSegmented(dir string, config Config) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	out := &segmentOutput{dir: dir, size: config.PlaylistSize}
+	return newWriter(out, config)
+}
+
+func (o *segmentOutput) writeInit(data []byte) error {
+	return writeFileSync(filepath.Join(o.dir, InitName), data)
+}
+
+func (o *segmentOutput) writeFragment(data []byte, duration time.Duration) error {
+	o.sequence++
+	name := SegmentName(o.sequence)
+	if err := writeFileSync(filepath.Join(o.dir, name), append(segmentType(), data...)); err != nil {
+		return err
+	}
+	o.segments = append(o.segments, segmentInfo{name: name, duration: duration})
+	if length := int(math.Ceil(duration.Seconds())); length > o.targetLength {
+		o.targetLength = length
+	}
+	var drop []segmentInfo
+	if o.size > 0 && len(o.segments) > o.size {
+		drop = o.segments[:len(o.segments)-o.size]
+		o.segments = o.segments[len(o.segments)-o.size:]
+		o.removed += uint32(len(drop))
+	}
+	if err := o.writePlaylist(); err != nil {
+		return err
+	}
+	// Remove segments only once the playlist no longer lists them.
+	for _, s := range drop {
+		if err := os.Remove(filepath.Join(o.dir, s.name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *segmentOutput) close() error {
+	o.ended = true
+	return o.writePlaylist()
+}
+
+func (o *segmentOutput) writePlaylist() error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", o.targetLength)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", o.removed)
+	if o.size == 0 {
+		b.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	}
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", InitName)
+	for _, s := range o.segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.duration.Seconds(), s.name)
+	}
+	if o.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	path := filepath.Join(o.dir, PlaylistName)
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, []byte(b.String())); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeFileSync writes a file and syncs it, so that the playlist never
+// lists a segment lost on a power failure.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
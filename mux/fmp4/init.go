@@ -0,0 +1,128 @@
+package fmp4
+
+import "github.com/paskozdilar/go-v4l2/v4l2"
+
+const trackId = 1
+
+// initSegment builds the ftyp and moov boxes describing a single video
+// track whose samples are all in fragments.
+func initSegment(config *Config, decoderConfig []byte, width, height uint32) []byte {
+	var c boxBuffer
+	c.begin("ftyp")
+	c.str("iso5")
+	c.u32(512)
+	c.str("iso5")
+	c.str("iso6")
+	c.str("mp41")
+	c.end()
+
+	c.begin("moov")
+	c.beginFull("mvhd", 0, 0)
+	c.u32(0) // creation time
+	c.u32(0) // modification time
+	c.u32(config.Timescale)
+	c.u32(0)          // duration, in the fragments
+	c.u32(0x00010000) // rate 1.0
+	c.u16(0x0100)     // volume 1.0
+	c.zeros(10)
+	c.matrix()
+	c.zeros(24) // pre_defined
+	c.u32(trackId + 1)
+	c.end()
+
+	c.begin("trak")
+	c.beginFull("tkhd", 0, 3) // enabled, in movie
+	c.u32(0)
+	c.u32(0)
+	c.u32(trackId)
+	c.u32(0)
+	c.u32(0) // duration
+	c.zeros(8)
+	c.u16(0) // layer
+	c.u16(0) // alternate group
+	c.u16(0) // volume
+	c.u16(0)
+	c.matrix()
+	c.u32(width << 16)
+	c.u32(height << 16)
+	c.end()
+
+	c.begin("mdia")
+	c.beginFull("mdhd", 0, 0)
+	c.u32(0)
+	c.u32(0)
+	c.u32(config.Timescale)
+	c.u32(0)
+	c.u16(0x55c4) // "und"
+	c.u16(0)
+	c.end()
+	c.beginFull("hdlr", 0, 0)
+	c.u32(0)
+	c.str("vide")
+	c.zeros(12)
+	c.str("VideoHandler\x00")
+	c.end()
+
+	c.begin("minf")
+	c.beginFull("vmhd", 0, 1)
+	c.zeros(8) // graphics mode, opcolor
+	c.end()
+	c.begin("dinf")
+	c.beginFull("dref", 0, 0)
+	c.u32(1)
+	c.beginFull("url ", 0, 1) // data in the same file
+	c.end()
+	c.end()
+	c.end()
+
+	c.begin("stbl")
+	c.beginFull("stsd", 0, 0)
+	c.u32(1)
+	sampleEntry, configBox := "avc1", "avcC"
+	if config.Codec == v4l2.PixFmt_Hevc {
+		sampleEntry, configBox = "hvc1", "hvcC"
+	}
+	c.begin(sampleEntry)
+	c.zeros(6)
+	c.u16(1) // data reference index
+	c.zeros(16)
+	c.u16(uint16(width))
+	c.u16(uint16(height))
+	c.u32(0x00480000) // 72 dpi
+	c.u32(0x00480000)
+	c.u32(0)
+	c.u16(1)    // frame count
+	c.zeros(32) // compressor name
+	c.u16(0x0018)
+	c.u16(0xffff)
+	c.begin(configBox)
+	c.b = append(c.b, decoderConfig...)
+	c.end()
+	c.end()
+	c.end() // stsd
+	for _, box := range []string{"stts", "stsc", "stco"} {
+		c.beginFull(box, 0, 0)
+		c.u32(0)
+		c.end()
+	}
+	c.beginFull("stsz", 0, 0)
+	c.u32(0)
+	c.u32(0)
+	c.end()
+	c.end() // stbl
+	c.end() // minf
+	c.end() // mdia
+	c.end() // trak
+
+	c.begin("mvex")
+	c.beginFull("trex", 0, 0)
+	c.u32(trackId)
+	c.u32(1) // sample description index
+	c.u32(0)
+	c.u32(0)
+	c.u32(0)
+	c.end()
+	c.end()
+	c.end() // moov
+	return c.b
+}
@@ -0,0 +1,136 @@
+package mkv
+
+import "math"
+
+// Element IDs, with their marker bits.
+const (
+	idEbml               = 0x1a45dfa3
+	idEbmlVersion        = 0x4286
+	idEbmlReadVersion    = 0x42f7
+	idEbmlMaxIdLength    = 0x42f2
+	idEbmlMaxSizeLength  = 0x42f3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idVoid               = 0xec
+
+	idSegment      = 0x18538067
+	idSeekHead     = 0x114d9b74
+	idSeek         = 0x4dbb
+	idSeekId       = 0x53ab
+	idSeekPosition = 0x53ac
+
+	idInfo          = 0x1549a966
+	idTimecodeScale = 0x2ad7b1
+	idDuration      = 0x4489
+	idMuxingApp     = 0x4d80
+	idWritingApp    = 0x5741
+
+	idTracks          = 0x1654ae6b
+	idTrackEntry      = 0xae
+	idTrackNumber     = 0xd7
+	idTrackUid        = 0x73c5
+	idTrackType       = 0x83
+	idFlagLacing      = 0x9c
+	idCodecId         = 0x86
+	idCodecPrivate    = 0x63a2
+	idDefaultDuration = 0x23e383
+	idVideo           = 0xe0
+	idPixelWidth      = 0xb0
+	idPixelHeight     = 0xba
+
+	idCluster     = 0x1f43b675
+	idTimecode    = 0xe7
+	idSimpleBlock = 0xa3
+
+	idCues               = 0x1c53bb6b
+	idCuePoint           = 0xbb
+	idCueTime            = 0xb3
+	idCueTrackPositions  = 0xb7
+	idCueTrack           = 0xf7
+	idCueClusterPosition = 0xf1
+)
+
+// unknownSize is the 8-byte size of elements written before their size is
+// known.
+var unknownSize = []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// ebmlBuffer builds EBML elements in memory. Master elements are built in
+// their own buffer and appended with master.
+type ebmlBuffer struct {
+	b []byte
+}
+
+func (e *ebmlBuffer) id(id uint32) {
+	switch {
+	case id >= 1<<24:
+		e.b = append(e.b, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id >= 1<<16:
+		e.b = append(e.b, byte(id>>16), byte(id>>8), byte(id))
+	case id >= 1<<8:
+		e.b = append(e.b, byte(id>>8), byte(id))
+	default:
+		e.b = append(e.b, byte(id))
+	}
+}
+
+// size appends the shortest variable size integer holding n.
+func (e *ebmlBuffer) size(n uint64) {
+	length := 1
+	for length < 8 && n >= 1<<(7*uint(length))-1 {
+		length++
+	}
+	e.b = append(e.b, byte(n>>(8*uint(length-1)))|0x80>>uint(length-1))
+	for i := length - 2; i >= 0; i-- {
+		e.b = append(e.b, byte(n>>(8*uint(i))))
+	}
+}
+
+func (e *ebmlBuffer) uint(id uint32, v uint64) {
+	length := 1
+	for length < 8 && v>>(8*uint(length)) != 0 {
+		length++
+	}
+	e.id(id)
+	e.size(uint64(length))
+	for i := length - 1; i >= 0; i-- {
+		e.b = append(e.b, byte(v>>(8*uint(i))))
+	}
+}
+
+// float appends a 64-bit float and returns the offset of its value.
+func (e *ebmlBuffer) float(id uint32, v float64) int {
+	e.id(id)
+	e.size(8)
+	offset := len(e.b)
+	e.b = appendUint64(e.b, math.Float64bits(v))
+	return offset
+}
+
+func (e *ebmlBuffer) str(id uint32, s string) {
+	e.id(id)
+	e.size(uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *ebmlBuffer) bytes(id uint32, data []byte) {
+	e.id(id)
+	e.size(uint64(len(data)))
+	e.b = append(e.b, data...)
+}
+
+func (e *ebmlBuffer) master(id uint32, body *ebmlBuffer) {
+	e.bytes(id, body.b)
+}
+
+// void appends a Void element of exactly n bytes, n from 2 to 128.
+func (e *ebmlBuffer) void(n int) {
+	e.id(idVoid)
+	e.size(uint64(n - 2))
+	e.b = append(e.b, make([]byte, n-2)...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return append(b, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
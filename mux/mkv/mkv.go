@@ -0,0 +1,408 @@
+// Package mkv writes compressed video from cameras and M2M encoders to
+// Matroska files, or WebM for VP8 and VP9, without re-encoding it.
+//
+// Clusters are written whole and synced as they complete, and the segment
+// starts with an unknown size, so a file cut short by a power loss is
+// playable up to its last cluster. Close adds the cues and fills in the
+// sizes and duration when the output is seekable.
+package mkv
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/h264"
+	"github.com/paskozdilar/go-v4l2/mux/nal"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrUnsupported = errors.New("mkv: unsupported codec")
+	ErrEmptyBuffer = errors.New("mkv: buffer has no payload")
+	ErrClosed      = errors.New("mkv: writer is closed")
+	ErrFrameSize   = errors.New("mkv: frame size not found in keyframe")
+)
+
+const (
+	muxingApp = "go-v4l2"
+	trackUid  = 1
+
+	defaultClusterDuration = 5 * time.Second
+
+	// Block timecodes are 16-bit and relative to their cluster.
+	maxClusterDuration = 32 * time.Second
+	seekHeadSize       = 96 // reserved for the SeekHead written by Close
+)
+
+type Config struct {
+	Codec     v4l2.PixFmt // PixFmt_H264, PixFmt_Hevc, PixFmt_Vp8 or PixFmt_Vp9
+	Width     uint32      // 0 to take it from the SPS or the first keyframe
+	Height    uint32
+	FrameRate v4l2.Fract // frames per second, optional
+
+	// ClusterDuration is the longest cluster, and so the most lost on a
+	// power loss, 0 for 5 seconds. Clusters also start at keyframes.
+	ClusterDuration time.Duration
+}
+
+type cuePoint struct {
+	time     uint64 // in milliseconds
+	position int64  // of the cluster, relative to the segment data
+}
+
+// Writer writes a single video track. Frames before the first keyframe are
+// dropped since they cannot be decoded.
+type Writer struct {
+	w        io.Writer
+	file     *os.File // closed by Close if opened by Create
+	seekable bool
+	config   Config
+	closed   bool
+
+	params  nal.ParameterSets
+	started bool
+	pos     int64 // relative to the start of the output
+
+	segmentData int64 // offset of the segment data
+	infoPos     int64 // offsets relative to the segment data
+	tracksPos   int64
+	durationPos int64 // absolute offset of the Duration value
+
+	firstTs      time.Duration
+	lastTs       time.Duration
+	cluster      ebmlBuffer
+	clusterTs    time.Duration
+	clusterBlock bool // the cluster holds a block
+	cues         []cuePoint
+}
+
+// Create creates a Matroska file at path.
+func Create(path string, config Config) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, config)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.file = f
+	return w, nil
+}
+
+// NewWriter writes to w, which must be at the start of the output. Nothing
+// is written until the first keyframe supplies the codec parameters.
+func NewWriter(w io.Writer, config Config) (*Writer, error) {
+	if codecId(config.Codec) == "" {
+		return nil, ErrUnsupported
+	}
+	if config.ClusterDuration <= 0 {
+		config.ClusterDuration = defaultClusterDuration
+	}
+	if config.ClusterDuration > maxClusterDuration {
+		config.ClusterDuration = maxClusterDuration
+	}
+	mw := &Writer{w: w, config: config}
+	mw.params.Codec = config.Codec
+	if s, ok := w.(io.Seeker); ok {
+		// Pipes are files too, but fail to seek.
+		_, err := s.Seek(0, io.SeekCurrent)
+		mw.seekable = err == nil
+	}
+	return mw, nil
+}
+
+func codecId(format v4l2.PixFmt) string {
+	switch format {
+	case v4l2.PixFmt_H264:
+		return "V_MPEG4/ISO/AVC"
+	case v4l2.PixFmt_Hevc:
+		return "V_MPEGH/ISO/HEVC"
+	case v4l2.PixFmt_Vp8:
+		return "V_VP8"
+	case v4l2.PixFmt_Vp9:
+		return "V_VP9"
+	}
+	return ""
+}
+
+func (w *Writer) isWebm() bool {
+	return w.config.Codec == v4l2.PixFmt_Vp8 || w.config.Codec == v4l2.PixFmt_Vp9
+}
+
+func (w *Writer) hasNals() bool {
+	return w.config.Codec == v4l2.PixFmt_H264 || w.config.Codec == v4l2.PixFmt_Hevc
+}
+
+// WritePacket writes a packet dequeued from an Encoder.
+func (w *Writer) WritePacket(p *v4l2.EncodedPacket) error {
+	return w.WriteFrame(p.Data, p.Timestamp, p.Keyframe())
+}
+
+// WriteBuffer writes the payload of a dequeued CAPTURE buffer, taking the
+// timestamp and keyframe flag from it.
+func (w *Writer) WriteBuffer(b *v4l2.QueueBuffer) error {
+	data := b.Data()
+	if len(data) == 0 {
+		return ErrEmptyBuffer
+	}
+	return w.WriteFrame(data[0], time.Duration(b.TimestampNs()), b.Flags&v4l2.BufFlag_Keyframe != 0)
+}
+
+// WriteFrame writes one frame, an Annex B access unit for H.264 and HEVC.
+// The timestamp becomes the block timecode, relative to the first keyframe.
+func (w *Writer) WriteFrame(data []byte, timestamp time.Duration, keyframe bool) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.hasNals() {
+		nals := h264.SplitAnnexB(data)
+		for _, n := range nals {
+			w.params.Add(n)
+		}
+		data = nal.LengthPrefixed(w.config.Codec, nals)
+	}
+	if !w.started {
+		if !keyframe {
+			return nil
+		}
+		if err := w.start(data, timestamp); err != nil {
+			return err
+		}
+	}
+
+	// Blocks before the cluster timecode, such as B-frames, are fine as
+	// long as their relative timecode fits in 16 bits.
+	delta := timestamp - w.clusterTs
+	if w.clusterBlock && (keyframe || delta >= w.config.ClusterDuration ||
+		delta < math.MinInt16*time.Millisecond || delta > math.MaxInt16*time.Millisecond) {
+		if err := w.flushCluster(); err != nil {
+			return err
+		}
+	}
+	if !w.clusterBlock {
+		w.clusterTs = timestamp
+		if w.clusterTs < w.firstTs {
+			w.clusterTs = w.firstTs
+		}
+		w.cluster = ebmlBuffer{}
+		w.cluster.uint(idTimecode, w.millis(w.clusterTs))
+		if keyframe {
+			w.cues = append(w.cues, cuePoint{
+				time:     w.millis(w.clusterTs),
+				position: w.pos - w.segmentData,
+			})
+		}
+	}
+
+	var block ebmlBuffer
+	block.size(1) // track number
+	rel := int16((timestamp - w.clusterTs) / time.Millisecond)
+	var flags byte
+	if keyframe {
+		flags |= 0x80
+	}
+	block.b = append(block.b, byte(uint16(rel)>>8), byte(rel), flags)
+	block.b = append(block.b, data...)
+	w.cluster.master(idSimpleBlock, &block)
+	w.clusterBlock = true
+	if timestamp > w.lastTs {
+		w.lastTs = timestamp
+	}
+	return nil
+}
+
+func (w *Writer) millis(ts time.Duration) uint64 {
+	return uint64((ts - w.firstTs) / time.Millisecond)
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.pos += int64(n)
+	return err
+}
+
+// start writes everything up to the first cluster, taking the codec
+// parameters from the first keyframe.
+func (w *Writer) start(keyframe []byte, timestamp time.Duration) error {
+	var private []byte
+	width, height := w.config.Width, w.config.Height
+	if w.hasNals() {
+		var err error
+		var spsWidth, spsHeight uint32
+		private, spsWidth, spsHeight, err = w.params.DecoderConfig()
+		if err != nil {
+			return err
+		}
+		if width == 0 || height == 0 {
+			width, height = spsWidth, spsHeight
+		}
+	} else if width == 0 || height == 0 {
+		var ok bool
+		if width, height, ok = vpxFrameSize(w.config.Codec, keyframe); !ok {
+			return ErrFrameSize
+		}
+	}
+	w.started = true
+	w.firstTs = timestamp
+	w.lastTs = timestamp
+
+	docType, docTypeVersion := "matroska", uint64(4)
+	if w.isWebm() {
+		docType, docTypeVersion = "webm", 2
+	}
+	var header, out ebmlBuffer
+	header.uint(idEbmlVersion, 1)
+	header.uint(idEbmlReadVersion, 1)
+	header.uint(idEbmlMaxIdLength, 4)
+	header.uint(idEbmlMaxSizeLength, 8)
+	header.str(idDocType, docType)
+	header.uint(idDocTypeVersion, docTypeVersion)
+	header.uint(idDocTypeReadVersion, 2)
+	out.master(idEbml, &header)
+	out.id(idSegment)
+	out.b = append(out.b, unknownSize...)
+	w.segmentData = int64(len(out.b))
+	out.void(seekHeadSize)
+
+	var info ebmlBuffer
+	info.uint(idTimecodeScale, uint64(time.Millisecond))
+	durationOffset := info.float(idDuration, 0)
+	info.str(idMuxingApp, muxingApp)
+	info.str(idWritingApp, muxingApp)
+	w.infoPos = int64(len(out.b)) - w.segmentData
+	out.id(idInfo)
+	out.size(uint64(len(info.b)))
+	w.durationPos = int64(len(out.b) + durationOffset)
+	out.b = append(out.b, info.b...)
+
+	var video, track, tracks ebmlBuffer
+	video.uint(idPixelWidth, uint64(width))
+	video.uint(idPixelHeight, uint64(height))
+	track.uint(idTrackNumber, 1)
+	track.uint(idTrackUid, trackUid)
+	track.uint(idTrackType, 1) // video
+	track.uint(idFlagLacing, 0)
+	track.str(idCodecId, codecId(w.config.Codec))
+	if private != nil {
+		track.bytes(idCodecPrivate, private)
+	}
+	if fr := w.config.FrameRate; fr.Numerator != 0 && fr.Denominator != 0 {
+		track.uint(idDefaultDuration, uint64(time.Second)*uint64(fr.Denominator)/uint64(fr.Numerator))
+	}
+	track.master(idVideo, &video)
+	tracks.master(idTrackEntry, &track)
+	w.tracksPos = int64(len(out.b)) - w.segmentData
+	out.master(idTracks, &tracks)
+	return w.write(out.b)
+}
+
+// flushCluster writes the current cluster and syncs it to storage.
+func (w *Writer) flushCluster() error {
+	var out ebmlBuffer
+	out.master(idCluster, &w.cluster)
+	w.clusterBlock = false
+	if err := w.write(out.b); err != nil {
+		return err
+	}
+	if s, ok := w.w.(interface{ Sync() error }); ok && w.seekable {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close writes the last cluster and the cues. If the output is seekable it
+// also writes the SeekHead, duration and segment size. It closes the file
+// if the Writer was made by Create.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	err := w.finish()
+	if w.file != nil {
+		if errClose := w.file.Close(); err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
+
+func (w *Writer) finish() error {
+	if !w.started {
+		return nil
+	}
+	if w.clusterBlock {
+		if err := w.flushCluster(); err != nil {
+			return err
+		}
+	}
+	cuesPos := w.pos - w.segmentData
+	var cues ebmlBuffer
+	for _, c := range w.cues {
+		var positions, point ebmlBuffer
+		positions.uint(idCueTrack, 1)
+		positions.uint(idCueClusterPosition, uint64(c.position))
+		point.uint(idCueTime, c.time)
+		point.master(idCueTrackPositions, &positions)
+		cues.master(idCuePoint, &point)
+	}
+	var out ebmlBuffer
+	out.master(idCues, &cues)
+	if err := w.write(out.b); err != nil {
+		return err
+	}
+	if !w.seekable {
+		return nil
+	}
+
+	var seekHead ebmlBuffer
+	for _, s := range []struct {
+		id  uint32
+		pos int64
+	}{{idInfo, w.infoPos}, {idTracks, w.tracksPos}, {idCues, cuesPos}} {
+		var seek, id ebmlBuffer
+		id.id(s.id)
+		seek.bytes(idSeekId, id.b)
+		seek.uint(idSeekPosition, uint64(s.pos))
+		seekHead.master(idSeek, &seek)
+	}
+	out = ebmlBuffer{}
+	out.master(idSeekHead, &seekHead)
+	out.void(seekHeadSize - len(out.b))
+	if err := w.writeAt(out.b, w.segmentData); err != nil {
+		return err
+	}
+
+	duration := w.lastTs - w.firstTs
+	if fr := w.config.FrameRate; fr.Numerator != 0 && fr.Denominator != 0 {
+		duration += time.Duration(fr.Denominator) * time.Second / time.Duration(fr.Numerator)
+	}
+	out = ebmlBuffer{}
+	out.b = appendUint64(out.b, math.Float64bits(float64(duration)/float64(time.Millisecond)))
+	if err := w.writeAt(out.b, w.durationPos); err != nil {
+		return err
+	}
+
+	out = ebmlBuffer{}
+	out.b = appendUint64(out.b, uint64(w.pos-w.segmentData))
+	out.b[0] = 0x01 // 8-byte size
+	return w.writeAt(out.b, w.segmentData-8)
+}
+
+// writeAt overwrites earlier data and returns to the end of the output.
+func (w *Writer) writeAt(data []byte, offset int64) error {
+	s := w.w.(io.WriteSeeker)
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := s.Write(data); err != nil {
+		return err
+	}
+	_, err := s.Seek(w.pos, io.SeekStart)
+	return err
+}
@@ -0,0 +1,129 @@
+package mkv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// A 320x240 VP8 keyframe header and an interframe.
+var (
+	vp8Keyframe = []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00}
+	vp8Frame    = []byte{0x01}
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, Config{Codec: v4l2.PixFmt_Vp8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := []struct {
+		data     []byte
+		ts       time.Duration
+		keyframe bool
+	}{
+		{vp8Frame, 0, false}, // dropped, before the first keyframe
+		{vp8Keyframe, 0, true},
+		{vp8Frame, 40 * time.Millisecond, false},
+		{vp8Frame, 20 * time.Millisecond, false}, // B-frame
+		{vp8Keyframe, 40 * time.Second, true},
+		{vp8Frame, 40*time.Second - 40*time.Millisecond, false}, // before its cluster
+		{vp8Frame, 5 * time.Second, false},                      // 35 s back
+	}
+	for _, f := range frames {
+		if err := w.WriteFrame(f.data, f.ts, f.keyframe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != ErrClosed {
+		t.Errorf("second Close: %v", err)
+	}
+
+	// A bytes.Buffer cannot seek: the SeekHead stays void and the duration
+	// and segment size unknown.
+	keyframe := "10 02 00 9d 01 2a 40 01 f0 00"
+	want := unhex(t, `
+		1a45dfa3 9f
+			4286 81 01  42f7 81 01  42f2 81 04  42f3 81 08
+			4282 84 7765626d  4287 81 02  4285 81 02
+		18538067 01ffffffffffffff
+			ec de`+strings.Repeat("00", 94)+`
+			1549a966 a6
+				2ad7b1 83 0f4240
+				4489 88 0000000000000000
+				4d80 87 676f2d76346c32
+				5741 87 676f2d76346c32
+			1654ae6b 9f
+				ae 9d
+					d7 81 01  73c5 81 01  83 81 01  9c 81 00
+					86 85 565f565038
+					e0 87  b0 82 0140  ba 81 f0
+			1f43b675 a1
+				e7 81 00
+				a3 8e 81 0000 80 `+keyframe+`
+				a3 85 81 0028 00 01
+				a3 85 81 0014 00 01
+			1f43b675 9b
+				e7 82 9c40
+				a3 8e 81 0000 80 `+keyframe+`
+				a3 85 81 ffd8 00 01
+			1f43b675 8b
+				e7 82 1388
+				a3 85 81 0000 00 01
+			1c53bb6b 9b
+				bb 8b  b3 81 00  b7 86  f7 81 01  f1 81 af
+				bb 8c  b3 82 9c40  b7 86  f7 81 01  f1 81 d5`)
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("got\n%x\nwant\n%x", b.Bytes(), want)
+	}
+}
+
+func TestVpxFrameSize(t *testing.T) {
+	tests := []struct {
+		codec         v4l2.PixFmt
+		frame         []byte
+		width, height uint32
+		ok            bool
+	}{
+		{v4l2.PixFmt_Vp8, vp8Keyframe, 320, 240, true},
+		{v4l2.PixFmt_Vp8, vp8Frame, 0, 0, false},
+		// Profile 0, BT.601, 320x240.
+		{v4l2.PixFmt_Vp9, []byte{0x82, 0x49, 0x83, 0x42, 0x20, 0x13, 0xf0, 0x0e, 0xf0}, 320, 240, true},
+		// Profile 1, sRGB, 1920x1080.
+		{v4l2.PixFmt_Vp9, []byte{0xa2, 0x49, 0x83, 0x42, 0xe0, 0x77, 0xf0, 0x43, 0x70}, 1920, 1080, true},
+		{v4l2.PixFmt_Vp9, []byte{0x86, 0x49, 0x83, 0x42}, 0, 0, false}, // interframe
+		{v4l2.PixFmt_Vp9, []byte{0x82, 0x49, 0x83, 0x42, 0x20, 0x13}, 0, 0, false},
+	}
+	for i, test := range tests {
+		width, height, ok := vpxFrameSize(test.codec, test.frame)
+		if width != test.width || height != test.height || ok != test.ok {
+			t.Errorf("%d: %dx%d %v, want %dx%d %v", i, width, height, ok, test.width, test.height, test.ok)
+		}
+	}
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b, Config{Codec: v4l2.PixFmt_Vp9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame([]byte{0x82, 0x49}, 0, true); err != ErrFrameSize {
+		t.Errorf("truncated keyframe: %v, want ErrFrameSize", err)
+	}
+}
@@ -0,0 +1,69 @@
+package mkv
+
+import "github.com/paskozdilar/go-v4l2/v4l2"
+
+// vpxFrameSize returns the frame size coded in the header of a VP8 or VP9
+// keyframe.
+func vpxFrameSize(codec v4l2.PixFmt, frame []byte) (width, height uint32, ok bool) {
+	if codec == v4l2.PixFmt_Vp8 {
+		// Frame tag, start code, then 14-bit sizes with 2 scaling bits.
+		if len(frame) < 10 || frame[0]&1 != 0 || frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+			return 0, 0, false
+		}
+		width = (uint32(frame[6]) | uint32(frame[7])<<8) & 0x3fff
+		height = (uint32(frame[8]) | uint32(frame[9])<<8) & 0x3fff
+		return width, height, true
+	}
+
+	// The uncompressed header of VP9, up to frame_size().
+	pos := 0
+	u := func(n int) uint32 {
+		var v uint32
+		for i := 0; i < n; i++ {
+			if pos >= len(frame)*8 {
+				ok = false
+				return 0
+			}
+			v = v<<1 | uint32(frame[pos/8]>>(7-uint(pos%8))&1)
+			pos++
+		}
+		return v
+	}
+	ok = true
+	if u(2) != 2 { // frame_marker
+		return 0, 0, false
+	}
+	profile := u(1)
+	profile |= u(1) << 1
+	if profile == 3 {
+		u(1) // reserved_zero
+	}
+	if u(1) == 1 { // show_existing_frame
+		return 0, 0, false
+	}
+	if u(1) != 0 { // frame_type, KEY_FRAME is 0
+		return 0, 0, false
+	}
+	u(2) // show_frame, error_resilient_mode
+	if u(24) != 0x498342 {
+		return 0, 0, false
+	}
+	if profile >= 2 {
+		u(1) // ten_or_twelve_bit
+	}
+	const csRgb = 7
+	if u(3) != csRgb {
+		u(1) // color_range
+		if profile == 1 || profile == 3 {
+			u(3) // subsampling_x, subsampling_y, reserved_zero
+		}
+	} else if profile == 1 || profile == 3 {
+		u(1) // reserved_zero
+	}
+	width = u(16) + 1
+	height = u(16) + 1
+	if !ok {
+		return 0, 0, false
+	}
+	return width, height, true
+}
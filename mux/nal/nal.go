@@ -0,0 +1,252 @@
+// Package nal prepares H.264 and HEVC access units for containers of the
+// ISO/IEC 14496-15 family: NAL units prefixed with their length instead of
+// start codes, and decoder configuration records built from the parameter
+// sets.
+package nal
+
+import (
+	"errors"
+
+	"github.com/paskozdilar/go-v4l2/h264"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrNoParameterSets = errors.New("nal: missing parameter sets")
+
+// HEVC NAL unit types.
+const (
+	hevcBlaWLp = 16
+	hevcCraNut = 21
+	hevcVps    = 32
+	hevcSps    = 33
+	hevcPps    = 34
+	hevcAud    = 35
+)
+
+// Type returns the nal_unit_type of a NAL unit of codec, PixFmt_H264 or
+// PixFmt_Hevc.
+func Type(codec v4l2.PixFmt, nal []byte) int {
+	if codec == v4l2.PixFmt_Hevc {
+		return int(nal[0] >> 1 & 0x3f)
+	}
+	return int(nal[0] & 0x1f)
+}
+
+// IsKeyframe reports whether the NAL unit is a slice of an IDR picture,
+// or any intra random access point picture for HEVC.
+func IsKeyframe(codec v4l2.PixFmt, nal []byte) bool {
+	t := Type(codec, nal)
+	if codec == v4l2.PixFmt_Hevc {
+		return t >= hevcBlaWLp && t <= hevcCraNut
+	}
+	return h264.NalType(t) == h264.NalType_SliceIdr
+}
+
+// ParameterSets collects the parameter sets of a stream, the latest of each
+// kind.
+type ParameterSets struct {
+	Codec v4l2.PixFmt // PixFmt_H264 or PixFmt_Hevc
+	Vps   []byte      // HEVC only
+	Sps   []byte
+	Pps   []byte
+}
+
+// Add keeps a copy of nal if it is a parameter set.
+func (p *ParameterSets) Add(nal []byte) {
+	if len(nal) == 0 {
+		return
+	}
+	t := Type(p.Codec, nal)
+	if p.Codec == v4l2.PixFmt_Hevc {
+		switch t {
+		case hevcVps:
+			p.Vps = append(p.Vps[:0], nal...)
+		case hevcSps:
+			p.Sps = append(p.Sps[:0], nal...)
+		case hevcPps:
+			p.Pps = append(p.Pps[:0], nal...)
+		}
+		return
+	}
+	switch h264.NalType(t) {
+	case h264.NalType_Sps:
+		p.Sps = append(p.Sps[:0], nal...)
+	case h264.NalType_Pps:
+		p.Pps = append(p.Pps[:0], nal...)
+	}
+}
+
+// Complete reports whether every parameter set the codec needs was seen.
+func (p *ParameterSets) Complete() bool {
+	if p.Codec == v4l2.PixFmt_Hevc && p.Vps == nil {
+		return false
+	}
+	return p.Sps != nil && p.Pps != nil
+}
+
+// DecoderConfig returns the avcC or hvcC decoder configuration record, and
+// the visible size of the frames.
+func (p *ParameterSets) DecoderConfig() (config []byte, width, height uint32, err error) {
+	if !p.Complete() {
+		return nil, 0, 0, ErrNoParameterSets
+	}
+	if p.Codec == v4l2.PixFmt_Hevc {
+		return hvcC(p)
+	}
+	return avcC(p)
+}
+
+// LengthPrefixed converts the NAL units of an access unit to 4-byte length
+// prefixed ones, dropping access unit delimiters.
+func LengthPrefixed(codec v4l2.PixFmt, nals [][]byte) []byte {
+	var size int
+	for _, nal := range nals {
+		size += 4 + len(nal)
+	}
+	out := make([]byte, 0, size)
+	for _, nal := range nals {
+		if len(nal) == 0 {
+			continue
+		}
+		t := Type(codec, nal)
+		if codec == v4l2.PixFmt_Hevc && t == hevcAud ||
+			codec == v4l2.PixFmt_H264 && h264.NalType(t) == h264.NalType_Aud {
+			continue
+		}
+		n := len(nal)
+		out = append(out, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		out = append(out, nal...)
+	}
+	return out
+}
+
+// avcC builds the AVCDecoderConfigurationRecord of ISO/IEC 14496-15.
+func avcC(p *ParameterSets) ([]byte, uint32, uint32, error) {
+	if len(p.Sps) < 4 {
+		return nil, 0, 0, h264.ErrShortData
+	}
+	sps, err := h264.ParseSps(h264.Unescape(p.Sps[1:]))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	b := []byte{1, p.Sps[1], p.Sps[2], p.Sps[3], 0xfc | 3, 0xe0 | 1}
+	b = append(b, byte(len(p.Sps)>>8), byte(len(p.Sps)))
+	b = append(b, p.Sps...)
+	b = append(b, 1, byte(len(p.Pps)>>8), byte(len(p.Pps)))
+	b = append(b, p.Pps...)
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 244:
+		b = append(b,
+			0xfc|byte(sps.ChromaFormatIdc),
+			0xf8|byte(sps.BitDepthLumaMinus8),
+			0xf8|byte(sps.BitDepthChromaMinus8),
+			0) // no SPS extensions
+	}
+	crop := sps.Crop()
+	return b, crop.Width, crop.Height, nil
+}
+
+// hvcC builds the HEVCDecoderConfigurationRecord of ISO/IEC 14496-15.
+func hvcC(p *ParameterSets) ([]byte, uint32, uint32, error) {
+	if len(p.Sps) < 15 {
+		return nil, 0, 0, h264.ErrShortData
+	}
+	rbsp := h264.Unescape(p.Sps[2:])
+	if len(rbsp) < 13 {
+		return nil, 0, 0, h264.ErrShortData
+	}
+	maxSubLayersMinus1 := rbsp[0] >> 1 & 7
+	temporalIdNesting := rbsp[0] & 1
+
+	// Skip the profile_tier_level() of sub-layers to reach the fields
+	// following it.
+	r := &bitReader{data: rbsp, pos: 13 * 8}
+	var profilePresent, levelPresent [8]bool
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		profilePresent[i] = r.u(1) == 1
+		levelPresent[i] = r.u(1) == 1
+	}
+	if maxSubLayersMinus1 > 0 {
+		r.u(2 * (8 - int(maxSubLayersMinus1)))
+	}
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		if profilePresent[i] {
+			r.u(88)
+		}
+		if levelPresent[i] {
+			r.u(8)
+		}
+	}
+	r.ue() // sps_seq_parameter_set_id
+	chromaFormatIdc := r.ue()
+	if chromaFormatIdc == 3 {
+		r.u(1) // separate_colour_plane_flag
+	}
+	width, height := r.ue(), r.ue()
+	if r.u(1) == 1 { // conformance_window_flag
+		unitX, unitY := uint32(1), uint32(1)
+		switch chromaFormatIdc {
+		case 1:
+			unitX, unitY = 2, 2
+		case 2:
+			unitX = 2
+		}
+		left, right, top, bottom := r.ue(), r.ue(), r.ue(), r.ue()
+		width -= (left + right) * unitX
+		height -= (top + bottom) * unitY
+	}
+	bitDepthLumaMinus8 := r.ue()
+	bitDepthChromaMinus8 := r.ue()
+	if r.err != nil {
+		return nil, 0, 0, r.err
+	}
+
+	b := []byte{1}
+	b = append(b, rbsp[1:13]...) // general profile, tier and level
+	b = append(b,
+		0xf0, 0x00, // min_spatial_segmentation_idc
+		0xfc, // parallelismType unknown
+		0xfc|byte(chromaFormatIdc),
+		0xf8|byte(bitDepthLumaMinus8),
+		0xf8|byte(bitDepthChromaMinus8),
+		0, 0, // avgFrameRate unknown
+		(maxSubLayersMinus1+1)<<3|temporalIdNesting<<2|3,
+		3) // arrays
+	for _, nal := range [][]byte{p.Vps, p.Sps, p.Pps} {
+		b = append(b, 0x80|nal[0]>>1&0x3f, 0, 1, byte(len(nal)>>8), byte(len(nal)))
+		b = append(b, nal...)
+	}
+	return b, width, height, nil
+}
+
+// bitReader reads the Exp-Golomb coded fields of an RBSP.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = h264.ErrShortData
+			return 0
+		}
+		v = v<<1 | uint32(r.data[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros == 32 {
+			r.err = h264.ErrShortData
+			return 0
+		}
+		zeros++
+	}
+	return 1<<uint(zeros) - 1 + r.u(zeros)
+}
@@ -0,0 +1,163 @@
+package nal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The parameter sets of a 1280x720 High profile stream written by x264.
+const (
+	avcSps = "6764001facd9405005bb0110000003001000000303c0f1831960"
+	avcPps = "68ce3c80"
+)
+
+func TestAvcC(t *testing.T) {
+	p := ParameterSets{Codec: v4l2.PixFmt_H264}
+	if _, _, _, err := p.DecoderConfig(); err != ErrNoParameterSets {
+		t.Errorf("no parameter sets: %v", err)
+	}
+	for _, n := range []string{"09f0", avcSps, avcPps, "6588840021"} {
+		p.Add(unhex(t, n))
+	}
+	config, width, height, err := p.DecoderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unhex(t, `
+		01 64 00 1f ff e1
+		001a `+avcSps+`
+		01 0004 `+avcPps+`
+		fd f8 f8 00`)
+	if !bytes.Equal(config, want) || width != 1280 || height != 720 {
+		t.Errorf("got %x %dx%d\nwant %x 1280x720", config, width, height, want)
+	}
+}
+
+// bitWriter writes the fields of a HEVC SPS.
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) u(n int, v uint64) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.data[len(w.data)-1] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	bits := 0
+	for (v+1)>>uint(bits) > 1 {
+		bits++
+	}
+	w.u(bits, 0)
+	w.u(bits+1, uint64(v+1))
+}
+
+// testHevcSps returns an SPS of a 1920x1080 Main profile stream with a
+// temporal sub-layer, emulation prevention included.
+func testHevcSps() []byte {
+	w := &bitWriter{}
+	w.u(4, 0) // sps_video_parameter_set_id
+	w.u(3, 1) // sps_max_sub_layers_minus1
+	w.u(1, 1) // sps_temporal_id_nesting_flag
+	// general_profile_space, tier_flag, profile_idc, compatibility flags
+	w.u(8, 0x01)
+	w.u(32, 0x60000000)
+	w.u(48, 0x900000000000) // progressive, frame only
+	w.u(8, 120)             // general_level_idc
+	w.u(1, 1)               // sub_layer_profile_present_flag
+	w.u(1, 0)               // sub_layer_level_present_flag
+	w.u(14, 0)              // reserved_zero_2bits
+	w.u(88, 0)              // sub-layer profile
+	w.ue(0)                 // sps_seq_parameter_set_id
+	w.ue(1)                 // chroma_format_idc
+	w.ue(1920)
+	w.ue(1088)
+	w.u(1, 1) // conformance_window_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.ue(0) // bit_depth_luma_minus8
+	w.ue(0) // bit_depth_chroma_minus8
+	w.u(8, 0x80)
+
+	nal := []byte{hevcSps << 1, 1}
+	zeros := 0
+	for _, b := range w.data {
+		if zeros >= 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, b)
+	}
+	return nal
+}
+
+func TestHvcC(t *testing.T) {
+	vps := unhex(t, "40010c01ffff016000000300900000030000030078959809")
+	sps := testHevcSps()
+	pps := unhex(t, "4401c172b46240")
+	p := ParameterSets{Codec: v4l2.PixFmt_Hevc}
+	for _, n := range [][]byte{sps, pps, {hevcAud << 1, 1, 0x50}} {
+		p.Add(n)
+	}
+	if _, _, _, err := p.DecoderConfig(); err != ErrNoParameterSets {
+		t.Errorf("no VPS: %v", err)
+	}
+	p.Add(vps)
+	config, width, height, err := p.DecoderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unhex(t, `
+		01
+		01 60000000 900000000000 78
+		f000 fc fd f8 f8 0000
+		17 03
+		a0 0001 0018`+hex.EncodeToString(vps)+`
+		a1 0001 `+hex.EncodeToString([]byte{0, byte(len(sps))})+hex.EncodeToString(sps)+`
+		a2 0001 0007 4401c172b46240`)
+	if !bytes.Equal(config, want) || width != 1920 || height != 1080 {
+		t.Errorf("got %x %dx%d\nwant %x 1920x1080", config, width, height, want)
+	}
+}
+
+func TestLengthPrefixed(t *testing.T) {
+	h264 := [][]byte{{0x09, 0xf0}, {0x67, 1, 2}, {}, {0x65, 3}}
+	if got, want := LengthPrefixed(v4l2.PixFmt_H264, h264), unhex(t, "00000003 670102 00000002 6503"); !bytes.Equal(got, want) {
+		t.Errorf("H.264: got %x, want %x", got, want)
+	}
+	hevc := [][]byte{{hevcAud << 1, 1, 0x50}, {0x26, 1, 0xaf}}
+	if got, want := LengthPrefixed(v4l2.PixFmt_Hevc, hevc), unhex(t, "00000003 2601af"); !bytes.Equal(got, want) {
+		t.Errorf("HEVC: got %x, want %x", got, want)
+	}
+	if !IsKeyframe(v4l2.PixFmt_Hevc, hevc[1]) || IsKeyframe(v4l2.PixFmt_H264, h264[1]) || !IsKeyframe(v4l2.PixFmt_H264, h264[3]) {
+		t.Error("IsKeyframe")
+	}
+}
@@ -0,0 +1,159 @@
+// Package raw dumps frames unchanged to a file, with a JSON sidecar that
+// describes their format.
+package raw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrFrameTooBig = errors.New("raw: frame larger than SizeImage")
+
+// Sidecar is the content of the JSON file written next to a raw dump.
+// Every frame occupies SizeImage bytes.
+type Sidecar struct {
+	Width        uint32 `json:"width"`
+	Height       uint32 `json:"height"`
+	PixelFormat  string `json:"pixel_format"`
+	Fourcc       uint32 `json:"fourcc"`
+	Field        uint32 `json:"field"`
+	BytesPerLine uint32 `json:"bytes_per_line"`
+	SizeImage    uint32 `json:"size_image"`
+	Colorspace   uint32 `json:"colorspace"`
+	YcbcrEnc     uint32 `json:"ycbcr_enc"`
+	Quantization uint32 `json:"quantization"`
+	XferFunc     uint32 `json:"xfer_func"`
+	// FrameRate is in frames per second, "30000/1001", if known.
+	FrameRate string `json:"frame_rate,omitempty"`
+	// FfmpegPixFmt is the -pix_fmt to read the file with ffmpeg's rawvideo
+	// demuxer, if there is one and rows are not padded.
+	FfmpegPixFmt string `json:"ffmpeg_pix_fmt,omitempty"`
+	Frames       int    `json:"frames"`
+}
+
+// ffmpegPixFmts maps formats to ffmpeg pixel formats, with the bytes per
+// pixel of their first plane and bits per pixel of all planes to detect
+// padding.
+var ffmpegPixFmts = map[v4l2.PixFmt]struct {
+	name          string
+	bytesPerPixel uint32
+	bitsPerPixel  uint32
+}{
+	v4l2.PixFmt_Yuyv:    {"yuyv422", 2, 16},
+	v4l2.PixFmt_Uyvy:    {"uyvy422", 2, 16},
+	v4l2.PixFmt_Yvyu:    {"yvyu422", 2, 16},
+	v4l2.PixFmt_Nv12:    {"nv12", 1, 12},
+	v4l2.PixFmt_Nv21:    {"nv21", 1, 12},
+	v4l2.PixFmt_Nv16:    {"nv16", 1, 16},
+	v4l2.PixFmt_Yuv420:  {"yuv420p", 1, 12},
+	v4l2.PixFmt_Yuv422P: {"yuv422p", 1, 16},
+	v4l2.PixFmt_Rgb24:   {"rgb24", 3, 24},
+	v4l2.PixFmt_Bgr24:   {"bgr24", 3, 24},
+	v4l2.PixFmt_Rgb565:  {"rgb565le", 2, 16},
+	v4l2.PixFmt_Xrgb32:  {"0rgb", 4, 32},
+	v4l2.PixFmt_Xbgr32:  {"bgr0", 4, 32},
+	v4l2.PixFmt_Grey:    {"gray", 1, 8},
+	v4l2.PixFmt_Y10:     {"gray10le", 2, 16},
+	v4l2.PixFmt_Y12:     {"gray12le", 2, 16},
+	v4l2.PixFmt_Y16:     {"gray16le", 2, 16},
+	v4l2.PixFmt_Sbggr8:  {"bayer_bggr8", 1, 8},
+	v4l2.PixFmt_Sgbrg8:  {"bayer_gbrg8", 1, 8},
+	v4l2.PixFmt_Sgrbg8:  {"bayer_grbg8", 1, 8},
+	v4l2.PixFmt_Srggb8:  {"bayer_rggb8", 1, 8},
+}
+
+// NewSidecar describes frames of format. parm is optional and supplies the
+// frame rate.
+func NewSidecar(format *v4l2.PixFormat, parm *v4l2.CaptureParm) Sidecar {
+	s := Sidecar{
+		Width:        format.Width,
+		Height:       format.Height,
+		PixelFormat:  format.PixelFormat.String(),
+		Fourcc:       uint32(format.PixelFormat),
+		Field:        uint32(format.Field),
+		BytesPerLine: format.BytesPerLine,
+		SizeImage:    format.SizeImage,
+		Colorspace:   uint32(format.Colorspace),
+		YcbcrEnc:     format.YcbcrEncOrHsvEnc,
+		Quantization: uint32(format.Quantization),
+		XferFunc:     format.XferFunc,
+	}
+	if parm != nil && parm.TimePerFrame.Numerator != 0 {
+		s.FrameRate = fmt.Sprintf("%d/%d", parm.TimePerFrame.Denominator, parm.TimePerFrame.Numerator)
+	}
+	if f, ok := ffmpegPixFmts[format.PixelFormat]; ok {
+		packed := format.BytesPerLine == 0 || format.BytesPerLine == format.Width*f.bytesPerPixel
+		size := format.Width * format.Height * f.bitsPerPixel / 8
+		if packed && (format.SizeImage == 0 || format.SizeImage == size) {
+			s.FfmpegPixFmt = f.name
+		}
+	}
+	return s
+}
+
+// Writer writes frames back to back to a file. Close writes the sidecar.
+type Writer struct {
+	file        *os.File
+	sidecarPath string
+	sidecar     Sidecar
+	pad         []byte
+}
+
+// Create creates path for the frames and path + ".json" for the sidecar.
+func Create(path string, format *v4l2.PixFormat, parm *v4l2.CaptureParm) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		file:        f,
+		sidecarPath: path + ".json",
+		sidecar:     NewSidecar(format, parm),
+	}, nil
+}
+
+// WriteFrame appends a frame, padding it with zeros to SizeImage so that
+// frames can be located by offset.
+func (w *Writer) WriteFrame(frame []byte) error {
+	size := int(w.sidecar.SizeImage)
+	if size == 0 {
+		size = len(frame)
+		w.sidecar.SizeImage = uint32(size)
+	}
+	if len(frame) > size {
+		return ErrFrameTooBig
+	}
+	if _, err := w.file.Write(frame); err != nil {
+		return err
+	}
+	if padding := size - len(frame); padding > 0 {
+		if len(w.pad) < padding {
+			w.pad = make([]byte, padding)
+		}
+		if _, err := w.file.Write(w.pad[:padding]); err != nil {
+			return err
+		}
+	}
+	w.sidecar.Frames++
+	return nil
+}
+
+func (w *Writer) Sidecar() Sidecar {
+	return w.sidecar
+}
+
+func (w *Writer) Close() error {
+	err := w.file.Close()
+	data, errJson := json.MarshalIndent(&w.sidecar, "", "  ")
+	if errJson != nil {
+		return errJson
+	}
+	if errWrite := os.WriteFile(w.sidecarPath, append(data, '\n'), 0644); errWrite != nil {
+		return errWrite
+	}
+	return err
+}
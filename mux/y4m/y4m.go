@@ -0,0 +1,209 @@
+// Package y4m writes raw frames to YUV4MPEG2 streams, as read by ffmpeg,
+// x264 and most test tools.
+package y4m
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/paskozdilar/go-v4l2/convert"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var ErrUnsupported = errors.New("y4m: pixel format has no YUV4MPEG2 equivalent")
+
+// Header is the stream header of a YUV4MPEG2 file.
+type Header struct {
+	Width       uint32
+	Height      uint32
+	FrameRate   v4l2.Fract // frames per second, 0/0 if unknown
+	Interlacing byte       // 'p', 't' (top field first), 'b' or 'm'
+	PixelAspect v4l2.Fract // width:height of a pixel, 0/0 if unknown
+	Colorspace  string     // "420jpeg", "422", "444" or "mono"
+	Range       string     // "FULL" or "LIMITED", empty if unknown
+}
+
+func (h *Header) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "YUV4MPEG2 W%d H%d", h.Width, h.Height)
+	if h.FrameRate.Numerator != 0 && h.FrameRate.Denominator != 0 {
+		fmt.Fprintf(&b, " F%d:%d", h.FrameRate.Numerator, h.FrameRate.Denominator)
+	}
+	if h.Interlacing != 0 {
+		fmt.Fprintf(&b, " I%c", h.Interlacing)
+	}
+	if h.PixelAspect.Numerator != 0 && h.PixelAspect.Denominator != 0 {
+		fmt.Fprintf(&b, " A%d:%d", h.PixelAspect.Numerator, h.PixelAspect.Denominator)
+	}
+	if h.Colorspace != "" {
+		fmt.Fprintf(&b, " C%s", h.Colorspace)
+	}
+	if h.Range != "" {
+		// ffmpeg's extension for the quantization range.
+		fmt.Fprintf(&b, " XCOLORRANGE=%s", h.Range)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// NewHeader describes frames of the given format. parm and cropcap are
+// optional and supply the frame rate and pixel aspect.
+func NewHeader(format *v4l2.PixFormat, parm *v4l2.CaptureParm, cropcap *v4l2.CropCap) (Header, error) {
+	h := Header{Width: format.Width, Height: format.Height}
+	switch {
+	case isGray(format.PixelFormat):
+		h.Colorspace = "mono"
+		if format.PixelFormat != v4l2.PixFmt_Grey {
+			h.Colorspace = "mono16"
+		}
+	case is420(format.PixelFormat):
+		h.Colorspace = "420jpeg"
+	case is422(format.PixelFormat):
+		h.Colorspace = "422"
+	default:
+		return h, ErrUnsupported
+	}
+	switch format.Field {
+	case v4l2.Field_Interlaced:
+		// The field order depends on the standard: top first for
+		// 625 lines, bottom first for 525.
+		h.Interlacing = 'm'
+	case v4l2.Field_InterlacedTb, v4l2.Field_SeqTb:
+		h.Interlacing = 't'
+	case v4l2.Field_InterlacedBt, v4l2.Field_SeqBt:
+		h.Interlacing = 'b'
+	default:
+		h.Interlacing = 'p'
+	}
+	if parm != nil && parm.TimePerFrame.Numerator != 0 {
+		h.FrameRate = v4l2.Fract{
+			Numerator:   parm.TimePerFrame.Denominator,
+			Denominator: parm.TimePerFrame.Numerator,
+		}
+	}
+	if cropcap != nil && cropcap.PixelAspect.Numerator != 0 {
+		// V4L2 gives the aspect as height:width.
+		h.PixelAspect = v4l2.Fract{
+			Numerator:   cropcap.PixelAspect.Denominator,
+			Denominator: cropcap.PixelAspect.Numerator,
+		}
+	}
+	if !isGray(format.PixelFormat) {
+		switch convert.NewMatrix(format).Quantization() {
+		case v4l2.Quantization_FullRange:
+			h.Range = "FULL"
+		case v4l2.Quantization_LimRange:
+			h.Range = "LIMITED"
+		}
+	}
+	return h, nil
+}
+
+func isGray(f v4l2.PixFmt) bool {
+	switch f {
+	case v4l2.PixFmt_Grey, v4l2.PixFmt_Y10, v4l2.PixFmt_Y12, v4l2.PixFmt_Y16, v4l2.PixFmt_Y16_Be:
+		return true
+	}
+	return false
+}
+
+func is420(f v4l2.PixFmt) bool {
+	switch f {
+	case v4l2.PixFmt_Nv12, v4l2.PixFmt_Nv21, v4l2.PixFmt_Yuv420, v4l2.PixFmt_Yvu420:
+		return true
+	}
+	return false
+}
+
+func is422(f v4l2.PixFmt) bool {
+	switch f {
+	case v4l2.PixFmt_Yuyv, v4l2.PixFmt_Uyvy, v4l2.PixFmt_Yvyu, v4l2.PixFmt_Vyuy,
+		v4l2.PixFmt_Nv16, v4l2.PixFmt_Nv61, v4l2.PixFmt_Yuv422P:
+		return true
+	}
+	return false
+}
+
+// Writer writes a YUV4MPEG2 stream. Frames are converted to the planar
+// layout of the format and fields stored sequentially are interleaved.
+type Writer struct {
+	w      io.Writer
+	format v4l2.PixFormat
+	header Header
+	buf    []byte
+}
+
+// NewWriter writes the stream header for frames of format to w.
+func NewWriter(w io.Writer, format *v4l2.PixFormat, parm *v4l2.CaptureParm, cropcap *v4l2.CropCap) (*Writer, error) {
+	header, err := NewHeader(format, parm, cropcap)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, format: *format, header: header}, nil
+}
+
+func (w *Writer) Header() Header {
+	return w.header
+}
+
+// WriteFrame writes one frame in the format passed to NewWriter.
+func (w *Writer) WriteFrame(frame []byte) error {
+	w.buf = append(w.buf[:0], "FRAME\n"...)
+	if isGray(w.format.PixelFormat) {
+		if w.format.PixelFormat == v4l2.PixFmt_Grey {
+			img, err := convert.Gray(&w.format, frame)
+			if err != nil {
+				return err
+			}
+			w.appendPlane(img.Pix, img.Stride, img.Rect.Dx(), img.Rect.Dy())
+		} else {
+			img, err := convert.Gray16(&w.format, frame)
+			if err != nil {
+				return err
+			}
+			// mono16 is little endian, image.Gray16 big endian.
+			start := len(w.buf)
+			w.appendPlane(img.Pix, img.Stride, img.Rect.Dx()*2, img.Rect.Dy())
+			pix := w.buf[start:]
+			for i := 0; i+1 < len(pix); i += 2 {
+				pix[i], pix[i+1] = pix[i+1], pix[i]
+			}
+		}
+	} else {
+		img, err := convert.YCbCr(&w.format, frame)
+		if err != nil {
+			return err
+		}
+		width, height := img.Rect.Dx(), img.Rect.Dy()
+		cw, ch := (width+1)/2, height
+		if img.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+			ch = (height + 1) / 2
+		}
+		w.appendPlane(img.Y, img.YStride, width, height)
+		w.appendPlane(img.Cb, img.CStride, cw, ch)
+		w.appendPlane(img.Cr, img.CStride, cw, ch)
+	}
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+// appendPlane appends the rows of a plane without padding, interleaving
+// the two halves of frames with sequential fields.
+func (w *Writer) appendPlane(pix []byte, stride, width, height int) {
+	for y := 0; y < height; y++ {
+		row := y
+		switch w.format.Field {
+		case v4l2.Field_SeqTb:
+			row = y/2 + y%2*((height+1)/2)
+		case v4l2.Field_SeqBt:
+			row = y/2 + (1-y%2)*(height/2)
+		}
+		w.buf = append(w.buf, pix[row*stride:row*stride+width]...)
+	}
+}
@@ -0,0 +1,94 @@
+package y4m
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		format  v4l2.PixFormat
+		parm    *v4l2.CaptureParm
+		cropcap *v4l2.CropCap
+		want    string
+	}{
+		{
+			// NTSC: 30000/1001 fps and pixels 10:11 wide.
+			v4l2.PixFormat{
+				Width: 720, Height: 480, PixelFormat: v4l2.PixFmt_Nv12,
+				Field: v4l2.Field_Interlaced, Quantization: v4l2.Quantization_LimRange,
+			},
+			&v4l2.CaptureParm{TimePerFrame: v4l2.Fract{Numerator: 1001, Denominator: 30000}},
+			&v4l2.CropCap{PixelAspect: v4l2.Fract{Numerator: 11, Denominator: 10}},
+			"YUV4MPEG2 W720 H480 F30000:1001 Im A10:11 C420jpeg XCOLORRANGE=LIMITED\n",
+		},
+		{
+			v4l2.PixFormat{
+				Width: 640, Height: 480, PixelFormat: v4l2.PixFmt_Yuyv,
+				Field: v4l2.Field_SeqBt, Quantization: v4l2.Quantization_FullRange,
+			},
+			&v4l2.CaptureParm{TimePerFrame: v4l2.Fract{Numerator: 1, Denominator: 25}},
+			nil,
+			"YUV4MPEG2 W640 H480 F25:1 Ib C422 XCOLORRANGE=FULL\n",
+		},
+		{
+			// Unknown rate and aspect, no range for grey.
+			v4l2.PixFormat{Width: 8, Height: 4, PixelFormat: v4l2.PixFmt_Y10, Field: v4l2.Field_InterlacedTb},
+			&v4l2.CaptureParm{},
+			&v4l2.CropCap{},
+			"YUV4MPEG2 W8 H4 It Cmono16\n",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHeader(&test.format, test.parm, test.cropcap)
+		if err != nil {
+			t.Errorf("%v: %v", test.format.PixelFormat, err)
+			continue
+		}
+		if s := h.String(); s != test.want {
+			t.Errorf("got %q, want %q", s, test.want)
+		}
+	}
+	if _, err := NewHeader(&v4l2.PixFormat{PixelFormat: v4l2.PixFmt_Rgb24}, nil, nil); err != ErrUnsupported {
+		t.Errorf("RGB24: %v", err)
+	}
+}
+
+func TestSequentialFields(t *testing.T) {
+	tests := []struct {
+		field  v4l2.Field
+		memory []byte // frame line stored in each row
+	}{
+		{v4l2.Field_None, []byte{0, 1, 2, 3}},
+		{v4l2.Field_SeqTb, []byte{0, 2, 1, 3}},
+		{v4l2.Field_SeqBt, []byte{1, 3, 0, 2}},
+	}
+	for _, test := range tests {
+		format := &v4l2.PixFormat{
+			Width:        2,
+			Height:       4,
+			PixelFormat:  v4l2.PixFmt_Grey,
+			Field:        test.field,
+			BytesPerLine: 3,
+		}
+		var frame []byte
+		for _, line := range test.memory {
+			frame = append(frame, line, line+10, 0xee)
+		}
+		var b bytes.Buffer
+		w, err := NewWriter(&b, format, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Reset()
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+		want := "FRAME\n\x00\x0a\x01\x0b\x02\x0c\x03\x0d"
+		if b.String() != want {
+			t.Errorf("field %d: got %q, want %q", test.field, b.String(), want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rtspVersion    = "RTSP/1.0"
+	sessionTimeout = 60 // seconds, sessions end with their connection anyway
+	maxBodySize    = 64 << 10
+)
+
+// writeTimeout bounds the time an interleaved packet may wait for a client
+// that stopped reading.
+var writeTimeout = 10 * time.Second
+
+var statusText = map[int]string{
+	200: "OK",
+	400: "Bad Request",
+	454: "Session Not Found",
+	455: "Method Not Valid in This State",
+	461: "Unsupported Transport",
+	501: "Not Implemented",
+	505: "RTSP Version Not Supported",
+}
+
+type request struct {
+	method string
+	url    string
+	header textproto.MIMEHeader
+}
+
+type response struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func newResponse(status int) *response {
+	return &response{status: status, header: make(textproto.MIMEHeader)}
+}
+
+// conn is an RTSP connection. The sessions set up over it end with it.
+type conn struct {
+	server   *Server
+	nc       net.Conn
+	r        *bufio.Reader
+	writeMu  sync.Mutex
+	sessions map[string]*session
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	return &conn{
+		server:   s,
+		nc:       nc,
+		r:        bufio.NewReader(nc),
+		sessions: make(map[string]*session),
+	}
+}
+
+func (c *conn) serve() {
+	defer func() {
+		for _, ss := range c.sessions {
+			ss.close()
+		}
+		c.nc.Close()
+		c.server.removeConn(c)
+	}()
+	for {
+		req, err := c.readRequest()
+		if err != nil {
+			return
+		}
+		resp := c.handle(req)
+		if err := c.writeResponse(req, resp); err != nil {
+			return
+		}
+	}
+}
+
+// readRequest reads the next request, skipping interleaved RTCP packets
+// sent by the client.
+func (c *conn) readRequest() (*request, error) {
+	for {
+		b, err := c.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '$' {
+			break
+		}
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(header[2])<<8 | int(header[3])
+		if _, err := c.r.Discard(length); err != nil {
+			return nil, err
+		}
+	}
+	tp := textproto.NewReader(c.r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("rtsp: malformed request line %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	req := &request{method: parts[0], url: parts[1], header: header}
+	if parts[2] != rtspVersion {
+		req.method = ""
+	}
+	if length := header.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > maxBodySize {
+			return nil, fmt.Errorf("rtsp: invalid Content-Length %q", length)
+		}
+		if _, err := c.r.Discard(n); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func (c *conn) writeResponse(req *request, resp *response) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d %s\r\n", rtspVersion, resp.status, statusText[resp.status])
+	// Written as is, MIMEHeader would spell it "Cseq".
+	fmt.Fprintf(&b, "CSeq: %s\r\n", req.header.Get("CSeq"))
+	if resp.body != nil {
+		resp.header.Set("Content-Length", strconv.Itoa(len(resp.body)))
+	}
+	keys := make([]string, 0, len(resp.header))
+	for k := range resp.header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range resp.header[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	b.Write(resp.body)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := io.WriteString(c.nc, b.String())
+	return err
+}
+
+// writeInterleaved sends an RTP or RTCP packet over the connection.
+func (c *conn) writeInterleaved(channel byte, packet []byte) error {
+	b := make([]byte, 0, 4+len(packet))
+	b = append(b, '$', channel, byte(len(packet)>>8), byte(len(packet)))
+	b = append(b, packet...)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	// A client that stops reading must not hold the session forever. The
+	// deadline is lifted again for responses, which may come much later.
+	c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.nc.Write(b)
+	c.nc.SetWriteDeadline(time.Time{})
+	return err
+}
+
+func (c *conn) handle(req *request) *response {
+	switch req.method {
+	case "":
+		return newResponse(505)
+	case "OPTIONS":
+		resp := newResponse(200)
+		resp.header.Set("Public", "OPTIONS, DESCRIBE, SETUP, PLAY, PAUSE, TEARDOWN, GET_PARAMETER")
+		return resp
+	case "DESCRIBE":
+		return c.describe(req)
+	case "SETUP":
+		return c.setup(req)
+	case "PLAY", "PAUSE", "TEARDOWN", "GET_PARAMETER":
+		ss := c.session(req)
+		if ss == nil {
+			if req.method == "GET_PARAMETER" {
+				// Keep-alive without a session.
+				return newResponse(200)
+			}
+			return newResponse(454)
+		}
+		resp := newResponse(200)
+		switch req.method {
+		case "PLAY":
+			ss.setPlaying(true)
+			resp.header.Set("Range", "npt=now-")
+			resp.header.Set("RTP-Info", fmt.Sprintf("url=%s;seq=%d", c.trackUrl(req.url), ss.nextSeq()))
+		case "PAUSE":
+			ss.setPlaying(false)
+		case "TEARDOWN":
+			ss.close()
+			delete(c.sessions, ss.id)
+			return resp
+		}
+		resp.header.Set("Session", fmt.Sprintf("%s;timeout=%d", ss.id, sessionTimeout))
+		return resp
+	default:
+		return newResponse(501)
+	}
+}
+
+func (c *conn) describe(req *request) *response {
+	var host net.IP
+	if addr, ok := c.nc.LocalAddr().(*net.TCPAddr); ok {
+		host = addr.IP
+	}
+	resp := newResponse(200)
+	base := req.url
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	resp.header.Set("Content-Base", base)
+	resp.header.Set("Content-Type", "application/sdp")
+	resp.body = c.server.sdp(host)
+	return resp
+}
+
+func (c *conn) setup(req *request) *response {
+	t, ok := c.parseTransport(req.header.Get("Transport"))
+	if !ok {
+		return newResponse(461)
+	}
+	ss := c.session(req)
+	if ss != nil {
+		ss.close()
+		delete(c.sessions, ss.id)
+	}
+	ss = newSession(c.server, c, t)
+	c.sessions[ss.id] = ss
+
+	resp := newResponse(200)
+	reply := t.String()
+	if !t.tcp {
+		rtpPort, rtcpPort := c.server.udpPorts()
+		reply += fmt.Sprintf(";server_port=%d-%d", rtpPort, rtcpPort)
+	}
+	resp.header.Set("Transport", fmt.Sprintf("%s;ssrc=%08X", reply, ss.ssrc))
+	resp.header.Set("Session", fmt.Sprintf("%s;timeout=%d", ss.id, sessionTimeout))
+	return resp
+}
+
+// session returns the session named by the Session header of req.
+func (c *conn) session(req *request) *session {
+	id := req.header.Get("Session")
+	if i := strings.IndexByte(id, ';'); i >= 0 {
+		id = id[:i]
+	}
+	return c.sessions[strings.TrimSpace(id)]
+}
+
+// trackUrl returns the URL of the track, given the URL of the presentation
+// or of the track.
+func (c *conn) trackUrl(url string) string {
+	if strings.HasSuffix(url, trackControl) {
+		return url
+	}
+	return strings.TrimSuffix(url, "/") + "/" + trackControl
+}
+
+// parseTransport picks the first supported alternative of a Transport
+// header: interleaved TCP or unicast UDP.
+func (c *conn) parseTransport(header string) (transport, bool) {
+	for _, alternative := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(alternative), ";")
+		var t transport
+		multicast := false
+		var interleaved, clientPort []int
+		for _, p := range params[1:] {
+			key, value := p, ""
+			if i := strings.IndexByte(p, '='); i >= 0 {
+				key, value = p[:i], p[i+1:]
+			}
+			switch key {
+			case "multicast":
+				multicast = true
+			case "interleaved":
+				interleaved = parseRange(value)
+			case "client_port":
+				clientPort = parseRange(value)
+			}
+		}
+		if multicast {
+			continue
+		}
+		switch params[0] {
+		case "RTP/AVP/TCP":
+			t.tcp = true
+			t.rtpChannel, t.rtcpChannel = 0, 1
+			if interleaved != nil {
+				t.rtpChannel, t.rtcpChannel = byte(interleaved[0]), byte(interleaved[1])
+			}
+			return t, true
+		case "RTP/AVP", "RTP/AVP/UDP":
+			remote, ok := c.nc.RemoteAddr().(*net.TCPAddr)
+			if clientPort == nil || !ok {
+				continue
+			}
+			t.rtpAddr = &net.UDPAddr{IP: remote.IP, Port: clientPort[0], Zone: remote.Zone}
+			t.rtcpAddr = &net.UDPAddr{IP: remote.IP, Port: clientPort[1], Zone: remote.Zone}
+			return t, true
+		}
+	}
+	return transport{}, false
+}
+
+// parseRange parses "a-b" or "a", in which case b is a+1.
+func parseRange(s string) []int {
+	first, second := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		first, second = s[:i], s[i+1:]
+	}
+	a, err := strconv.Atoi(first)
+	if err != nil || a < 0 || a > 65535 {
+		return nil
+	}
+	b := a + 1
+	if second != "" {
+		b, err = strconv.Atoi(second)
+		if err != nil || b < 0 || b > 65535 {
+			return nil
+		}
+	}
+	return []int{a, b}
+}
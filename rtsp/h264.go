@@ -0,0 +1,97 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/paskozdilar/go-v4l2/h264"
+	"github.com/paskozdilar/go-v4l2/mux/nal"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// RFC 6184 constants.
+const (
+	payloadTypeH264 = 96 // dynamic
+
+	nalTypeFuA = 28
+	fuStart    = 0x80
+	fuEnd      = 0x40
+)
+
+// h264Packetizer implements the non-interleaved mode of RFC 6184: NAL
+// units that fit are sent in single NAL unit packets, others are split in
+// FU-A fragments. The parameter sets seen in the stream are announced in
+// the SDP.
+type h264Packetizer struct {
+	maxPayload int
+
+	mu     sync.Mutex
+	params nal.ParameterSets
+}
+
+func (p *h264Packetizer) payloadType() uint8 {
+	return payloadTypeH264
+}
+
+func (p *h264Packetizer) mediaAttributes() []string {
+	attributes := []string{fmt.Sprintf("rtpmap:%d H264/%d", payloadTypeH264, clockRate)}
+	fmtp := fmt.Sprintf("fmtp:%d packetization-mode=1", payloadTypeH264)
+	p.mu.Lock()
+	if sps, pps := p.params.Sps, p.params.Pps; sps != nil && pps != nil && len(sps) >= 4 {
+		fmtp += fmt.Sprintf(";profile-level-id=%02X%02X%02X;sprop-parameter-sets=%s,%s",
+			sps[1], sps[2], sps[3],
+			base64.StdEncoding.EncodeToString(sps),
+			base64.StdEncoding.EncodeToString(pps))
+	}
+	p.mu.Unlock()
+	return append(attributes, fmtp)
+}
+
+// observe keeps the parameter sets, which encoders may send only once,
+// before the first client plays the stream.
+func (p *h264Packetizer) observe(frame []byte) {
+	for _, n := range h264.SplitAnnexB(frame) {
+		switch h264.NalType(nal.Type(v4l2.PixFmt_H264, n)) {
+		case h264.NalType_Sps, h264.NalType_Pps:
+			p.mu.Lock()
+			p.params.Add(n)
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *h264Packetizer) packetize(frame []byte) ([][]byte, bool, error) {
+	var payloads [][]byte
+	keyframe := false
+	for _, n := range h264.SplitAnnexB(frame) {
+		t := h264.NalType(nal.Type(v4l2.PixFmt_H264, n))
+		switch t {
+		case h264.NalType_Aud:
+			continue
+		case h264.NalType_SliceIdr:
+			keyframe = true
+		}
+		if len(n) <= p.maxPayload {
+			payloads = append(payloads, n)
+			continue
+		}
+		indicator := n[0]&0xe0 | nalTypeFuA
+		header := n[0] & 0x1f
+		data := n[1:]
+		for first := true; len(data) > 0; first = false {
+			size := p.maxPayload - 2
+			fu := []byte{indicator, header}
+			if first {
+				fu[1] |= fuStart
+			}
+			if size >= len(data) {
+				size = len(data)
+				fu[1] |= fuEnd
+			}
+			payloads = append(payloads, append(fu, data[:size]...))
+			data = data[size:]
+		}
+	}
+	return payloads, keyframe, nil
+}
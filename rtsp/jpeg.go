@@ -0,0 +1,139 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+
+	"github.com/paskozdilar/go-v4l2/mjpeg"
+)
+
+// RFC 2435 constants.
+const (
+	payloadTypeJpeg = 26 // static
+
+	jpegType422     = 0
+	jpegType420     = 1
+	jpegTypeRestart = 64 // added to the type if restart markers are used
+	jpegQInBand     = 255
+)
+
+// jpegPacketizer implements RFC 2435, sending the quantization tables
+// in-band with every frame.
+type jpegPacketizer struct {
+	maxPayload int
+	width      uint32
+	height     uint32
+}
+
+func (p *jpegPacketizer) payloadType() uint8 {
+	return payloadTypeJpeg
+}
+
+func (p *jpegPacketizer) mediaAttributes() []string {
+	return []string{
+		fmt.Sprintf("rtpmap:%d JPEG/%d", payloadTypeJpeg, clockRate),
+		fmt.Sprintf("framesize:%d %d-%d", payloadTypeJpeg, p.width, p.height),
+	}
+}
+
+func (p *jpegPacketizer) observe(frame []byte) {}
+
+func (p *jpegPacketizer) packetize(frame []byte) ([][]byte, bool, error) {
+	h, err := mjpeg.ParseHeader(frame)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.CustomHuffman {
+		// Receivers decode the scan with the standard tables.
+		if h, err = reencode(frame); err != nil {
+			return nil, false, err
+		}
+	}
+	typ, err := jpegType(h)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.Width > 2040 || h.Height > 2040 {
+		return nil, false, ErrUnsupported
+	}
+
+	var restart []byte
+	if h.RestartInterval != 0 {
+		typ += jpegTypeRestart
+		// Every packet starts at a restart interval only by chance, so
+		// the count is not given.
+		restart = []byte{byte(h.RestartInterval >> 8), byte(h.RestartInterval), 0xff, 0xff}
+	}
+	luma := h.QuantTables[h.Components[0].QuantTable]
+	chroma := h.QuantTables[h.Components[1].QuantTable]
+	if luma == nil || chroma == nil {
+		return nil, false, ErrUnsupported
+	}
+	var precision byte
+	if len(luma) == 128 {
+		precision |= 1
+	}
+	if len(chroma) == 128 {
+		precision |= 2
+	}
+	tablesLength := len(luma) + len(chroma)
+	quant := []byte{0, precision, byte(tablesLength >> 8), byte(tablesLength)}
+	quant = append(quant, luma...)
+	quant = append(quant, chroma...)
+
+	var payloads [][]byte
+	scan := h.Scan
+	for offset := 0; offset < len(h.Scan); {
+		b := []byte{0, byte(offset >> 16), byte(offset >> 8), byte(offset),
+			typ, jpegQInBand, byte(h.Width / 8), byte(h.Height / 8)}
+		b = append(b, restart...)
+		if offset == 0 {
+			b = append(b, quant...)
+		}
+		n := p.maxPayload - len(b)
+		if n > len(scan) {
+			n = len(scan)
+		}
+		b = append(b, scan[:n]...)
+		scan = scan[n:]
+		offset += n
+		payloads = append(payloads, b)
+	}
+	return payloads, true, nil
+}
+
+// reencodeQuality is the JPEG quality of frames encoded again.
+const reencodeQuality = 90
+
+// reencode encodes a frame again with the standard Huffman tables.
+func reencode(frame []byte) (*mjpeg.Header, error) {
+	img, err := mjpeg.Decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: reencodeQuality}); err != nil {
+		return nil, err
+	}
+	return mjpeg.ParseHeader(b.Bytes())
+}
+
+// jpegType returns the RFC 2435 type of the sampling of a YCbCr frame.
+func jpegType(h *mjpeg.Header) (byte, error) {
+	if len(h.Components) != 3 {
+		return 0, ErrUnsupported
+	}
+	for _, c := range h.Components[1:] {
+		if c.H != 1 || c.V != 1 {
+			return 0, ErrUnsupported
+		}
+	}
+	switch y := h.Components[0]; {
+	case y.H == 2 && y.V == 1:
+		return jpegType422, nil
+	case y.H == 2 && y.V == 2:
+		return jpegType420, nil
+	}
+	return 0, ErrUnsupported
+}
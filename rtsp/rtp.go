@@ -0,0 +1,69 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	rtpVersion    = 2
+	rtpHeaderSize = 12
+	clockRate     = 90000 // of all video payload formats used here
+
+	rtcpSenderReport = 200
+)
+
+// packetizer splits frames into RTP payloads.
+type packetizer interface {
+	payloadType() uint8
+	// observe is shown every frame, playing or not, to learn the stream
+	// parameters the SDP announces.
+	observe(frame []byte)
+	// packetize returns the payloads of a frame, the last one gets the
+	// marker bit, and whether the frame can be decoded on its own.
+	packetize(frame []byte) (payloads [][]byte, keyframe bool, err error)
+	// mediaAttributes returns the SDP attributes of the media.
+	mediaAttributes() []string
+}
+
+// rtpTimestamp converts a buffer timestamp to the 90 kHz clock. It wraps
+// like RTP timestamps do.
+func rtpTimestamp(ts time.Duration) uint32 {
+	d := uint64(ts)
+	return uint32(d/uint64(time.Second)*clockRate + d%uint64(time.Second)*clockRate/uint64(time.Second))
+}
+
+func appendRtpHeader(b []byte, marker bool, payloadType uint8, seq uint16, timestamp, ssrc uint32) []byte {
+	m := payloadType
+	if marker {
+		m |= 0x80
+	}
+	b = append(b, rtpVersion<<6, m, byte(seq>>8), byte(seq))
+	b = append(b, byte(timestamp>>24), byte(timestamp>>16), byte(timestamp>>8), byte(timestamp))
+	return append(b, byte(ssrc>>24), byte(ssrc>>16), byte(ssrc>>8), byte(ssrc))
+}
+
+// ntpEpochOffset is the number of seconds from 1900 to 1970.
+const ntpEpochOffset = 2208988800
+
+func ntpTime(t time.Time) uint64 {
+	ns := uint64(t.UnixNano())
+	seconds := ns/uint64(time.Second) + ntpEpochOffset
+	fraction := ns % uint64(time.Second) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// senderReport builds an RTCP sender report without report blocks, so
+// that receivers can map RTP timestamps to wall clock time.
+func senderReport(ssrc uint32, now time.Time, rtpTime, packets, octets uint32) []byte {
+	b := make([]byte, 28)
+	b[0] = rtpVersion << 6
+	b[1] = rtcpSenderReport
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)/4-1))
+	binary.BigEndian.PutUint32(b[4:], ssrc)
+	binary.BigEndian.PutUint64(b[8:], ntpTime(now))
+	binary.BigEndian.PutUint32(b[16:], rtpTime)
+	binary.BigEndian.PutUint32(b[20:], packets)
+	binary.BigEndian.PutUint32(b[24:], octets)
+	return b
+}
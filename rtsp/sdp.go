@@ -0,0 +1,39 @@
+package rtsp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// trackControl is the control URL of the only track, relative to the
+// Content-Base of the presentation.
+const trackControl = "trackID=0"
+
+// sdp describes the stream for DESCRIBE, as served from host.
+func (s *Server) sdp(host net.IP) []byte {
+	addrType, addr, unspecified := "IP4", "0.0.0.0", "0.0.0.0"
+	if host != nil {
+		addr = host.String()
+		if host.To4() == nil {
+			addrType, unspecified = "IP6", "::"
+		}
+	}
+	var b strings.Builder
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(&b, "o=- %d 1 IN %s %s\r\n", s.sessionId, addrType, addr)
+	fmt.Fprintf(&b, "s=%s\r\n", s.config.Name)
+	fmt.Fprintf(&b, "c=IN %s %s\r\n", addrType, unspecified)
+	b.WriteString("t=0 0\r\n")
+	b.WriteString("a=control:*\r\n")
+	b.WriteString("a=range:npt=now-\r\n")
+	fmt.Fprintf(&b, "m=video 0 RTP/AVP %d\r\n", s.packetizer.payloadType())
+	for _, a := range s.packetizer.mediaAttributes() {
+		fmt.Fprintf(&b, "a=%s\r\n", a)
+	}
+	if fr := s.config.FrameRate; fr.Numerator != 0 && fr.Denominator != 0 {
+		fmt.Fprintf(&b, "a=framerate:%g\r\n", float64(fr.Numerator)/float64(fr.Denominator))
+	}
+	fmt.Fprintf(&b, "a=control:%s\r\n", trackControl)
+	return []byte(b.String())
+}
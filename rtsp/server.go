@@ -0,0 +1,299 @@
+// Package rtsp serves a capture stream to RTSP clients over RTP, either
+// interleaved in the RTSP connection or over UDP. MJPEG is sent as RFC 2435
+// and H.264 as RFC 6184; raw formats are encoded to JPEG first.
+package rtsp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/snapshot"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrUnsupported = errors.New("rtsp: unsupported frame format")
+	ErrEmptyBuffer = errors.New("rtsp: buffer has no payload")
+	ErrClosed      = errors.New("rtsp: server is closed")
+)
+
+const (
+	DefaultQuality       = 85
+	defaultMaxPacketSize = 1400
+	defaultName          = "go-v4l2"
+
+	// Frames queued for a session before it drops them.
+	sessionQueue       = 16
+	senderReportPeriod = 5 * time.Second
+)
+
+type Config struct {
+	Format    v4l2.PixFormat // of the frames passed to WriteFrame
+	FrameRate v4l2.Fract     // frames per second, optional
+	Quality   int            // JPEG quality for raw formats, 0 for DefaultQuality
+	Name      string         // session name in the SDP, "" for "go-v4l2"
+
+	// MaxPacketSize limits RTP packets, headers included, 0 for 1400.
+	MaxPacketSize int
+	// UdpPort is the RTP port for UDP transport, RTCP uses the next one.
+	// 0 picks free ports.
+	UdpPort int
+}
+
+// frame is the packetized form of a frame, shared by all sessions.
+type frame struct {
+	payloads  [][]byte
+	timestamp uint32 // RTP, before the session offset
+	keyframe  bool
+}
+
+// Server is an RTSP server for a single stream. Frames are handed to it
+// with WriteFrame, which only packetizes them: sessions send them from
+// their own goroutines and drop frames when they fall behind.
+type Server struct {
+	config     Config
+	packetizer packetizer
+	sessionId  uint64 // of the SDP
+
+	rtpConn  *net.UDPConn
+	rtcpConn *net.UDPConn
+
+	mu        sync.Mutex
+	sessions  map[*session]struct{}
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+}
+
+// NewServer returns a server for frames in config.Format: PixFmt_Mjpeg,
+// PixFmt_Jpeg, PixFmt_H264, or any raw format the snapshot package encodes.
+func NewServer(config Config) (*Server, error) {
+	if config.Quality == 0 {
+		config.Quality = DefaultQuality
+	}
+	if config.Name == "" {
+		config.Name = defaultName
+	}
+	if config.MaxPacketSize == 0 {
+		config.MaxPacketSize = defaultMaxPacketSize
+	}
+	maxPayload := config.MaxPacketSize - rtpHeaderSize
+	s := &Server{
+		config:    config,
+		sessionId: uint64(randomUint32()),
+		sessions:  make(map[*session]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+	if config.Format.PixelFormat == v4l2.PixFmt_H264 {
+		p := &h264Packetizer{maxPayload: maxPayload}
+		p.params.Codec = v4l2.PixFmt_H264
+		s.packetizer = p
+	} else {
+		s.packetizer = &jpegPacketizer{
+			maxPayload: maxPayload,
+			width:      config.Format.Width,
+			height:     config.Format.Height,
+		}
+	}
+	if err := s.listenUdp(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) listenUdp() error {
+	var err error
+	s.rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: s.config.UdpPort})
+	if err != nil {
+		return err
+	}
+	rtpPort := s.rtpConn.LocalAddr().(*net.UDPAddr).Port
+	s.rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: rtpPort + 1})
+	if err != nil && s.config.UdpPort == 0 {
+		// The next port is taken, any port will do.
+		s.rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{})
+	}
+	if err != nil {
+		s.rtpConn.Close()
+		return err
+	}
+	// Receiver reports are not used, read them to keep the socket
+	// buffer from filling.
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := s.rtcpConn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Server) udpPorts() (int, int) {
+	return s.rtpConn.LocalAddr().(*net.UDPAddr).Port, s.rtcpConn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// ListenAndServe listens on the TCP address addr, ":554" if empty, and
+// serves RTSP clients until the server is closed.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = ":554"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts RTSP connections on l until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+		c := newConn(s, nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return ErrClosed
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// Close stops the listeners and disconnects all clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.rtpConn.Close()
+	s.rtcpConn.Close()
+	return nil
+}
+
+// WritePacket writes a packet dequeued from an Encoder.
+func (s *Server) WritePacket(p *v4l2.EncodedPacket) error {
+	return s.WriteFrame(p.Data, p.Timestamp)
+}
+
+// WriteBuffer writes the payload of a dequeued capture buffer, with its
+// timestamp.
+func (s *Server) WriteBuffer(b *v4l2.QueueBuffer) error {
+	data := b.Data()
+	if len(data) == 0 {
+		return ErrEmptyBuffer
+	}
+	return s.WriteFrame(data[0], time.Duration(b.TimestampNs()))
+}
+
+// WriteFrame sends a frame to the playing sessions, with an RTP timestamp
+// taken from the buffer timestamp. The frame is copied, so its buffer may
+// be requeued right away. While no session is playing, frames are only
+// scanned for the parameters the SDP announces.
+func (s *Server) WriteFrame(data []byte, timestamp time.Duration) error {
+	s.packetizer.observe(data)
+	if !s.playing() {
+		return nil
+	}
+	switch s.config.Format.PixelFormat {
+	case v4l2.PixFmt_H264, v4l2.PixFmt_Mjpeg, v4l2.PixFmt_Jpeg:
+		data = append([]byte(nil), data...)
+	default:
+		var err error
+		data, err = snapshot.Snapshot(data, &s.config.Format, s.config.Quality)
+		if err != nil {
+			return err
+		}
+	}
+	payloads, keyframe, err := s.packetizer.packetize(data)
+	if err != nil {
+		return err
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+	f := &frame{payloads: payloads, timestamp: rtpTimestamp(timestamp), keyframe: keyframe}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ss := range s.sessions {
+		ss.queue(f)
+	}
+	return nil
+}
+
+func (s *Server) playing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ss := range s.sessions {
+		if ss.playing {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) addSession(ss *session) {
+	s.mu.Lock()
+	s.sessions[ss] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Server) removeSession(ss *session) {
+	s.mu.Lock()
+	delete(s.sessions, ss)
+	s.mu.Unlock()
+}
+
+func (s *Server) removeConn(c *conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
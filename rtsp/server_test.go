@@ -0,0 +1,447 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/mjpeg"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// client is a minimal RTSP client.
+type client struct {
+	t    *testing.T
+	nc   net.Conn
+	r    *bufio.Reader
+	url  string
+	cseq int
+}
+
+func dial(t *testing.T, l net.Listener) *client {
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	return &client{t: t, nc: nc, r: bufio.NewReader(nc), url: "rtsp://" + l.Addr().String() + "/stream"}
+}
+
+// do sends a request and returns the status code, headers and body of the
+// response, skipping interleaved packets sent before it.
+func (c *client) do(method, url string, header ...string) (int, textproto.MIMEHeader, []byte) {
+	c.t.Helper()
+	c.cseq++
+	req := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, url, c.cseq)
+	for _, h := range header {
+		req += h + "\r\n"
+	}
+	if _, err := io.WriteString(c.nc, req+"\r\n"); err != nil {
+		c.t.Fatal(err)
+	}
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		b, err := c.r.Peek(1)
+		if err != nil {
+			c.t.Fatalf("%s: %v", method, err)
+		}
+		if b[0] != '$' {
+			break
+		}
+		c.readPacket()
+	}
+	tp := textproto.NewReader(c.r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	h, err := tp.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if cseq := h.Get("CSeq"); cseq != strconv.Itoa(c.cseq) {
+		c.t.Errorf("%s: CSeq %q, want %d", method, cseq, c.cseq)
+	}
+	var body []byte
+	if length := h.Get("Content-Length"); length != "" {
+		n, _ := strconv.Atoi(length)
+		body = make([]byte, n)
+		if _, err := io.ReadFull(c.r, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	parts := strings.Fields(line)
+	if len(parts) < 2 || parts[0] != rtspVersion {
+		c.t.Fatalf("%s: bad status line %q", method, line)
+	}
+	status, _ := strconv.Atoi(parts[1])
+	return status, h, body
+}
+
+// readPacket reads an interleaved packet.
+func (c *client) readPacket() (byte, []byte) {
+	c.t.Helper()
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0] != '$' {
+		c.t.Fatalf("not an interleaved packet: %x", header)
+	}
+	packet := make([]byte, int(header[2])<<8|int(header[3]))
+	if _, err := io.ReadFull(c.r, packet); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[1], packet
+}
+
+func sessionHeader(h textproto.MIMEHeader) string {
+	return "Session: " + strings.Split(h.Get("Session"), ";")[0]
+}
+
+func testJpeg(t *testing.T, width, height int) []byte {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func newTestServer(t *testing.T, config Config) (*Server, net.Listener) {
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return s, l
+}
+
+// feed writes a frame every 10 ms, 40 ms apart in stream time, until the
+// test ends.
+func feed(t *testing.T, s *Server, frame []byte) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		ts := time.Duration(0)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := s.WriteFrame(frame, ts); err != nil {
+				t.Error(err)
+				return
+			}
+			ts += 40 * time.Millisecond
+		}
+	}()
+}
+
+func TestInterleaved(t *testing.T) {
+	timeout := writeTimeout
+	writeTimeout = 100 * time.Millisecond
+	defer func() { writeTimeout = timeout }()
+
+	format := v4l2.PixFormat{Width: 320, Height: 240, PixelFormat: v4l2.PixFmt_Mjpeg}
+	s, l := newTestServer(t, Config{Format: format, MaxPacketSize: 500})
+	feed(t, s, testJpeg(t, 320, 240))
+	c := dial(t, l)
+
+	status, h, _ := c.do("OPTIONS", c.url)
+	if status != 200 || !strings.Contains(h.Get("Public"), "SETUP") {
+		t.Fatalf("OPTIONS: %d %v", status, h)
+	}
+	status, h, body := c.do("DESCRIBE", c.url, "Accept: application/sdp")
+	if status != 200 || h.Get("Content-Type") != "application/sdp" {
+		t.Fatalf("DESCRIBE: %d %v", status, h)
+	}
+	for _, line := range []string{"m=video 0 RTP/AVP 26", "a=framesize:26 320-240", "a=control:trackID=0"} {
+		if !bytes.Contains(body, []byte(line+"\r\n")) {
+			t.Errorf("SDP lacks %q:\n%s", line, body)
+		}
+	}
+	status, h, _ = c.do("SETUP", h.Get("Content-Base")+trackControl, "Transport: RTP/AVP/TCP;unicast;interleaved=4-5")
+	if status != 200 || !strings.HasPrefix(h.Get("Transport"), "RTP/AVP/TCP;unicast;interleaved=4-5") {
+		t.Fatalf("SETUP: %d %v", status, h)
+	}
+	sess := sessionHeader(h)
+	if status, _, _ := c.do("PLAY", c.url); status != 454 {
+		t.Errorf("PLAY without session: %d, want 454", status)
+	}
+	if status, _, _ = c.do("PLAY", c.url, sess); status != 200 {
+		t.Fatalf("PLAY: %d", status)
+	}
+
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var last uint32
+	for i := 0; i < 4; {
+		channel, packet := c.readPacket()
+		if channel == 5 {
+			continue // sender report
+		}
+		if channel != 4 {
+			t.Fatalf("packet on channel %d", channel)
+		}
+		if packet[1]&0x80 == 0 {
+			continue
+		}
+		ts := uint32(packet[4])<<24 | uint32(packet[5])<<16 | uint32(packet[6])<<8 | uint32(packet[7])
+		if i > 0 && ts-last != 3600 {
+			t.Errorf("timestamps %d apart, want 3600", ts-last)
+		}
+		last = ts
+		i++
+	}
+
+	if status, _, _ = c.do("PAUSE", c.url, sess); status != 200 {
+		t.Fatalf("PAUSE: %d", status)
+	}
+	// Responses after a pause longer than the packet write timeout.
+	time.Sleep(3 * writeTimeout)
+	if status, _, _ = c.do("GET_PARAMETER", c.url, sess); status != 200 {
+		t.Fatalf("GET_PARAMETER: %d", status)
+	}
+	if status, _, _ = c.do("PLAY", c.url, sess); status != 200 {
+		t.Fatalf("PLAY after PAUSE: %d", status)
+	}
+	if status, _, _ = c.do("TEARDOWN", c.url, sess); status != 200 {
+		t.Fatalf("TEARDOWN: %d", status)
+	}
+	if status, _, _ = c.do("PLAY", c.url, sess); status != 454 {
+		t.Errorf("PLAY after TEARDOWN: %d, want 454", status)
+	}
+}
+
+func TestUdp(t *testing.T) {
+	format := v4l2.PixFormat{Width: 320, Height: 240, PixelFormat: v4l2.PixFmt_Mjpeg}
+	s, l := newTestServer(t, Config{Format: format, MaxPacketSize: 500})
+	feed(t, s, testJpeg(t, 320, 240))
+	c := dial(t, l)
+
+	rtp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtp.Close()
+	port := rtp.LocalAddr().(*net.UDPAddr).Port
+	status, h, _ := c.do("SETUP", c.url+"/"+trackControl,
+		fmt.Sprintf("Transport: RTP/AVP;multicast, RTP/AVP;unicast;client_port=%d-%d", port, port+1))
+	if status != 200 || !strings.Contains(h.Get("Transport"), "server_port=") {
+		t.Fatalf("SETUP: %d %v", status, h)
+	}
+	sess := sessionHeader(h)
+	if status, _, _ = c.do("PLAY", c.url, sess); status != 200 {
+		t.Fatalf("PLAY: %d", status)
+	}
+
+	// A frame of the 320x240 JPEG spans several packets: the payload
+	// header of each holds the fragment offset.
+	buf := make([]byte, 1500)
+	offset, frames := 0, 0
+	started := false
+	for frames < 3 {
+		rtp.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := rtp.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 500 {
+			t.Fatalf("%d byte packet, limit is 500", n)
+		}
+		payload := buf[rtpHeaderSize:n]
+		fragment := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+		if fragment == 0 {
+			started, offset = true, 0
+		}
+		if !started {
+			continue // joined mid-frame
+		}
+		if fragment != offset {
+			t.Fatalf("fragment offset %d, want %d", fragment, offset)
+		}
+		data := payload[8:]
+		if offset == 0 {
+			// Quantization table header, Q is 255.
+			data = data[4+int(payload[10])<<8|int(payload[11]):]
+		}
+		offset += len(data)
+		if buf[1]&0x80 != 0 {
+			frames++
+		}
+	}
+	if status, _, _ = c.do("TEARDOWN", c.url, sess); status != 200 {
+		t.Fatalf("TEARDOWN: %d", status)
+	}
+}
+
+func TestUnsupportedTransport(t *testing.T) {
+	_, l := newTestServer(t, Config{Format: v4l2.PixFormat{PixelFormat: v4l2.PixFmt_Mjpeg}})
+	c := dial(t, l)
+	status, _, _ := c.do("SETUP", c.url+"/"+trackControl, "Transport: RTP/AVP;multicast")
+	if status != 461 {
+		t.Errorf("SETUP multicast: %d, want 461", status)
+	}
+}
+
+func TestH264ParameterSets(t *testing.T) {
+	s, l := newTestServer(t, Config{Format: v4l2.PixFormat{PixelFormat: v4l2.PixFmt_H264}})
+	// Headers sent separately, before any client plays the stream.
+	headers := []byte{
+		0, 0, 0, 1, 0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0xa0, 0x47, 0xfe, 0xc8,
+		0, 0, 0, 1, 0x68, 0xce, 0x3c, 0x80,
+	}
+	if err := s.WriteFrame(headers, 0); err != nil {
+		t.Fatal(err)
+	}
+	c := dial(t, l)
+	status, _, body := c.do("DESCRIBE", c.url)
+	if status != 200 {
+		t.Fatalf("DESCRIBE: %d", status)
+	}
+	want := "a=fmtp:96 packetization-mode=1;profile-level-id=42C01E;sprop-parameter-sets=Z0LAHtkAoEf+yA==,aM48gA==\r\n"
+	if !bytes.Contains(body, []byte(want)) {
+		t.Errorf("SDP lacks %q:\n%s", want, body)
+	}
+}
+
+// customHuffmanJpeg returns a grey 32x16 frame whose luma DC table swaps
+// the codes of the first two categories of the standard one.
+func customHuffmanJpeg(t *testing.T) []byte {
+	img := image.NewYCbCr(image.Rect(0, 0, 32, 16), image.YCbCrSubsampleRatio420)
+	for _, p := range [][]byte{img.Y, img.Cb, img.Cr} {
+		for i := range p {
+			p[i] = 128
+		}
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	frame := b.Bytes()
+	// image/jpeg writes the luma DC table first.
+	dht := bytes.Index(frame, []byte{0xff, 0xc4})
+	values := frame[dht+5+16:]
+	values[0], values[1] = values[1], values[0]
+
+	// Every block has a DC difference of 0 and no AC coefficient: per
+	// MCU, 4 luma blocks "010" "1010" and 2 chroma blocks "00" "00".
+	sos := bytes.Index(frame, []byte{0xff, 0xda})
+	scan := sos + 2 + int(frame[sos+2])<<8 | int(frame[sos+3])
+	mcu := strings.Repeat("0101010", 4) + strings.Repeat("0000", 2)
+	bits := mcu + mcu
+	custom := append([]byte(nil), frame[:scan]...)
+	for i := 0; i < len(bits); i += 8 {
+		v, _ := strconv.ParseUint(bits[i:i+8], 2, 8)
+		custom = append(custom, byte(v))
+	}
+	return append(custom, 0xff, 0xd9)
+}
+
+// readJpeg reassembles the next complete RFC 2435 frame sent on channel 0
+// into a JPEG frame without Huffman tables.
+func (c *client) readJpeg() []byte {
+	c.t.Helper()
+	var scan, header []byte
+	started := false
+	for {
+		channel, packet := c.readPacket()
+		if channel != 0 {
+			continue
+		}
+		payload := packet[rtpHeaderSize:]
+		fragment := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+		if fragment == 0 {
+			started, scan = true, nil
+			header = payload[:8]
+			length := int(payload[10])<<8 | int(payload[11])
+			header = append(header, payload[12:12+length]...)
+			payload = payload[12+length-8:]
+		}
+		if !started {
+			continue
+		}
+		scan = append(scan, payload[8:]...)
+		if packet[1]&0x80 != 0 {
+			break
+		}
+	}
+
+	typ, width, height, tables := header[4], int(header[6])*8, int(header[7])*8, header[8:]
+	sampling := byte(0x21)
+	if typ == jpegType420 {
+		sampling = 0x22
+	}
+	frame := []byte{0xff, 0xd8, 0xff, 0xdb, 0, 2 + 2*65, 0}
+	frame = append(frame, tables[:64]...)
+	frame = append(frame, 1)
+	frame = append(frame, tables[64:128]...)
+	frame = append(frame, 0xff, 0xc0, 0, 17, 8, byte(height>>8), byte(height), byte(width>>8), byte(width), 3,
+		1, sampling, 0, 2, 0x11, 1, 3, 0x11, 1)
+	frame = append(frame, 0xff, 0xda, 0, 12, 3, 1, 0x00, 2, 0x11, 3, 0x11, 0, 63, 0)
+	frame = append(frame, scan...)
+	return append(frame, 0xff, 0xd9)
+}
+
+func TestCustomHuffman(t *testing.T) {
+	frame := customHuffmanJpeg(t)
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y := img.(*image.YCbCr).Y[0]; y != 128 {
+		t.Fatalf("test frame is not grey: %d", y)
+	}
+	if h, err := mjpeg.ParseHeader(frame); err != nil || !h.CustomHuffman {
+		t.Fatalf("custom tables not found: %v", err)
+	}
+	if h, err := mjpeg.ParseHeader(testJpeg(t, 16, 16)); err != nil || h.CustomHuffman {
+		t.Fatalf("standard tables taken as custom: %v", err)
+	}
+
+	format := v4l2.PixFormat{Width: 32, Height: 16, PixelFormat: v4l2.PixFmt_Mjpeg}
+	s, l := newTestServer(t, Config{Format: format, MaxPacketSize: 200})
+	feed(t, s, frame)
+	c := dial(t, l)
+	status, h, _ := c.do("SETUP", c.url+"/"+trackControl, "Transport: RTP/AVP/TCP;unicast;interleaved=0-1")
+	if status != 200 {
+		t.Fatalf("SETUP: %d", status)
+	}
+	if status, _, _ = c.do("PLAY", c.url, sessionHeader(h)); status != 200 {
+		t.Fatalf("PLAY: %d", status)
+	}
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	received, err := mjpeg.Decode(c.readJpeg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ycbcr := received.(*image.YCbCr)
+	if b := ycbcr.Rect; b.Dx() != 32 || b.Dy() != 16 {
+		t.Fatalf("%v frame received", b)
+	}
+	for i, y := range ycbcr.Y {
+		if y < 127 || y > 129 {
+			t.Fatalf("luma %d at %d, want 128", y, i)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rtsp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transport is where a session sends its packets.
+type transport struct {
+	tcp         bool
+	rtpChannel  byte // interleaved channels, TCP
+	rtcpChannel byte
+	rtpAddr     *net.UDPAddr // UDP
+	rtcpAddr    *net.UDPAddr
+}
+
+func (t *transport) String() string {
+	if t.tcp {
+		return fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", t.rtpChannel, t.rtcpChannel)
+	}
+	return fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", t.rtpAddr.Port, t.rtcpAddr.Port)
+}
+
+// session is a client set up to receive the stream. Its packets carry their
+// own SSRC, sequence numbers and timestamp offset.
+type session struct {
+	id        string
+	server    *Server
+	conn      *conn
+	transport transport
+	ssrc      uint32
+	seq       uint32 // atomic, the low 16 bits are sent
+	tsOffset  uint32
+
+	// Guarded by server.mu.
+	playing bool
+	waitKey bool // a frame was dropped, skip to the next keyframe
+
+	frames    chan *frame
+	done      chan struct{}
+	closeOnce sync.Once
+
+	packets    uint32
+	octets     uint32
+	lastReport time.Time
+}
+
+func newSession(s *Server, c *conn, t transport) *session {
+	ss := &session{
+		id:        fmt.Sprintf("%08X", randomUint32()),
+		server:    s,
+		conn:      c,
+		transport: t,
+		ssrc:      randomUint32(),
+		seq:       randomUint32(),
+		tsOffset:  randomUint32(),
+		frames:    make(chan *frame, sessionQueue),
+		done:      make(chan struct{}),
+	}
+	s.addSession(ss)
+	go ss.run()
+	return ss
+}
+
+// queue hands a frame to the session without blocking. Called with
+// server.mu held.
+func (ss *session) queue(f *frame) {
+	if !ss.playing || ss.waitKey && !f.keyframe {
+		return
+	}
+	select {
+	case ss.frames <- f:
+		ss.waitKey = false
+	default:
+		ss.waitKey = true
+	}
+}
+
+func (ss *session) setPlaying(playing bool) {
+	ss.server.mu.Lock()
+	ss.playing = playing
+	// Start from a frame that can be decoded.
+	ss.waitKey = true
+	ss.server.mu.Unlock()
+}
+
+// nextSeq returns the sequence number of the next RTP packet.
+func (ss *session) nextSeq() uint16 {
+	return uint16(atomic.LoadUint32(&ss.seq))
+}
+
+func (ss *session) close() {
+	ss.closeOnce.Do(func() {
+		ss.server.removeSession(ss)
+		close(ss.done)
+	})
+}
+
+func (ss *session) run() {
+	for {
+		select {
+		case <-ss.done:
+			return
+		case f := <-ss.frames:
+			if err := ss.send(f); err != nil {
+				// Interleaved sessions die with their connection,
+				// UDP errors are transient.
+				if ss.transport.tcp {
+					ss.conn.nc.Close()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (ss *session) send(f *frame) error {
+	timestamp := f.timestamp + ss.tsOffset
+	for i, payload := range f.payloads {
+		packet := make([]byte, 0, rtpHeaderSize+len(payload))
+		packet = appendRtpHeader(packet, i == len(f.payloads)-1, ss.server.packetizer.payloadType(),
+			ss.nextSeq(), timestamp, ss.ssrc)
+		packet = append(packet, payload...)
+		atomic.AddUint32(&ss.seq, 1)
+		ss.packets++
+		ss.octets += uint32(len(payload))
+		if err := ss.write(packet, false); err != nil {
+			return err
+		}
+	}
+	if now := time.Now(); now.Sub(ss.lastReport) >= senderReportPeriod {
+		ss.lastReport = now
+		return ss.write(senderReport(ss.ssrc, now, timestamp, ss.packets, ss.octets), true)
+	}
+	return nil
+}
+
+func (ss *session) write(packet []byte, rtcp bool) error {
+	t := &ss.transport
+	if t.tcp {
+		channel := t.rtpChannel
+		if rtcp {
+			channel = t.rtcpChannel
+		}
+		return ss.conn.writeInterleaved(channel, packet)
+	}
+	if rtcp {
+		_, err := ss.server.rtcpConn.WriteToUDP(packet, t.rtcpAddr)
+		return err
+	}
+	_, err := ss.server.rtpConn.WriteToUDP(packet, t.rtpAddr)
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/httpstream"
+	"github.com/paskozdilar/go-v4l2/snapshot"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// serveMain streams a capture device as MJPEG over HTTP.
+func serveMain(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	devPath := flags.String("dev-path", "/dev/video0", "Video4linux device path")
+	addr := flags.String("addr", ":8080", "HTTP listen address")
+	width := flags.Uint("width", 0, "Frame width, 0 keeps the current format")
+	height := flags.Uint("height", 0, "Frame height")
+	fourcc := flags.String("format", "", "Pixel format fourcc, e.g. YUYV or MJPG")
+	quality := flags.Int("quality", httpstream.DefaultQuality, "JPEG quality 1-100 for raw formats")
+	timeout := flags.Duration("timeout", 5*time.Second, "Time to wait for each frame")
+	flags.Parse(args)
+
+	dev, err := v4l2.Open(*devPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Close()
+	if err := setCaptureFormat(dev, *width, *height, *fourcc); err != nil {
+		log.Fatal(err)
+	}
+	src, err := newDeviceSource(dev, *timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.close()
+	log.Printf("- streaming %dx%d %v", src.format.Width, src.format.Height, src.format.PixelFormat)
+
+	server := httpstream.NewServer(*quality)
+	go func() {
+		log.Fatal(server.Run(src))
+	}()
+	log.Printf("- serving on %s, snapshots at %s", *addr, httpstream.SnapshotPath)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
+
+// deviceSource reads frames from a single-planar capture device. Each
+// buffer is requeued on the next ReadFrame, once the server copied it.
+type deviceSource struct {
+	dev     *v4l2.Device
+	queue   *v4l2.Queue
+	format  v4l2.PixFormat
+	timeout time.Duration
+	last    *v4l2.QueueBuffer
+}
+
+func newDeviceSource(dev *v4l2.Device, timeout time.Duration) (*deviceSource, error) {
+	format, err := dev.GetFormat(v4l2.BufType_VideoCapture)
+	if err != nil {
+		return nil, err
+	}
+	q, err := dev.RequestQueue(v4l2.BufType_VideoCapture, v4l2.Memory_Mmap, 4)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range q.Buffers {
+		if err := q.Enqueue(b); err != nil {
+			q.Release()
+			return nil, err
+		}
+	}
+	if err := q.StreamOn(); err != nil {
+		q.Release()
+		return nil, err
+	}
+	return &deviceSource{dev: dev, queue: q, format: *format.Pix(), timeout: timeout}, nil
+}
+
+func (s *deviceSource) ReadFrame() ([]byte, v4l2.PixFormat, error) {
+	for {
+		if s.last != nil {
+			if err := s.queue.Enqueue(s.last); err != nil {
+				return nil, s.format, err
+			}
+			s.last = nil
+		}
+		revents, err := s.dev.Poll(v4l2.PollIn, s.timeout)
+		if err != nil {
+			return nil, s.format, err
+		}
+		if revents == 0 {
+			return nil, s.format, snapshot.ErrTimeout
+		}
+		b, err := s.queue.Dequeue()
+		if err != nil {
+			return nil, s.format, err
+		}
+		s.last = b
+		data := b.Data()
+		if b.Flags&v4l2.BufFlag_Error == 0 && len(data) > 0 && len(data[0]) > 0 {
+			return data[0], s.format, nil
+		}
+	}
+}
+
+func (s *deviceSource) close() {
+	s.queue.StreamOff()
+	s.queue.Release()
+}
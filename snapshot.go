@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/snapshot"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// snapshotMain saves one frame from a capture device as JPEG or PNG,
+// depending on the extension of the output file.
+func snapshotMain(args []string) {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	devPath := flags.String("dev-path", "/dev/video0", "Video4linux device path")
+	output := flags.String("o", "snapshot.jpg", "Output file, .jpg or .png")
+	width := flags.Uint("width", 0, "Frame width, 0 keeps the current format")
+	height := flags.Uint("height", 0, "Frame height")
+	fourcc := flags.String("format", "", "Pixel format fourcc, e.g. YUYV or MJPG")
+	quality := flags.Int("quality", 0, "JPEG quality 1-100, 0 for the device's or the default")
+	skip := flags.Int("skip", 5, "Frames to drop while exposure settles")
+	timeout := flags.Duration("timeout", 5*time.Second, "Time to wait for each frame")
+	flags.Parse(args)
+
+	dev, err := v4l2.Open(*devPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Close()
+
+	if err := setCaptureFormat(dev, *width, *height, *fourcc); err != nil {
+		log.Fatal(err)
+	}
+
+	// Multi-planar devices never produce JPEG, their format is left to
+	// snapshot.Capture.
+	format, err := dev.GetFormat(v4l2.BufType_VideoCapture)
+	isJpeg := err == nil && (format.Pix().PixelFormat == v4l2.PixFmt_Mjpeg || format.Pix().PixelFormat == v4l2.PixFmt_Jpeg)
+	if isJpeg && *quality != 0 {
+		if err := snapshot.SetJpegQuality(dev, *quality); err != nil {
+			log.Println("Ignoring error [SetJpegQuality]:", err)
+		}
+	}
+	if *quality == 0 {
+		*quality = 90
+		if q, err := snapshot.JpegQuality(dev); err == nil && q > 0 {
+			*quality = q
+		}
+	}
+
+	frame, pix, err := snapshot.Capture(dev, *skip, *timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("- captured %dx%d frame, %d bytes", pix.Width, pix.Height, len(frame))
+
+	var data []byte
+	if strings.EqualFold(filepath.Ext(*output), ".png") {
+		data, err = snapshot.SnapshotPNG(frame, &pix)
+	} else {
+		data, err = snapshot.Snapshot(frame, &pix, *quality)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("- saved", *output)
+}
+
+// setCaptureFormat changes the size and pixel format of a single-planar
+// capture device, if requested on the command line.
+func setCaptureFormat(dev *v4l2.Device, width, height uint, fourcc string) error {
+	if width == 0 && fourcc == "" {
+		return nil
+	}
+	format, err := dev.GetFormat(v4l2.BufType_VideoCapture)
+	if err != nil {
+		return err
+	}
+	pix := format.Pix()
+	if width != 0 {
+		pix.Width = uint32(width)
+		pix.Height = uint32(height)
+	}
+	if fourcc != "" {
+		code := []byte(fourcc + "    ")
+		pix.PixelFormat = v4l2.Fourcc(uint32(code[0]), uint32(code[1]), uint32(code[2]), uint32(code[3]))
+	}
+	return dev.SetFormat(&format)
+}
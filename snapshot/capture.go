@@ -0,0 +1,110 @@
+package snapshot
+
+import (
+	"errors"
+	"time"
+
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+var (
+	ErrNotCapture = errors.New("snapshot: not a single-plane video capture device")
+	ErrTimeout    = errors.New("snapshot: timed out waiting for a frame")
+)
+
+// Capture streams from a video capture device until it has a frame to
+// return, dropping the first skip frames while auto exposure settles. The
+// frame is in the format currently set on the device.
+func Capture(dev *v4l2.Device, skip int, timeout time.Duration) ([]byte, v4l2.PixFormat, error) {
+	t, err := captureType(dev)
+	if err != nil {
+		return nil, v4l2.PixFormat{}, err
+	}
+	format, err := dev.GetFormat(t)
+	if err != nil {
+		return nil, v4l2.PixFormat{}, err
+	}
+	pix := pixFormat(&format)
+	if pix == nil {
+		return nil, v4l2.PixFormat{}, ErrNotCapture
+	}
+
+	q, err := dev.RequestQueue(t, v4l2.Memory_Mmap, 4)
+	if err != nil {
+		return nil, *pix, err
+	}
+	defer q.Release()
+	for _, b := range q.Buffers {
+		if err := q.Enqueue(b); err != nil {
+			return nil, *pix, err
+		}
+	}
+	if err := q.StreamOn(); err != nil {
+		return nil, *pix, err
+	}
+	defer q.StreamOff()
+
+	for i := 0; ; i++ {
+		revents, err := dev.Poll(v4l2.PollIn, timeout)
+		if err != nil {
+			return nil, *pix, err
+		}
+		if revents == 0 {
+			return nil, *pix, ErrTimeout
+		}
+		b, err := q.Dequeue()
+		if err != nil {
+			return nil, *pix, err
+		}
+		data := b.Data()
+		if i >= skip && b.Flags&v4l2.BufFlag_Error == 0 && len(data) > 0 && len(data[0]) > 0 {
+			return append([]byte(nil), data[0]...), *pix, nil
+		}
+		if err := q.Enqueue(b); err != nil {
+			return nil, *pix, err
+		}
+	}
+}
+
+func captureType(dev *v4l2.Device) (v4l2.BufType, error) {
+	capability, err := dev.QueryCap()
+	if err != nil {
+		return 0, err
+	}
+	caps := capability.Capabilities
+	if caps&v4l2.Cap_DeviceCaps != 0 {
+		caps = v4l2.Cap(capability.DeviceCaps)
+	}
+	switch {
+	case caps&v4l2.Cap_VideoCapture != 0:
+		return v4l2.BufType_VideoCapture, nil
+	case caps&v4l2.Cap_VideoCaptureMplane != 0:
+		return v4l2.BufType_VideoCaptureMplane, nil
+	default:
+		return 0, ErrNotCapture
+	}
+}
+
+// pixFormat returns the single-planar equivalent of format, or nil for
+// formats with more than one plane.
+func pixFormat(format *v4l2.Format) *v4l2.PixFormat {
+	if !format.Type.IsMultiplanar() {
+		return format.Pix()
+	}
+	mp := format.PixMp()
+	if mp.NumPlanes != 1 {
+		return nil
+	}
+	return &v4l2.PixFormat{
+		Width:            mp.Width,
+		Height:           mp.Height,
+		PixelFormat:      v4l2.PixFmt(mp.PixelFormat),
+		Field:            v4l2.Field(mp.Field),
+		BytesPerLine:     mp.PlaneFmt[0].BytesPerLine,
+		SizeImage:        mp.PlaneFmt[0].SizeImage,
+		Colorspace:       v4l2.Colorspace(mp.Colorspace),
+		YcbcrEncOrHsvEnc: uint32(mp.YcbcrEncOrHsvEnc),
+		Quantization:     v4l2.Quantization(mp.Quantization),
+		XferFunc:         uint32(mp.XferFunc),
+	}
+}
@@ -0,0 +1,104 @@
+// Package snapshot encodes captured frames as JPEG or PNG still images.
+package snapshot
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/paskozdilar/go-v4l2/convert"
+	"github.com/paskozdilar/go-v4l2/demosaic"
+	"github.com/paskozdilar/go-v4l2/mjpeg"
+	"github.com/paskozdilar/go-v4l2/v4l2"
+)
+
+// DemosaicOptions are used for Bayer frames. They favour a pleasant image
+// over a faithful one.
+var DemosaicOptions = demosaic.Options{
+	Algorithm:        demosaic.Algorithm_Malvar,
+	AutoWhiteBalance: true,
+	Gamma:            2.2,
+}
+
+func isJpeg(f v4l2.PixFmt) bool {
+	return f == v4l2.PixFmt_Mjpeg || f == v4l2.PixFmt_Jpeg
+}
+
+// Decode converts a frame in any format supported by the convert, demosaic
+// or mjpeg packages to an image.
+func Decode(frame []byte, format *v4l2.PixFormat) (image.Image, error) {
+	if isJpeg(format.PixelFormat) {
+		return mjpeg.Decode(frame)
+	}
+	if _, ok := demosaic.LookupRawFormat(format.PixelFormat); ok {
+		return demosaic.Image(format, frame, &DemosaicOptions)
+	}
+	return convert.Image(format, frame)
+}
+
+// Snapshot encodes a frame as JPEG at the given quality, from 1 to 100.
+// Frames that already are JPEG are passed through without re-encoding, only
+// made decodable on their own; their quality is set on the device with
+// SetJpegQuality.
+func Snapshot(frame []byte, format *v4l2.PixFormat, quality int) ([]byte, error) {
+	if isJpeg(format.PixelFormat) {
+		fixed, err := mjpeg.Fix(frame)
+		if err != nil {
+			return nil, err
+		}
+		// The frame may live in a buffer that is about to be requeued.
+		return append([]byte(nil), fixed...), nil
+	}
+	img, err := Decode(frame, format)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SnapshotPNG encodes a frame losslessly as PNG. Frames with more than 8
+// bits per sample keep their depth.
+func SnapshotPNG(frame []byte, format *v4l2.PixFormat) ([]byte, error) {
+	img, err := Decode(frame, format)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// JpegQuality returns the JPEG quality the device compresses with, from
+// the JPEG compression quality control or the older VIDIOC_G_JPEGCOMP.
+func JpegQuality(dev *v4l2.Device) (int, error) {
+	quality, err := dev.GetControl(v4l2.Cid_JpegCompressionQuality)
+	if err == nil {
+		return int(quality), nil
+	}
+	compression, err := dev.GetJpegCompression()
+	if err != nil {
+		return 0, err
+	}
+	return int(compression.Quality), nil
+}
+
+// SetJpegQuality sets the JPEG quality of a device producing MJPEG.
+func SetJpegQuality(dev *v4l2.Device, quality int) error {
+	err := dev.SetControl(v4l2.Cid_JpegCompressionQuality, int32(quality))
+	if err == nil {
+		return nil
+	}
+	compression, errComp := dev.GetJpegCompression()
+	if errComp != nil {
+		return err
+	}
+	compression.Quality = int32(quality)
+	return dev.SetJpegCompression(&compression)
+}
@@ -0,0 +1,197 @@
+package v4l2
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultClockPeriod = time.Second
+	clockHistory       = 8 // samples kept to map timestamps older than the last one
+	clockReads         = 3 // paired reads per sample, the tightest one is kept
+
+	// NTP slews the clocks by at most 500 ppm, a larger change of the
+	// realtime offset is a step.
+	maxClockDrift = 500e-6
+	// A change of the boottime offset larger than this is a suspend.
+	suspendThreshold = 10 * time.Millisecond
+)
+
+// ClockSample is a paired reading of the system clocks.
+type ClockSample struct {
+	Monotonic time.Duration // CLOCK_MONOTONIC
+	Boottime  time.Duration // CLOCK_BOOTTIME
+	Realtime  time.Time     // CLOCK_REALTIME
+	Error     time.Duration // half the time the reading took
+}
+
+// FrameTime is the time of a frame on each clock.
+type FrameTime struct {
+	Monotonic time.Duration
+	Boottime  time.Duration
+	Wall      time.Time
+	Error     time.Duration // bound of the error of Wall
+}
+
+// ClockMapper maps CLOCK_MONOTONIC timestamps to CLOCK_REALTIME and
+// CLOCK_BOOTTIME. The clocks are read again once the last sample is older
+// than the period, once the estimated error exceeds maxError, and after a
+// suspend. Between samples the drift of the realtime clock, as slewed by
+// NTP or PTP, is extrapolated. Timestamps are mapped with the last sample
+// taken before them, so frames captured before a clock step or a suspend
+// keep their times.
+type ClockMapper struct {
+	period   time.Duration
+	maxError time.Duration
+
+	mu      sync.Mutex
+	samples []ClockSample // oldest first
+	drift   float64       // of realtime against monotonic, since the last sample
+}
+
+// NewClockMapper returns a mapper reading the clocks every period, 0 for
+// one second, or whenever its error would exceed maxError, 0 for no limit.
+func NewClockMapper(period, maxError time.Duration) *ClockMapper {
+	if period == 0 {
+		period = defaultClockPeriod
+	}
+	m := &ClockMapper{period: period, maxError: maxError}
+	m.Sync()
+	return m
+}
+
+// readClocks and peekClocks are variables so tests can stand in for the
+// system clocks.
+var (
+	readClocks = sysReadClocks
+	peekClocks = sysPeekClocks
+)
+
+// sysReadClocks takes the tightest of a few paired readings. Boottime and
+// realtime are read between two monotonic readings and attributed to their
+// midpoint.
+func sysReadClocks() ClockSample {
+	var best ClockSample
+	for i := 0; i < clockReads; i++ {
+		before := clockNow(clockMonotonic)
+		realtime := clockNow(clockRealtime)
+		boottime := clockNow(clockBoottime)
+		after := clockNow(clockMonotonic)
+		s := ClockSample{
+			Monotonic: before + (after-before)/2,
+			Boottime:  boottime,
+			Realtime:  time.Unix(0, int64(realtime)),
+			Error:     (after - before + 1) / 2,
+		}
+		if i == 0 || s.Error < best.Error {
+			best = s
+		}
+	}
+	return best
+}
+
+// sysPeekClocks reads CLOCK_MONOTONIC and CLOCK_BOOTTIME once.
+func sysPeekClocks() ClockSample {
+	return ClockSample{
+		Monotonic: clockNow(clockMonotonic),
+		Boottime:  clockNow(clockBoottime),
+	}
+}
+
+// Sync reads the clocks and returns the new sample.
+func (m *ClockMapper) Sync() ClockSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sync()
+}
+
+func (m *ClockMapper) sync() ClockSample {
+	s := readClocks()
+	m.drift = 0
+	if n := len(m.samples); n > 0 {
+		last := m.samples[n-1]
+		elapsed := s.Monotonic - last.Monotonic
+		change := s.Realtime.Sub(last.Realtime) - elapsed
+		if elapsed > 0 && !suspended(last, s) {
+			drift := float64(change) / float64(elapsed)
+			if drift <= maxClockDrift && drift >= -maxClockDrift {
+				m.drift = drift
+			}
+		}
+	}
+	if len(m.samples) == clockHistory {
+		copy(m.samples, m.samples[1:])
+		m.samples = m.samples[:clockHistory-1]
+	}
+	m.samples = append(m.samples, s)
+	return s
+}
+
+// suspended reports whether the system was suspended between two samples:
+// CLOCK_BOOTTIME kept running, CLOCK_MONOTONIC did not.
+func suspended(a, b ClockSample) bool {
+	gap := (b.Boottime - b.Monotonic) - (a.Boottime - a.Monotonic)
+	return gap > suspendThreshold
+}
+
+// refresh takes a new sample if the last one went stale.
+func (m *ClockMapper) refresh() {
+	last := m.samples[len(m.samples)-1]
+	now := peekClocks()
+	age := now.Monotonic - last.Monotonic
+	stale := age >= m.period || suspended(last, now)
+	if m.maxError > 0 && last.Error+m.extrapolationError(age) > m.maxError {
+		stale = true
+	}
+	if stale {
+		m.sync()
+	}
+}
+
+func (m *ClockMapper) extrapolationError(d time.Duration) time.Duration {
+	if d < 0 {
+		d = -d
+	}
+	drift := m.drift
+	if drift < 0 {
+		drift = -drift
+	}
+	return time.Duration(float64(d) * drift)
+}
+
+// Map returns the times of the CLOCK_MONOTONIC timestamp mono.
+func (m *ClockMapper) Map(mono time.Duration) FrameTime {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh()
+
+	// The drift is only known since the last sample, earlier samples are
+	// used as they are.
+	i := len(m.samples) - 1
+	for i > 0 && m.samples[i].Monotonic > mono {
+		i--
+	}
+	s := m.samples[i]
+	d := mono - s.Monotonic
+	wall := d
+	extrapolation := time.Duration(0)
+	if i == len(m.samples)-1 {
+		wall += time.Duration(float64(d) * m.drift)
+		extrapolation = m.extrapolationError(d)
+	}
+	return FrameTime{
+		Monotonic: mono,
+		Boottime:  s.Boottime + d,
+		Wall:      s.Realtime.Add(wall),
+		Error:     s.Error + extrapolation,
+	}
+}
+
+// FrameTime maps the timestamp of a dequeued buffer. It returns false if
+// the driver did not stamp the buffer with CLOCK_MONOTONIC.
+func (m *ClockMapper) FrameTime(b *Buffer) (FrameTime, bool) {
+	if b.TimestampType() != BufFlag_TimestampMonotonic {
+		return FrameTime{}, false
+	}
+	return m.Map(b.Timestamp.Duration()), true
+}
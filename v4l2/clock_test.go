@@ -0,0 +1,147 @@
+package v4l2
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClocks stands in for the system clocks. The realtime clock runs at
+// the rate of the monotonic one plus drift, unless stepped.
+type fakeClocks struct {
+	mono, boot time.Duration
+	real       time.Time
+	drift      float64
+	err        time.Duration
+	reads      int
+}
+
+func newFakeClocks(t *testing.T) *fakeClocks {
+	c := &fakeClocks{
+		mono: 10 * time.Second,
+		boot: 12 * time.Second,
+		real: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		err:  time.Microsecond,
+	}
+	readClocks = func() ClockSample {
+		c.reads++
+		return ClockSample{Monotonic: c.mono, Boottime: c.boot, Realtime: c.real, Error: c.err}
+	}
+	peekClocks = func() ClockSample {
+		return ClockSample{Monotonic: c.mono, Boottime: c.boot}
+	}
+	t.Cleanup(func() {
+		readClocks = sysReadClocks
+		peekClocks = sysPeekClocks
+	})
+	return c
+}
+
+func (c *fakeClocks) advance(d time.Duration) {
+	c.mono += d
+	c.boot += d
+	c.real = c.real.Add(d + time.Duration(float64(d)*c.drift))
+}
+
+func TestClockSuspend(t *testing.T) {
+	c := newFakeClocks(t)
+	m := NewClockMapper(time.Hour, 0)
+	start, startReal := c.mono, c.real
+
+	// A 5 second suspend, which CLOCK_MONOTONIC does not count.
+	c.advance(100 * time.Millisecond)
+	c.boot += 5 * time.Second
+	c.real = c.real.Add(5 * time.Second)
+	now := m.Map(c.mono)
+	if c.reads != 2 {
+		t.Fatalf("%d clock reads, want a resync after the suspend", c.reads)
+	}
+	if now.Boottime != c.boot || !now.Wall.Equal(c.real) {
+		t.Errorf("after the suspend: %+v, want boottime %v and %v", now, c.boot, c.real)
+	}
+	if m.drift != 0 {
+		t.Errorf("drift %g across the suspend", m.drift)
+	}
+
+	// Frames captured before the suspend keep their times.
+	before := m.Map(start + 50*time.Millisecond)
+	if before.Boottime != 12*time.Second+50*time.Millisecond || !before.Wall.Equal(startReal.Add(50*time.Millisecond)) {
+		t.Errorf("before the suspend: %+v", before)
+	}
+	if c.reads != 2 {
+		t.Errorf("%d clock reads, want no resync", c.reads)
+	}
+}
+
+func TestClockStep(t *testing.T) {
+	c := newFakeClocks(t)
+	m := NewClockMapper(time.Second, 0)
+	start, startReal := c.mono, c.real
+
+	// The realtime clock is stepped an hour forward, which is noticed
+	// once the period has passed.
+	c.advance(2 * time.Second)
+	c.real = c.real.Add(time.Hour)
+	after := m.Map(c.mono + 500*time.Millisecond)
+	if c.reads != 2 {
+		t.Fatalf("%d clock reads, want a resync after the period", c.reads)
+	}
+	if want := c.real.Add(500 * time.Millisecond); !after.Wall.Equal(want) {
+		t.Errorf("after the step: %v, want %v", after.Wall, want)
+	}
+	if m.drift != 0 {
+		t.Errorf("drift %g across the step", m.drift)
+	}
+
+	before := m.Map(start + 1500*time.Millisecond)
+	if want := startReal.Add(1500 * time.Millisecond); !before.Wall.Equal(want) || before.Error != c.err {
+		t.Errorf("before the step: %v with error %v, want %v with error %v", before.Wall, before.Error, want, c.err)
+	}
+}
+
+func TestClockExtrapolation(t *testing.T) {
+	c := newFakeClocks(t)
+	c.drift = 100e-6
+	m := NewClockMapper(time.Hour, 0)
+	c.advance(time.Second)
+	s := m.Sync()
+	if m.drift < 99e-6 || m.drift > 101e-6 {
+		t.Fatalf("drift %g, want 100e-6", m.drift)
+	}
+
+	// The error grows with the distance from the last sample.
+	for _, d := range []time.Duration{0, time.Second, 2 * time.Second} {
+		ft := m.Map(s.Monotonic + d)
+		wantError := c.err + d/10000
+		if diff := ft.Error - wantError; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%v from the sample: error %v, want %v", d, ft.Error, wantError)
+		}
+		wantWall := s.Realtime.Add(d + d/10000)
+		if diff := ft.Wall.Sub(wantWall); diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%v from the sample: %v, want %v", d, ft.Wall, wantWall)
+		}
+	}
+
+	// Earlier timestamps are mapped with the earlier sample, without
+	// extrapolation.
+	ft := m.Map(s.Monotonic - 500*time.Millisecond)
+	if want := s.Realtime.Add(-time.Second - 100*time.Microsecond + 500*time.Millisecond); !ft.Wall.Equal(want) || ft.Error != c.err {
+		t.Errorf("before the sample: %v with error %v, want %v with error %v", ft.Wall, ft.Error, want, c.err)
+	}
+
+	// A maximum error forces a resync once the extrapolation reaches it.
+	c = newFakeClocks(t)
+	c.drift = 100e-6
+	m = NewClockMapper(time.Hour, 50*time.Microsecond)
+	c.advance(time.Second)
+	m.Sync()
+	c.advance(400 * time.Millisecond)
+	m.Map(c.mono)
+	if c.reads != 2 {
+		t.Errorf("%d clock reads with an error of 41µs, want 2", c.reads)
+	}
+	c.advance(100 * time.Millisecond)
+	m.Map(c.mono)
+	if c.reads != 3 {
+		t.Errorf("%d clock reads with an error of 51µs, want 3", c.reads)
+	}
+}
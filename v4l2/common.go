@@ -0,0 +1,24 @@
+package v4l2
+
+// v4l2-common.h
+
+type SelTgt uint32
+
+const (
+	SelTgt_Crop           SelTgt = 0x0000
+	SelTgt_CropDefault    SelTgt = 0x0001
+	SelTgt_CropBounds     SelTgt = 0x0002
+	SelTgt_NativeSize     SelTgt = 0x0003
+	SelTgt_Compose        SelTgt = 0x0100
+	SelTgt_ComposeDefault SelTgt = 0x0101
+	SelTgt_ComposeBounds  SelTgt = 0x0102
+	SelTgt_ComposePadded  SelTgt = 0x0103
+)
+
+type SelFlag uint32
+
+const (
+	SelFlag_Ge         SelFlag = 1 << 0
+	SelFlag_Le         SelFlag = 1 << 1
+	SelFlag_KeepConfig SelFlag = 1 << 2
+)
@@ -0,0 +1,445 @@
+package v4l2
+
+// v4l2-controls.h
+
+const (
+	CtrlClass_User           = 0x00980000
+	CtrlClass_Mpeg           = 0x00990000
+	CtrlClass_Jpeg           = 0x009d0000
+	CtrlClass_CodecStateless = 0x00a40000
+)
+
+const (
+	CidBase     = CtrlClass_User | 0x900
+	CidUserBase = CidBase
+
+	Cid_MinBuffersForCapture = CidBase + 39
+	Cid_MinBuffersForOutput  = CidBase + 40
+)
+
+// Codec controls, formerly known as MPEG controls.
+
+const (
+	CidCodecBase = CtrlClass_Mpeg | 0x900
+	CidMpegBase  = CidCodecBase
+
+	Cid_MpegVideoBFrames         = CidCodecBase + 202
+	Cid_MpegVideoGopSize         = CidCodecBase + 203
+	Cid_MpegVideoBitrateMode     = CidCodecBase + 206
+	Cid_MpegVideoBitrate         = CidCodecBase + 207
+	Cid_MpegVideoBitratePeak     = CidCodecBase + 208
+	Cid_MpegVideoHeaderMode      = CidCodecBase + 216
+	Cid_MpegVideoRepeatSeqHeader = CidCodecBase + 226
+	Cid_MpegVideoForceKeyFrame   = CidCodecBase + 229
+	Cid_MpegVideoH264MinQp       = CidCodecBase + 353
+	Cid_MpegVideoH264MaxQp       = CidCodecBase + 354
+	Cid_MpegVideoH264IPeriod     = CidCodecBase + 358
+	Cid_MpegVideoH264Level       = CidCodecBase + 359
+	Cid_MpegVideoH264Profile     = CidCodecBase + 363
+)
+
+type MpegVideoBitrateMode int32
+
+const (
+	MpegVideoBitrateMode_Vbr MpegVideoBitrateMode = 0
+	MpegVideoBitrateMode_Cbr MpegVideoBitrateMode = 1
+	MpegVideoBitrateMode_Cq  MpegVideoBitrateMode = 2
+)
+
+type MpegVideoHeaderMode int32
+
+const (
+	MpegVideoHeaderMode_Separate           MpegVideoHeaderMode = 0
+	MpegVideoHeaderMode_JoinedWith1stFrame MpegVideoHeaderMode = 1
+)
+
+// JPEG-class controls
+
+const (
+	CidJpegClassBase = CtrlClass_Jpeg | 0x900
+
+	Cid_JpegChromaSubsampling  = CidJpegClassBase + 1
+	Cid_JpegRestartInterval    = CidJpegClassBase + 2
+	Cid_JpegCompressionQuality = CidJpegClassBase + 3
+	Cid_JpegActiveMarker       = CidJpegClassBase + 4
+)
+
+// Stateless codec controls
+
+const (
+	CidCodecStatelessBase = CtrlClass_CodecStateless | 0x900
+
+	Cid_StatelessH264DecodeMode    = CidCodecStatelessBase + 0
+	Cid_StatelessH264StartCode     = CidCodecStatelessBase + 1
+	Cid_StatelessH264Sps           = CidCodecStatelessBase + 2
+	Cid_StatelessH264Pps           = CidCodecStatelessBase + 3
+	Cid_StatelessH264ScalingMatrix = CidCodecStatelessBase + 4
+	Cid_StatelessH264PredWeights   = CidCodecStatelessBase + 5
+	Cid_StatelessH264SliceParams   = CidCodecStatelessBase + 6
+	Cid_StatelessH264DecodeParams  = CidCodecStatelessBase + 7
+	Cid_StatelessVp8Frame          = CidCodecStatelessBase + 200
+	Cid_StatelessVp9Frame          = CidCodecStatelessBase + 300
+	Cid_StatelessVp9CompressedHdr  = CidCodecStatelessBase + 301
+)
+
+type StatelessH264DecodeMode int32
+
+const (
+	StatelessH264DecodeMode_SliceBased StatelessH264DecodeMode = 0
+	StatelessH264DecodeMode_FrameBased StatelessH264DecodeMode = 1
+)
+
+type StatelessH264StartCode int32
+
+const (
+	StatelessH264StartCode_None   StatelessH264StartCode = 0
+	StatelessH264StartCode_AnnexB StatelessH264StartCode = 1
+)
+
+const (
+	H264SpsConstraintSet0Flag = 0x01
+	H264SpsConstraintSet1Flag = 0x02
+	H264SpsConstraintSet2Flag = 0x04
+	H264SpsConstraintSet3Flag = 0x08
+	H264SpsConstraintSet4Flag = 0x10
+	H264SpsConstraintSet5Flag = 0x20
+)
+
+const (
+	H264SpsFlag_SeparateColourPlane         = 0x01
+	H264SpsFlag_QpprimeYZeroTransformBypass = 0x02
+	H264SpsFlag_DeltaPicOrderAlwaysZero     = 0x04
+	H264SpsFlag_GapsInFrameNumValueAllowed  = 0x08
+	H264SpsFlag_FrameMbsOnly                = 0x10
+	H264SpsFlag_MbAdaptiveFrameField        = 0x20
+	H264SpsFlag_Direct8x8Inference          = 0x40
+)
+
+type CtrlH264Sps struct {
+	ProfileIdc                     uint8
+	ConstraintSetFlags             uint8
+	LevelIdc                       uint8
+	SeqParameterSetId              uint8
+	ChromaFormatIdc                uint8
+	BitDepthLumaMinus8             uint8
+	BitDepthChromaMinus8           uint8
+	Log2MaxFrameNumMinus4          uint8
+	PicOrderCntType                uint8
+	Log2MaxPicOrderCntLsbMinus4    uint8
+	MaxNumRefFrames                uint8
+	NumRefFramesInPicOrderCntCycle uint8
+	OffsetForRefFrame              [255]int32
+	OffsetForNonRefPic             int32
+	OffsetForTopToBottomField      int32
+	PicWidthInMbsMinus1            uint16
+	PicHeightInMapUnitsMinus1      uint16
+	Flags                          uint32
+}
+
+const (
+	H264PpsFlag_EntropyCodingMode                 = 0x0001
+	H264PpsFlag_BottomFieldPicOrderInFramePresent = 0x0002
+	H264PpsFlag_WeightedPred                      = 0x0004
+	H264PpsFlag_DeblockingFilterControlPresent    = 0x0008
+	H264PpsFlag_ConstrainedIntraPred              = 0x0010
+	H264PpsFlag_RedundantPicCntPresent            = 0x0020
+	H264PpsFlag_Transform8x8Mode                  = 0x0040
+	H264PpsFlag_ScalingMatrixPresent              = 0x0080
+)
+
+type CtrlH264Pps struct {
+	PicParameterSetId              uint8
+	SeqParameterSetId              uint8
+	NumSliceGroupsMinus1           uint8
+	NumRefIdxL0DefaultActiveMinus1 uint8
+	NumRefIdxL1DefaultActiveMinus1 uint8
+	WeightedBipredIdc              uint8
+	PicInitQpMinus26               int8
+	PicInitQsMinus26               int8
+	ChromaQpIndexOffset            int8
+	SecondChromaQpIndexOffset      int8
+	Flags                          uint16
+}
+
+type CtrlH264ScalingMatrix struct {
+	ScalingList4x4 [6][16]uint8
+	ScalingList8x8 [6][64]uint8
+}
+
+type H264WeightFactors struct {
+	LumaWeight   [32]int16
+	LumaOffset   [32]int16
+	ChromaWeight [32][2]int16
+	ChromaOffset [32][2]int16
+}
+
+type CtrlH264PredWeights struct {
+	LumaLog2WeightDenom   uint16
+	ChromaLog2WeightDenom uint16
+	WeightFactors         [2]H264WeightFactors
+}
+
+const (
+	H264SliceType_P  = 0
+	H264SliceType_B  = 1
+	H264SliceType_I  = 2
+	H264SliceType_Sp = 3
+	H264SliceType_Si = 4
+)
+
+const (
+	H264SliceFlag_DirectSpatialMvPred = 0x01
+	H264SliceFlag_SpForSwitch         = 0x02
+)
+
+const (
+	H264TopFieldRef    = 0x1
+	H264BottomFieldRef = 0x2
+	H264FrameRef       = 0x3
+)
+
+type H264Reference struct {
+	Fields uint8
+	Index  uint8
+}
+
+const (
+	H264NumDpbEntries = 16
+	H264RefListLen    = 2 * H264NumDpbEntries
+)
+
+type CtrlH264SliceParams struct {
+	HeaderBitSize              uint32
+	FirstMbInSlice             uint32
+	SliceType                  uint8
+	ColourPlaneId              uint8
+	RedundantPicCnt            uint8
+	CabacInitIdc               uint8
+	SliceQpDelta               int8
+	SliceQsDelta               int8
+	DisableDeblockingFilterIdc uint8
+	SliceAlphaC0OffsetDiv2     int8
+	SliceBetaOffsetDiv2        int8
+	NumRefIdxL0ActiveMinus1    uint8
+	NumRefIdxL1ActiveMinus1    uint8
+	Reserved                   uint8
+	RefPicList0                [H264RefListLen]H264Reference
+	RefPicList1                [H264RefListLen]H264Reference
+	Flags                      uint32
+}
+
+const (
+	H264DpbEntryFlag_Valid    = 0x01
+	H264DpbEntryFlag_Active   = 0x02
+	H264DpbEntryFlag_LongTerm = 0x04
+	H264DpbEntryFlag_Field    = 0x08
+)
+
+type H264DpbEntry struct {
+	ReferenceTs         uint64 // timestamp of the CAPTURE buffer in nanoseconds
+	PicNum              uint32
+	FrameNum            uint16
+	Fields              uint8
+	Reserved            [5]uint8
+	TopFieldOrderCnt    int32
+	BottomFieldOrderCnt int32
+	Flags               uint32
+}
+
+const (
+	H264DecodeParamFlag_IdrPic      = 0x01
+	H264DecodeParamFlag_FieldPic    = 0x02
+	H264DecodeParamFlag_BottomField = 0x04
+	H264DecodeParamFlag_Pframe      = 0x08
+	H264DecodeParamFlag_Bframe      = 0x10
+)
+
+type CtrlH264DecodeParams struct {
+	Dpb                     [H264NumDpbEntries]H264DpbEntry
+	NalRefIdc               uint16
+	FrameNum                uint16
+	TopFieldOrderCnt        int32
+	BottomFieldOrderCnt     int32
+	IdrPicId                uint16
+	PicOrderCntLsb          uint16
+	DeltaPicOrderCntBottom  int32
+	DeltaPicOrderCnt0       int32
+	DeltaPicOrderCnt1       int32
+	DecRefPicMarkingBitSize uint32
+	PicOrderCntBitSize      uint32
+	SliceGroupChangeCycle   uint32
+	Reserved                uint32
+	Flags                   uint32
+}
+
+const (
+	Vp8SegmentFlag_Enabled           = 0x01
+	Vp8SegmentFlag_UpdateMap         = 0x02
+	Vp8SegmentFlag_UpdateFeatureData = 0x04
+	Vp8SegmentFlag_DeltaValueMode    = 0x08
+)
+
+type Vp8Segment struct {
+	QuantUpdate  [4]int8
+	LfUpdate     [4]int8
+	SegmentProbs [3]uint8
+	Padding      uint8
+	Flags        uint32
+}
+
+const (
+	Vp8LfFlag_AdjEnable        = 0x01
+	Vp8LfFlag_DeltaUpdate      = 0x02
+	Vp8LfFlag_FilterTypeSimple = 0x04
+)
+
+type Vp8LoopFilter struct {
+	RefFrmDelta    [4]int8
+	MbModeDelta    [4]int8
+	SharpnessLevel uint8
+	Level          uint8
+	Padding        uint16
+	Flags          uint32
+}
+
+type Vp8Quantization struct {
+	YAcQi     uint8
+	YDcDelta  int8
+	Y2DcDelta int8
+	Y2AcDelta int8
+	UvDcDelta int8
+	UvAcDelta int8
+	Padding   uint16
+}
+
+const (
+	Vp8CoeffProbCount = 11
+	Vp8MvProbCount    = 19
+)
+
+type Vp8Entropy struct {
+	CoeffProbs  [4][8][3][Vp8CoeffProbCount]uint8
+	YModeProbs  [4]uint8
+	UvModeProbs [3]uint8
+	MvProbs     [2][Vp8MvProbCount]uint8
+	Padding     [3]uint8
+}
+
+type Vp8EntropyCoderState struct {
+	Range    uint8
+	Value    uint8
+	BitCount uint8
+	Padding  uint8
+}
+
+const (
+	Vp8FrameFlag_KeyFrame       = 0x01
+	Vp8FrameFlag_Experimental   = 0x02
+	Vp8FrameFlag_ShowFrame      = 0x04
+	Vp8FrameFlag_MbNoSkipCoeff  = 0x08
+	Vp8FrameFlag_SignBiasGolden = 0x10
+	Vp8FrameFlag_SignBiasAlt    = 0x20
+)
+
+type CtrlVp8Frame struct {
+	Segment             Vp8Segment
+	Lf                  Vp8LoopFilter
+	Quant               Vp8Quantization
+	Entropy             Vp8Entropy
+	CoderState          Vp8EntropyCoderState
+	Width               uint16
+	Height              uint16
+	HorizontalScale     uint8
+	VerticalScale       uint8
+	Version             uint8
+	ProbSkipFalse       uint8
+	ProbIntra           uint8
+	ProbLast            uint8
+	ProbGf              uint8
+	NumDctParts         uint8
+	FirstPartSize       uint32
+	FirstPartHeaderBits uint32
+	DctPartSizes        [8]uint32
+	LastFrameTs         uint64
+	GoldenFrameTs       uint64
+	AltFrameTs          uint64
+	Flags               uint64
+}
+
+const (
+	Vp9LoopFilterFlag_DeltaEnabled = 0x1
+	Vp9LoopFilterFlag_DeltaUpdate  = 0x2
+)
+
+type Vp9LoopFilter struct {
+	RefDeltas  [4]int8
+	ModeDeltas [2]int8
+	Level      uint8
+	Sharpness  uint8
+	Flags      uint8
+	Reserved   [7]uint8
+}
+
+type Vp9Quantization struct {
+	BaseQIdx   uint8
+	DeltaQYDc  int8
+	DeltaQUvDc int8
+	DeltaQUvAc int8
+	Reserved   [4]uint8
+}
+
+const (
+	Vp9SegmentationFlag_Enabled          = 0x01
+	Vp9SegmentationFlag_UpdateMap        = 0x02
+	Vp9SegmentationFlag_TemporalUpdate   = 0x04
+	Vp9SegmentationFlag_UpdateData       = 0x08
+	Vp9SegmentationFlag_AbsOrDeltaUpdate = 0x10
+)
+
+type Vp9Segmentation struct {
+	FeatureData    [8][4]int16
+	FeatureEnabled [8]uint8
+	TreeProbs      [7]uint8
+	PredProbs      [3]uint8
+	Flags          uint8
+	Reserved       [5]uint8
+}
+
+const (
+	Vp9FrameFlag_KeyFrame            = 0x001
+	Vp9FrameFlag_ShowFrame           = 0x002
+	Vp9FrameFlag_ErrorResilient      = 0x004
+	Vp9FrameFlag_IntraOnly           = 0x008
+	Vp9FrameFlag_AllowHighPrecMv     = 0x010
+	Vp9FrameFlag_RefreshFrameCtx     = 0x020
+	Vp9FrameFlag_ParallelDecMode     = 0x040
+	Vp9FrameFlag_XSubsampling        = 0x080
+	Vp9FrameFlag_YSubsampling        = 0x100
+	Vp9FrameFlag_ColorRangeFullSwing = 0x200
+)
+
+type CtrlVp9Frame struct {
+	Lf                     Vp9LoopFilter
+	Quant                  Vp9Quantization
+	Seg                    Vp9Segmentation
+	Flags                  uint32
+	CompressedHeaderSize   uint16
+	UncompressedHeaderSize uint16
+	FrameWidthMinus1       uint16
+	FrameHeightMinus1      uint16
+	RenderWidthMinus1      uint16
+	RenderHeightMinus1     uint16
+	LastFrameTs            uint64
+	GoldenFrameTs          uint64
+	AltFrameTs             uint64
+	RefFrameSignBias       uint8
+	ResetFrameContext      uint8
+	FrameContextIdx        uint8
+	Profile                uint8
+	BitDepth               uint8
+	InterpolationFilter    uint8
+	TileColsLog2           uint8
+	TileRowsLog2           uint8
+	ReferenceMode          uint8
+	Reserved               [7]uint8
+}
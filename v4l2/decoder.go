@@ -0,0 +1,451 @@
+package v4l2
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrNotM2M       = errors.New("v4l2: not a memory-to-memory device")
+	ErrNeedInput    = errors.New("v4l2: codec needs more input")
+	ErrBufferTooBig = errors.New("v4l2: data does not fit into buffer")
+)
+
+// DecoderConfig describes the coded stream fed to a Decoder.
+type DecoderConfig struct {
+	CodedFormat   PixFmt
+	Width         uint32 // optional, the decoder parses it from the stream
+	Height        uint32
+	BufferSize    uint32 // size of OUTPUT buffers, 0 for the driver default
+	OutputBuffers uint32 // 0 for 4
+
+	// Raw format of decoded frames, 0 for the driver's choice.
+	CaptureFormat PixFmt
+	// Buffers allocated on top of Cid_MinBuffersForCapture, 0 for 2.
+	ExtraCaptureBuffers uint32
+}
+
+// DecodedFrame is a frame copied out of a CAPTURE buffer.
+type DecodedFrame struct {
+	Format    Format
+	Visible   Rect
+	Planes    [][]byte
+	Timestamp time.Duration // copied from the OUTPUT buffer
+	Sequence  uint32
+	Flags     BufFlag
+}
+
+// Decoder drives a stateful memory-to-memory video decoder, following the
+// kernel's "Memory-to-Memory Stateful Video Decoder Interface".
+type Decoder struct {
+	dev     *Device
+	config  DecoderConfig
+	output  *Queue
+	capture *Queue
+	outType BufType
+	capType BufType
+	capFmt  Format
+	visible Rect
+
+	free   []*QueueBuffer // OUTPUT buffers owned by us
+	ready  []*DecodedFrame
+	change bool // source change pending
+	last   bool // LAST buffer dequeued
+	drain  bool
+	eos    bool
+}
+
+// NewDecoder sets up the OUTPUT queue of dev. The CAPTURE queue is set up
+// once the decoder has parsed the stream headers.
+func NewDecoder(dev *Device, config DecoderConfig) (*Decoder, error) {
+	mplane, err := m2mMultiplanar(dev)
+	if err != nil {
+		return nil, err
+	}
+	if config.OutputBuffers == 0 {
+		config.OutputBuffers = 4
+	}
+	if config.ExtraCaptureBuffers == 0 {
+		config.ExtraCaptureBuffers = 2
+	}
+	d := &Decoder{
+		dev:     dev,
+		config:  config,
+		outType: BufType_VideoOutput,
+		capType: BufType_VideoCapture,
+	}
+	if mplane {
+		d.outType = BufType_VideoOutputMplane
+		d.capType = BufType_VideoCaptureMplane
+	}
+	if err := dev.SetNonblock(true); err != nil {
+		return nil, err
+	}
+
+	format := Format{Type: d.outType}
+	if mplane {
+		pix := format.PixMp()
+		pix.PixelFormat = uint32(config.CodedFormat)
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.NumPlanes = 1
+		pix.PlaneFmt[0].SizeImage = config.BufferSize
+	} else {
+		pix := format.Pix()
+		pix.PixelFormat = config.CodedFormat
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.SizeImage = config.BufferSize
+	}
+	if err := dev.SetFormat(&format); err != nil {
+		return nil, err
+	}
+	if err := dev.SubscribeEvent(Event_SourceChange, 0, 0); err != nil {
+		return nil, err
+	}
+	if err := dev.SubscribeEvent(Event_Eos, 0, 0); err != nil {
+		return nil, err
+	}
+
+	if d.output, err = dev.RequestQueue(d.outType, Memory_Mmap, config.OutputBuffers); err != nil {
+		return nil, err
+	}
+	d.free = append(d.free, d.output.Buffers...)
+	if err := d.output.StreamOn(); err != nil {
+		d.output.Release()
+		return nil, err
+	}
+	return d, nil
+}
+
+func m2mMultiplanar(dev *Device) (bool, error) {
+	capability, err := dev.QueryCap()
+	if err != nil {
+		return false, err
+	}
+	caps := capability.Capabilities
+	if caps&Cap_DeviceCaps != 0 {
+		caps = Cap(capability.DeviceCaps)
+	}
+	switch {
+	case caps&Cap_VideoM2MMplane != 0:
+		return true, nil
+	case caps&Cap_VideoM2M != 0:
+		return false, nil
+	default:
+		return false, ErrNotM2M
+	}
+}
+
+// Decode queues a chunk of the coded stream, waiting for a free OUTPUT
+// buffer if necessary. Frames decoded in the meantime are kept for
+// ReadFrame. Decoding resumes after a drain.
+func (d *Decoder) Decode(data []byte, timestamp time.Duration) error {
+	if d.drain {
+		if err := d.dev.DecoderCommand(DecCmd_Start, 0); err != nil {
+			return err
+		}
+		d.drain = false
+		d.eos = false
+		if err := d.requeueCapture(); err != nil {
+			return err
+		}
+	}
+	for len(d.free) == 0 {
+		if err := d.process(-1); err != nil {
+			return err
+		}
+	}
+	b := d.free[0]
+	if len(data) > len(b.Mem[0]) {
+		return ErrBufferTooBig
+	}
+	d.free = d.free[1:]
+	copy(b.Mem[0], data)
+	b.SetBytesUsed(uint32(len(data)))
+	b.Flags = BufFlag_TimestampCopy
+	b.Timestamp = NewTimeval(timestamp)
+	return d.output.Enqueue(b)
+}
+
+// ReadFrame returns the next decoded frame. It returns nil when no frame
+// becomes ready within timeout, and io.EOF once a drain has completed.
+func (d *Decoder) ReadFrame(timeout time.Duration) (*DecodedFrame, error) {
+	deadline := time.Now().Add(timeout)
+	for len(d.ready) == 0 {
+		if d.eos {
+			return nil, io.EOF
+		}
+		wait := time.Until(deadline)
+		if timeout < 0 {
+			wait = -1
+		} else if wait < 0 {
+			wait = 0
+		}
+		if err := d.process(wait); err != nil {
+			return nil, err
+		}
+		if timeout >= 0 && len(d.ready) == 0 && !time.Now().Before(deadline) {
+			return nil, nil
+		}
+	}
+	frame := d.ready[0]
+	d.ready = d.ready[1:]
+	return frame, nil
+}
+
+// Drain asks the decoder to decode all queued data. ReadFrame returns the
+// remaining frames followed by io.EOF.
+func (d *Decoder) Drain() error {
+	if d.capture == nil {
+		// Headers were never parsed, nothing will be decoded.
+		d.drain = true
+		d.eos = true
+		return nil
+	}
+	if err := d.dev.DecoderCommand(DecCmd_Stop, 0); err != nil {
+		return err
+	}
+	d.drain = true
+	return nil
+}
+
+// Seek drops all queued coded data and decoded frames. The data decoded
+// next must start at a point the decoder can resume from, such as a
+// keyframe preceded by its parameter sets.
+func (d *Decoder) Seek() error {
+	if err := d.output.StreamOff(); err != nil {
+		return err
+	}
+	d.free = append(d.free[:0], d.output.Buffers...)
+	if err := d.output.StreamOn(); err != nil {
+		return err
+	}
+	d.ready = nil
+	d.drain = false
+	d.eos = false
+	d.last = false
+	if d.capture == nil {
+		return nil
+	}
+	if err := d.capture.StreamOff(); err != nil {
+		return err
+	}
+	if d.change {
+		// The LAST buffer of the old resolution will not come after
+		// STREAMOFF: switch to the new one now.
+		d.change = false
+		return d.setupCapture()
+	}
+	return d.startCapture()
+}
+
+// Format returns the format of decoded frames and the visible rectangle
+// within them. It is only valid once the first frame has been decoded.
+func (d *Decoder) Format() (Format, Rect) {
+	return d.capFmt, d.visible
+}
+
+func (d *Decoder) Close() error {
+	if d.capture != nil {
+		d.capture.Release()
+	}
+	return d.output.Release()
+}
+
+func (d *Decoder) process(timeout time.Duration) error {
+	events := int16(PollPri | PollOut)
+	if d.capture != nil {
+		events |= PollIn
+	}
+	revents, err := d.dev.Poll(events, timeout)
+	if err != nil {
+		return err
+	}
+	if revents&(PollPri|PollOut|PollIn) == 0 && revents&PollErr != 0 {
+		// Nothing is queued anywhere.
+		return ErrNeedInput
+	}
+
+	if revents&PollPri != 0 {
+		if err := d.dequeueEvents(); err != nil {
+			return err
+		}
+	}
+	if err := d.dequeueOutput(); err != nil {
+		return err
+	}
+	if d.capture != nil {
+		if err := d.dequeueCapture(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case d.change && (d.capture == nil || d.last):
+		d.change = false
+		d.last = false
+		return d.setupCapture()
+	case d.last && d.drain:
+		d.last = false
+		d.eos = true
+	}
+	return nil
+}
+
+func (d *Decoder) dequeueEvents() error {
+	for {
+		event, err := d.dev.DequeueEvent()
+		if err == syscall.ENOENT {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event.Type == Event_SourceChange && event.SrcChange().Changes&EventSrcChResolution != 0 {
+			d.change = true
+		}
+	}
+}
+
+func (d *Decoder) dequeueOutput() error {
+	for {
+		b, err := d.output.Dequeue()
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d.free = append(d.free, b)
+	}
+}
+
+func (d *Decoder) dequeueCapture() error {
+	for !d.last {
+		b, err := d.capture.Dequeue()
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err == syscall.EPIPE {
+			d.last = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b.Flags&BufFlag_Last != 0 {
+			d.last = true
+		}
+		if b.Flags&BufFlag_Error == 0 && payloadSize(b) > 0 {
+			d.ready = append(d.ready, d.copyFrame(b))
+		}
+		if d.last {
+			return nil
+		}
+		if err := d.capture.Enqueue(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func payloadSize(b *QueueBuffer) uint32 {
+	if b.Planes == nil {
+		return b.BytesUsed
+	}
+	var size uint32
+	for _, p := range b.Planes {
+		size += p.BytesUsed
+	}
+	return size
+}
+
+func (d *Decoder) copyFrame(b *QueueBuffer) *DecodedFrame {
+	frame := &DecodedFrame{
+		Format:    d.capFmt,
+		Visible:   d.visible,
+		Timestamp: b.Timestamp.Duration(),
+		Sequence:  b.Sequence,
+		Flags:     b.Flags,
+	}
+	for _, data := range b.Data() {
+		frame.Planes = append(frame.Planes, append([]byte(nil), data...))
+	}
+	return frame
+}
+
+// setupCapture (re)allocates the CAPTURE queue for the format the decoder
+// found in the stream.
+func (d *Decoder) setupCapture() error {
+	if d.capture != nil {
+		if err := d.capture.Release(); err != nil {
+			return err
+		}
+		d.capture = nil
+	}
+	format, err := d.dev.GetFormat(d.capType)
+	if err != nil {
+		return err
+	}
+	if d.config.CaptureFormat != 0 {
+		if d.capType.IsMultiplanar() {
+			format.PixMp().PixelFormat = uint32(d.config.CaptureFormat)
+		} else {
+			format.Pix().PixelFormat = d.config.CaptureFormat
+		}
+		if err := d.dev.SetFormat(&format); err != nil {
+			return err
+		}
+	}
+	d.capFmt = format
+
+	d.visible, err = d.dev.GetSelection(d.capType, SelTgt_Compose)
+	if err != nil {
+		d.visible = Rect{Width: format.Pix().Width, Height: format.Pix().Height}
+	}
+
+	count := uint32(d.config.ExtraCaptureBuffers)
+	if minimum, err := d.dev.GetControl(Cid_MinBuffersForCapture); err == nil {
+		count += uint32(minimum)
+	} else {
+		count += 2
+	}
+	if d.capture, err = d.dev.RequestQueue(d.capType, Memory_Mmap, count); err != nil {
+		return err
+	}
+	return d.startCapture()
+}
+
+// requeueCapture gives the buffers held back after a LAST buffer to the
+// driver again.
+func (d *Decoder) requeueCapture() error {
+	if d.capture == nil {
+		return nil
+	}
+	for _, b := range d.capture.Buffers {
+		if b.Queued {
+			continue
+		}
+		if err := d.capture.Enqueue(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) startCapture() error {
+	for _, b := range d.capture.Buffers {
+		if b.Planes != nil {
+			for i := range b.Planes {
+				b.Planes[i].BytesUsed = 0
+			}
+		}
+		if err := d.capture.Enqueue(b); err != nil {
+			return err
+		}
+	}
+	return d.capture.StreamOn()
+}
@@ -0,0 +1,427 @@
+package v4l2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+const (
+	fakeBufferSize  = 4096
+	fakeCaptureBase = 64 * fakeBufferSize // memory offset of the CAPTURE buffers
+)
+
+// fakeDriver stands in for the driver of a device in tests.
+type fakeDriver interface {
+	ioctl(request uintptr, arg unsafe.Pointer) error
+	poll(events int16) int16
+}
+
+// fakeM2M holds the queues of a fake memory-to-memory driver. The mapped
+// buffers are backed by a file, OUTPUT buffers first.
+type fakeM2M struct {
+	t    *testing.T
+	file *os.File
+
+	formats   map[BufType]Format
+	buffers   map[BufType][]Buffer
+	queued    map[BufType][]uint32 // indices, in queuing order
+	done      map[BufType][]uint32
+	streaming map[BufType]bool
+	events    []Event
+
+	stalled  bool // LAST buffer returned, CAPTURE must be restarted
+	sequence uint32
+}
+
+// newFakeDevice returns a device whose ioctl and poll calls go to the
+// driver returned by newDriver.
+func newFakeDevice(t *testing.T, newDriver func(m *fakeM2M) fakeDriver) *Device {
+	f, err := os.Create(filepath.Join(t.TempDir(), "video0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(2 * fakeCaptureBase); err != nil {
+		t.Fatal(err)
+	}
+	driver := newDriver(&fakeM2M{
+		t:         t,
+		file:      f,
+		formats:   make(map[BufType]Format),
+		buffers:   make(map[BufType][]Buffer),
+		queued:    make(map[BufType][]uint32),
+		done:      make(map[BufType][]uint32),
+		streaming: make(map[BufType]bool),
+	})
+	dev := &Device{file: f, fd: f.Fd()}
+	sysIoctl, sysPoll := ioctl, poll
+	ioctl = func(fd, request uintptr, arg unsafe.Pointer) error {
+		if fd != dev.fd {
+			return sysIoctl(fd, request, arg)
+		}
+		return driver.ioctl(request, arg)
+	}
+	poll = func(fd uintptr, events int16, timeout time.Duration) (int16, error) {
+		if fd != dev.fd {
+			return sysPoll(fd, events, timeout)
+		}
+		return driver.poll(events), nil
+	}
+	t.Cleanup(func() {
+		ioctl, poll = sysIoctl, sysPoll
+		f.Close()
+	})
+	return dev
+}
+
+// ioctl handles the requests common to decoders and encoders.
+func (f *fakeM2M) ioctl(request uintptr, arg unsafe.Pointer) error {
+	switch request {
+	case Vidioc_QueryCap:
+		(*Capability)(arg).Capabilities = Cap_VideoM2M | Cap_Streaming
+	case Vidioc_SubscribeEvent:
+	case Vidioc_DQEvent:
+		if len(f.events) == 0 {
+			return syscall.ENOENT
+		}
+		*(*Event)(arg) = f.events[0]
+		f.events = f.events[1:]
+	case Vidioc_Reqbufs:
+		req := (*RequestBuffers)(arg)
+		if f.streaming[req.Type] {
+			return syscall.EBUSY
+		}
+		f.buffers[req.Type] = nil
+		base := uint32(0)
+		if req.Type == BufType_VideoCapture {
+			base = fakeCaptureBase
+		}
+		for i := uint32(0); i < req.Count; i++ {
+			b := Buffer{Index: i, Type: req.Type, Length: fakeBufferSize}
+			*(*uint32)(unsafe.Pointer(&b.OffsetOrUserptrOrPlanesOrFd)) = base + i*fakeBufferSize
+			f.buffers[req.Type] = append(f.buffers[req.Type], b)
+		}
+	case Vidioc_Querybuf:
+		buf := (*Buffer)(arg)
+		*buf = f.buffers[buf.Type][buf.Index]
+	case Vidioc_Qbuf:
+		buf := (*Buffer)(arg)
+		b := &f.buffers[buf.Type][buf.Index]
+		b.BytesUsed, b.Timestamp, b.Flags = buf.BytesUsed, buf.Timestamp, 0
+		f.queued[buf.Type] = append(f.queued[buf.Type], buf.Index)
+	case Vidioc_Dqbuf:
+		buf := (*Buffer)(arg)
+		done := f.done[buf.Type]
+		if len(done) == 0 {
+			if buf.Type == BufType_VideoCapture && f.stalled {
+				return syscall.EPIPE
+			}
+			return syscall.EAGAIN
+		}
+		*buf = f.buffers[buf.Type][done[0]]
+		f.done[buf.Type] = done[1:]
+	case Vidioc_StreamOn, Vidioc_StreamOff:
+		t := BufType(*(*int32)(arg))
+		f.streaming[t] = request == Vidioc_StreamOn
+		if request == Vidioc_StreamOff {
+			f.queued[t], f.done[t] = nil, nil
+			if t == BufType_VideoCapture {
+				f.stalled = false
+			}
+		}
+	default:
+		return syscall.ENOTTY
+	}
+	return nil
+}
+
+// revents returns the poll events signalled by the queues.
+func (f *fakeM2M) revents(events int16) int16 {
+	var revents int16
+	if len(f.events) > 0 {
+		revents |= PollPri
+	}
+	if len(f.done[BufType_VideoOutput]) > 0 {
+		revents |= PollOut
+	}
+	if len(f.done[BufType_VideoCapture]) > 0 || f.stalled {
+		revents |= PollIn
+	}
+	if revents == 0 && len(f.queued[BufType_VideoOutput]) == 0 {
+		revents |= PollErr
+	}
+	return revents & (events | PollErr)
+}
+
+// canCapture returns whether a CAPTURE buffer is ready to be filled.
+func (f *fakeM2M) canCapture() bool {
+	return f.streaming[BufType_VideoCapture] && len(f.queued[BufType_VideoCapture]) > 0
+}
+
+// takeCapture moves the first queued CAPTURE buffer to the done ones.
+func (f *fakeM2M) takeCapture() *Buffer {
+	index := f.queued[BufType_VideoCapture][0]
+	f.queued[BufType_VideoCapture] = f.queued[BufType_VideoCapture][1:]
+	f.done[BufType_VideoCapture] = append(f.done[BufType_VideoCapture], index)
+	return &f.buffers[BufType_VideoCapture][index]
+}
+
+// takeOutput moves the first queued OUTPUT buffer to the done ones and
+// returns its data.
+func (f *fakeM2M) takeOutput() (*Buffer, []byte) {
+	index := f.queued[BufType_VideoOutput][0]
+	f.queued[BufType_VideoOutput] = f.queued[BufType_VideoOutput][1:]
+	f.done[BufType_VideoOutput] = append(f.done[BufType_VideoOutput], index)
+	out := &f.buffers[BufType_VideoOutput][index]
+	return out, f.read(out)
+}
+
+func (f *fakeM2M) read(b *Buffer) []byte {
+	data := make([]byte, b.BytesUsed)
+	if _, err := f.file.ReadAt(data, int64(b.Offset())); err != nil {
+		f.t.Fatal(err)
+	}
+	return data
+}
+
+// fill writes the data of a CAPTURE buffer produced from out.
+func (f *fakeM2M) fill(b, out *Buffer, data []byte) {
+	if _, err := f.file.WriteAt(data, int64(b.Offset())); err != nil {
+		f.t.Fatal(err)
+	}
+	b.BytesUsed, b.Timestamp, b.Sequence = uint32(len(data)), out.Timestamp, f.sequence
+	f.sequence++
+}
+
+// fakeDecoder is a stateful decoder driver. Every chunk of coded data is a
+// frame, except "SIZE wxh" that changes the resolution. It advances by
+// one step every time it is polled, so tests can stop between the steps
+// of a resolution change or a drain.
+type fakeDecoder struct {
+	*fakeM2M
+	width, height uint32
+	draining      bool
+	lastDue       bool // LAST buffer to be returned
+}
+
+func newFakeDecoder(t *testing.T) (*fakeDecoder, *Device) {
+	var fake *fakeDecoder
+	dev := newFakeDevice(t, func(m *fakeM2M) fakeDriver {
+		fake = &fakeDecoder{fakeM2M: m}
+		return fake
+	})
+	return fake, dev
+}
+
+func (f *fakeDecoder) ioctl(request uintptr, arg unsafe.Pointer) error {
+	switch request {
+	case Vidioc_SFmt:
+		format := (*Format)(arg)
+		if format.Type == BufType_VideoCapture {
+			// The decoder picks the size.
+			format.Pix().Width, format.Pix().Height = f.width, f.height
+		}
+		format.Pix().SizeImage = fakeBufferSize
+		f.formats[format.Type] = *format
+	case Vidioc_GFmt:
+		format := (*Format)(arg)
+		t := format.Type
+		*format = f.formats[t]
+		format.Type = t
+		if t == BufType_VideoCapture {
+			format.Pix().Width, format.Pix().Height = f.width, f.height
+			format.Pix().SizeImage = fakeBufferSize
+		}
+	case Vidioc_GCtrl:
+		control := (*Control)(arg)
+		if control.Id != Cid_MinBuffersForCapture {
+			return syscall.EINVAL
+		}
+		control.Value = 2
+	case Vidioc_StreamOff:
+		if BufType(*(*int32)(arg)) == BufType_VideoCapture {
+			f.lastDue = false
+		}
+		return f.fakeM2M.ioctl(request, arg)
+	case Vidioc_DecoderCmd:
+		switch DecCmd((*DecoderCmd)(arg).Cmd) {
+		case DecCmd_Stop:
+			f.draining = true
+		case DecCmd_Start:
+			f.draining, f.stalled = false, false
+		}
+	default:
+		return f.fakeM2M.ioctl(request, arg)
+	}
+	return nil
+}
+
+// poll runs a step of the decoder and returns the events it signals.
+func (f *fakeDecoder) poll(events int16) int16 {
+	f.step()
+	return f.revents(events)
+}
+
+func (f *fakeDecoder) step() {
+	if f.lastDue {
+		if f.canCapture() {
+			b := f.takeCapture()
+			b.Flags, b.BytesUsed = BufFlag_Last, 0
+			f.lastDue, f.stalled = false, true
+			if f.draining {
+				f.events = append(f.events, Event{Type: Event_Eos})
+			}
+		}
+		return
+	}
+	if f.stalled || !f.streaming[BufType_VideoOutput] {
+		return
+	}
+	queued := f.queued[BufType_VideoOutput]
+	if len(queued) == 0 {
+		if f.draining && f.streaming[BufType_VideoCapture] {
+			f.lastDue = true
+			f.step()
+		}
+		return
+	}
+	data := f.read(&f.buffers[BufType_VideoOutput][queued[0]])
+	var width, height uint32
+	if _, err := fmt.Sscanf(string(data), "SIZE %dx%d", &width, &height); err == nil {
+		f.width, f.height = width, height
+		event := Event{Type: Event_SourceChange}
+		event.SrcChange().Changes = EventSrcChResolution
+		f.events = append(f.events, event)
+		f.lastDue = f.streaming[BufType_VideoCapture]
+		f.takeOutput()
+		return
+	}
+	if !f.canCapture() {
+		return
+	}
+	out, data := f.takeOutput()
+	f.fill(f.takeCapture(), out, data)
+}
+
+// frameTime returns the timestamp of the n-th frame at 25 fps, timestamps
+// only keep microseconds.
+func frameTime(n int) time.Duration {
+	return time.Duration(n) * 40 * time.Millisecond
+}
+
+func decode(t *testing.T, d *Decoder, data string, n int) {
+	t.Helper()
+	if err := d.Decode([]byte(data), frameTime(n)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads a frame, checking its contents and size.
+func readFrame(t *testing.T, d *Decoder, want string, n int, width, height uint32) {
+	t.Helper()
+	frame, err := d.ReadFrame(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame == nil {
+		t.Fatalf("no frame, want %q", want)
+	}
+	if !bytes.Equal(frame.Planes[0], []byte(want)) || frame.Timestamp != frameTime(n) {
+		t.Errorf("frame %q at %v, want %q at %v", frame.Planes[0], frame.Timestamp, want, frameTime(n))
+	}
+	pix := frame.Format.Pix()
+	if pix.Width != width || pix.Height != height || frame.Visible.Width != width {
+		t.Errorf("frame %q is %dx%d, visible %v, want %dx%d", want, pix.Width, pix.Height, frame.Visible, width, height)
+	}
+}
+
+func readEOF(t *testing.T, d *Decoder) {
+	t.Helper()
+	frame, err := d.ReadFrame(time.Second)
+	if err != io.EOF {
+		t.Fatalf("got %v, %v, want io.EOF", frame, err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	_, dev := newFakeDecoder(t)
+	d, err := NewDecoder(dev, DecoderConfig{CodedFormat: PixFmt_H264})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// The CAPTURE queue is set up once the headers are parsed.
+	decode(t, d, "SIZE 320x240", 0)
+	decode(t, d, "frame 1", 1)
+	decode(t, d, "frame 2", 2)
+	readFrame(t, d, "frame 1", 1, 320, 240)
+	readFrame(t, d, "frame 2", 2, 320, 240)
+	if len(d.capture.Buffers) != 4 {
+		t.Errorf("%d CAPTURE buffers, want 4", len(d.capture.Buffers))
+	}
+
+	// Resolution change: the CAPTURE queue is reallocated after the LAST
+	// buffer.
+	decode(t, d, "frame 3", 3)
+	decode(t, d, "SIZE 640x480", 4)
+	decode(t, d, "frame 4", 4)
+	readFrame(t, d, "frame 3", 3, 320, 240)
+	readFrame(t, d, "frame 4", 4, 640, 480)
+
+	// Drain, then resume.
+	decode(t, d, "frame 5", 5)
+	if err := d.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	readFrame(t, d, "frame 5", 5, 640, 480)
+	readEOF(t, d)
+	readEOF(t, d)
+	decode(t, d, "frame 6", 6)
+	readFrame(t, d, "frame 6", 6, 640, 480)
+}
+
+func TestDecoderSeek(t *testing.T) {
+	_, dev := newFakeDecoder(t)
+	d, err := NewDecoder(dev, DecoderConfig{CodedFormat: PixFmt_H264})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	decode(t, d, "SIZE 320x240", 0)
+	decode(t, d, "frame 1", 1)
+	decode(t, d, "frame 2", 2)
+	readFrame(t, d, "frame 1", 1, 320, 240)
+	// Frame 2 is dropped by the seek.
+	if err := d.Seek(); err != nil {
+		t.Fatal(err)
+	}
+	decode(t, d, "frame 10", 10)
+	readFrame(t, d, "frame 10", 10, 320, 240)
+
+	// Seek while a resolution change is pending: the source change event
+	// has been seen, its LAST buffer has not.
+	decode(t, d, "SIZE 640x480", 11)
+	if frame, err := d.ReadFrame(0); frame != nil || err != nil {
+		t.Fatalf("got %v, %v before the LAST buffer", frame, err)
+	}
+	if !d.change {
+		t.Fatal("source change not seen")
+	}
+	if err := d.Seek(); err != nil {
+		t.Fatal(err)
+	}
+	decode(t, d, "frame 20", 20)
+	readFrame(t, d, "frame 20", 20, 640, 480)
+	if err := d.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	readEOF(t, d)
+}
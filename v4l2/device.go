@@ -0,0 +1,204 @@
+package v4l2
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Device is an open video4linux device node.
+type Device struct {
+	file *os.File
+	fd   uintptr
+}
+
+func Open(path string) (*Device, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{file: f, fd: f.Fd()}, nil
+}
+
+func (d *Device) Close() error {
+	return d.file.Close()
+}
+
+func (d *Device) Fd() uintptr {
+	return d.fd
+}
+
+func (d *Device) Read(p []byte) (int, error) {
+	return d.file.Read(p)
+}
+
+func (d *Device) Write(p []byte) (int, error) {
+	return d.file.Write(p)
+}
+
+func (d *Device) Ioctl(request Vidioc, arg unsafe.Pointer) error {
+	return ioctl(d.fd, request, arg)
+}
+
+func (d *Device) QueryCap() (Capability, error) {
+	capability := Capability{}
+	err := d.Ioctl(Vidioc_QueryCap, unsafe.Pointer(&capability))
+	return capability, err
+}
+
+func (d *Device) GetFormat(t BufType) (Format, error) {
+	format := Format{Type: t}
+	err := d.Ioctl(Vidioc_GFmt, unsafe.Pointer(&format))
+	return format, err
+}
+
+func (d *Device) SetFormat(format *Format) error {
+	return d.Ioctl(Vidioc_SFmt, unsafe.Pointer(format))
+}
+
+func (d *Device) TryFormat(format *Format) error {
+	return d.Ioctl(Vidioc_TryFmt, unsafe.Pointer(format))
+}
+
+func (d *Device) SetNonblock(nonblocking bool) error {
+	return syscall.SetNonblock(int(d.fd), nonblocking)
+}
+
+func (d *Device) StreamOn(t BufType) error {
+	arg := int32(t)
+	return d.Ioctl(Vidioc_StreamOn, unsafe.Pointer(&arg))
+}
+
+func (d *Device) StreamOff(t BufType) error {
+	arg := int32(t)
+	return d.Ioctl(Vidioc_StreamOff, unsafe.Pointer(&arg))
+}
+
+func (d *Device) GetControl(id uint32) (int32, error) {
+	control := Control{Id: id}
+	err := d.Ioctl(Vidioc_GCtrl, unsafe.Pointer(&control))
+	return int32(control.Value), err
+}
+
+func (d *Device) SetControl(id uint32, value int32) error {
+	control := Control{Id: id, Value: uint32(value)}
+	return d.Ioctl(Vidioc_SCtrl, unsafe.Pointer(&control))
+}
+
+func (d *Device) GetSelection(t BufType, target SelTgt) (Rect, error) {
+	selection := Selection{Type: uint32(t), Target: uint32(target)}
+	err := d.Ioctl(Vidioc_GSelection, unsafe.Pointer(&selection))
+	return selection.R, err
+}
+
+func (d *Device) SubscribeEvent(t EventType, id uint32, flags uint32) error {
+	sub := EventSubscription{Type: uint32(t), Id: id, Flags: flags}
+	return d.Ioctl(Vidioc_SubscribeEvent, unsafe.Pointer(&sub))
+}
+
+func (d *Device) UnsubscribeEvent(t EventType, id uint32) error {
+	sub := EventSubscription{Type: uint32(t), Id: id}
+	return d.Ioctl(Vidioc_UnsubscribeEvent, unsafe.Pointer(&sub))
+}
+
+// DequeueEvent returns syscall.ENOENT when no event is pending.
+func (d *Device) DequeueEvent() (Event, error) {
+	event := Event{}
+	err := d.Ioctl(Vidioc_DQEvent, unsafe.Pointer(&event))
+	return event, err
+}
+
+func (d *Device) DecoderCommand(cmd DecCmd, flags uint32) error {
+	command := DecoderCmd{Cmd: uint32(cmd), Flags: flags}
+	return d.Ioctl(Vidioc_DecoderCmd, unsafe.Pointer(&command))
+}
+
+func (d *Device) EncoderCommand(cmd EncCmd, flags uint32) error {
+	command := EncoderCmd{Cmd: cmd, Flags: flags}
+	return d.Ioctl(Vidioc_EncoderCmd, unsafe.Pointer(&command))
+}
+
+func (d *Device) GetParm(t BufType) (StreamParm, error) {
+	parm := StreamParm{Type: t}
+	err := d.Ioctl(Vidioc_GParm, unsafe.Pointer(&parm))
+	return parm, err
+}
+
+func (d *Device) SetParm(parm *StreamParm) error {
+	return d.Ioctl(Vidioc_SParm, unsafe.Pointer(parm))
+}
+
+func (d *Device) GetJpegCompression() (JpegCompression, error) {
+	var jpeg JpegCompression
+	err := d.Ioctl(Vidioc_GJpegComp, unsafe.Pointer(&jpeg))
+	return jpeg, err
+}
+
+func (d *Device) SetJpegCompression(jpeg *JpegCompression) error {
+	return d.Ioctl(Vidioc_SJpegComp, unsafe.Pointer(jpeg))
+}
+
+// poll.h
+const (
+	PollIn  = 0x0001
+	PollPri = 0x0002
+	PollOut = 0x0004
+	PollErr = 0x0008
+)
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// Poll waits until one of the events is signalled on the device and returns
+// the signalled events, or 0 when the timeout expires. A negative timeout
+// waits forever.
+func (d *Device) Poll(events int16, timeout time.Duration) (int16, error) {
+	return poll(d.fd, events, timeout)
+}
+
+// PollFd is Poll for any file descriptor, such as a media request.
+func PollFd(fd uintptr, events int16, timeout time.Duration) (int16, error) {
+	pfd := pollFd{fd: int32(fd), events: events}
+	var ts *syscall.Timespec
+	if timeout >= 0 {
+		t := syscall.NsecToTimespec(int64(timeout))
+		ts = &t
+	}
+	for {
+		n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL,
+			uintptr(unsafe.Pointer(&pfd)), 1, uintptr(unsafe.Pointer(ts)), 0, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, errno
+		}
+		if n == 0 {
+			return 0, nil
+		}
+		return pfd.revents, nil
+	}
+}
+
+// ioctl and poll are variables so tests can stand in for a driver.
+var (
+	ioctl = sysIoctl
+	poll  = PollFd
+)
+
+func sysIoctl(fd, request uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
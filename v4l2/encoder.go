@@ -0,0 +1,326 @@
+package v4l2
+
+import (
+	"io"
+	"syscall"
+	"time"
+)
+
+// EncoderConfig describes the raw frames fed to an Encoder and the stream
+// it produces.
+type EncoderConfig struct {
+	RawFormat   PixFmt
+	Width       uint32
+	Height      uint32
+	CodedFormat PixFmt
+	BufferSize  uint32 // size of CAPTURE buffers, 0 for the driver default
+	FrameRate   Fract  // frames per second, optional
+
+	OutputBuffers  uint32 // 0 for 4
+	CaptureBuffers uint32 // 0 for 4
+
+	// Controls set before streaming, 0 keeps the driver default.
+	Bitrate     int32
+	BitrateMode MpegVideoBitrateMode
+	GopSize     int32
+}
+
+// EncodedPacket is a chunk of the bitstream copied out of a CAPTURE buffer.
+type EncodedPacket struct {
+	Data      []byte
+	Timestamp time.Duration // copied from the OUTPUT buffer
+	Sequence  uint32
+	Flags     BufFlag
+}
+
+func (p *EncodedPacket) Keyframe() bool {
+	return p.Flags&BufFlag_Keyframe != 0
+}
+
+// Encoder drives a stateful memory-to-memory video encoder, following the
+// kernel's "Memory-to-Memory Stateful Video Encoder Interface".
+type Encoder struct {
+	dev     *Device
+	output  *Queue
+	capture *Queue
+	rawFmt  Format
+
+	free  []*QueueBuffer // OUTPUT buffers owned by us
+	ready []*EncodedPacket
+	drain bool
+	eos   bool
+}
+
+func NewEncoder(dev *Device, config EncoderConfig) (*Encoder, error) {
+	mplane, err := m2mMultiplanar(dev)
+	if err != nil {
+		return nil, err
+	}
+	if config.OutputBuffers == 0 {
+		config.OutputBuffers = 4
+	}
+	if config.CaptureBuffers == 0 {
+		config.CaptureBuffers = 4
+	}
+	outType, capType := BufType_VideoOutput, BufType_VideoCapture
+	if mplane {
+		outType, capType = BufType_VideoOutputMplane, BufType_VideoCaptureMplane
+	}
+	if err := dev.SetNonblock(true); err != nil {
+		return nil, err
+	}
+
+	// The coded format is set first, it determines the raw formats the
+	// encoder accepts.
+	coded := Format{Type: capType}
+	raw := Format{Type: outType}
+	if mplane {
+		pix := coded.PixMp()
+		pix.PixelFormat = uint32(config.CodedFormat)
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.NumPlanes = 1
+		pix.PlaneFmt[0].SizeImage = config.BufferSize
+		pix = raw.PixMp()
+		pix.PixelFormat = uint32(config.RawFormat)
+		pix.Width = config.Width
+		pix.Height = config.Height
+	} else {
+		pix := coded.Pix()
+		pix.PixelFormat = config.CodedFormat
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.SizeImage = config.BufferSize
+		pix = raw.Pix()
+		pix.PixelFormat = config.RawFormat
+		pix.Width = config.Width
+		pix.Height = config.Height
+	}
+	if err := dev.SetFormat(&coded); err != nil {
+		return nil, err
+	}
+	if err := dev.SetFormat(&raw); err != nil {
+		return nil, err
+	}
+
+	if config.FrameRate.Numerator != 0 {
+		parm := StreamParm{Type: outType}
+		parm.Output().TimePerFrame = Fract{
+			Numerator:   config.FrameRate.Denominator,
+			Denominator: config.FrameRate.Numerator,
+		}
+		if err := dev.SetParm(&parm); err != nil {
+			return nil, err
+		}
+	}
+	if config.BitrateMode != 0 {
+		if err := dev.SetControl(Cid_MpegVideoBitrateMode, int32(config.BitrateMode)); err != nil {
+			return nil, err
+		}
+	}
+	if config.Bitrate != 0 {
+		if err := dev.SetControl(Cid_MpegVideoBitrate, config.Bitrate); err != nil {
+			return nil, err
+		}
+	}
+	if config.GopSize != 0 {
+		if err := setGopSize(dev, config.GopSize); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &Encoder{dev: dev, rawFmt: raw}
+	if e.output, err = dev.RequestQueue(outType, Memory_Mmap, config.OutputBuffers); err != nil {
+		return nil, err
+	}
+	if e.capture, err = dev.RequestQueue(capType, Memory_Mmap, config.CaptureBuffers); err != nil {
+		e.output.Release()
+		return nil, err
+	}
+	e.free = append(e.free, e.output.Buffers...)
+	if err := e.start(); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Encoder) start() error {
+	for _, b := range e.capture.Buffers {
+		if err := e.capture.Enqueue(b); err != nil {
+			return err
+		}
+	}
+	if err := e.capture.StreamOn(); err != nil {
+		return err
+	}
+	return e.output.StreamOn()
+}
+
+// Format returns the raw format negotiated with the driver. Frames passed to
+// Encode must match its plane layout.
+func (e *Encoder) Format() Format {
+	return e.rawFmt
+}
+
+// Encode queues a raw frame, waiting for a free OUTPUT buffer if necessary.
+// The frame holds one slice per plane; on single-planar queues the planes
+// are stored back to back. Encoding resumes after a drain.
+func (e *Encoder) Encode(frame [][]byte, timestamp time.Duration) error {
+	if e.drain {
+		if err := e.dev.EncoderCommand(EncCmd_Start, 0); err != nil {
+			return err
+		}
+		e.drain = false
+		e.eos = false
+		for _, b := range e.capture.Buffers {
+			if b.Queued {
+				continue
+			}
+			if err := e.capture.Enqueue(b); err != nil {
+				return err
+			}
+		}
+	}
+	for len(e.free) == 0 {
+		if err := e.process(-1); err != nil {
+			return err
+		}
+	}
+	b := e.free[0]
+	if err := b.copyFrame(frame); err != nil {
+		return err
+	}
+	e.free = e.free[1:]
+	b.Flags = BufFlag_TimestampCopy
+	b.Timestamp = NewTimeval(timestamp)
+	return e.output.Enqueue(b)
+}
+
+// ReadPacket returns the next chunk of the bitstream. It returns nil when
+// no packet becomes ready within timeout, and io.EOF once a drain has
+// completed.
+func (e *Encoder) ReadPacket(timeout time.Duration) (*EncodedPacket, error) {
+	deadline := time.Now().Add(timeout)
+	for len(e.ready) == 0 {
+		if e.eos {
+			return nil, io.EOF
+		}
+		wait := time.Until(deadline)
+		if timeout < 0 {
+			wait = -1
+		} else if wait < 0 {
+			wait = 0
+		}
+		if err := e.process(wait); err != nil {
+			return nil, err
+		}
+		if timeout >= 0 && len(e.ready) == 0 && !time.Now().Before(deadline) {
+			return nil, nil
+		}
+	}
+	packet := e.ready[0]
+	e.ready = e.ready[1:]
+	return packet, nil
+}
+
+// Drain asks the encoder to encode all queued frames. ReadPacket returns
+// the remaining packets followed by io.EOF.
+func (e *Encoder) Drain() error {
+	if err := e.dev.EncoderCommand(EncCmd_Stop, 0); err != nil {
+		return err
+	}
+	e.drain = true
+	return nil
+}
+
+// SetBitrate changes the target bitrate in bits per second while encoding.
+func (e *Encoder) SetBitrate(bitrate int32) error {
+	return e.dev.SetControl(Cid_MpegVideoBitrate, bitrate)
+}
+
+func (e *Encoder) SetGopSize(size int32) error {
+	return setGopSize(e.dev, size)
+}
+
+// ForceKeyFrame makes the next frame queued a keyframe.
+func (e *Encoder) ForceKeyFrame() error {
+	return e.dev.SetControl(Cid_MpegVideoForceKeyFrame, 1)
+}
+
+func (e *Encoder) Close() error {
+	e.capture.Release()
+	return e.output.Release()
+}
+
+// setGopSize sets the keyframe interval. H.264 encoders use their own
+// I-period control and may not implement the generic one.
+func setGopSize(dev *Device, size int32) error {
+	err := dev.SetControl(Cid_MpegVideoGopSize, size)
+	if errH264 := dev.SetControl(Cid_MpegVideoH264IPeriod, size); errH264 == nil {
+		return nil
+	}
+	return err
+}
+
+func (e *Encoder) process(timeout time.Duration) error {
+	revents, err := e.dev.Poll(PollIn|PollOut, timeout)
+	if err != nil {
+		return err
+	}
+	if revents&(PollIn|PollOut) == 0 && revents&PollErr != 0 {
+		return ErrNeedInput
+	}
+	if err := e.dequeueOutput(); err != nil {
+		return err
+	}
+	return e.dequeueCapture()
+}
+
+func (e *Encoder) dequeueOutput() error {
+	for {
+		b, err := e.output.Dequeue()
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e.free = append(e.free, b)
+	}
+}
+
+func (e *Encoder) dequeueCapture() error {
+	for !e.eos {
+		b, err := e.capture.Dequeue()
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err == syscall.EPIPE {
+			e.eos = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b.Flags&BufFlag_Error == 0 && payloadSize(b) > 0 {
+			packet := &EncodedPacket{
+				Timestamp: b.Timestamp.Duration(),
+				Sequence:  b.Sequence,
+				Flags:     b.Flags,
+			}
+			for _, data := range b.Data() {
+				packet.Data = append(packet.Data, data...)
+			}
+			e.ready = append(e.ready, packet)
+		}
+		if b.Flags&BufFlag_Last != 0 {
+			e.eos = true
+			return nil
+		}
+		if err := e.capture.Enqueue(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
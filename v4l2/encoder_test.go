@@ -0,0 +1,235 @@
+package v4l2
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// fakeEncoder is a stateful encoder driver. A frame starting with 'I', 'P'
+// or 'B' is encoded as a keyframe, P-frame or B-frame holding the frame
+// itself. It advances by one step every time it is polled.
+type fakeEncoder struct {
+	*fakeM2M
+	draining bool
+	epipe    bool // end a drain with EPIPE instead of a LAST buffer
+
+	commands    []EncCmd
+	controls    []uint32
+	unsupported map[uint32]bool // controls failing with EINVAL
+}
+
+func newFakeEncoder(t *testing.T) (*fakeEncoder, *Encoder) {
+	var fake *fakeEncoder
+	dev := newFakeDevice(t, func(m *fakeM2M) fakeDriver {
+		fake = &fakeEncoder{fakeM2M: m, unsupported: make(map[uint32]bool)}
+		return fake
+	})
+	e, err := NewEncoder(dev, EncoderConfig{
+		RawFormat:   PixFmt_Grey,
+		Width:       8,
+		Height:      2,
+		CodedFormat: PixFmt_H264,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return fake, e
+}
+
+func (f *fakeEncoder) ioctl(request uintptr, arg unsafe.Pointer) error {
+	switch request {
+	case Vidioc_SFmt:
+		format := (*Format)(arg)
+		pix := format.Pix()
+		if format.Type == BufType_VideoOutput {
+			pix.BytesPerLine = pix.Width
+			pix.SizeImage = pix.Width * pix.Height
+		} else {
+			pix.SizeImage = fakeBufferSize
+		}
+		f.formats[format.Type] = *format
+	case Vidioc_SCtrl:
+		id := (*Control)(arg).Id
+		f.controls = append(f.controls, id)
+		if f.unsupported[id] {
+			return syscall.EINVAL
+		}
+	case Vidioc_EncoderCmd:
+		cmd := (*EncoderCmd)(arg).Cmd
+		f.commands = append(f.commands, cmd)
+		switch cmd {
+		case EncCmd_Stop:
+			f.draining = true
+		case EncCmd_Start:
+			f.draining, f.stalled = false, false
+		}
+	default:
+		return f.fakeM2M.ioctl(request, arg)
+	}
+	return nil
+}
+
+func (f *fakeEncoder) poll(events int16) int16 {
+	f.step()
+	return f.revents(events)
+}
+
+func (f *fakeEncoder) step() {
+	if f.stalled || !f.streaming[BufType_VideoOutput] {
+		return
+	}
+	if len(f.queued[BufType_VideoOutput]) == 0 {
+		if !f.draining {
+			return
+		}
+		if f.epipe {
+			f.stalled = true
+		} else if f.canCapture() {
+			b := f.takeCapture()
+			b.Flags, b.BytesUsed = BufFlag_Last, 0
+			f.stalled = true
+		}
+		return
+	}
+	if !f.canCapture() {
+		return
+	}
+	out, data := f.takeOutput()
+	b := f.takeCapture()
+	f.fill(b, out, data)
+	switch data[0] {
+	case 'I':
+		b.Flags = BufFlag_Keyframe
+	case 'P':
+		b.Flags = BufFlag_Pframe
+	case 'B':
+		b.Flags = BufFlag_Bframe
+	}
+}
+
+// frame returns a raw 8x2 frame starting with the frame type.
+func frame(kind byte, n int) [][]byte {
+	data := bytes.Repeat([]byte{byte(n)}, 16)
+	data[0] = kind
+	return [][]byte{data}
+}
+
+func encode(t *testing.T, e *Encoder, kind byte, n int) {
+	t.Helper()
+	if err := e.Encode(frame(kind, n), frameTime(n)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readPacket(t *testing.T, e *Encoder, kind byte, n int, flag BufFlag) {
+	t.Helper()
+	packet, err := e.ReadPacket(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet == nil {
+		t.Fatalf("no packet, want frame %d", n)
+	}
+	if !bytes.Equal(packet.Data, frame(kind, n)[0]) || packet.Timestamp != frameTime(n) {
+		t.Errorf("packet %x at %v, want frame %d at %v", packet.Data, packet.Timestamp, n, frameTime(n))
+	}
+	if packet.Flags&(BufFlag_Keyframe|BufFlag_Pframe|BufFlag_Bframe) != flag {
+		t.Errorf("frame %d flags %#x, want %#x", n, packet.Flags, flag)
+	}
+	if packet.Keyframe() != (flag == BufFlag_Keyframe) {
+		t.Errorf("frame %d: Keyframe() %v", n, packet.Keyframe())
+	}
+}
+
+func readPacketEOF(t *testing.T, e *Encoder) {
+	t.Helper()
+	packet, err := e.ReadPacket(time.Second)
+	if err != io.EOF {
+		t.Fatalf("got %v, %v, want io.EOF", packet, err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	fake, e := newFakeEncoder(t)
+	format := e.Format()
+	if pix := format.Pix(); pix.BytesPerLine != 8 || pix.SizeImage != 16 {
+		t.Errorf("raw format %+v", pix)
+	}
+
+	encode(t, e, 'I', 1)
+	encode(t, e, 'P', 2)
+	encode(t, e, 'B', 3)
+	readPacket(t, e, 'I', 1, BufFlag_Keyframe)
+	readPacket(t, e, 'P', 2, BufFlag_Pframe)
+	readPacket(t, e, 'B', 3, BufFlag_Bframe)
+	if packet, err := e.ReadPacket(0); packet != nil || err != ErrNeedInput {
+		t.Errorf("got %v, %v without input, want ErrNeedInput", packet, err)
+	}
+
+	// The drain ends with an empty LAST buffer, which is held back.
+	encode(t, e, 'P', 4)
+	if err := e.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	readPacket(t, e, 'P', 4, BufFlag_Pframe)
+	readPacketEOF(t, e)
+	readPacketEOF(t, e)
+	if n := len(fake.queued[BufType_VideoCapture]); n != 3 {
+		t.Errorf("%d CAPTURE buffers queued after the drain, want 3", n)
+	}
+
+	// Encoding resumes with the LAST buffer queued again.
+	encode(t, e, 'I', 5)
+	if len(fake.commands) != 2 || fake.commands[0] != EncCmd_Stop || fake.commands[1] != EncCmd_Start {
+		t.Errorf("encoder commands %v, want stop and start", fake.commands)
+	}
+	if n := len(fake.queued[BufType_VideoCapture]); n != 4 {
+		t.Errorf("%d CAPTURE buffers queued after the restart, want 4", n)
+	}
+	readPacket(t, e, 'I', 5, BufFlag_Keyframe)
+}
+
+func TestEncoderDrainEpipe(t *testing.T) {
+	fake, e := newFakeEncoder(t)
+	fake.epipe = true
+
+	encode(t, e, 'I', 1)
+	if err := e.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	readPacket(t, e, 'I', 1, BufFlag_Keyframe)
+	readPacketEOF(t, e)
+
+	encode(t, e, 'P', 2)
+	readPacket(t, e, 'P', 2, BufFlag_Pframe)
+}
+
+func TestEncoderSetGopSize(t *testing.T) {
+	tests := []struct {
+		unsupported []uint32
+		err         error
+	}{
+		{nil, nil},
+		{[]uint32{Cid_MpegVideoGopSize}, nil},
+		{[]uint32{Cid_MpegVideoH264IPeriod}, nil},
+		{[]uint32{Cid_MpegVideoGopSize, Cid_MpegVideoH264IPeriod}, syscall.EINVAL},
+	}
+	for _, test := range tests {
+		fake, e := newFakeEncoder(t)
+		for _, id := range test.unsupported {
+			fake.unsupported[id] = true
+		}
+		fake.controls = nil
+		if err := e.SetGopSize(30); err != test.err {
+			t.Errorf("unsupported %v: got %v, want %v", test.unsupported, err, test.err)
+		}
+		if len(fake.controls) != 2 || fake.controls[0] != Cid_MpegVideoGopSize || fake.controls[1] != Cid_MpegVideoH264IPeriod {
+			t.Errorf("unsupported %v: controls set %v", test.unsupported, fake.controls)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package v4l2
+
+// The i386 ABI aligns 64-bit integers to 4 bytes, so the union of struct
+// v4l2_event follows its type without padding.
+const (
+	eventUnionPadding = 0
+	eventTailPadding  = 0
+)
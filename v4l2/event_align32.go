@@ -0,0 +1,11 @@
+//go:build arm || mips || mipsle
+// +build arm mips mipsle
+
+package v4l2
+
+// These ABIs align 64-bit integers to 8 bytes, Go aligns them to 4 bytes
+// on 32-bit platforms.
+const (
+	eventUnionPadding = 4
+	eventTailPadding  = 4
+)
@@ -0,0 +1,11 @@
+//go:build !386 && !arm && !mips && !mipsle
+// +build !386,!arm,!mips,!mipsle
+
+package v4l2
+
+// The padding at the end of struct v4l2_event follows from its 64-bit
+// timespec.
+const (
+	eventUnionPadding = 4
+	eventTailPadding  = 0
+)
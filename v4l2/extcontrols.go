@@ -0,0 +1,96 @@
+package v4l2
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// ControlValue is a control set through the extended control ioctls.
+// Compound controls point to their payload, all others use Value.
+type ControlValue struct {
+	Id    uint32
+	Value int64
+	Ptr   unsafe.Pointer
+	Size  uint32
+}
+
+func (c *ExtControl) Int32() int32 {
+	return *(*int32)(unsafe.Pointer(&c.Value))
+}
+
+func (c *ExtControl) SetInt32(v int32) {
+	*(*int32)(unsafe.Pointer(&c.Value)) = v
+}
+
+func (c *ExtControl) Int64() int64 {
+	return *(*int64)(unsafe.Pointer(&c.Value))
+}
+
+func (c *ExtControl) SetInt64(v int64) {
+	*(*int64)(unsafe.Pointer(&c.Value)) = v
+}
+
+// SetControls sets the controls atomically. With a requestFd of -1 they are
+// applied immediately, otherwise they are stored in the media request and
+// applied when it is queued.
+func (d *Device) SetControls(requestFd int32, values ...ControlValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	controls := make([]ExtControl, len(values))
+	for i, v := range values {
+		c := &controls[i]
+		c.Id = v.Id
+		if v.Ptr != nil {
+			c.Size = v.Size
+			*(*uintptr)(unsafe.Pointer(&c.Value)) = uintptr(v.Ptr)
+		} else {
+			c.SetInt64(v.Value)
+		}
+	}
+	ext := ExtControls{
+		CtrlClassOrWhich: CtrlWhichCurVal,
+		Count:            uint32(len(controls)),
+		Controls:         uintptr(unsafe.Pointer(&controls[0])),
+	}
+	if requestFd >= 0 {
+		ext.CtrlClassOrWhich = CtrlWhichRequestVal
+		ext.RequestFd = requestFd
+	}
+	err := d.Ioctl(Vidioc_SExtCtrls, unsafe.Pointer(&ext))
+	runtime.KeepAlive(controls)
+	runtime.KeepAlive(values)
+	return err
+}
+
+func (c *CtrlH264Sps) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264Sps, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlH264Pps) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264Pps, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlH264ScalingMatrix) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264ScalingMatrix, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlH264PredWeights) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264PredWeights, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlH264SliceParams) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264SliceParams, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlH264DecodeParams) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessH264DecodeParams, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlVp8Frame) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessVp8Frame, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
+
+func (c *CtrlVp9Frame) Control() ControlValue {
+	return ControlValue{Id: Cid_StatelessVp9Frame, Ptr: unsafe.Pointer(c), Size: uint32(unsafe.Sizeof(*c))}
+}
@@ -0,0 +1,53 @@
+package v4l2
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+// The offsets and sizes of struct v4l2_buffer and struct v4l2_event, as
+// laid out by the kernel for 64-bit platforms, i386, and 32-bit platforms
+// aligning 64-bit integers to 8 bytes.
+func TestLayout(t *testing.T) {
+	type layout struct {
+		name   string
+		got    uintptr
+		want64 uintptr
+		want32 uintptr
+		wantA8 uintptr // arm and mips
+	}
+	var b Buffer
+	var e Event
+	var p Plane
+	tests := []layout{
+		{"sizeof(v4l2_buffer)", unsafe.Sizeof(b), 88, 68, 68},
+		{"v4l2_buffer.timestamp", unsafe.Offsetof(b.Timestamp), 24, 20, 20},
+		{"v4l2_buffer.timecode", unsafe.Offsetof(b.Timecode), 40, 28, 28},
+		{"v4l2_buffer.sequence", unsafe.Offsetof(b.Sequence), 56, 44, 44},
+		{"v4l2_buffer.m", unsafe.Offsetof(b.OffsetOrUserptrOrPlanesOrFd), 64, 52, 52},
+		{"v4l2_buffer.length", unsafe.Offsetof(b.Length), 72, 56, 56},
+		{"v4l2_buffer.request_fd", unsafe.Offsetof(b.RequestFdOrReserved), 80, 64, 64},
+		{"sizeof(v4l2_plane)", unsafe.Sizeof(p), 64, 60, 60},
+		{"v4l2_plane.data_offset", unsafe.Offsetof(p.DataOffset), 16, 12, 12},
+		{"sizeof(v4l2_event)", unsafe.Sizeof(e), 136, 120, 128},
+		{"v4l2_event.u", unsafe.Offsetof(e.U), 8, 4, 8},
+		{"v4l2_event.pending", unsafe.Offsetof(e.Pending), 72, 68, 72},
+		{"v4l2_event.timestamp", unsafe.Offsetof(e.Timestamp), 80, 76, 80},
+		{"v4l2_event.id", unsafe.Offsetof(e.Id), 96, 84, 88},
+		{"v4l2_event.reserved", unsafe.Offsetof(e.Reserved), 100, 88, 92},
+	}
+	for _, test := range tests {
+		want := test.want64
+		switch {
+		case unsafe.Sizeof(uintptr(0)) == 8:
+		case runtime.GOARCH == "386":
+			want = test.want32
+		default:
+			want = test.wantA8
+		}
+		if test.got != want {
+			t.Errorf("%s on %s: %d, want %d", test.name, runtime.GOARCH, test.got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package v4l2
+
+import "strings"
+
+// media-bus-format.h
+
+type MbusFmt uint32
+
+const (
+	MbusFmt_Fixed                MbusFmt = 0x0001
+	MbusFmt_Rgb444_1x12          MbusFmt = 0x1016
+	MbusFmt_Rgb444_2x8_Padhi_Be  MbusFmt = 0x1001
+	MbusFmt_Rgb444_2x8_Padhi_Le  MbusFmt = 0x1002
+	MbusFmt_Rgb555_2x8_Padhi_Be  MbusFmt = 0x1003
+	MbusFmt_Rgb555_2x8_Padhi_Le  MbusFmt = 0x1004
+	MbusFmt_Rgb565_1x16          MbusFmt = 0x1017
+	MbusFmt_Bgr565_2x8_Be        MbusFmt = 0x1005
+	MbusFmt_Bgr565_2x8_Le        MbusFmt = 0x1006
+	MbusFmt_Rgb565_2x8_Be        MbusFmt = 0x1007
+	MbusFmt_Rgb565_2x8_Le        MbusFmt = 0x1008
+	MbusFmt_Rgb666_1x18          MbusFmt = 0x1009
+	MbusFmt_Rgb666_2x9_Be        MbusFmt = 0x1025
+	MbusFmt_Bgr666_1x18          MbusFmt = 0x1023
+	MbusFmt_Rbg888_1x24          MbusFmt = 0x100e
+	MbusFmt_Rgb666_1x24_Cpadhi   MbusFmt = 0x1015
+	MbusFmt_Bgr666_1x24_Cpadhi   MbusFmt = 0x1024
+	MbusFmt_Rgb565_1x24_Cpadhi   MbusFmt = 0x1022
+	MbusFmt_Rgb666_1x7x3_Spwg    MbusFmt = 0x1010
+	MbusFmt_Bgr888_1x24          MbusFmt = 0x1013
+	MbusFmt_Bgr888_3x8           MbusFmt = 0x101b
+	MbusFmt_Gbr888_1x24          MbusFmt = 0x1014
+	MbusFmt_Rgb888_1x24          MbusFmt = 0x100a
+	MbusFmt_Rgb888_2x12_Be       MbusFmt = 0x100b
+	MbusFmt_Rgb888_2x12_Le       MbusFmt = 0x100c
+	MbusFmt_Rgb888_3x8           MbusFmt = 0x101c
+	MbusFmt_Rgb888_3x8_Delta     MbusFmt = 0x101d
+	MbusFmt_Rgb888_1x7x4_Spwg    MbusFmt = 0x1011
+	MbusFmt_Rgb888_1x7x4_Jeida   MbusFmt = 0x1012
+	MbusFmt_Rgb666_1x30_Cpadlo   MbusFmt = 0x101e
+	MbusFmt_Rgb888_1x30_Cpadlo   MbusFmt = 0x101f
+	MbusFmt_Argb8888_1x32        MbusFmt = 0x100d
+	MbusFmt_Rgb888_1x32_Padhi    MbusFmt = 0x100f
+	MbusFmt_Rgb101010_1x30       MbusFmt = 0x1018
+	MbusFmt_Rgb666_1x36_Cpadlo   MbusFmt = 0x1020
+	MbusFmt_Rgb888_1x36_Cpadlo   MbusFmt = 0x1021
+	MbusFmt_Rgb121212_1x36       MbusFmt = 0x1019
+	MbusFmt_Rgb161616_1x48       MbusFmt = 0x101a
+	MbusFmt_Y8_1x8               MbusFmt = 0x2001
+	MbusFmt_Uv8_1x8              MbusFmt = 0x2015
+	MbusFmt_Uyvy8_1_5x8          MbusFmt = 0x2002
+	MbusFmt_Vyuy8_1_5x8          MbusFmt = 0x2003
+	MbusFmt_Yuyv8_1_5x8          MbusFmt = 0x2004
+	MbusFmt_Yvyu8_1_5x8          MbusFmt = 0x2005
+	MbusFmt_Uyvy8_2x8            MbusFmt = 0x2006
+	MbusFmt_Vyuy8_2x8            MbusFmt = 0x2007
+	MbusFmt_Yuyv8_2x8            MbusFmt = 0x2008
+	MbusFmt_Yvyu8_2x8            MbusFmt = 0x2009
+	MbusFmt_Y10_1x10             MbusFmt = 0x200a
+	MbusFmt_Y10_2x8_Padhi_Le     MbusFmt = 0x202c
+	MbusFmt_Uyvy10_2x10          MbusFmt = 0x2018
+	MbusFmt_Vyuy10_2x10          MbusFmt = 0x2019
+	MbusFmt_Yuyv10_2x10          MbusFmt = 0x200b
+	MbusFmt_Yvyu10_2x10          MbusFmt = 0x200c
+	MbusFmt_Y12_1x12             MbusFmt = 0x2013
+	MbusFmt_Uyvy12_2x12          MbusFmt = 0x201c
+	MbusFmt_Vyuy12_2x12          MbusFmt = 0x201d
+	MbusFmt_Yuyv12_2x12          MbusFmt = 0x201e
+	MbusFmt_Yvyu12_2x12          MbusFmt = 0x201f
+	MbusFmt_Y14_1x14             MbusFmt = 0x202d
+	MbusFmt_Uyvy8_1x16           MbusFmt = 0x200f
+	MbusFmt_Vyuy8_1x16           MbusFmt = 0x2010
+	MbusFmt_Yuyv8_1x16           MbusFmt = 0x2011
+	MbusFmt_Yvyu8_1x16           MbusFmt = 0x2012
+	MbusFmt_Ydyuydyv8_1x16       MbusFmt = 0x2014
+	MbusFmt_Uyvy10_1x20          MbusFmt = 0x201a
+	MbusFmt_Vyuy10_1x20          MbusFmt = 0x201b
+	MbusFmt_Yuyv10_1x20          MbusFmt = 0x200d
+	MbusFmt_Yvyu10_1x20          MbusFmt = 0x200e
+	MbusFmt_Vuy8_1x24            MbusFmt = 0x2024
+	MbusFmt_Yuv8_1x24            MbusFmt = 0x2025
+	MbusFmt_Uyyvyy8_0_5x24       MbusFmt = 0x2026
+	MbusFmt_Uyvy12_1x24          MbusFmt = 0x2020
+	MbusFmt_Vyuy12_1x24          MbusFmt = 0x2021
+	MbusFmt_Yuyv12_1x24          MbusFmt = 0x2022
+	MbusFmt_Yvyu12_1x24          MbusFmt = 0x2023
+	MbusFmt_Yuv10_1x30           MbusFmt = 0x2016
+	MbusFmt_Uyyvyy10_0_5x30      MbusFmt = 0x2027
+	MbusFmt_Ayuv8_1x32           MbusFmt = 0x2017
+	MbusFmt_Uyyvyy12_0_5x36      MbusFmt = 0x2028
+	MbusFmt_Yuv12_1x36           MbusFmt = 0x2029
+	MbusFmt_Yuv16_1x48           MbusFmt = 0x202a
+	MbusFmt_Uyyvyy16_0_5x48      MbusFmt = 0x202b
+	MbusFmt_Sbggr8_1x8           MbusFmt = 0x3001
+	MbusFmt_Sgbrg8_1x8           MbusFmt = 0x3013
+	MbusFmt_Sgrbg8_1x8           MbusFmt = 0x3002
+	MbusFmt_Srggb8_1x8           MbusFmt = 0x3014
+	MbusFmt_Sbggr10_Alaw8_1x8    MbusFmt = 0x3015
+	MbusFmt_Sgbrg10_Alaw8_1x8    MbusFmt = 0x3016
+	MbusFmt_Sgrbg10_Alaw8_1x8    MbusFmt = 0x3017
+	MbusFmt_Srggb10_Alaw8_1x8    MbusFmt = 0x3018
+	MbusFmt_Sbggr10_Dpcm8_1x8    MbusFmt = 0x300b
+	MbusFmt_Sgbrg10_Dpcm8_1x8    MbusFmt = 0x300c
+	MbusFmt_Sgrbg10_Dpcm8_1x8    MbusFmt = 0x3009
+	MbusFmt_Srggb10_Dpcm8_1x8    MbusFmt = 0x300d
+	MbusFmt_Sbggr10_2x8_Padhi_Be MbusFmt = 0x3003
+	MbusFmt_Sbggr10_2x8_Padhi_Le MbusFmt = 0x3004
+	MbusFmt_Sbggr10_2x8_Padlo_Be MbusFmt = 0x3005
+	MbusFmt_Sbggr10_2x8_Padlo_Le MbusFmt = 0x3006
+	MbusFmt_Sbggr10_1x10         MbusFmt = 0x3007
+	MbusFmt_Sgbrg10_1x10         MbusFmt = 0x300e
+	MbusFmt_Sgrbg10_1x10         MbusFmt = 0x300a
+	MbusFmt_Srggb10_1x10         MbusFmt = 0x300f
+	MbusFmt_Sbggr12_1x12         MbusFmt = 0x3008
+	MbusFmt_Sgbrg12_1x12         MbusFmt = 0x3010
+	MbusFmt_Sgrbg12_1x12         MbusFmt = 0x3011
+	MbusFmt_Srggb12_1x12         MbusFmt = 0x3012
+	MbusFmt_Sbggr14_1x14         MbusFmt = 0x3019
+	MbusFmt_Sgbrg14_1x14         MbusFmt = 0x301a
+	MbusFmt_Sgrbg14_1x14         MbusFmt = 0x301b
+	MbusFmt_Srggb14_1x14         MbusFmt = 0x301c
+	MbusFmt_Sbggr16_1x16         MbusFmt = 0x301d
+	MbusFmt_Sgbrg16_1x16         MbusFmt = 0x301e
+	MbusFmt_Sgrbg16_1x16         MbusFmt = 0x301f
+	MbusFmt_Srggb16_1x16         MbusFmt = 0x3020
+	MbusFmt_Jpeg_1x8             MbusFmt = 0x4001
+	MbusFmt_S5c_Uyvy_Jpeg_1x8    MbusFmt = 0x5001
+	MbusFmt_Ahsv8888_1x32        MbusFmt = 0x6001
+	MbusFmt_Metadata_Fixed       MbusFmt = 0x7001
+)
+
+var mbusFmtNames = map[MbusFmt]string{
+	MbusFmt_Fixed:                "FIXED",
+	MbusFmt_Rgb444_1x12:          "RGB444_1X12",
+	MbusFmt_Rgb444_2x8_Padhi_Be:  "RGB444_2X8_PADHI_BE",
+	MbusFmt_Rgb444_2x8_Padhi_Le:  "RGB444_2X8_PADHI_LE",
+	MbusFmt_Rgb555_2x8_Padhi_Be:  "RGB555_2X8_PADHI_BE",
+	MbusFmt_Rgb555_2x8_Padhi_Le:  "RGB555_2X8_PADHI_LE",
+	MbusFmt_Rgb565_1x16:          "RGB565_1X16",
+	MbusFmt_Bgr565_2x8_Be:        "BGR565_2X8_BE",
+	MbusFmt_Bgr565_2x8_Le:        "BGR565_2X8_LE",
+	MbusFmt_Rgb565_2x8_Be:        "RGB565_2X8_BE",
+	MbusFmt_Rgb565_2x8_Le:        "RGB565_2X8_LE",
+	MbusFmt_Rgb666_1x18:          "RGB666_1X18",
+	MbusFmt_Rgb666_2x9_Be:        "RGB666_2X9_BE",
+	MbusFmt_Bgr666_1x18:          "BGR666_1X18",
+	MbusFmt_Rbg888_1x24:          "RBG888_1X24",
+	MbusFmt_Rgb666_1x24_Cpadhi:   "RGB666_1X24_CPADHI",
+	MbusFmt_Bgr666_1x24_Cpadhi:   "BGR666_1X24_CPADHI",
+	MbusFmt_Rgb565_1x24_Cpadhi:   "RGB565_1X24_CPADHI",
+	MbusFmt_Rgb666_1x7x3_Spwg:    "RGB666_1X7X3_SPWG",
+	MbusFmt_Bgr888_1x24:          "BGR888_1X24",
+	MbusFmt_Bgr888_3x8:           "BGR888_3X8",
+	MbusFmt_Gbr888_1x24:          "GBR888_1X24",
+	MbusFmt_Rgb888_1x24:          "RGB888_1X24",
+	MbusFmt_Rgb888_2x12_Be:       "RGB888_2X12_BE",
+	MbusFmt_Rgb888_2x12_Le:       "RGB888_2X12_LE",
+	MbusFmt_Rgb888_3x8:           "RGB888_3X8",
+	MbusFmt_Rgb888_3x8_Delta:     "RGB888_3X8_DELTA",
+	MbusFmt_Rgb888_1x7x4_Spwg:    "RGB888_1X7X4_SPWG",
+	MbusFmt_Rgb888_1x7x4_Jeida:   "RGB888_1X7X4_JEIDA",
+	MbusFmt_Rgb666_1x30_Cpadlo:   "RGB666_1X30_CPADLO",
+	MbusFmt_Rgb888_1x30_Cpadlo:   "RGB888_1X30_CPADLO",
+	MbusFmt_Argb8888_1x32:        "ARGB8888_1X32",
+	MbusFmt_Rgb888_1x32_Padhi:    "RGB888_1X32_PADHI",
+	MbusFmt_Rgb101010_1x30:       "RGB101010_1X30",
+	MbusFmt_Rgb666_1x36_Cpadlo:   "RGB666_1X36_CPADLO",
+	MbusFmt_Rgb888_1x36_Cpadlo:   "RGB888_1X36_CPADLO",
+	MbusFmt_Rgb121212_1x36:       "RGB121212_1X36",
+	MbusFmt_Rgb161616_1x48:       "RGB161616_1X48",
+	MbusFmt_Y8_1x8:               "Y8_1X8",
+	MbusFmt_Uv8_1x8:              "UV8_1X8",
+	MbusFmt_Uyvy8_1_5x8:          "UYVY8_1_5X8",
+	MbusFmt_Vyuy8_1_5x8:          "VYUY8_1_5X8",
+	MbusFmt_Yuyv8_1_5x8:          "YUYV8_1_5X8",
+	MbusFmt_Yvyu8_1_5x8:          "YVYU8_1_5X8",
+	MbusFmt_Uyvy8_2x8:            "UYVY8_2X8",
+	MbusFmt_Vyuy8_2x8:            "VYUY8_2X8",
+	MbusFmt_Yuyv8_2x8:            "YUYV8_2X8",
+	MbusFmt_Yvyu8_2x8:            "YVYU8_2X8",
+	MbusFmt_Y10_1x10:             "Y10_1X10",
+	MbusFmt_Y10_2x8_Padhi_Le:     "Y10_2X8_PADHI_LE",
+	MbusFmt_Uyvy10_2x10:          "UYVY10_2X10",
+	MbusFmt_Vyuy10_2x10:          "VYUY10_2X10",
+	MbusFmt_Yuyv10_2x10:          "YUYV10_2X10",
+	MbusFmt_Yvyu10_2x10:          "YVYU10_2X10",
+	MbusFmt_Y12_1x12:             "Y12_1X12",
+	MbusFmt_Uyvy12_2x12:          "UYVY12_2X12",
+	MbusFmt_Vyuy12_2x12:          "VYUY12_2X12",
+	MbusFmt_Yuyv12_2x12:          "YUYV12_2X12",
+	MbusFmt_Yvyu12_2x12:          "YVYU12_2X12",
+	MbusFmt_Y14_1x14:             "Y14_1X14",
+	MbusFmt_Uyvy8_1x16:           "UYVY8_1X16",
+	MbusFmt_Vyuy8_1x16:           "VYUY8_1X16",
+	MbusFmt_Yuyv8_1x16:           "YUYV8_1X16",
+	MbusFmt_Yvyu8_1x16:           "YVYU8_1X16",
+	MbusFmt_Ydyuydyv8_1x16:       "YDYUYDYV8_1X16",
+	MbusFmt_Uyvy10_1x20:          "UYVY10_1X20",
+	MbusFmt_Vyuy10_1x20:          "VYUY10_1X20",
+	MbusFmt_Yuyv10_1x20:          "YUYV10_1X20",
+	MbusFmt_Yvyu10_1x20:          "YVYU10_1X20",
+	MbusFmt_Vuy8_1x24:            "VUY8_1X24",
+	MbusFmt_Yuv8_1x24:            "YUV8_1X24",
+	MbusFmt_Uyyvyy8_0_5x24:       "UYYVYY8_0_5X24",
+	MbusFmt_Uyvy12_1x24:          "UYVY12_1X24",
+	MbusFmt_Vyuy12_1x24:          "VYUY12_1X24",
+	MbusFmt_Yuyv12_1x24:          "YUYV12_1X24",
+	MbusFmt_Yvyu12_1x24:          "YVYU12_1X24",
+	MbusFmt_Yuv10_1x30:           "YUV10_1X30",
+	MbusFmt_Uyyvyy10_0_5x30:      "UYYVYY10_0_5X30",
+	MbusFmt_Ayuv8_1x32:           "AYUV8_1X32",
+	MbusFmt_Uyyvyy12_0_5x36:      "UYYVYY12_0_5X36",
+	MbusFmt_Yuv12_1x36:           "YUV12_1X36",
+	MbusFmt_Yuv16_1x48:           "YUV16_1X48",
+	MbusFmt_Uyyvyy16_0_5x48:      "UYYVYY16_0_5X48",
+	MbusFmt_Sbggr8_1x8:           "SBGGR8_1X8",
+	MbusFmt_Sgbrg8_1x8:           "SGBRG8_1X8",
+	MbusFmt_Sgrbg8_1x8:           "SGRBG8_1X8",
+	MbusFmt_Srggb8_1x8:           "SRGGB8_1X8",
+	MbusFmt_Sbggr10_Alaw8_1x8:    "SBGGR10_ALAW8_1X8",
+	MbusFmt_Sgbrg10_Alaw8_1x8:    "SGBRG10_ALAW8_1X8",
+	MbusFmt_Sgrbg10_Alaw8_1x8:    "SGRBG10_ALAW8_1X8",
+	MbusFmt_Srggb10_Alaw8_1x8:    "SRGGB10_ALAW8_1X8",
+	MbusFmt_Sbggr10_Dpcm8_1x8:    "SBGGR10_DPCM8_1X8",
+	MbusFmt_Sgbrg10_Dpcm8_1x8:    "SGBRG10_DPCM8_1X8",
+	MbusFmt_Sgrbg10_Dpcm8_1x8:    "SGRBG10_DPCM8_1X8",
+	MbusFmt_Srggb10_Dpcm8_1x8:    "SRGGB10_DPCM8_1X8",
+	MbusFmt_Sbggr10_2x8_Padhi_Be: "SBGGR10_2X8_PADHI_BE",
+	MbusFmt_Sbggr10_2x8_Padhi_Le: "SBGGR10_2X8_PADHI_LE",
+	MbusFmt_Sbggr10_2x8_Padlo_Be: "SBGGR10_2X8_PADLO_BE",
+	MbusFmt_Sbggr10_2x8_Padlo_Le: "SBGGR10_2X8_PADLO_LE",
+	MbusFmt_Sbggr10_1x10:         "SBGGR10_1X10",
+	MbusFmt_Sgbrg10_1x10:         "SGBRG10_1X10",
+	MbusFmt_Sgrbg10_1x10:         "SGRBG10_1X10",
+	MbusFmt_Srggb10_1x10:         "SRGGB10_1X10",
+	MbusFmt_Sbggr12_1x12:         "SBGGR12_1X12",
+	MbusFmt_Sgbrg12_1x12:         "SGBRG12_1X12",
+	MbusFmt_Sgrbg12_1x12:         "SGRBG12_1X12",
+	MbusFmt_Srggb12_1x12:         "SRGGB12_1X12",
+	MbusFmt_Sbggr14_1x14:         "SBGGR14_1X14",
+	MbusFmt_Sgbrg14_1x14:         "SGBRG14_1X14",
+	MbusFmt_Sgrbg14_1x14:         "SGRBG14_1X14",
+	MbusFmt_Srggb14_1x14:         "SRGGB14_1X14",
+	MbusFmt_Sbggr16_1x16:         "SBGGR16_1X16",
+	MbusFmt_Sgbrg16_1x16:         "SGBRG16_1X16",
+	MbusFmt_Sgrbg16_1x16:         "SGRBG16_1X16",
+	MbusFmt_Srggb16_1x16:         "SRGGB16_1X16",
+	MbusFmt_Jpeg_1x8:             "JPEG_1X8",
+	MbusFmt_S5c_Uyvy_Jpeg_1x8:    "S5C_UYVY_JPEG_1X8",
+	MbusFmt_Ahsv8888_1x32:        "AHSV8888_1X32",
+	MbusFmt_Metadata_Fixed:       "METADATA_FIXED",
+}
+
+// String returns the name of the code as used by media-ctl, e.g.
+// "SRGGB10_1X10".
+func (c MbusFmt) String() string {
+	if name, ok := mbusFmtNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseMbusFmt looks up a media bus code by its media-ctl name.
+func ParseMbusFmt(name string) (MbusFmt, bool) {
+	name = strings.ToUpper(name)
+	for c, n := range mbusFmtNames {
+		if n == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
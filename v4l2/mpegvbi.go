@@ -0,0 +1,238 @@
+package v4l2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ErrMpegVbiMagic = errors.New("v4l2: not an ivtv VBI packet")
+
+const mpegVbiLineSize = 43 // sizeof(struct v4l2_mpeg_vbi_itv0_line)
+
+// Lines 6-23 of each field can be embedded, field 1 first.
+const (
+	mpegVbiFirstLine  = 6
+	mpegVbiFieldLines = 18
+)
+
+// ParseMpegVbiIvtv parses the payload of an ivtv private stream 1 packet.
+// Payloads of the "itv0" kind only carry the lines set in their line mask,
+// so they may be shorter than the struct.
+func ParseMpegVbiIvtv(payload []byte) (*MpegVbiFmtIvtv, error) {
+	f := &MpegVbiFmtIvtv{}
+	if len(payload) < len(f.Magic) {
+		return nil, ErrMpegVbiMagic
+	}
+	copy(f.Magic[:], payload)
+	if f.Magic != MjpegVbiIvtvMagic0 && f.Magic != MjpegVbiIvtvMagic1 {
+		return nil, ErrMpegVbiMagic
+	}
+	copy(f.Itv0[:], payload[len(f.Magic):])
+	return f, nil
+}
+
+func (f *MpegVbiFmtIvtv) IsItv0() bool {
+	return f.Magic == MjpegVbiIvtvMagic0
+}
+
+func (f *MpegVbiFmtIvtv) IsITV0() bool {
+	return f.Magic == MjpegVbiIvtvMagic1
+}
+
+// AsItv0 interprets the union as the line mask variant ("itv0").
+func (f *MpegVbiFmtIvtv) AsItv0() MpegVbiItv0 {
+	v := MpegVbiItv0{}
+	v.Linemask[0] = binary.LittleEndian.Uint32(f.Itv0[0:])
+	v.Linemask[1] = binary.LittleEndian.Uint32(f.Itv0[4:])
+	for i := range v.Line {
+		v.Line[i] = mpegVbiLine(f.Itv0[8+i*mpegVbiLineSize:])
+	}
+	return v
+}
+
+// AsITV0 interprets the union as the all lines variant ("ITV0").
+func (f *MpegVbiFmtIvtv) AsITV0() MpegVbiITV0 {
+	v := MpegVbiITV0{}
+	for i := range v.Line {
+		v.Line[i] = mpegVbiLine(f.Itv0[i*mpegVbiLineSize:])
+	}
+	return v
+}
+
+func mpegVbiLine(b []byte) MpegVbiItv0Line {
+	line := MpegVbiItv0Line{Id: MpegVbiIvtv(b[0])}
+	copy(line.Data[:], b[1:mpegVbiLineSize])
+	return line
+}
+
+// Sliced returns the embedded lines in the layout of sliced VBI capture,
+// skipping empty lines and unknown services.
+func (f *MpegVbiFmtIvtv) Sliced() []SlicedVbiData {
+	var lines []MpegVbiItv0Line
+	var numbers []int
+	if f.IsITV0() {
+		all := f.AsITV0()
+		for i, line := range all.Line {
+			lines = append(lines, line)
+			numbers = append(numbers, i)
+		}
+	} else {
+		masked := f.AsItv0()
+		mask := uint64(masked.Linemask[0]) | uint64(masked.Linemask[1])<<32
+		n := 0
+		for i := 0; i < 2*mpegVbiFieldLines && n < len(masked.Line); i++ {
+			if mask&(1<<uint(i)) == 0 {
+				continue
+			}
+			lines = append(lines, masked.Line[n])
+			numbers = append(numbers, i)
+			n++
+		}
+	}
+
+	var sliced []SlicedVbiData
+	for i, line := range lines {
+		id := line.Id.Sliced()
+		if id == 0 {
+			continue
+		}
+		data := SlicedVbiData{
+			Id:    uint32(id),
+			Field: uint32(numbers[i] / mpegVbiFieldLines),
+			Line:  uint32(numbers[i]%mpegVbiFieldLines + mpegVbiFirstLine),
+		}
+		copy(data.Data[:], line.Data[:])
+		sliced = append(sliced, data)
+	}
+	return sliced
+}
+
+func (id MpegVbiIvtv) Sliced() Sliced {
+	switch id {
+	case MpegVbiIvtv_TeletextB:
+		return Sliced_TeletextB
+	case MpegVbiIvtv_Caption525:
+		return Sliced_Caption525
+	case MpegVbiIvtv_Wss625:
+		return Sliced_Wss625
+	case MpegVbiIvtv_Vps:
+		return Sliced_Vps
+	default:
+		return 0
+	}
+}
+
+// MpegVbiPacket is the VBI data of one private stream 1 packet.
+type MpegVbiPacket struct {
+	Pts   int64 // 90 kHz, -1 when the packet has no PTS
+	Lines []SlicedVbiData
+}
+
+// MpegVbiReader extracts the VBI data that ivtv and cx18 encoders embed in
+// their MPEG-2 program stream output.
+type MpegVbiReader struct {
+	r *bufio.Reader
+}
+
+func NewMpegVbiReader(r io.Reader) *MpegVbiReader {
+	return &MpegVbiReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next packet carrying VBI data. It returns io.EOF at the
+// end of the stream.
+func (m *MpegVbiReader) Next() (MpegVbiPacket, error) {
+	for {
+		id, err := m.nextStartCode()
+		if err != nil {
+			return MpegVbiPacket{}, err
+		}
+		switch {
+		case id == 0xba:
+			err = m.skipPackHeader()
+		case id >= 0xbb:
+			var payload []byte
+			if payload, err = m.readPacket(); err != nil || id != 0xbd {
+				break
+			}
+			if packet, ok := parseMpegVbiPes(payload); ok {
+				return packet, nil
+			}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return MpegVbiPacket{}, err
+		}
+	}
+}
+
+func (m *MpegVbiReader) nextStartCode() (byte, error) {
+	zeros := 0
+	for {
+		b, err := m.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case b == 0:
+			zeros++
+		case b == 1 && zeros >= 2:
+			return m.r.ReadByte()
+		default:
+			zeros = 0
+		}
+	}
+}
+
+func (m *MpegVbiReader) skipPackHeader() error {
+	b, err := m.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	if b[0]>>6 != 1 {
+		// MPEG-1 pack header
+		_, err = m.r.Discard(8)
+		return err
+	}
+	var hdr [10]byte
+	if _, err := io.ReadFull(m.r, hdr[:]); err != nil {
+		return err
+	}
+	_, err = m.r.Discard(int(hdr[9] & 7))
+	return err
+}
+
+func (m *MpegVbiReader) readPacket() ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(m.r, length[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(length[:]))
+	_, err := io.ReadFull(m.r, payload)
+	return payload, err
+}
+
+func parseMpegVbiPes(pes []byte) (MpegVbiPacket, bool) {
+	packet := MpegVbiPacket{Pts: -1}
+	if len(pes) < 3 || pes[0]>>6 != 2 {
+		return packet, false
+	}
+	hdrLen := 3 + int(pes[2])
+	if len(pes) < hdrLen {
+		return packet, false
+	}
+	if pes[1]&0x80 != 0 && hdrLen >= 8 {
+		p := pes[3:8]
+		packet.Pts = int64(p[0]>>1&7)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 |
+			int64(p[3])<<7 | int64(p[4]>>1)
+	}
+	f, err := ParseMpegVbiIvtv(pes[hdrLen:])
+	if err != nil {
+		return packet, false
+	}
+	packet.Lines = f.Sliced()
+	return packet, true
+}
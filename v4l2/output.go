@@ -0,0 +1,269 @@
+package v4l2
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrNotOutput = errors.New("v4l2: not a video output device")
+	ErrNotMapped = errors.New("v4l2: buffers are not memory mapped")
+)
+
+// OutputConfig describes the frames written to an OutputStream.
+type OutputConfig struct {
+	PixelFormat  PixFmt
+	Width        uint32
+	Height       uint32
+	Field        Field  // 0 for Field_None
+	BytesPerLine uint32 // of the first plane, 0 for the driver default
+	FrameRate    Fract  // frames per second, 0 keeps the device setting
+
+	Memory  Memory // Memory_Mmap or Memory_Dmabuf, 0 for Memory_Mmap
+	Buffers uint32 // 0 for 4
+}
+
+// OutputStream feeds frames to a video output device, such as v4l2loopback
+// or the output of vivid. Frames are paced to the TimePerFrame of the
+// device.
+type OutputStream struct {
+	dev    *Device
+	queue  *Queue
+	format Format
+	field  Field
+
+	free     []*QueueBuffer // buffers owned by us
+	interval time.Duration  // 0 when the device does not say
+	due      time.Time      // when the next frame may be queued
+	bottom   bool           // field of the next frame for Field_Alternate
+	timecode *TimecodeGenerator
+}
+
+// NewOutputStream negotiates the format and frame rate of dev and
+// allocates its buffers. Streaming starts with the first frame.
+func NewOutputStream(dev *Device, config OutputConfig) (*OutputStream, error) {
+	mplane, err := outputMultiplanar(dev)
+	if err != nil {
+		return nil, err
+	}
+	if config.Field == Field_Any {
+		config.Field = Field_None
+	}
+	if config.Memory == 0 {
+		config.Memory = Memory_Mmap
+	}
+	if config.Buffers == 0 {
+		config.Buffers = 4
+	}
+	outType := BufType_VideoOutput
+	if mplane {
+		outType = BufType_VideoOutputMplane
+	}
+	if err := dev.SetNonblock(true); err != nil {
+		return nil, err
+	}
+
+	format := Format{Type: outType}
+	if mplane {
+		pix := format.PixMp()
+		pix.PixelFormat = uint32(config.PixelFormat)
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.Field = uint32(config.Field)
+		pix.PlaneFmt[0].BytesPerLine = config.BytesPerLine
+	} else {
+		pix := format.Pix()
+		pix.PixelFormat = config.PixelFormat
+		pix.Width = config.Width
+		pix.Height = config.Height
+		pix.Field = config.Field
+		pix.BytesPerLine = config.BytesPerLine
+	}
+	if err := dev.SetFormat(&format); err != nil {
+		return nil, err
+	}
+
+	if config.FrameRate.Numerator != 0 {
+		parm := StreamParm{Type: outType}
+		parm.Output().TimePerFrame = Fract{
+			Numerator:   config.FrameRate.Denominator,
+			Denominator: config.FrameRate.Numerator,
+		}
+		if err := dev.SetParm(&parm); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &OutputStream{dev: dev, format: format}
+	if mplane {
+		s.field = Field(format.PixMp().Field)
+	} else {
+		s.field = format.Pix().Field
+	}
+	// Not all output drivers implement G_PARM, they are not paced.
+	if parm, err := dev.GetParm(outType); err == nil {
+		tpf := parm.Output().TimePerFrame
+		if tpf.Numerator != 0 && tpf.Denominator != 0 {
+			s.interval = time.Duration(tpf.Numerator) * time.Second / time.Duration(tpf.Denominator)
+		}
+	}
+	if s.queue, err = dev.RequestQueue(outType, config.Memory, config.Buffers); err != nil {
+		return nil, err
+	}
+	s.free = append(s.free, s.queue.Buffers...)
+	return s, nil
+}
+
+func outputMultiplanar(dev *Device) (bool, error) {
+	capability, err := dev.QueryCap()
+	if err != nil {
+		return false, err
+	}
+	caps := capability.Capabilities
+	if caps&Cap_DeviceCaps != 0 {
+		caps = Cap(capability.DeviceCaps)
+	}
+	switch {
+	case caps&Cap_VideoOutputMplane != 0:
+		return true, nil
+	case caps&Cap_VideoOutput != 0:
+		return false, nil
+	default:
+		return false, ErrNotOutput
+	}
+}
+
+// Format returns the format negotiated with the driver. Frames passed to
+// WriteFrame must match its plane layout.
+func (s *OutputStream) Format() Format {
+	return s.format
+}
+
+// Interval returns the time between frames, or 0 if the device does not
+// report its frame rate and frames are queued as fast as it takes them.
+func (s *OutputStream) Interval() time.Duration {
+	return s.interval
+}
+
+// Queue returns the buffers of the stream, for instance to export them.
+func (s *OutputStream) Queue() *Queue {
+	return s.queue
+}
+
+// SetTimecode stamps the frames written from now on with the timecodes of
+// g, nil to stop.
+func (s *OutputStream) SetTimecode(g *TimecodeGenerator) {
+	s.timecode = g
+}
+
+// WriteFrame copies a frame into a free memory mapped buffer and queues it
+// once it is due. The frame holds one slice per plane; on single-planar
+// queues the planes are stored back to back.
+func (s *OutputStream) WriteFrame(frame [][]byte, timestamp time.Duration) error {
+	if s.queue.Memory != Memory_Mmap {
+		return ErrNotMapped
+	}
+	b, err := s.buffer()
+	if err != nil {
+		return err
+	}
+	if err := b.copyFrame(frame); err != nil {
+		return err
+	}
+	return s.enqueue(b, timestamp)
+}
+
+// WriteDmabuf queues a frame held in DMABUF buffers, one file descriptor
+// and payload size per plane. The driver reads the buffers until they are
+// dequeued, which happens while writing later frames: their contents must
+// not change until len(Queue().Buffers) more frames have been written.
+func (s *OutputStream) WriteDmabuf(fds []int32, sizes []uint32, timestamp time.Duration) error {
+	if s.queue.Memory != Memory_Dmabuf {
+		return ErrNotMapped
+	}
+	b, err := s.buffer()
+	if err != nil {
+		return err
+	}
+	if len(sizes) != len(fds) {
+		return ErrPlaneCount
+	}
+	if err := b.SetDmabuf(fds...); err != nil {
+		return err
+	}
+	b.SetBytesUsed(sizes...)
+	return s.enqueue(b, timestamp)
+}
+
+// buffer returns a free buffer, waiting for the driver to release one if
+// necessary.
+func (s *OutputStream) buffer() (*QueueBuffer, error) {
+	for {
+		if err := s.reclaim(); err != nil {
+			return nil, err
+		}
+		if len(s.free) > 0 {
+			return s.free[0], nil
+		}
+		if _, err := s.dev.Poll(PollOut, -1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *OutputStream) reclaim() error {
+	if !s.queue.Streaming() {
+		return nil
+	}
+	for {
+		b, err := s.queue.Dequeue()
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.free = append(s.free, b)
+	}
+}
+
+// enqueue waits until the frame is due, then hands b to the driver.
+func (s *OutputStream) enqueue(b *QueueBuffer, timestamp time.Duration) error {
+	if s.interval > 0 {
+		now := time.Now()
+		if wait := s.due.Sub(now); wait > 0 {
+			time.Sleep(wait)
+			s.due = s.due.Add(s.interval)
+		} else {
+			// Late or first frame: do not burst to catch up.
+			s.due = now.Add(s.interval)
+		}
+	}
+	b.Flags = BufFlag_TimestampCopy
+	b.Timestamp = NewTimeval(timestamp)
+	b.Field = s.field
+	if s.field == Field_Alternate {
+		b.Field = Field_Top
+		if s.bottom {
+			b.Field = Field_Bottom
+		}
+		s.bottom = !s.bottom
+	}
+	if s.timecode != nil {
+		s.timecode.Stamp(&b.Buffer)
+	}
+	if err := s.queue.Enqueue(b); err != nil {
+		return err
+	}
+	s.free = s.free[1:]
+	if !s.queue.Streaming() {
+		return s.queue.StreamOn()
+	}
+	return nil
+}
+
+// Close stops streaming and frees the buffers.
+func (s *OutputStream) Close() error {
+	return s.queue.Release()
+}
@@ -0,0 +1,288 @@
+package v4l2
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var ErrPlaneCount = errors.New("v4l2: number of planes does not match the buffer")
+
+// Queue is the set of buffers of one buffer type of a device.
+type Queue struct {
+	dev       *Device
+	Type      BufType
+	Memory    Memory
+	Buffers   []*QueueBuffer
+	streaming bool
+	dqPlanes  *[VideoMaxPlanes]Plane // kept on the heap, the kernel writes to it
+}
+
+// QueueBuffer is a buffer of a Queue. Fill in the fields of the embedded
+// Buffer (and Planes for multiplanar queues) before enqueuing it.
+type QueueBuffer struct {
+	Buffer
+	Planes []Plane  // multiplanar queues only
+	Mem    [][]byte // mapped memory of each plane
+	Queued bool
+	planes [VideoMaxPlanes]Plane
+}
+
+// RequestQueue allocates count buffers of type t. Memory mapped buffers are
+// queried and mapped into the process. The number of buffers allocated by
+// the driver may differ from count.
+func (d *Device) RequestQueue(t BufType, memory Memory, count uint32) (*Queue, error) {
+	req := RequestBuffers{
+		Count:  count,
+		Type:   t,
+		Memory: memory,
+	}
+	if err := d.Ioctl(Vidioc_Reqbufs, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dev:      d,
+		Type:     t,
+		Memory:   memory,
+		dqPlanes: new([VideoMaxPlanes]Plane),
+	}
+	for i := uint32(0); i < req.Count; i++ {
+		b := &QueueBuffer{}
+		b.Index = i
+		q.Buffers = append(q.Buffers, b)
+		if err := q.query(b); err != nil {
+			q.Release()
+			return nil, err
+		}
+		if memory != Memory_Mmap {
+			continue
+		}
+		if err := q.mmap(b); err != nil {
+			q.Release()
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (q *Queue) query(b *QueueBuffer) error {
+	buf := q.buffer(b)
+	if q.Type.IsMultiplanar() {
+		buf.Length = VideoMaxPlanes
+	}
+	if err := q.dev.Ioctl(Vidioc_Querybuf, unsafe.Pointer(&buf)); err != nil {
+		return err
+	}
+	b.update(&buf, q.Type.IsMultiplanar())
+	return nil
+}
+
+func (q *Queue) mmap(b *QueueBuffer) error {
+	if !q.Type.IsMultiplanar() {
+		mem, err := syscall.Mmap(int(q.dev.fd), int64(b.Offset()), int(b.Length),
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+		b.Mem = [][]byte{mem}
+		return nil
+	}
+	for i := range b.Planes {
+		p := &b.Planes[i]
+		mem, err := syscall.Mmap(int(q.dev.fd), int64(p.MemOffset()), int(p.Length),
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+		b.Mem = append(b.Mem, mem)
+	}
+	return nil
+}
+
+// buffer returns the struct passed to the kernel for b.
+func (q *Queue) buffer(b *QueueBuffer) Buffer {
+	buf := b.Buffer
+	buf.Type = q.Type
+	buf.Memory = uint32(q.Memory)
+	if q.Type.IsMultiplanar() {
+		buf.Length = uint32(len(b.Planes))
+		buf.SetPlanes(&b.planes[0])
+	}
+	return buf
+}
+
+func (b *QueueBuffer) update(buf *Buffer, multiplanar bool) {
+	b.Buffer = *buf
+	if multiplanar {
+		b.Planes = b.planes[:buf.Length]
+	}
+}
+
+// Enqueue hands the buffer to the driver.
+func (q *Queue) Enqueue(b *QueueBuffer) error {
+	buf := q.buffer(b)
+	if err := q.dev.Ioctl(Vidioc_Qbuf, unsafe.Pointer(&buf)); err != nil {
+		return err
+	}
+	b.Queued = true
+	return nil
+}
+
+// EnqueueRequest hands the buffer to the driver as part of a media request.
+// The buffer is processed once the request is queued.
+func (q *Queue) EnqueueRequest(b *QueueBuffer, requestFd int32) error {
+	buf := q.buffer(b)
+	buf.Flags |= BufFlag_RequestFd
+	buf.SetRequestFd(requestFd)
+	if err := q.dev.Ioctl(Vidioc_Qbuf, unsafe.Pointer(&buf)); err != nil {
+		return err
+	}
+	b.Queued = true
+	return nil
+}
+
+// Dequeue takes the next done buffer from the driver. On a non-blocking
+// device it returns syscall.EAGAIN when no buffer is done, and
+// syscall.EPIPE after the last buffer of a drained stream.
+func (q *Queue) Dequeue() (*QueueBuffer, error) {
+	buf := Buffer{
+		Type:   q.Type,
+		Memory: uint32(q.Memory),
+	}
+	if q.Type.IsMultiplanar() {
+		buf.Length = VideoMaxPlanes
+		buf.SetPlanes(&q.dqPlanes[0])
+	}
+	if err := q.dev.Ioctl(Vidioc_Dqbuf, unsafe.Pointer(&buf)); err != nil {
+		return nil, err
+	}
+	b := q.Buffers[buf.Index]
+	b.planes = *q.dqPlanes
+	b.update(&buf, q.Type.IsMultiplanar())
+	b.Queued = false
+	return b, nil
+}
+
+// Data returns the payload of each plane of a memory mapped buffer.
+func (b *QueueBuffer) Data() [][]byte {
+	if b.Planes == nil {
+		if len(b.Mem) == 0 {
+			return nil
+		}
+		return [][]byte{b.Mem[0][:b.BytesUsed]}
+	}
+	data := make([][]byte, len(b.Mem))
+	for i, mem := range b.Mem {
+		p := &b.Planes[i]
+		data[i] = mem[p.DataOffset:p.BytesUsed]
+	}
+	return data
+}
+
+// SetBytesUsed sets the payload size of the planes of a buffer about to be
+// enqueued.
+func (b *QueueBuffer) SetBytesUsed(sizes ...uint32) {
+	if b.Planes == nil {
+		b.BytesUsed = sizes[0]
+		return
+	}
+	for i, size := range sizes {
+		b.Planes[i].BytesUsed = size
+	}
+}
+
+// SetDmabuf attaches a DMABUF file descriptor to each plane of a buffer of
+// a Memory_Dmabuf queue about to be enqueued. There must be one file
+// descriptor per plane.
+func (b *QueueBuffer) SetDmabuf(fds ...int32) error {
+	if b.Planes == nil {
+		if len(fds) != 1 {
+			return ErrPlaneCount
+		}
+		b.SetFd(fds[0])
+		return nil
+	}
+	if len(fds) != len(b.Planes) {
+		return ErrPlaneCount
+	}
+	for i, fd := range fds {
+		b.Planes[i].SetFd(fd)
+	}
+	return nil
+}
+
+// copyFrame copies a frame into a memory mapped buffer and sets its payload
+// size. The frame holds one slice per plane; on single-planar queues the
+// planes are stored back to back.
+func (b *QueueBuffer) copyFrame(frame [][]byte) error {
+	if b.Planes == nil {
+		size := 0
+		for _, plane := range frame {
+			size += len(plane)
+		}
+		if len(b.Mem) == 0 || size > len(b.Mem[0]) {
+			return ErrBufferTooBig
+		}
+		offset := 0
+		for _, plane := range frame {
+			offset += copy(b.Mem[0][offset:], plane)
+		}
+		b.SetBytesUsed(uint32(size))
+		return nil
+	}
+	if len(frame) > len(b.Mem) {
+		return ErrBufferTooBig
+	}
+	for i, plane := range frame {
+		if len(plane) > len(b.Mem[i]) {
+			return ErrBufferTooBig
+		}
+		copy(b.Mem[i], plane)
+		b.Planes[i].BytesUsed = uint32(len(plane))
+	}
+	return nil
+}
+
+func (q *Queue) StreamOn() error {
+	if err := q.dev.StreamOn(q.Type); err != nil {
+		return err
+	}
+	q.streaming = true
+	return nil
+}
+
+// StreamOff stops streaming. All buffers are returned to the application.
+func (q *Queue) StreamOff() error {
+	if err := q.dev.StreamOff(q.Type); err != nil {
+		return err
+	}
+	q.streaming = false
+	for _, b := range q.Buffers {
+		b.Queued = false
+	}
+	return nil
+}
+
+func (q *Queue) Streaming() bool {
+	return q.streaming
+}
+
+// Release stops streaming, unmaps and frees all buffers.
+func (q *Queue) Release() error {
+	if q.streaming {
+		q.StreamOff()
+	}
+	for _, b := range q.Buffers {
+		for _, mem := range b.Mem {
+			syscall.Munmap(mem)
+		}
+		b.Mem = nil
+	}
+	q.Buffers = nil
+	req := RequestBuffers{
+		Count:  0,
+		Type:   q.Type,
+		Memory: q.Memory,
+	}
+	return q.dev.Ioctl(Vidioc_Reqbufs, unsafe.Pointer(&req))
+}
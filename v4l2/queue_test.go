@@ -0,0 +1,29 @@
+package v4l2
+
+import "testing"
+
+func TestSetDmabuf(t *testing.T) {
+	single := &QueueBuffer{}
+	multi := &QueueBuffer{}
+	multi.Planes = multi.planes[:2]
+	tests := []struct {
+		b   *QueueBuffer
+		fds []int32
+		err error
+	}{
+		{single, nil, ErrPlaneCount},
+		{single, []int32{3}, nil},
+		{single, []int32{3, 4}, ErrPlaneCount},
+		{multi, nil, ErrPlaneCount},
+		{multi, []int32{3}, ErrPlaneCount},
+		{multi, []int32{3, 4}, nil},
+	}
+	for _, test := range tests {
+		if err := test.b.SetDmabuf(test.fds...); err != test.err {
+			t.Errorf("%d planes, fds %v: %v, want %v", len(test.b.Planes), test.fds, err, test.err)
+		}
+	}
+	if single.Fd() != 3 || multi.Planes[0].Fd() != 3 || multi.Planes[1].Fd() != 4 {
+		t.Errorf("fds %d, %d %d", single.Fd(), multi.Planes[0].Fd(), multi.Planes[1].Fd())
+	}
+}
@@ -0,0 +1,99 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+var ErrVbiLine = errors.New("v4l2: no such sliced VBI field line")
+
+// SlicedVbiCapture reads hardware-sliced VBI data from a
+// BufType_SlicedVbiCapture device using read() I/O.
+type SlicedVbiCapture struct {
+	dev    *Device
+	Format SlicedVbiFormat
+	buf    []byte
+}
+
+func (d *Device) SlicedVbiCap(t BufType) (SlicedVbiCap, error) {
+	capability := SlicedVbiCap{Type: t}
+	err := d.Ioctl(Vidioc_GSlicedVbiCap, unsafe.Pointer(&capability))
+	return capability, err
+}
+
+// validVbiLine reports whether field and line index ServiceLines.
+func validVbiLine(field, line int) bool {
+	return field >= 0 && field < 2 && line >= 0 && line < 24
+}
+
+// LineServices returns the services the device can slice on a line,
+// relative to the start of the field, none for lines outside ServiceLines.
+func (c *SlicedVbiCap) LineServices(field, line int) Sliced {
+	if !validVbiLine(field, line) {
+		return 0
+	}
+	return Sliced(c.ServiceLines[field][line])
+}
+
+// SetLine selects the services to slice on a line, relative to the start of
+// the field.
+func (f *SlicedVbiFormat) SetLine(field, line int, services Sliced) error {
+	if !validVbiLine(field, line) {
+		return ErrVbiLine
+	}
+	f.ServiceLines[field][line] = uint16(services)
+	f.ServiceSet = 0
+	for field := range f.ServiceLines {
+		for _, s := range f.ServiceLines[field] {
+			f.ServiceSet |= Sliced(s)
+		}
+	}
+	return nil
+}
+
+func (f *SlicedVbiFormat) LineServices(field, line int) Sliced {
+	if !validVbiLine(field, line) {
+		return 0
+	}
+	return Sliced(f.ServiceLines[field][line])
+}
+
+// NewSlicedVbiCapture configures dev for sliced VBI capture. When format has
+// a ServiceSet but no ServiceLines, the driver picks the lines itself. The
+// format accepted by the driver is stored in the returned capture.
+func NewSlicedVbiCapture(dev *Device, sliced SlicedVbiFormat) (*SlicedVbiCapture, error) {
+	format := Format{Type: BufType_SlicedVbiCapture}
+	*format.SlicedVbi() = sliced
+	if err := dev.SetFormat(&format); err != nil {
+		return nil, err
+	}
+	c := &SlicedVbiCapture{
+		dev:    dev,
+		Format: *format.SlicedVbi(),
+	}
+	size := int(unsafe.Sizeof(SlicedVbiData{}))
+	if int(c.Format.IoSize) < size {
+		return nil, fmt.Errorf("v4l2: sliced VBI io size %d too small", c.Format.IoSize)
+	}
+	c.buf = make([]byte, c.Format.IoSize/uint32(size)*uint32(size))
+	return c, nil
+}
+
+// ReadData blocks until the next frame of sliced data is available. Empty
+// entries (Id 0) are dropped.
+func (c *SlicedVbiCapture) ReadData() ([]SlicedVbiData, error) {
+	n, err := c.dev.Read(c.buf)
+	if err != nil {
+		return nil, err
+	}
+	size := int(unsafe.Sizeof(SlicedVbiData{}))
+	var sliced []SlicedVbiData
+	for i := 0; i+size <= n; i += size {
+		data := *(*SlicedVbiData)(unsafe.Pointer(&c.buf[i]))
+		if data.Id != 0 {
+			sliced = append(sliced, data)
+		}
+	}
+	return sliced, nil
+}
@@ -0,0 +1,346 @@
+package v4l2
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// v4l2-mediabus.h
+
+type MbusFramefmt struct {
+	Width        uint32
+	Height       uint32
+	Code         MbusFmt
+	Field        Field
+	Colorspace   Colorspace
+	YcbcrEnc     uint16 // or HsvEnc
+	Quantization uint16
+	XferFunc     uint16
+	Flags        uint16
+	Reserved     [10]uint16
+}
+
+// v4l2-subdev.h
+
+type SubdevCap uint32
+
+const (
+	SubdevCap_RoSubdev SubdevCap = 0x00000001
+	SubdevCap_Streams  SubdevCap = 0x00000002
+)
+
+type SubdevCapability struct {
+	Version      uint32
+	Capabilities SubdevCap
+	Reserved     [14]uint32
+}
+
+type SubdevFormatWhence uint32
+
+const (
+	SubdevFormat_Try    SubdevFormatWhence = 0
+	SubdevFormat_Active SubdevFormatWhence = 1
+)
+
+type SubdevFormat struct {
+	Which    SubdevFormatWhence
+	Pad      uint32
+	Format   MbusFramefmt
+	Stream   uint32
+	Reserved [7]uint32
+}
+
+type SubdevSelection struct {
+	Which    SubdevFormatWhence
+	Pad      uint32
+	Target   SelTgt
+	Flags    SelFlag
+	R        Rect
+	Stream   uint32
+	Reserved [7]uint32
+}
+
+type SubdevMbusCodeFlag uint32
+
+const (
+	SubdevMbusCode_CscColorspace   SubdevMbusCodeFlag = 0x00000001
+	SubdevMbusCode_CscXferFunc     SubdevMbusCodeFlag = 0x00000002
+	SubdevMbusCode_CscYcbcrEnc     SubdevMbusCodeFlag = 0x00000004
+	SubdevMbusCode_CscHsvEnc       SubdevMbusCodeFlag = SubdevMbusCode_CscYcbcrEnc
+	SubdevMbusCode_CscQuantization SubdevMbusCodeFlag = 0x00000008
+)
+
+type SubdevMbusCodeEnum struct {
+	Pad      uint32
+	Index    uint32
+	Code     MbusFmt
+	Which    SubdevFormatWhence
+	Flags    SubdevMbusCodeFlag
+	Stream   uint32
+	Reserved [6]uint32
+}
+
+type SubdevFrameSizeEnum struct {
+	Index     uint32
+	Pad       uint32
+	Code      MbusFmt
+	MinWidth  uint32
+	MaxWidth  uint32
+	MinHeight uint32
+	MaxHeight uint32
+	Which     SubdevFormatWhence
+	Stream    uint32
+	Reserved  [7]uint32
+}
+
+type SubdevFrameIntervalEnum struct {
+	Index    uint32
+	Pad      uint32
+	Code     MbusFmt
+	Width    uint32
+	Height   uint32
+	Interval Fract
+	Which    SubdevFormatWhence
+	Stream   uint32
+	Reserved [7]uint32
+}
+
+type SubdevFrameInterval struct {
+	Pad      uint32
+	Interval Fract
+	Stream   uint32
+	Which    SubdevFormatWhence
+	Reserved [7]uint32
+}
+
+type SubdevRouteFlag uint32
+
+const (
+	SubdevRouteFl_Active SubdevRouteFlag = 1 << 0
+)
+
+type SubdevRoute struct {
+	SinkPad      uint32
+	SinkStream   uint32
+	SourcePad    uint32
+	SourceStream uint32
+	Flags        SubdevRouteFlag
+	Reserved     [5]uint32
+}
+
+type SubdevRouting struct {
+	Which     SubdevFormatWhence
+	LenRoutes uint32
+	Routes    uint64 // pointer to []SubdevRoute
+	NumRoutes uint32
+	Reserved  [11]uint32
+}
+
+type SubdevClientCap uint64
+
+const (
+	SubdevClientCap_Streams           SubdevClientCap = 1 << 0
+	SubdevClientCap_IntervalUsesWhich SubdevClientCap = 1 << 1
+)
+
+type SubdevClientCapability struct {
+	Capabilities SubdevClientCap
+}
+
+var (
+	Vidioc_SubdevQueryCap          Vidioc = _IOR('V', 0, unsafe.Sizeof(SubdevCapability{}))
+	Vidioc_SubdevEnumMbusCode      Vidioc = _IOWR('V', 2, unsafe.Sizeof(SubdevMbusCodeEnum{}))
+	Vidioc_SubdevGFmt              Vidioc = _IOWR('V', 4, unsafe.Sizeof(SubdevFormat{}))
+	Vidioc_SubdevSFmt              Vidioc = _IOWR('V', 5, unsafe.Sizeof(SubdevFormat{}))
+	Vidioc_SubdevGFrameInterval    Vidioc = _IOWR('V', 21, unsafe.Sizeof(SubdevFrameInterval{}))
+	Vidioc_SubdevSFrameInterval    Vidioc = _IOWR('V', 22, unsafe.Sizeof(SubdevFrameInterval{}))
+	Vidioc_SubdevGRouting          Vidioc = _IOWR('V', 38, unsafe.Sizeof(SubdevRouting{}))
+	Vidioc_SubdevSRouting          Vidioc = _IOWR('V', 39, unsafe.Sizeof(SubdevRouting{}))
+	Vidioc_SubdevGSelection        Vidioc = _IOWR('V', 61, unsafe.Sizeof(SubdevSelection{}))
+	Vidioc_SubdevSSelection        Vidioc = _IOWR('V', 62, unsafe.Sizeof(SubdevSelection{}))
+	Vidioc_SubdevEnumFrameSize     Vidioc = _IOWR('V', 74, unsafe.Sizeof(SubdevFrameSizeEnum{}))
+	Vidioc_SubdevEnumFrameInterval Vidioc = _IOWR('V', 75, unsafe.Sizeof(SubdevFrameIntervalEnum{}))
+	Vidioc_SubdevGClientCap        Vidioc = _IOR('V', 101, unsafe.Sizeof(SubdevClientCapability{}))
+	Vidioc_SubdevSClientCap        Vidioc = _IOWR('V', 102, unsafe.Sizeof(SubdevClientCapability{}))
+)
+
+// Subdev is an open sub-device node (/dev/v4l-subdev*), such as a sensor or
+// a bridge.
+type Subdev struct {
+	file *os.File
+	fd   uintptr
+}
+
+func OpenSubdev(path string) (*Subdev, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Subdev{file: f, fd: f.Fd()}, nil
+}
+
+func (s *Subdev) Close() error {
+	return s.file.Close()
+}
+
+func (s *Subdev) Fd() uintptr {
+	return s.fd
+}
+
+func (s *Subdev) Ioctl(request Vidioc, arg unsafe.Pointer) error {
+	return ioctl(s.fd, request, arg)
+}
+
+func (s *Subdev) GetFormat(pad uint32, which SubdevFormatWhence) (MbusFramefmt, error) {
+	format := SubdevFormat{Which: which, Pad: pad}
+	err := s.Ioctl(Vidioc_SubdevGFmt, unsafe.Pointer(&format))
+	return format.Format, err
+}
+
+// SetFormat sets the format of a pad. The driver adjusts format to what it
+// supports.
+func (s *Subdev) SetFormat(format *SubdevFormat) error {
+	return s.Ioctl(Vidioc_SubdevSFmt, unsafe.Pointer(format))
+}
+
+func (s *Subdev) GetSelection(pad uint32, which SubdevFormatWhence, target SelTgt) (Rect, error) {
+	selection := SubdevSelection{Which: which, Pad: pad, Target: target}
+	err := s.Ioctl(Vidioc_SubdevGSelection, unsafe.Pointer(&selection))
+	return selection.R, err
+}
+
+func (s *Subdev) SetSelection(selection *SubdevSelection) error {
+	return s.Ioctl(Vidioc_SubdevSSelection, unsafe.Pointer(selection))
+}
+
+func (s *Subdev) GetFrameInterval(pad uint32) (Fract, error) {
+	interval := SubdevFrameInterval{Pad: pad, Which: SubdevFormat_Active}
+	err := s.Ioctl(Vidioc_SubdevGFrameInterval, unsafe.Pointer(&interval))
+	return interval.Interval, err
+}
+
+func (s *Subdev) SetFrameInterval(interval *SubdevFrameInterval) error {
+	return s.Ioctl(Vidioc_SubdevSFrameInterval, unsafe.Pointer(interval))
+}
+
+func (s *Subdev) QueryCap() (SubdevCapability, error) {
+	var capability SubdevCapability
+	err := s.Ioctl(Vidioc_SubdevQueryCap, unsafe.Pointer(&capability))
+	return capability, err
+}
+
+func (s *Subdev) GetClientCap() (SubdevClientCap, error) {
+	var capability SubdevClientCapability
+	err := s.Ioctl(Vidioc_SubdevGClientCap, unsafe.Pointer(&capability))
+	return capability.Capabilities, err
+}
+
+// SetClientCap tells the driver which optional parts of the API the caller
+// understands and returns the ones it accepted. Routing requires
+// SubdevClientCap_Streams, and the Which field of SubdevFrameInterval is
+// ignored without SubdevClientCap_IntervalUsesWhich.
+func (s *Subdev) SetClientCap(caps SubdevClientCap) (SubdevClientCap, error) {
+	capability := SubdevClientCapability{Capabilities: caps}
+	err := s.Ioctl(Vidioc_SubdevSClientCap, unsafe.Pointer(&capability))
+	return capability.Capabilities, err
+}
+
+// EnumMbusCodes lists the media bus codes supported on a pad.
+func (s *Subdev) EnumMbusCodes(pad uint32, which SubdevFormatWhence) ([]SubdevMbusCodeEnum, error) {
+	var codes []SubdevMbusCodeEnum
+	for i := uint32(0); ; i++ {
+		code := SubdevMbusCodeEnum{Pad: pad, Index: i, Which: which}
+		err := s.Ioctl(Vidioc_SubdevEnumMbusCode, unsafe.Pointer(&code))
+		if err == syscall.EINVAL {
+			return codes, nil
+		}
+		if err != nil {
+			return codes, err
+		}
+		codes = append(codes, code)
+	}
+}
+
+// EnumFrameSizes lists the frame sizes supported on a pad for a media bus
+// code. Sensors report discrete sizes with equal minimum and maximum.
+func (s *Subdev) EnumFrameSizes(pad uint32, code MbusFmt, which SubdevFormatWhence) ([]SubdevFrameSizeEnum, error) {
+	var sizes []SubdevFrameSizeEnum
+	for i := uint32(0); ; i++ {
+		size := SubdevFrameSizeEnum{Index: i, Pad: pad, Code: code, Which: which}
+		err := s.Ioctl(Vidioc_SubdevEnumFrameSize, unsafe.Pointer(&size))
+		if err == syscall.EINVAL {
+			return sizes, nil
+		}
+		if err != nil {
+			return sizes, err
+		}
+		sizes = append(sizes, size)
+	}
+}
+
+// EnumFrameIntervals lists the frame intervals supported on a pad for a
+// media bus code and frame size.
+func (s *Subdev) EnumFrameIntervals(pad uint32, code MbusFmt, width, height uint32, which SubdevFormatWhence) ([]Fract, error) {
+	var intervals []Fract
+	for i := uint32(0); ; i++ {
+		interval := SubdevFrameIntervalEnum{
+			Index:  i,
+			Pad:    pad,
+			Code:   code,
+			Width:  width,
+			Height: height,
+			Which:  which,
+		}
+		err := s.Ioctl(Vidioc_SubdevEnumFrameInterval, unsafe.Pointer(&interval))
+		if err == syscall.EINVAL {
+			return intervals, nil
+		}
+		if err != nil {
+			return intervals, err
+		}
+		intervals = append(intervals, interval.Interval)
+	}
+}
+
+// GetRouting returns the routing table of a sub-device that supports
+// streams. SetClientCap(SubdevClientCap_Streams) must have been called.
+func (s *Subdev) GetRouting(which SubdevFormatWhence) ([]SubdevRoute, error) {
+	// The table is never empty so that it has an address to pass.
+	routes := make([]SubdevRoute, 8)
+	for {
+		routing := SubdevRouting{
+			Which:     which,
+			LenRoutes: uint32(len(routes)),
+			Routes:    uint64(uintptr(unsafe.Pointer(&routes[0]))),
+		}
+		err := s.Ioctl(Vidioc_SubdevGRouting, unsafe.Pointer(&routing))
+		runtime.KeepAlive(routes)
+		if err == syscall.ENOSPC {
+			// NumRoutes holds the size of the table.
+			routes = make([]SubdevRoute, routing.NumRoutes+1)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return routes[:routing.NumRoutes], nil
+	}
+}
+
+// SetRouting replaces the routing table. Formats on the routed pads are
+// reset by the driver.
+func (s *Subdev) SetRouting(which SubdevFormatWhence, routes []SubdevRoute) error {
+	table := make([]SubdevRoute, len(routes)+1)
+	copy(table, routes)
+	routing := SubdevRouting{
+		Which:     which,
+		LenRoutes: uint32(len(table)),
+		NumRoutes: uint32(len(routes)),
+		Routes:    uint64(uintptr(unsafe.Pointer(&table[0]))),
+	}
+	err := s.Ioctl(Vidioc_SubdevSRouting, unsafe.Pointer(&routing))
+	runtime.KeepAlive(table)
+	return err
+}
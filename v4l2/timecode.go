@@ -0,0 +1,165 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTcType = errors.New("v4l2: unknown timecode type")
+
+// Fps returns the nominal frame rate of a timecode type, or 0 for an
+// unknown type. The 30 and 60 fps types also count 29.97 and 59.94 fps
+// video, with TcFlag_Dropframe.
+func (t TcType) Fps() int {
+	switch t {
+	case TcType_24Fps:
+		return 24
+	case TcType_25Fps:
+		return 25
+	case TcType_30Fps:
+		return 30
+	case TcType_50Fps:
+		return 50
+	case TcType_60Fps:
+		return 60
+	}
+	return 0
+}
+
+// dropFrames returns the number of frame numbers skipped every minute but
+// every tenth one, 0 if tc does not count in drop-frame.
+func (tc Timecode) dropFrames() int {
+	if tc.Flags&TcFlag_Dropframe == 0 || tc.Type.Fps()%30 != 0 {
+		return 0
+	}
+	return tc.Type.Fps() / 15
+}
+
+// String formats the timecode as "hh:mm:ss:ff", or "hh:mm:ss;ff" in
+// drop-frame.
+func (tc Timecode) String() string {
+	sep := ':'
+	if tc.dropFrames() != 0 {
+		sep = ';'
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%c%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+// FrameNumber returns the number of frames since 00:00:00:00.
+func (tc Timecode) FrameNumber() (int, error) {
+	fps := tc.Type.Fps()
+	if fps == 0 {
+		return 0, ErrTcType
+	}
+	minutes := int(tc.Hours)*60 + int(tc.Minutes)
+	n := (minutes*60+int(tc.Seconds))*fps + int(tc.Frames)
+	return n - tc.dropFrames()*(minutes-minutes/10), nil
+}
+
+// NewTimecode returns the timecode of frame n, counted from 00:00:00:00.
+// Timecodes wrap around after 24 hours.
+func NewTimecode(t TcType, flags TcFlag, n int) (Timecode, error) {
+	tc := Timecode{Type: t, Flags: flags}
+	fps := t.Fps()
+	if fps == 0 {
+		return tc, ErrTcType
+	}
+	if drop := tc.dropFrames(); drop != 0 {
+		perMinute := 60*fps - drop
+		perTenMinutes := 10*perMinute + drop
+		n %= 24 * 6 * perTenMinutes
+		if n < 0 {
+			n += 24 * 6 * perTenMinutes
+		}
+		// Add back the frame numbers skipped so far.
+		tens, rest := n/perTenMinutes, n%perTenMinutes
+		n += 9 * drop * tens
+		if rest > drop {
+			n += drop * ((rest - drop) / perMinute)
+		}
+	} else {
+		n %= 24 * 3600 * fps
+		if n < 0 {
+			n += 24 * 3600 * fps
+		}
+	}
+	tc.Frames = uint8(n % fps)
+	n /= fps
+	tc.Seconds = uint8(n % 60)
+	n /= 60
+	tc.Minutes = uint8(n % 60)
+	tc.Hours = uint8(n / 60)
+	return tc, nil
+}
+
+// Add returns the timecode n frames later, keeping the flags and user bits.
+func (tc Timecode) Add(n int) (Timecode, error) {
+	frame, err := tc.FrameNumber()
+	if err != nil {
+		return tc, err
+	}
+	next, err := NewTimecode(tc.Type, tc.Flags, frame+n)
+	next.Userbits = tc.Userbits
+	return next, err
+}
+
+// Increment advances the timecode by one frame.
+func (tc *Timecode) Increment() error {
+	next, err := tc.Add(1)
+	if err != nil {
+		return err
+	}
+	*tc = next
+	return nil
+}
+
+// Compare returns -1, 0 or 1 as tc is before, equal to or after other.
+// Both should be of the same type.
+func (tc Timecode) Compare(other Timecode) int {
+	a := [4]uint8{tc.Hours, tc.Minutes, tc.Seconds, tc.Frames}
+	b := [4]uint8{other.Hours, other.Minutes, other.Seconds, other.Frames}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// TimecodeGenerator stamps consecutive timecodes on buffers about to be
+// enqueued. Both fields of a Field_Alternate frame get the same timecode.
+type TimecodeGenerator struct {
+	next   Timecode
+	fields int
+}
+
+func NewTimecodeGenerator(start Timecode) (*TimecodeGenerator, error) {
+	if start.Type.Fps() == 0 {
+		return nil, ErrTcType
+	}
+	return &TimecodeGenerator{next: start}, nil
+}
+
+// Next returns the timecode of the next buffer.
+func (g *TimecodeGenerator) Next() Timecode {
+	return g.next
+}
+
+// Stamp sets the timecode of b and BufFlag_Timecode. The field of b must
+// already be set.
+func (g *TimecodeGenerator) Stamp(b *Buffer) {
+	b.Timecode = g.next
+	b.Flags |= BufFlag_Timecode
+	if b.Field == Field_Top || b.Field == Field_Bottom {
+		g.fields++
+		if g.fields < 2 {
+			return
+		}
+		g.fields = 0
+	}
+	// The type was checked by NewTimecodeGenerator.
+	g.next.Increment()
+}
@@ -0,0 +1,105 @@
+package v4l2
+
+import "testing"
+
+func TestTimecodeDropFrame(t *testing.T) {
+	tests := []struct {
+		tc   Timecode
+		next string
+	}{
+		{Timecode{Type: TcType_30Fps, Flags: TcFlag_Dropframe, Seconds: 59, Frames: 29}, "00:01:00;02"},
+		{Timecode{Type: TcType_30Fps, Flags: TcFlag_Dropframe, Minutes: 9, Seconds: 59, Frames: 29}, "00:10:00;00"},
+		{Timecode{Type: TcType_30Fps, Flags: TcFlag_Dropframe, Minutes: 1, Frames: 2}, "00:01:00;03"},
+		{Timecode{Type: TcType_60Fps, Flags: TcFlag_Dropframe, Seconds: 59, Frames: 59}, "00:01:00;04"},
+		{Timecode{Type: TcType_30Fps, Flags: TcFlag_Dropframe, Hours: 23, Minutes: 59, Seconds: 59, Frames: 29}, "00:00:00;00"},
+		// Drop-frame only applies to 30 and 60 fps.
+		{Timecode{Type: TcType_25Fps, Flags: TcFlag_Dropframe, Seconds: 59, Frames: 24}, "00:01:00:00"},
+		{Timecode{Type: TcType_30Fps, Seconds: 59, Frames: 29}, "00:01:00:00"},
+	}
+	for _, test := range tests {
+		next, err := test.tc.Add(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.String() != test.next {
+			t.Errorf("%v + 1 = %v, want %s", test.tc, next, test.next)
+		}
+	}
+}
+
+func TestTimecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		t     TcType
+		flags TcFlag
+		day   int // frames in 24 hours
+	}{
+		{TcType_30Fps, TcFlag_Dropframe, 2589408},
+		{TcType_60Fps, TcFlag_Dropframe, 5178816},
+		{TcType_25Fps, 0, 2160000},
+	}
+	for _, test := range tests {
+		var prev Timecode
+		for n := 0; n < test.day; n++ {
+			tc, err := NewTimecode(test.t, test.flags, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := tc.FrameNumber(); got != n {
+				t.Fatalf("%v: frame %d, want %d", tc, got, n)
+			}
+			if n > 0 && tc.Compare(prev) != 1 {
+				t.Fatalf("%v not after %v", tc, prev)
+			}
+			prev = tc
+		}
+		if tc, _ := NewTimecode(test.t, test.flags, test.day); tc.String()[:8] != "00:00:00" {
+			t.Errorf("%d fps: frame %d is %v, want midnight", test.t.Fps(), test.day, tc)
+		}
+		if tc, _ := NewTimecode(test.t, test.flags, -1); tc.Hours != 23 || tc.Minutes != 59 || tc.Seconds != 59 {
+			t.Errorf("%d fps: frame -1 is %v", test.t.Fps(), tc)
+		}
+	}
+	if _, err := NewTimecode(0, 0, 0); err != ErrTcType {
+		t.Errorf("unknown type: %v", err)
+	}
+}
+
+func TestTimecodeString(t *testing.T) {
+	tests := []struct {
+		tc   Timecode
+		want string
+	}{
+		{Timecode{Type: TcType_25Fps, Hours: 1, Minutes: 2, Seconds: 3, Frames: 4}, "01:02:03:04"},
+		{Timecode{Type: TcType_30Fps, Flags: TcFlag_Dropframe, Hours: 10, Minutes: 20, Seconds: 30, Frames: 15}, "10:20:30;15"},
+		{Timecode{Type: TcType_24Fps, Flags: TcFlag_Dropframe, Frames: 23}, "00:00:00:23"},
+	}
+	for _, test := range tests {
+		if s := test.tc.String(); s != test.want {
+			t.Errorf("got %s, want %s", s, test.want)
+		}
+	}
+}
+
+func TestTimecodeGenerator(t *testing.T) {
+	start := Timecode{Type: TcType_25Fps, Seconds: 1, Userbits: [4]uint8{1, 2, 3, 4}}
+	g, err := NewTimecodeGenerator(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both fields of a frame get the same timecode.
+	fields := []Field{Field_Top, Field_Bottom, Field_Top, Field_Bottom, Field_None}
+	want := []string{"00:00:01:00", "00:00:01:00", "00:00:01:01", "00:00:01:01", "00:00:01:02"}
+	for i, field := range fields {
+		b := Buffer{Field: field}
+		g.Stamp(&b)
+		if b.Flags&BufFlag_Timecode == 0 || b.Timecode.String() != want[i] || b.Timecode.Userbits != start.Userbits {
+			t.Errorf("buffer %d: flags %#x, timecode %v, want %s", i, b.Flags, b.Timecode, want[i])
+		}
+	}
+	if next := g.Next(); next.String() != "00:00:01:03" {
+		t.Errorf("next timecode %v", next)
+	}
+	if _, err := NewTimecodeGenerator(Timecode{}); err != ErrTcType {
+		t.Errorf("unknown type: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package v4l2
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// linux/time.h
+const (
+	clockRealtime  = 0
+	clockMonotonic = 1
+	clockBoottime  = 7
+)
+
+func NewTimeval(d time.Duration) Timeval {
+	return Timeval{
+		Sec:  int(d / time.Second),
+		Usec: int(d % time.Second / time.Microsecond),
+	}
+}
+
+func (tv Timeval) Duration() time.Duration {
+	return time.Duration(tv.Sec)*time.Second + time.Duration(tv.Usec)*time.Microsecond
+}
+
+// TimestampNs returns the timestamp in nanoseconds, the unit stateless
+// codec controls use to refer to reference frames.
+func (b *Buffer) TimestampNs() uint64 {
+	return uint64(b.Timestamp.Duration())
+}
+
+// TimestampType returns BufFlag_TimestampMonotonic if the driver stamped the
+// buffer with CLOCK_MONOTONIC, BufFlag_TimestampCopy if the timestamp was
+// copied from an OUTPUT buffer, or BufFlag_TimestampUnknown.
+func (b *Buffer) TimestampType() BufFlag {
+	return b.Flags & BufFlag_TimestampMask
+}
+
+// TimestampSource returns BufFlag_TstampSrcEof if the timestamp was taken
+// when the last pixel of the frame was received, or BufFlag_TstampSrcSoe if
+// it was taken at the start of exposure.
+func (b *Buffer) TimestampSource() BufFlag {
+	return b.Flags & BufFlag_TstampSrcMask
+}
+
+// Time returns the wall clock time of a monotonic timestamp. It returns
+// false for timestamps of other types, whose clock is not known.
+func (b *Buffer) Time() (time.Time, bool) {
+	if b.TimestampType() != BufFlag_TimestampMonotonic {
+		return time.Time{}, false
+	}
+	now, mono := time.Now(), clockNow(clockMonotonic)
+	return now.Add(b.Timestamp.Duration() - mono), true
+}
+
+// SetTime sets the timestamp of a buffer about to be enqueued to t, on the
+// CLOCK_MONOTONIC timeline capture drivers use.
+func (b *Buffer) SetTime(t time.Time) {
+	now, mono := time.Now(), clockNow(clockMonotonic)
+	b.Timestamp = NewTimeval(mono + t.Sub(now))
+}
+
+// clockNow reads a clock the time package does not expose.
+func clockNow(id uintptr) time.Duration {
+	var ts syscall.Timespec
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, id, uintptr(unsafe.Pointer(&ts)), 0)
+	return time.Duration(ts.Nano())
+}
@@ -0,0 +1,113 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrVbiSampleFormat = errors.New("v4l2: raw VBI sample format is not GREY")
+
+// VbiCapture reads raw VBI frames from a BufType_VbiCapture device using
+// read() I/O.
+type VbiCapture struct {
+	dev    *Device
+	Format VbiFormat
+	buf    []byte
+}
+
+// NewVbiCapture configures dev for raw VBI capture. When vbi is nil the
+// format currently set on the device is used.
+func NewVbiCapture(dev *Device, vbi *VbiFormat) (*VbiCapture, error) {
+	format := Format{Type: BufType_VbiCapture}
+	if vbi != nil {
+		*format.Vbi() = *vbi
+		if err := dev.SetFormat(&format); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if format, err = dev.GetFormat(BufType_VbiCapture); err != nil {
+			return nil, err
+		}
+	}
+	c := &VbiCapture{
+		dev:    dev,
+		Format: *format.Vbi(),
+	}
+	if c.Format.SampleFormat != PixFmt_Grey {
+		return nil, ErrVbiSampleFormat
+	}
+	c.buf = make([]byte, c.Format.FrameSize())
+	return c, nil
+}
+
+// ReadFrame blocks until the next VBI frame (both fields) is available.
+func (c *VbiCapture) ReadFrame() (*VbiFrame, error) {
+	n, err := c.dev.Read(c.buf)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(c.buf) {
+		return nil, fmt.Errorf("v4l2: short VBI read: %d of %d bytes: %w", n, len(c.buf), io.ErrUnexpectedEOF)
+	}
+	data := make([]byte, n)
+	copy(data, c.buf)
+	return &VbiFrame{Format: c.Format, Data: data}, nil
+}
+
+func (vf *VbiFormat) Lines() int {
+	return int(vf.Count[0] + vf.Count[1])
+}
+
+func (vf *VbiFormat) FrameSize() int {
+	return vf.Lines() * int(vf.SamplesPerLine)
+}
+
+// VbiFrame holds the raw samples of one VBI frame, as returned by read().
+type VbiFrame struct {
+	Format VbiFormat
+	Data   []byte
+}
+
+func (f *VbiFrame) Lines() int {
+	return f.Format.Lines()
+}
+
+func (f *VbiFrame) Line(i int) []byte {
+	spl := int(f.Format.SamplesPerLine)
+	return f.Data[i*spl : (i+1)*spl]
+}
+
+// LineNumber returns the field (0 or 1) and the ITU-R line number of the
+// i-th line in the frame. The line number is 0 if the driver does not
+// report line numbers.
+func (f *VbiFrame) LineNumber(i int) (field int, line int) {
+	count0 := int(f.Format.Count[0])
+	var n int
+	if f.Format.Flags&Vbi_Interlaced != 0 {
+		// Interlaced frames require equal line counts in both fields.
+		field, n = i%2, i/2
+	} else if i < count0 {
+		field, n = 0, i
+	} else {
+		field, n = 1, i-count0
+	}
+	if f.Format.Start[field] <= 0 {
+		return field, 0
+	}
+	return field, int(f.Format.Start[field]) + n
+}
+
+// FieldLine converts an ITU-R line number of the given field into a line
+// number relative to the start of the field, as used by SlicedVbiData and
+// SlicedVbiFormat.ServiceLines.
+func FieldLine(field int, line int) int {
+	if field == 0 || line <= 0 {
+		return line
+	}
+	if line >= int(Vbi_Itu625F2Start) {
+		return line - int(Vbi_Itu625F2Start) + 1
+	}
+	return line - int(Vbi_Itu525F2Start) + 1
+}
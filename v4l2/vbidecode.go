@@ -0,0 +1,253 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrHamming = errors.New("v4l2: uncorrectable hamming 8/4 error")
+	ErrParity  = errors.New("v4l2: parity error")
+)
+
+// Decode interprets the payload of a sliced VBI record according to its
+// service id. The result is one of TeletextPacket, CaptionPair, Vps or
+// Wss625.
+func (d *SlicedVbiData) Decode() (interface{}, error) {
+	switch Sliced(d.Id) {
+	case Sliced_TeletextB:
+		return d.Teletext()
+	case Sliced_Caption525:
+		return d.Caption()
+	case Sliced_Vps:
+		return d.Vps()
+	case Sliced_Wss625:
+		return d.Wss()
+	default:
+		return nil, fmt.Errorf("v4l2: unknown sliced VBI service 0x%04x", d.Id)
+	}
+}
+
+// Teletext
+
+type TeletextPacket struct {
+	Magazine int // 1-8
+	Packet   int // 0-31
+	Data     [40]byte
+}
+
+type TeletextHeader struct {
+	Page    int    // 0x100-0x8ff
+	Subcode uint16 // S1 in the lowest nibble
+	Control uint16 // bit n is control bit Cn, C4-C14
+	Text    string // the 32 displayable header characters
+}
+
+func (d *SlicedVbiData) Teletext() (TeletextPacket, error) {
+	p := TeletextPacket{}
+	d0, d1 := Hamming84(d.Data[0]), Hamming84(d.Data[1])
+	if d0 < 0 || d1 < 0 {
+		return p, ErrHamming
+	}
+	p.Magazine = d0 & 7
+	if p.Magazine == 0 {
+		p.Magazine = 8
+	}
+	p.Packet = d0>>3 | d1<<1
+	copy(p.Data[:], d.Data[2:42])
+	return p, nil
+}
+
+// Header decodes a page header (packet 0).
+func (p *TeletextPacket) Header() (TeletextHeader, error) {
+	h := TeletextHeader{}
+	if p.Packet != 0 {
+		return h, fmt.Errorf("v4l2: teletext packet %d is not a page header", p.Packet)
+	}
+	var n [8]int
+	for i := range n {
+		if n[i] = Hamming84(p.Data[i]); n[i] < 0 {
+			return h, ErrHamming
+		}
+	}
+	h.Page = p.Magazine<<8 | n[1]<<4 | n[0]
+	h.Subcode = uint16(n[2]) | uint16(n[3]&7)<<4 | uint16(n[4])<<8 | uint16(n[5]&3)<<12
+	h.Control = uint16(n[3]>>3)<<4 | uint16(n[5]>>2)<<5 | uint16(n[6])<<7 | uint16(n[7])<<11
+	h.Text = teletextText(p.Data[8:])
+	return h, nil
+}
+
+// Text returns the characters of a display row (packets 1-25). Characters
+// with parity errors and control codes are replaced by spaces.
+func (p *TeletextPacket) Text() string {
+	return teletextText(p.Data[:])
+}
+
+func teletextText(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if !OddParity(c) || c&0x7f < 0x20 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(c & 0x7f)
+		}
+	}
+	return b.String()
+}
+
+// Closed captions
+
+// CaptionPair is one CEA-608 byte pair, still carrying its parity bits.
+type CaptionPair struct {
+	Field int
+	Data  [2]byte
+}
+
+func (d *SlicedVbiData) Caption() (CaptionPair, error) {
+	c := CaptionPair{Field: int(d.Field), Data: [2]byte{d.Data[0], d.Data[1]}}
+	if !c.Valid() {
+		return c, ErrParity
+	}
+	return c, nil
+}
+
+func (c CaptionPair) Valid() bool {
+	return OddParity(c.Data[0]) && OddParity(c.Data[1])
+}
+
+// Bytes returns the pair with the parity bits stripped.
+func (c CaptionPair) Bytes() (byte, byte) {
+	return c.Data[0] & 0x7f, c.Data[1] & 0x7f
+}
+
+// VPS
+
+type Vps struct {
+	Cni      uint16 // country and network identification
+	Pil      Pil
+	PcsAudio uint8
+	Pty      uint8 // program type
+}
+
+// Pil is a programme identification label.
+type Pil uint32
+
+func (p Pil) Day() int    { return int(p>>15) & 0x1f }
+func (p Pil) Month() int  { return int(p>>11) & 0xf }
+func (p Pil) Hour() int   { return int(p>>6) & 0x1f }
+func (p Pil) Minute() int { return int(p) & 0x3f }
+
+func (d *SlicedVbiData) Vps() (Vps, error) {
+	b := d.Data[:13]
+	return Vps{
+		Cni: uint16(b[10]&3)<<10 | uint16(b[11]&0xc0)<<2 |
+			uint16(b[8]&0xc0) | uint16(b[11]&0x3f),
+		Pil:      Pil(b[8]&0x3f)<<14 | Pil(b[9])<<6 | Pil(b[10]>>2),
+		PcsAudio: b[2] >> 6,
+		Pty:      b[12],
+	}, nil
+}
+
+// WSS
+
+type WssAspect uint8
+
+const (
+	WssAspect_4x3              WssAspect = 8
+	WssAspect_14x9Letterbox    WssAspect = 1
+	WssAspect_14x9LetterboxTop WssAspect = 2
+	WssAspect_16x9Letterbox    WssAspect = 11
+	WssAspect_16x9LetterboxTop WssAspect = 4
+	WssAspect_Over16x9         WssAspect = 13
+	WssAspect_14x9             WssAspect = 14
+	WssAspect_16x9Anamorphic   WssAspect = 7
+)
+
+func (a WssAspect) Ratio() float64 {
+	switch a {
+	case WssAspect_4x3:
+		return 4.0 / 3.0
+	case WssAspect_14x9Letterbox, WssAspect_14x9LetterboxTop, WssAspect_14x9:
+		return 14.0 / 9.0
+	case WssAspect_Over16x9:
+		return 2.0
+	default:
+		return 16.0 / 9.0
+	}
+}
+
+// Letterbox reports whether the picture is letterboxed inside a 4:3 frame.
+func (a WssAspect) Letterbox() bool {
+	switch a {
+	case WssAspect_4x3, WssAspect_14x9, WssAspect_16x9Anamorphic:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wss625 is the wide screen signalling of 625 line systems (EN 300 294).
+type Wss625 struct {
+	Aspect         WssAspect
+	FilmMode       bool
+	ColourPlus     bool
+	Helper         bool
+	TtxSubtitles   bool
+	OpenSubtitles  uint8 // 0 none, 1 inside, 2 outside the active picture
+	SurroundSound  bool
+	Copyright      bool
+	CopyRestricted bool
+}
+
+func (d *SlicedVbiData) Wss() (Wss625, error) {
+	bits := uint16(d.Data[0]) | uint16(d.Data[1]&0x3f)<<8
+	w := Wss625{Aspect: WssAspect(bits & 0xf)}
+	// The aspect ratio group carries an odd parity bit in b3.
+	if !OddParity(byte(w.Aspect)) {
+		return w, ErrParity
+	}
+	w.FilmMode = bits&(1<<4) != 0
+	w.ColourPlus = bits&(1<<5) != 0
+	w.Helper = bits&(1<<6) != 0
+	w.TtxSubtitles = bits&(1<<8) != 0
+	w.OpenSubtitles = uint8(bits>>9) & 3
+	w.SurroundSound = bits&(1<<11) != 0
+	w.Copyright = bits&(1<<12) != 0
+	w.CopyRestricted = bits&(1<<13) != 0
+	return w, nil
+}
+
+// Coding helpers
+
+func OddParity(b byte) bool {
+	b ^= b >> 4
+	b ^= b >> 2
+	b ^= b >> 1
+	return b&1 == 1
+}
+
+var hamming84Codes = [16]byte{
+	0x15, 0x02, 0x49, 0x5e, 0x64, 0x73, 0x38, 0x2f,
+	0xd0, 0xc7, 0x8c, 0x9b, 0xa1, 0xb6, 0xfd, 0xea,
+}
+
+var hamming84Table = func() (table [256]int8) {
+	for b := range table {
+		table[b] = -1
+		for n, code := range hamming84Codes {
+			diff := byte(b) ^ code
+			if diff&(diff-1) == 0 {
+				// Equal or a single bit error.
+				table[b] = int8(n)
+			}
+		}
+	}
+	return table
+}()
+
+// Hamming84 decodes a teletext hamming 8/4 byte, correcting single bit
+// errors. It returns -1 when the byte is not correctable.
+func Hamming84(b byte) int {
+	return int(hamming84Table[b])
+}
@@ -0,0 +1,187 @@
+package v4l2
+
+// VbiSlicer recovers sliced VBI services from raw VBI sample lines in
+// software, for drivers that do not slice VBI in hardware.
+type VbiSlicer struct {
+	format   VbiFormat
+	services []vbiService
+}
+
+type vbiCoding int
+
+const (
+	vbiNrzLsb     vbiCoding = iota // bit is high for all its elements, bytes LSB first
+	vbiBiphaseMsb                  // first half of the bit is high for 1, bytes MSB first
+	vbiBiphaseLsb                  // first half of the bit is high for 1, LSB first
+)
+
+type vbiService struct {
+	id          Sliced
+	lines       [2][2]int // first and last field line for each field
+	elementRate float64   // Hz
+	sync        uint32    // clock run-in and framing code, first element in MSB
+	syncBits    int
+	payloadBits int
+	bitElements int
+	coding      vbiCoding
+}
+
+// Earliest start of VBI data after 0H. Everything before it is ignored so
+// the horizontal sync pulse does not disturb the slicing threshold.
+const vbiDataStart = 6e-6 // seconds
+
+const vbiMinAmplitude = 16
+
+// The caption clock run-in runs at the bit rate, so caption lines are
+// sliced at twice the bit rate to see both of its half cycles.
+var vbiServices = []vbiService{
+	{Sliced_TeletextB, [2][2]int{{6, 22}, {6, 22}}, 6937500, 0xaaaae4, 24, 42 * 8, 1, vbiNrzLsb},
+	{Sliced_Vps, [2][2]int{{16, 16}, {}}, 5000000, 0xaaaa8a99, 32, 13 * 8, 2, vbiBiphaseMsb},
+	{Sliced_Caption525, [2][2]int{{21, 21}, {21, 21}}, 2 * 503496.5, 0x2a83, 14, 16, 2, vbiNrzLsb},
+	{Sliced_Wss625, [2][2]int{{23, 23}, {}}, 5000000, 0xc71e3c1f, 32, 14, 6, vbiBiphaseLsb},
+}
+
+// NewVbiSlicer returns a slicer for lines captured with the given raw VBI
+// format. Only the services set in services are searched for.
+func NewVbiSlicer(format VbiFormat, services Sliced) *VbiSlicer {
+	s := &VbiSlicer{format: format}
+	for _, svc := range vbiServices {
+		if services&svc.id != 0 {
+			s.services = append(s.services, svc)
+		}
+	}
+	return s
+}
+
+func (s *VbiSlicer) Services() Sliced {
+	var services Sliced
+	for _, svc := range s.services {
+		services |= svc.id
+	}
+	return services
+}
+
+// Slice decodes every line of a raw VBI frame and returns the recovered
+// data in the same layout a hardware slicer produces.
+func (s *VbiSlicer) Slice(frame *VbiFrame) []SlicedVbiData {
+	var sliced []SlicedVbiData
+	for i := 0; i < frame.Lines(); i++ {
+		field, line := frame.LineNumber(i)
+		data, ok := s.SliceLine(frame.Line(i), field, FieldLine(field, line))
+		if ok {
+			sliced = append(sliced, data)
+		}
+	}
+	return sliced
+}
+
+// SliceLine decodes a single line of samples. line is relative to the
+// start of the field; when it is 0 every enabled service is tried.
+func (s *VbiSlicer) SliceLine(samples []byte, field int, line int) (SlicedVbiData, bool) {
+	for i := range s.services {
+		svc := &s.services[i]
+		if line != 0 && (line < svc.lines[field][0] || line > svc.lines[field][1]) {
+			continue
+		}
+		payload, ok := svc.slice(samples, &s.format)
+		if !ok {
+			continue
+		}
+		data := SlicedVbiData{
+			Id:    uint32(svc.id),
+			Field: uint32(field),
+			Line:  uint32(line),
+		}
+		copy(data.Data[:], payload)
+		return data, true
+	}
+	return SlicedVbiData{}, false
+}
+
+func (svc *vbiService) slice(samples []byte, format *VbiFormat) ([]byte, bool) {
+	rate := float64(format.SamplingRate)
+	first := int(vbiDataStart*rate) - int(format.Offset)
+	if first < 0 {
+		first = 0
+	}
+	if first >= len(samples) {
+		return nil, false
+	}
+	samples = samples[first:]
+
+	lo, hi := samples[0], samples[0]
+	for _, v := range samples {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	if hi-lo < vbiMinAmplitude {
+		return nil, false
+	}
+	threshold := (float64(lo) + float64(hi)) / 2
+
+	spe := rate / svc.elementRate // samples per element
+	span := float64(svc.syncBits+svc.payloadBits*svc.bitElements) * spe
+	for start := 0.0; start+span <= float64(len(samples)); start += spe / 4 {
+		if svc.matchSync(samples, start, spe, threshold) {
+			return svc.decode(samples, start+float64(svc.syncBits)*spe, spe, threshold), true
+		}
+	}
+	return nil, false
+}
+
+func (svc *vbiService) matchSync(samples []byte, start, spe, threshold float64) bool {
+	for i := 0; i < svc.syncBits; i++ {
+		want := svc.sync&(1<<uint(svc.syncBits-1-i)) != 0
+		if vbiSample(samples, start+(float64(i)+0.5)*spe) > threshold != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (svc *vbiService) decode(samples []byte, start, spe, threshold float64) []byte {
+	payload := make([]byte, (svc.payloadBits+7)/8)
+	element := func(i int) float64 {
+		return vbiSample(samples, start+(float64(i)+0.5)*spe)
+	}
+	half := svc.bitElements / 2
+	for i := 0; i < svc.payloadBits; i++ {
+		var first, second float64
+		for j := 0; j < svc.bitElements; j++ {
+			if j < half {
+				first += element(i*svc.bitElements + j)
+			} else {
+				second += element(i*svc.bitElements + j)
+			}
+		}
+		var bit bool
+		if svc.coding == vbiNrzLsb {
+			bit = (first+second)/float64(svc.bitElements) > threshold
+		} else {
+			bit = first > second
+		}
+		if !bit {
+			continue
+		}
+		if svc.coding == vbiBiphaseMsb {
+			payload[i/8] |= 0x80 >> uint(i%8)
+		} else {
+			payload[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return payload
+}
+
+// vbiSample linearly interpolates the sample value at a fractional position.
+func vbiSample(samples []byte, pos float64) float64 {
+	i := int(pos)
+	if i+1 >= len(samples) {
+		return float64(samples[len(samples)-1])
+	}
+	frac := pos - float64(i)
+	return float64(samples[i])*(1-frac) + float64(samples[i+1])*frac
+}
@@ -0,0 +1,160 @@
+package v4l2
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The format of saa7134 and similar bridges: a whole line at 27 MHz.
+var testVbiFormat = VbiFormat{SamplingRate: 27000000, SamplesPerLine: 1728}
+
+// vbiLine renders a line carrying payload for the service id, starting
+// 10 µs after 0H.
+func vbiLine(t *testing.T, id Sliced, payload []byte) []byte {
+	t.Helper()
+	var svc *vbiService
+	for i := range vbiServices {
+		if vbiServices[i].id == id {
+			svc = &vbiServices[i]
+		}
+	}
+	if svc == nil {
+		t.Fatalf("no service %#x", id)
+	}
+	var elements []bool
+	for i := 0; i < svc.syncBits; i++ {
+		elements = append(elements, svc.sync&(1<<uint(svc.syncBits-1-i)) != 0)
+	}
+	for i := 0; i < svc.payloadBits; i++ {
+		var bit bool
+		if svc.coding == vbiBiphaseMsb {
+			bit = payload[i/8]&(0x80>>uint(i%8)) != 0
+		} else {
+			bit = payload[i/8]&(1<<uint(i%8)) != 0
+		}
+		for j := 0; j < svc.bitElements; j++ {
+			if svc.coding == vbiNrzLsb || j < svc.bitElements/2 {
+				elements = append(elements, bit)
+			} else {
+				elements = append(elements, !bit)
+			}
+		}
+	}
+
+	rate := float64(testVbiFormat.SamplingRate)
+	line := bytes.Repeat([]byte{16}, int(testVbiFormat.SamplesPerLine))
+	for i := range line {
+		e := int((float64(i)/rate - 10e-6) * svc.elementRate)
+		if e >= 0 && e < len(elements) && elements[e] {
+			line[i] = 200
+		}
+	}
+	return line
+}
+
+func withParity(b byte) byte {
+	if !OddParity(b) {
+		b |= 0x80
+	}
+	return b
+}
+
+func TestVbiSlicerCaption(t *testing.T) {
+	s := NewVbiSlicer(testVbiFormat, Sliced_Caption525)
+	if s.Services() != Sliced_Caption525 {
+		t.Errorf("services %#x", s.Services())
+	}
+	line := vbiLine(t, Sliced_Caption525, []byte{withParity(0x14), withParity(0x2c)})
+	for _, field := range []int{0, 1} {
+		data, ok := s.SliceLine(line, field, 21)
+		if !ok {
+			t.Fatalf("field %d: caption not found", field)
+		}
+		if Sliced(data.Id) != Sliced_Caption525 || data.Field != uint32(field) || data.Line != 21 {
+			t.Errorf("field %d: id %#x, field %d, line %d", field, data.Id, data.Field, data.Line)
+		}
+		pair, err := data.Caption()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b1, b2 := pair.Bytes(); b1 != 0x14 || b2 != 0x2c {
+			t.Errorf("field %d: caption bytes %#x %#x", field, b1, b2)
+		}
+	}
+	if _, ok := s.SliceLine(line, 0, 18); ok {
+		t.Error("caption found on line 18")
+	}
+	// Lines without numbers are searched for every service.
+	if _, ok := s.SliceLine(line, 0, 0); !ok {
+		t.Error("caption not found without a line number")
+	}
+	if _, ok := s.SliceLine(bytes.Repeat([]byte{16}, len(line)), 0, 21); ok {
+		t.Error("caption found on a blank line")
+	}
+}
+
+func TestVbiSlicerWss(t *testing.T) {
+	s := NewVbiSlicer(testVbiFormat, Sliced_Wss625)
+	// 16:9 anamorphic, subtitles in the teletext service, copyright.
+	bits := uint16(WssAspect_16x9Anamorphic) | 1<<8 | 1<<12
+	line := vbiLine(t, Sliced_Wss625, []byte{byte(bits), byte(bits >> 8)})
+	data, ok := s.SliceLine(line, 0, 23)
+	if !ok {
+		t.Fatal("WSS not found")
+	}
+	wss, err := data.Wss()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Wss625{Aspect: WssAspect_16x9Anamorphic, TtxSubtitles: true, Copyright: true}
+	if wss != want {
+		t.Errorf("got %+v, want %+v", wss, want)
+	}
+	if _, ok := s.SliceLine(line, 1, 23); ok {
+		t.Error("WSS found in the second field")
+	}
+}
+
+func TestVbiSlicerTeletext(t *testing.T) {
+	s := NewVbiSlicer(testVbiFormat, Sliced_TeletextB|Sliced_Wss625)
+	// Magazine 1, packet 1.
+	payload := []byte{hamming84Codes[1|1<<3], hamming84Codes[0]}
+	for _, c := range []byte("HELLO WORLD") {
+		payload = append(payload, withParity(c))
+	}
+	for len(payload) < 42 {
+		payload = append(payload, withParity(' '))
+	}
+	line := vbiLine(t, Sliced_TeletextB, payload)
+
+	frame := &VbiFrame{
+		Format: testVbiFormat,
+		Data:   append(append(bytes.Repeat([]byte{16}, len(line)), line...), line...),
+	}
+	frame.Format.Start = [2]int32{9, 335}
+	frame.Format.Count = [2]uint32{2, 1}
+	sliced := s.Slice(frame)
+	if len(sliced) != 2 {
+		t.Fatalf("%d lines sliced, want 2", len(sliced))
+	}
+	// Line 335 is line 22 of the second field.
+	lines := []uint32{10, 22}
+	for i, data := range sliced {
+		if Sliced(data.Id) != Sliced_TeletextB || data.Field != uint32(i) || data.Line != lines[i] {
+			t.Errorf("line %d: id %#x, field %d, line %d", i, data.Id, data.Field, data.Line)
+		}
+		if !bytes.Equal(data.Data[:42], payload) {
+			t.Errorf("line %d: data %x, want %x", i, data.Data[:42], payload)
+		}
+		packet, err := data.Teletext()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Magazine != 1 || packet.Packet != 1 {
+			t.Errorf("line %d: magazine %d, packet %d", i, packet.Magazine, packet.Packet)
+		}
+		if text := packet.Text(); text[:11] != "HELLO WORLD" {
+			t.Errorf("line %d: text %q", i, text)
+		}
+	}
+}
@@ -18,6 +18,16 @@ func FourccBe(a, b, c, d uint32) PixFmt {
 	return Fourcc(a, b, c, d) | 1<<31
 }
 
+// String returns the four character code, followed by "-BE" for big endian
+// variants.
+func (f PixFmt) String() string {
+	code := []byte{byte(f), byte(f >> 8), byte(f >> 16), byte(f>>24) &^ 0x80}
+	if f&(1<<31) != 0 {
+		return string(code) + "-BE"
+	}
+	return string(code)
+}
+
 type Field uint32
 
 const (
@@ -466,6 +476,7 @@ var (
 	PixFmt_H264           PixFmt = Fourcc('H', '2', '6', '4')
 	PixFmt_H264_NoSc      PixFmt = Fourcc('A', 'V', 'C', '1')
 	PixFmt_H264_Mvc       PixFmt = Fourcc('M', '2', '6', '4')
+	PixFmt_H264_Slice     PixFmt = Fourcc('S', '2', '6', '4')
 	PixFmt_H263           PixFmt = Fourcc('H', '2', '6', '3')
 	PixFmt_Mpeg1          PixFmt = Fourcc('M', 'P', 'G', '1')
 	PixFmt_Mpeg2          PixFmt = Fourcc('M', 'P', 'G', '2')
@@ -475,7 +486,9 @@ var (
 	PixFmt_Vc1_AnnexG     PixFmt = Fourcc('V', 'C', '1', 'G')
 	PixFmt_Vc1_AnnexL     PixFmt = Fourcc('V', 'C', '1', 'L')
 	PixFmt_Vp8            PixFmt = Fourcc('V', 'P', '8', '0')
+	PixFmt_Vp8_Frame      PixFmt = Fourcc('V', 'P', '8', 'F')
 	PixFmt_Vp9            PixFmt = Fourcc('V', 'P', '9', '0')
+	PixFmt_Vp9_Frame      PixFmt = Fourcc('V', 'P', '9', 'F')
 	PixFmt_Hevc           PixFmt = Fourcc('H', 'E', 'V', 'C')
 	PixFmt_Fwht           PixFmt = Fourcc('F', 'W', 'H', 'T')
 	PixFmt_FwhtStateless  PixFmt = Fourcc('S', 'F', 'W', 'H')
@@ -621,6 +634,13 @@ type FrmIvalEnum struct {
 	Reserved [2]uint32
 }
 
+// Timeval is the struct timeval of buffer timestamps. Its fields are C
+// longs, so it is 8 bytes on 32-bit platforms and 16 bytes on 64-bit ones.
+type Timeval struct {
+	Sec  int
+	Usec int
+}
+
 type Timecode struct {
 	Type     TcType
 	Flags    TcFlag
@@ -653,11 +673,11 @@ const (
 )
 
 type JpegCompression struct {
-	Quality     int
-	AppN        int
-	AppLen      int
+	Quality     int32
+	AppN        int32
+	AppLen      int32
 	AppData     [60]byte
-	ComLen      int
+	ComLen      int32
 	ComData     [60]byte
 	JpegMarkers JpegMarker
 }
@@ -693,7 +713,7 @@ const (
 type Plane struct {
 	BytesUsed              uint32
 	Length                 uint32
-	MemOffsetOrUserptrOrFd [8]byte // uint32 and uintptr and int32 union type
+	MemOffsetOrUserptrOrFd [unsafe.Sizeof(uintptr(0))]byte // uint32 and uintptr and int32 union type
 	//	MemOffsetOrUserptrOrFd union {
 	//		MemOffset uint32
 	//		Userptr uintptr
@@ -703,18 +723,29 @@ type Plane struct {
 	Resertved  [11]uint32
 }
 
+func (p *Plane) MemOffset() uint32 {
+	return *(*uint32)(unsafe.Pointer(&p.MemOffsetOrUserptrOrFd))
+}
+
+func (p *Plane) Fd() int32 {
+	return *(*int32)(unsafe.Pointer(&p.MemOffsetOrUserptrOrFd))
+}
+
+func (p *Plane) SetFd(fd int32) {
+	*(*int32)(unsafe.Pointer(&p.MemOffsetOrUserptrOrFd)) = fd
+}
+
 type Buffer struct {
-	Index     uint32
-	Type      BufType
-	BytesUsed uint32
-	Flags     BufFlag
-	Field     Field
-	Timestamp [16]byte // Timestamp: [sys/time.h] sizeof(struct timeval) == 16
-	// TODO: Write a timeval struct?
+	Index                       uint32
+	Type                        BufType
+	BytesUsed                   uint32
+	Flags                       BufFlag
+	Field                       Field
+	Timestamp                   Timeval
 	Timecode                    Timecode
 	Sequence                    uint32
 	Memory                      uint32
-	OffsetOrUserptrOrPlanesOrFd [8]byte
+	OffsetOrUserptrOrPlanesOrFd [unsafe.Sizeof(uintptr(0))]byte
 	//	OffsetOrUserptrOrPlanesOrFd union {
 	//		Offset uint32
 	//		Userptr uintptr
@@ -730,7 +761,31 @@ type Buffer struct {
 	//	}
 }
 
-// skipped v4l2_timeval_to_ns()
+func (b *Buffer) Offset() uint32 {
+	return *(*uint32)(unsafe.Pointer(&b.OffsetOrUserptrOrPlanesOrFd))
+}
+
+func (b *Buffer) Fd() int32 {
+	return *(*int32)(unsafe.Pointer(&b.OffsetOrUserptrOrPlanesOrFd))
+}
+
+func (b *Buffer) SetFd(fd int32) {
+	*(*int32)(unsafe.Pointer(&b.OffsetOrUserptrOrPlanesOrFd)) = fd
+}
+
+// SetPlanes points a multiplanar buffer at its plane array. The array must
+// not be garbage collected or moved while the kernel uses it.
+func (b *Buffer) SetPlanes(planes *Plane) {
+	*(*uintptr)(unsafe.Pointer(&b.OffsetOrUserptrOrPlanesOrFd)) = uintptr(unsafe.Pointer(planes))
+}
+
+func (b *Buffer) RequestFd() int32 {
+	return *(*int32)(unsafe.Pointer(&b.RequestFdOrReserved))
+}
+
+func (b *Buffer) SetRequestFd(fd int32) {
+	*(*int32)(unsafe.Pointer(&b.RequestFdOrReserved)) = fd
+}
 
 type BufFlag uint32
 
@@ -1212,6 +1267,16 @@ const (
 	CtrlType_U8            CtrlType = 0x0100
 	CtrlType_U16           CtrlType = 0x0101
 	CtrlType_U32           CtrlType = 0x0102
+
+	CtrlType_H264Sps           CtrlType = 0x0200
+	CtrlType_H264Pps           CtrlType = 0x0201
+	CtrlType_H264ScalingMatrix CtrlType = 0x0202
+	CtrlType_H264SliceParams   CtrlType = 0x0203
+	CtrlType_H264DecodeParams  CtrlType = 0x0204
+	CtrlType_H264PredWeights   CtrlType = 0x0205
+	CtrlType_Vp8Frame          CtrlType = 0x0240
+	CtrlType_Vp9CompressedHdr  CtrlType = 0x0260
+	CtrlType_Vp9Frame          CtrlType = 0x0261
 )
 
 type QueryCtrl struct {
@@ -1588,7 +1653,7 @@ type MpegVbiITV0 struct {
 type MpegVbiFmtIvtv struct {
 	Magic [4]uint8
 
-	// TODO: find a smarter way to create union
+	// Use the AsItv0 and AsITV0 methods to access the union.
 	Itv0 [1548]byte
 	//	Itv0 union {
 	//		MpegVbiItv0
@@ -1648,6 +1713,22 @@ type Format struct {
 	//	}
 }
 
+func (f *Format) Pix() *PixFormat {
+	return (*PixFormat)(unsafe.Pointer(&f.Fmt))
+}
+
+func (f *Format) Vbi() *VbiFormat {
+	return (*VbiFormat)(unsafe.Pointer(&f.Fmt))
+}
+
+func (f *Format) SlicedVbi() *SlicedVbiFormat {
+	return (*SlicedVbiFormat)(unsafe.Pointer(&f.Fmt))
+}
+
+func (f *Format) PixMp() *PixFormatMplane {
+	return (*PixFormatMplane)(unsafe.Pointer(&f.Fmt))
+}
+
 type StreamParm struct {
 	Type BufType
 	Parm [200]byte
@@ -1658,6 +1739,14 @@ type StreamParm struct {
 	//	}
 }
 
+func (p *StreamParm) Capture() *CaptureParm {
+	return (*CaptureParm)(unsafe.Pointer(&p.Parm))
+}
+
+func (p *StreamParm) Output() *OutputParm {
+	return (*OutputParm)(unsafe.Pointer(&p.Parm))
+}
+
 // TODO: type EventType ?
 type EventType uint32
 
@@ -1705,7 +1794,7 @@ type EventFrameSync struct {
 const EventSrcChResolution = 1 << 0
 
 type EventSrcChange struct {
-	changes uint32
+	Changes uint32
 }
 
 const EventMdFlHaveFrameSeq = 1 << 0
@@ -1717,8 +1806,9 @@ type EventMotionDet struct {
 }
 
 type Event struct {
-	Type EventType
-	U    [64]byte
+	Type     EventType
+	_padding [eventUnionPadding]uint8 // the union holds 64-bit integers
+	U        [64]byte
 	//	U union {
 	//		EventVsync
 	//		EventCtrl
@@ -1729,9 +1819,13 @@ type Event struct {
 	//	}
 	Pending   uint32
 	Sequence  uint32
-	Timestamp syscall.Timespec // TODO: check if same size as C timespec
+	Timestamp syscall.Timespec
 	Id        uint32
-	Reserved  [8]uint32
+	Reserved  [8 + eventTailPadding/4]uint32 // with the padding at the end
+}
+
+func (e *Event) SrcChange() *EventSrcChange {
+	return (*EventSrcChange)(unsafe.Pointer(&e.U))
 }
 
 // TODO: type this?
@@ -1775,12 +1869,12 @@ var (
 	Vidioc_Querybuf  Vidioc = _IOWR('V', 9, unsafe.Sizeof(Buffer{}))
 	Vidioc_GFbuf     Vidioc = _IOR('V', 10, unsafe.Sizeof(FrameBuffer{}))
 	Vidioc_SFbuf     Vidioc = _IOW('V', 11, unsafe.Sizeof(FrameBuffer{}))
-	Vidioc_Overlay   Vidioc = _IOW('V', 14, unsafe.Sizeof(int(0)))
+	Vidioc_Overlay   Vidioc = _IOW('V', 14, unsafe.Sizeof(int32(0)))
 	Vidioc_Qbuf      Vidioc = _IOWR('V', 15, unsafe.Sizeof(Buffer{}))
 	Vidioc_Expbuf    Vidioc = _IOWR('V', 16, unsafe.Sizeof(ExportBuffer{}))
 	Vidioc_Dqbuf     Vidioc = _IOWR('V', 17, unsafe.Sizeof(Buffer{}))
-	Vidioc_StreamOn  Vidioc = _IOW('V', 18, unsafe.Sizeof(int(0)))
-	Vidioc_StreamOff Vidioc = _IOW('V', 19, unsafe.Sizeof(int(0)))
+	Vidioc_StreamOn  Vidioc = _IOW('V', 18, unsafe.Sizeof(int32(0)))
+	Vidioc_StreamOff Vidioc = _IOW('V', 19, unsafe.Sizeof(int32(0)))
 	Vidioc_GParm     Vidioc = _IOWR('V', 21, unsafe.Sizeof(StreamParm{}))
 	Vidioc_SParm     Vidioc = _IOWR('V', 22, unsafe.Sizeof(StreamParm{}))
 	Vidioc_GStd      Vidioc = _IOR('V', 23, unsafe.Sizeof(StdId(0)))
@@ -1795,13 +1889,13 @@ var (
 	Vidioc_SAudio    Vidioc = _IOW('V', 34, unsafe.Sizeof(Audio{}))
 	Vidioc_Queryctrl Vidioc = _IOWR('V', 36, unsafe.Sizeof(QueryCtrl{}))
 	Vidioc_Querymenu Vidioc = _IOWR('V', 37, unsafe.Sizeof(QueryMenu{}))
-	Vidioc_GInput    Vidioc = _IOR('V', 38, unsafe.Sizeof(int(0)))
-	Vidioc_SInput    Vidioc = _IOWR('V', 39, unsafe.Sizeof(int(0)))
+	Vidioc_GInput    Vidioc = _IOR('V', 38, unsafe.Sizeof(int32(0)))
+	Vidioc_SInput    Vidioc = _IOWR('V', 39, unsafe.Sizeof(int32(0)))
 	// TODO: get struct v4l2_edid from v4l2-common.h
 	//Vidioc_GEdid              Vidioc = _IOWR('V', 40, unsafe.Sizeof(edid{}))
 	//Vidioc_SEdid              Vidioc = _IOWR('V', 41, unsafe.Sizeof(edid{}))
-	Vidioc_GOutput            Vidioc = _IOR('V', 46, unsafe.Sizeof(int(0)))
-	Vidioc_SOutput            Vidioc = _IOWR('V', 47, unsafe.Sizeof(int(0)))
+	Vidioc_GOutput            Vidioc = _IOR('V', 46, unsafe.Sizeof(int32(0)))
+	Vidioc_SOutput            Vidioc = _IOWR('V', 47, unsafe.Sizeof(int32(0)))
 	Vidioc_EnumOutput         Vidioc = _IOWR('V', 48, unsafe.Sizeof(Output{}))
 	Vidioc_GAudOut            Vidioc = _IOR('V', 49, unsafe.Sizeof(AudioOut{}))
 	Vidioc_SAudOut            Vidioc = _IOW('V', 50, unsafe.Sizeof(AudioOut{}))
@@ -1830,6 +1924,15 @@ var (
 	Vidioc_GEncIndex          Vidioc = _IOR('V', 76, unsafe.Sizeof(EncIdx{}))
 	Vidioc_EncoderCmd         Vidioc = _IOWR('V', 77, unsafe.Sizeof(EncoderCmd{}))
 	Vidioc_TryEncoderCmd      Vidioc = _IOWR('V', 78, unsafe.Sizeof(EncoderCmd{}))
+
+	Vidioc_DQEvent          Vidioc = _IOR('V', 89, unsafe.Sizeof(Event{}))
+	Vidioc_SubscribeEvent   Vidioc = _IOW('V', 90, unsafe.Sizeof(EventSubscription{}))
+	Vidioc_UnsubscribeEvent Vidioc = _IOW('V', 91, unsafe.Sizeof(EventSubscription{}))
+	Vidioc_PrepareBuf       Vidioc = _IOWR('V', 93, unsafe.Sizeof(Buffer{}))
+	Vidioc_GSelection       Vidioc = _IOWR('V', 94, unsafe.Sizeof(Selection{}))
+	Vidioc_SSelection       Vidioc = _IOWR('V', 95, unsafe.Sizeof(Selection{}))
+	Vidioc_DecoderCmd       Vidioc = _IOWR('V', 96, unsafe.Sizeof(DecoderCmd{}))
+	Vidioc_TryDecoderCmd    Vidioc = _IOWR('V', 97, unsafe.Sizeof(DecoderCmd{}))
 )
 
 // ioctl.h (but a little more golangy)